@@ -1,67 +1,132 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/joho/godotenv"
 	"github.com/lite-blog/backend/internal/api/router"
 	"github.com/lite-blog/backend/internal/config"
 	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/pkg/logger"
+	"github.com/lite-blog/backend/pkg/worker"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+	gormlogger "gorm.io/gorm/logger"
 )
 
 func main() {
 	// Load .env file (optional, won't error if not exists)
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using environment variables")
-	}
+	envErr := godotenv.Load()
 
 	// Load config
 	cfg := config.Load()
 
-	// Configure GORM logger
-	gormConfig := &gorm.Config{}
+	// Log as configured from here on, including through the log package
+	if err := logger.Setup(cfg.Log.Level, cfg.Log.Format); err != nil {
+		log.Fatalf("Invalid log config: %v", err)
+	}
+	if envErr != nil {
+		slog.Info("No .env file found, using environment variables")
+	}
+
+	// Configure GORM logger. Queries are logged without their values.
+	gormLogLevel := gormlogger.Silent
 	if cfg.Server.Mode == "debug" {
-		gormConfig.Logger = logger.Default.LogMode(logger.Info)
-	} else {
-		gormConfig.Logger = logger.Default.LogMode(logger.Silent)
+		gormLogLevel = gormlogger.Info
+	}
+	gormConfig := &gorm.Config{
+		Logger: gormlogger.NewSlogLogger(slog.Default(), gormlogger.Config{
+			LogLevel:             gormLogLevel,
+			ParameterizedQueries: true,
+		}),
 	}
 
 	// Connect to database
 	db, err := gorm.Open(sqlite.Open(cfg.Database.Path), gormConfig)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("Failed to connect to database", err)
 	}
 
-	log.Println("Database connected successfully")
+	slog.Info("Database connected successfully")
 
 	// Run migrations
 	if err := model.Migrate(db); err != nil {
-		log.Fatalf("Failed to migrate database: %v", err)
+		fatal("Failed to migrate database", err)
 	}
 
 	// Seed initial data
 	if err := model.Seed(db); err != nil {
-		log.Fatalf("Failed to seed database: %v", err)
+		fatal("Failed to seed database", err)
 	}
 
 	// Create admin user from environment variables if provided
 	if err := model.CreateAdminFromEnv(db); err != nil {
-		log.Fatalf("Failed to create admin user: %v", err)
+		fatal("Failed to create admin user", err)
 	}
 
-	// Setup router
-	r := router.Setup(cfg, db)
+	// Setup router; background jobs run in the worker group
+	workers := worker.NewGroup()
+	r := router.Setup(cfg, db, workers)
 
 	// Start server
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
-	log.Printf("Server starting on http://localhost%s", addr)
-	log.Printf("Mode: %s", cfg.Server.Mode)
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      r,
+		ReadTimeout:  cfg.Server.ReadTimeout(),
+		WriteTimeout: cfg.Server.WriteTimeout(),
+		IdleTimeout:  cfg.Server.IdleTimeout(),
+	}
+	slog.Info("Server starting", "url", "http://localhost"+addr, "mode", cfg.Server.Mode)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// Wait for SIGINT/SIGTERM. A second signal kills the process at once.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-serverErr:
+		fatal("Failed to start server", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	slog.Info("Shutting down, waiting for requests and background jobs to finish")
+	shutdownCtx := context.Background()
+	if timeout := cfg.Server.ShutdownTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, timeout)
+		defer cancel()
+	}
+
+	// Requests go first, since they may still start background jobs
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Server did not shut down cleanly", "error", err)
+	}
+	if err := workers.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Background jobs did not finish in time", "error", err)
+	}
 
-	if err := r.Run(addr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	if sqlDB, err := db.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			slog.Error("Failed to close database", "error", err)
+		}
 	}
+	slog.Info("Server stopped")
+}
+
+// fatal logs an error that keeps the server from running and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lite-blog/backend/internal/api/middleware"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/service"
+)
+
+type AccessTokenHandler struct {
+	accessTokenService *service.AccessTokenService
+}
+
+func NewAccessTokenHandler(accessTokenService *service.AccessTokenService) *AccessTokenHandler {
+	return &AccessTokenHandler{
+		accessTokenService: accessTokenService,
+	}
+}
+
+// CreateAccessTokenRequest represents the create access token request body.
+// An expiry of zero days means the token never expires.
+type CreateAccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=365"`
+}
+
+// AccessTokenResponse represents an access token in responses. Token is only
+// set when the token is created.
+type AccessTokenResponse struct {
+	ID         uint     `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	Token      string   `json:"token,omitempty"`
+	ExpiresAt  *string  `json:"expires_at,omitempty"`
+	LastUsedAt *string  `json:"last_used_at,omitempty"`
+	CreatedAt  string   `json:"created_at"`
+}
+
+// buildAccessTokenResponse creates an AccessTokenResponse from an AccessToken model
+func buildAccessTokenResponse(token *model.AccessToken) AccessTokenResponse {
+	resp := AccessTokenResponse{
+		ID:        token.ID,
+		Name:      token.Name,
+		Prefix:    token.Prefix,
+		Scopes:    token.ScopeList(),
+		CreatedAt: token.CreatedAt.Format(time.RFC3339),
+	}
+	if token.ExpiresAt != nil {
+		expiresAt := token.ExpiresAt.Format(time.RFC3339)
+		resp.ExpiresAt = &expiresAt
+	}
+	if token.LastUsedAt != nil {
+		lastUsedAt := token.LastUsedAt.Format(time.RFC3339)
+		resp.LastUsedAt = &lastUsedAt
+	}
+	return resp
+}
+
+// List returns the current user's access tokens and the scopes a token can have
+func (h *AccessTokenHandler) List(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	tokens, err := h.accessTokenService.List(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch access tokens",
+			"code":  "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	resp := make([]AccessTokenResponse, len(tokens))
+	for i := range tokens {
+		resp[i] = buildAccessTokenResponse(&tokens[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": resp,
+		"scopes": model.AccessTokenScopes,
+	})
+}
+
+// Create creates an access token for the current user. The token is only
+// returned in this response.
+func (h *AccessTokenHandler) Create(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	var req CreateAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	token, plaintext, err := h.accessTokenService.Create(user, req.Name, req.Scopes, req.ExpiresInDays)
+	if err != nil {
+		switch err {
+		case service.ErrAccessTokenScopeInvalid:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Unknown scope, or a scope your account can't grant",
+				"code":  "INVALID_SCOPE",
+			})
+		case service.ErrAccessTokenLimit:
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "You have too many access tokens, revoke one first",
+				"code":  "TOKEN_LIMIT_REACHED",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to create access token",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	resp := buildAccessTokenResponse(token)
+	resp.Token = plaintext
+	c.JSON(http.StatusCreated, resp)
+}
+
+// Revoke deletes one of the current user's access tokens
+func (h *AccessTokenHandler) Revoke(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid access token ID",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	if err := h.accessTokenService.Revoke(user.ID, uint(id)); err != nil {
+		switch err {
+		case service.ErrAccessTokenNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Access token not found",
+				"code":  "NOT_FOUND",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to revoke access token",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Access token revoked",
+	})
+}
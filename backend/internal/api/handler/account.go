@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lite-blog/backend/internal/api/middleware"
+	"github.com/lite-blog/backend/internal/service"
+)
+
+type AccountHandler struct {
+	accountService *service.AccountService
+}
+
+func NewAccountHandler(accountService *service.AccountService) *AccountHandler {
+	return &AccountHandler{
+		accountService: accountService,
+	}
+}
+
+// DeleteAccountRequest represents the delete account request body. The
+// account email is typed again to confirm.
+type DeleteAccountRequest struct {
+	ConfirmEmail string `json:"confirm_email" binding:"required"`
+}
+
+// Export downloads the current user's personal data, as JSON or with
+// ?format=zip as a ZIP of one JSON file per section
+func (h *AccountHandler) Export(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Format must be json or zip",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	export, err := h.accountService.Export(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to export account data",
+			"code":  "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("account-%d-%s.%s", user.ID, export.ExportedAt.Format("20060102"), format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Cache-Control", "no-store")
+	if format == "json" {
+		c.IndentedJSON(http.StatusOK, export)
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+	if err := service.WriteExportZip(c.Writer, export); err != nil {
+		// Headers are already sent, so the download just ends early
+		slog.ErrorContext(c.Request.Context(), "Failed to write account export", "user_id", user.ID, "error", err)
+	}
+}
+
+// DeletionStatus returns when the current user's account will be deleted, if scheduled
+func (h *AccountHandler) DeletionStatus(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	resp := gin.H{
+		"scheduled": user.DeletionScheduledAt != nil,
+	}
+	if user.DeletionScheduledAt != nil {
+		resp["delete_at"] = user.DeletionScheduledAt.Format(time.RFC3339)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ScheduleDeletion schedules the current user's account for deletion. It can
+// be cancelled until the grace period is over.
+func (h *AccountHandler) ScheduleDeletion(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	deleteAt, err := h.accountService.ScheduleDeletion(c.Request.Context(), user, req.ConfirmEmail)
+	if err != nil {
+		switch err {
+		case service.ErrDeletionConfirmMismatch:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Type your account email to confirm",
+				"code":  "CONFIRMATION_MISMATCH",
+			})
+		case service.ErrCannotDeleteAdmin:
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Admins must give up the admin role before deleting their account",
+				"code":  "FORBIDDEN",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to schedule account deletion",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":   "Your account will be deleted",
+		"delete_at": deleteAt.Format(time.RFC3339),
+	})
+}
+
+// CancelDeletion keeps the current user's account
+func (h *AccountHandler) CancelDeletion(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	if err := h.accountService.CancelDeletion(c.Request.Context(), user); err != nil {
+		switch err {
+		case service.ErrDeletionNotScheduled:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Account deletion is not scheduled",
+				"code":  "DELETION_NOT_SCHEDULED",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to cancel account deletion",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Account deletion cancelled",
+	})
+}
@@ -91,7 +91,7 @@ func (h *ArticleHandler) GetBySlug(c *gin.Context) {
 	// Get user from context (may be nil for guests)
 	user := middleware.GetUserFromContext(c)
 
-	article, err := h.articleService.GetArticleBySlug(slug, user)
+	article, err := h.articleService.GetArticleBySlug(c.Request.Context(), slug, user)
 	if err != nil {
 		if err == service.ErrArticleNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -113,11 +113,13 @@ func (h *ArticleHandler) GetBySlug(c *gin.Context) {
 // AdminArticleHandler handles admin article operations
 type AdminArticleHandler struct {
 	articleService *service.ArticleService
+	auditService   *service.AuditService
 }
 
-func NewAdminArticleHandler(articleService *service.ArticleService) *AdminArticleHandler {
+func NewAdminArticleHandler(articleService *service.ArticleService, auditService *service.AuditService) *AdminArticleHandler {
 	return &AdminArticleHandler{
 		articleService: articleService,
+		auditService:   auditService,
 	}
 }
 
@@ -275,6 +277,8 @@ func (h *AdminArticleHandler) Create(c *gin.Context) {
 		return
 	}
 
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditArticleCreate, model.AuditTargetArticle, strconv.FormatUint(uint64(article.ID), 10), nil, article)
+
 	c.JSON(http.StatusCreated, article)
 }
 
@@ -299,6 +303,7 @@ func (h *AdminArticleHandler) Update(c *gin.Context) {
 		return
 	}
 
+	before, _ := h.articleService.GetArticleByID(uint(id))
 	article, err := h.articleService.UpdateArticle(
 		uint(id),
 		req.Title,
@@ -335,6 +340,8 @@ func (h *AdminArticleHandler) Update(c *gin.Context) {
 		return
 	}
 
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditArticleUpdate, model.AuditTargetArticle, idStr, before, article)
+
 	c.JSON(http.StatusOK, article)
 }
 
@@ -350,6 +357,7 @@ func (h *AdminArticleHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	before, _ := h.articleService.GetArticleByID(uint(id))
 	if err := h.articleService.DeleteArticle(uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to delete article",
@@ -358,6 +366,8 @@ func (h *AdminArticleHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditArticleDelete, model.AuditTargetArticle, idStr, before, nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Article deleted successfully",
 	})
@@ -375,6 +385,7 @@ func (h *AdminArticleHandler) Publish(c *gin.Context) {
 		return
 	}
 
+	before, _ := h.articleService.GetArticleByID(uint(id))
 	article, err := h.articleService.PublishArticle(uint(id))
 	if err != nil {
 		if err == service.ErrArticleNotFound {
@@ -391,6 +402,8 @@ func (h *AdminArticleHandler) Publish(c *gin.Context) {
 		return
 	}
 
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditArticlePublish, model.AuditTargetArticle, idStr, before, article)
+
 	c.JSON(http.StatusOK, article)
 }
 
@@ -406,6 +419,7 @@ func (h *AdminArticleHandler) Unpublish(c *gin.Context) {
 		return
 	}
 
+	before, _ := h.articleService.GetArticleByID(uint(id))
 	article, err := h.articleService.UnpublishArticle(uint(id))
 	if err != nil {
 		if err == service.ErrArticleNotFound {
@@ -422,5 +436,7 @@ func (h *AdminArticleHandler) Unpublish(c *gin.Context) {
 		return
 	}
 
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditArticleUnpublish, model.AuditTargetArticle, idStr, before, article)
+
 	c.JSON(http.StatusOK, article)
 }
@@ -1,7 +1,11 @@
 package handler
 
 import (
+	"errors"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -9,24 +13,57 @@ import (
 	"github.com/lite-blog/backend/internal/config"
 	"github.com/lite-blog/backend/internal/model"
 	"github.com/lite-blog/backend/internal/service"
+	"github.com/lite-blog/backend/pkg/jwt"
 )
 
 type AuthHandler struct {
-	authService *service.AuthService
-	cfg         *config.Config
+	authService      *service.AuthService
+	twoFactorService *service.TwoFactorService
+	passkeyService   *service.PasskeyService
+	oauthService     *service.OAuthService
+	magicLinkService *service.MagicLinkService
+	passwordReset    *service.PasswordResetService
+	challengeService *service.ChallengeService
+	passwordPolicy   *service.PasswordPolicy
+	cfg              *config.Config
 }
 
-func NewAuthHandler(authService *service.AuthService, cfg *config.Config) *AuthHandler {
+func NewAuthHandler(
+	authService *service.AuthService,
+	twoFactorService *service.TwoFactorService,
+	passkeyService *service.PasskeyService,
+	oauthService *service.OAuthService,
+	magicLinkService *service.MagicLinkService,
+	passwordReset *service.PasswordResetService,
+	challengeService *service.ChallengeService,
+	passwordPolicy *service.PasswordPolicy,
+	cfg *config.Config,
+) *AuthHandler {
 	return &AuthHandler{
-		authService: authService,
-		cfg:         cfg,
+		authService:      authService,
+		twoFactorService: twoFactorService,
+		passkeyService:   passkeyService,
+		oauthService:     oauthService,
+		magicLinkService: magicLinkService,
+		passwordReset:    passwordReset,
+		challengeService: challengeService,
+		passwordPolicy:   passwordPolicy,
+		cfg:              cfg,
 	}
 }
 
 // RegisterRequest represents the register request body
 type RegisterRequest struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6,max=128"`
+	Password string `json:"password" binding:"required"` // Checked against the password policy
+	Language string `json:"language"`
+
+	// Invitation token, needed to sign up when registration is invite-only
+	InvitationToken string `json:"invitation_token"`
+
+	// Solved proof-of-work challenge, required when challenges are enabled
+	ChallengeToken    string `json:"challenge_token"`
+	ChallengeSolution string `json:"challenge_solution"`
 }
 
 // LoginRequest represents the login request body
@@ -40,15 +77,38 @@ type VerifyEmailRequest struct {
 	Token string `json:"token" binding:"required"`
 }
 
+// ChangePasswordRequest represents the change password request body
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// UpdateLanguageRequest represents the update language request body
+type UpdateLanguageRequest struct {
+	Language string `json:"language" binding:"required"`
+}
+
 // UserResponse represents the user response
 type UserResponse struct {
-	ID             uint    `json:"id"`
-	Email          string  `json:"email"`
-	EmailVerified  bool    `json:"email_verified"`
-	IsMember       bool    `json:"is_member"`
-	MemberExpireAt *string `json:"member_expire_at,omitempty"`
+	ID             uint     `json:"id"`
+	Email          string   `json:"email"`
+	EmailVerified  bool     `json:"email_verified"`
+	IsMember       bool     `json:"is_member"`
+	MemberExpireAt *string  `json:"member_expire_at,omitempty"`
 	Roles          []string `json:"roles"`
-	CreatedAt      string  `json:"created_at"`
+	Language       string   `json:"language"`
+	TOTPEnabled    bool     `json:"totp_enabled"`
+	DeletionAt     *string  `json:"deletion_scheduled_at,omitempty"`
+	CreatedAt      string   `json:"created_at"`
+
+	// ImpersonatedBy is set when an admin is viewing the site as this user
+	ImpersonatedBy *ImpersonatorInfo `json:"impersonated_by,omitempty"`
+}
+
+// ImpersonatorInfo identifies the admin behind an impersonated session
+type ImpersonatorInfo struct {
+	ID    uint   `json:"id"`
+	Email string `json:"email"`
 }
 
 // buildUserResponse creates a UserResponse from a User model
@@ -59,12 +119,18 @@ func buildUserResponse(user *model.User) UserResponse {
 		EmailVerified: user.EmailVerified,
 		IsMember:      user.IsMember(),
 		Roles:         user.GetRoleCodes(),
+		Language:      user.Language,
+		TOTPEnabled:   user.TOTPEnabled,
 		CreatedAt:     user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 	}
 	if user.MemberExpireAt != nil {
 		expireStr := user.MemberExpireAt.Format("2006-01-02T15:04:05Z07:00")
 		resp.MemberExpireAt = &expireStr
 	}
+	if user.DeletionScheduledAt != nil {
+		deletionStr := user.DeletionScheduledAt.Format("2006-01-02T15:04:05Z07:00")
+		resp.DeletionAt = &deletionStr
+	}
 	return resp
 }
 
@@ -79,11 +145,29 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	if !verifyChallenge(c, h.challengeService, service.ChallengePurposeRegister, req.ChallengeToken, req.ChallengeSolution) {
+		return
+	}
+
 	// Normalize email
 	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
 
-	user, err := h.authService.Register(req.Email, req.Password)
+	// Fall back to the browser language for emails
+	language := req.Language
+	if language == "" {
+		language = c.GetHeader("Accept-Language")
+	}
+
+	user, err := h.authService.Register(c.Request.Context(), req.Email, req.Password, language, strings.TrimSpace(req.InvitationToken))
 	if err != nil {
+		if respondSignupNotAllowed(c, err) {
+			return
+		}
+
+		if respondWeakPassword(c, err) {
+			return
+		}
+
 		switch err {
 		case service.ErrEmailAlreadyExists:
 			c.JSON(http.StatusConflict, gin.H{
@@ -119,9 +203,22 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	// Normalize email
 	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
 
-	user, token, err := h.authService.Login(req.Email, req.Password)
+	user, token, err := h.authService.Login(c.Request.Context(), req.Email, req.Password, c.ClientIP())
 	if err != nil {
+		var throttled *service.LoginThrottleError
+		if errors.As(err, &throttled) {
+			respondLoginThrottled(c, throttled)
+			return
+		}
+
 		switch err {
+		case service.ErrMFARequired:
+			// The password was right; the session is issued by LoginTwoFactor
+			h.setMFATokenCookie(c, token)
+			c.JSON(http.StatusOK, gin.H{
+				"message":      "Two-factor authentication required",
+				"mfa_required": true,
+			})
 		case service.ErrInvalidCredentials:
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Invalid email or password",
@@ -132,6 +229,11 @@ func (h *AuthHandler) Login(c *gin.Context) {
 				"error": "Your account has been disabled",
 				"code":  "ACCOUNT_DISABLED",
 			})
+		case service.ErrEmailNotVerified:
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Please verify your email first. A new verification link has been sent",
+				"code":  "EMAIL_NOT_VERIFIED",
+			})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Login failed",
@@ -150,10 +252,31 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	})
 }
 
+// respondLoginThrottled tells the client how long to wait before trying again
+func respondLoginThrottled(c *gin.Context, throttled *service.LoginThrottleError) {
+	retryAfter := int(math.Ceil(throttled.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+
+	if throttled.Locked {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many failed login attempts. Sign-in is temporarily locked",
+			"code":        "ACCOUNT_LOCKED",
+			"retry_after": retryAfter,
+		})
+		return
+	}
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many failed login attempts. Please wait before trying again",
+		"code":        "TOO_MANY_ATTEMPTS",
+		"retry_after": retryAfter,
+	})
+}
+
 // Logout handles user logout
 func (h *AuthHandler) Logout(c *gin.Context) {
-	// Clear the token cookie
+	// Clear the token cookie, and an admin session saved while impersonating
 	h.clearTokenCookie(c)
+	clearImpersonatorCookie(c)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Logged out successfully",
@@ -171,7 +294,11 @@ func (h *AuthHandler) Me(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, buildUserResponse(user))
+	resp := buildUserResponse(user)
+	if impersonator := middleware.GetImpersonatorFromContext(c); impersonator != nil {
+		resp.ImpersonatedBy = &ImpersonatorInfo{ID: impersonator.ID, Email: impersonator.Email}
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // VerifyEmail handles email verification
@@ -218,7 +345,7 @@ func (h *AuthHandler) ResendVerification(c *gin.Context) {
 		return
 	}
 
-	err := h.authService.ResendVerification(user.ID)
+	err := h.authService.ResendVerification(c.Request.Context(), user.ID)
 	if err != nil {
 		switch err {
 		case service.ErrTooManyRequests:
@@ -240,6 +367,48 @@ func (h *AuthHandler) ResendVerification(c *gin.Context) {
 	})
 }
 
+// UpdateLanguage updates the current user's preferred email language
+func (h *AuthHandler) UpdateLanguage(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	var req UpdateLanguageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	err := h.authService.UpdateLanguage(user.ID, req.Language)
+	if err != nil {
+		switch err {
+		case service.ErrUnsupportedLanguage:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Unsupported language",
+				"code":  "UNSUPPORTED_LANGUAGE",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to update language",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Language updated",
+	})
+}
+
 // setTokenCookie sets the JWT token in an HttpOnly cookie
 func (h *AuthHandler) setTokenCookie(c *gin.Context, token string) {
 	maxAge := h.cfg.JWT.ExpireHours * 3600 // Convert hours to seconds
@@ -256,6 +425,16 @@ func (h *AuthHandler) setTokenCookie(c *gin.Context, token string) {
 	)
 }
 
+// RefreshSession replaces the cookie of a session whose roles have changed
+func (h *AuthHandler) RefreshSession(c *gin.Context, user *model.User, claims *jwt.Claims) {
+	token, err := h.authService.RefreshSession(user, claims)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to refresh session", "user_id", user.ID, "error", err)
+		return
+	}
+	h.setTokenCookie(c, token)
+}
+
 // clearTokenCookie clears the JWT token cookie
 func (h *AuthHandler) clearTokenCookie(c *gin.Context) {
 	secure := isSecureRequest(c)
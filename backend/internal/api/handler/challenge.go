@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lite-blog/backend/internal/service"
+)
+
+type ChallengeHandler struct {
+	challengeService *service.ChallengeService
+}
+
+func NewChallengeHandler(challengeService *service.ChallengeService) *ChallengeHandler {
+	return &ChallengeHandler{
+		challengeService: challengeService,
+	}
+}
+
+// Issue returns a proof-of-work challenge for the purpose in the query. The
+// client submits the challenge token and its solution with the protected request.
+func (h *ChallengeHandler) Issue(c *gin.Context) {
+	challenge, err := h.challengeService.Issue(c.Query("purpose"), c.ClientIP())
+	if err != nil {
+		switch err {
+		case service.ErrChallengePurposeInvalid:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Unknown challenge purpose",
+				"code":  "INVALID_REQUEST",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to create challenge",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, challenge)
+}
+
+// verifyChallenge checks the solved challenge sent with a protected request,
+// responding and returning false if it isn't acceptable
+func verifyChallenge(c *gin.Context, challengeService *service.ChallengeService, purpose, token, solution string) bool {
+	err := challengeService.Verify(purpose, c.ClientIP(), token, solution)
+	switch err {
+	case nil:
+		return true
+	case service.ErrChallengeRequired:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Please complete the challenge",
+			"code":  "CHALLENGE_REQUIRED",
+		})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Challenge is invalid or expired. Please try again",
+			"code":  "INVALID_CHALLENGE",
+		})
+	}
+	return false
+}
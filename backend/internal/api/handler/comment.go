@@ -6,16 +6,19 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/lite-blog/backend/internal/api/middleware"
+	"github.com/lite-blog/backend/internal/model"
 	"github.com/lite-blog/backend/internal/service"
 )
 
 type CommentHandler struct {
-	commentService *service.CommentService
+	commentService   *service.CommentService
+	challengeService *service.ChallengeService
 }
 
-func NewCommentHandler(commentService *service.CommentService) *CommentHandler {
+func NewCommentHandler(commentService *service.CommentService, challengeService *service.ChallengeService) *CommentHandler {
 	return &CommentHandler{
-		commentService: commentService,
+		commentService:   commentService,
+		challengeService: challengeService,
 	}
 }
 
@@ -23,6 +26,10 @@ func NewCommentHandler(commentService *service.CommentService) *CommentHandler {
 type CreateCommentRequest struct {
 	Content  string `json:"content" binding:"required,min=1,max=500"`
 	ParentID *uint  `json:"parent_id,omitempty"`
+
+	// Solved proof-of-work challenge, required when challenges are enabled
+	ChallengeToken    string `json:"challenge_token"`
+	ChallengeSolution string `json:"challenge_solution"`
 }
 
 // ListCommentsRequest represents the list comments request
@@ -121,6 +128,11 @@ func (h *CommentHandler) Create(c *gin.Context) {
 		return
 	}
 
+	// Admins moderate comments, so they aren't challenged
+	if !user.IsAdmin() && !verifyChallenge(c, h.challengeService, service.ChallengePurposeComment, req.ChallengeToken, req.ChallengeSolution) {
+		return
+	}
+
 	comment, err := h.commentService.CreateComment(uint(articleID), user, req.Content, req.ParentID)
 	if err != nil {
 		switch err {
@@ -164,11 +176,13 @@ func (h *CommentHandler) Create(c *gin.Context) {
 // AdminCommentHandler handles admin comment operations
 type AdminCommentHandler struct {
 	commentService *service.CommentService
+	auditService   *service.AuditService
 }
 
-func NewAdminCommentHandler(commentService *service.CommentService) *AdminCommentHandler {
+func NewAdminCommentHandler(commentService *service.CommentService, auditService *service.AuditService) *AdminCommentHandler {
 	return &AdminCommentHandler{
 		commentService: commentService,
+		auditService:   auditService,
 	}
 }
 
@@ -184,6 +198,7 @@ func (h *AdminCommentHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	before, _ := h.commentService.GetComment(uint(commentID))
 	if err := h.commentService.DeleteComment(uint(commentID)); err != nil {
 		if err == service.ErrCommentNotFound {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -199,6 +214,9 @@ func (h *AdminCommentHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	after, _ := h.commentService.GetComment(uint(commentID))
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditCommentDelete, model.AuditTargetComment, commentIDStr, before, after)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Comment deleted successfully",
 	})
@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/service"
+)
+
+// AdminEmailHandler handles admin inspection of the email outbox
+type AdminEmailHandler struct {
+	emailService *service.EmailService
+	auditService *service.AuditService
+}
+
+func NewAdminEmailHandler(emailService *service.EmailService, auditService *service.AuditService) *AdminEmailHandler {
+	return &AdminEmailHandler{
+		emailService: emailService,
+		auditService: auditService,
+	}
+}
+
+// ListEmailsRequest represents the list emails request
+type ListEmailsRequest struct {
+	Status   string `form:"status" binding:"omitempty,oneof=pending sending sent failed"`
+	Page     int    `form:"page,default=1"`
+	PageSize int    `form:"page_size,default=20"`
+}
+
+// EmailListResponse represents the paginated outbox list response
+type EmailListResponse struct {
+	Emails     []model.EmailOutbox `json:"emails"`
+	Total      int64               `json:"total"`
+	Page       int                 `json:"page"`
+	PageSize   int                 `json:"page_size"`
+	TotalPages int                 `json:"total_pages"`
+}
+
+// List returns a paginated list of outbox messages, e.g. ?status=failed
+func (h *AdminEmailHandler) List(c *gin.Context) {
+	var req ListEmailsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid query parameters",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.PageSize < 1 || req.PageSize > 100 {
+		req.PageSize = 20
+	}
+
+	emails, total, err := h.emailService.ListOutbox(req.Status, req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch emails",
+			"code":  "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	totalPages := int(total) / req.PageSize
+	if int(total)%req.PageSize > 0 {
+		totalPages++
+	}
+
+	c.JSON(http.StatusOK, EmailListResponse{
+		Emails:     emails,
+		Total:      total,
+		Page:       req.Page,
+		PageSize:   req.PageSize,
+		TotalPages: totalPages,
+	})
+}
+
+// GetByID returns a single outbox message including its content, with link
+// tokens redacted
+func (h *AdminEmailHandler) GetByID(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid email ID",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	email, err := h.emailService.GetOutboxMessage(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Email not found",
+			"code":  "NOT_FOUND",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, email)
+}
+
+// Retry requeues a failed message
+func (h *AdminEmailHandler) Retry(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid email ID",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	before, _ := h.emailService.GetOutboxMessage(uint(id))
+	err = h.emailService.RetryOutboxMessage(uint(id))
+	if err != nil {
+		switch err {
+		case service.ErrEmailNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Email not found",
+				"code":  "NOT_FOUND",
+			})
+		case service.ErrEmailNotRetryable:
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Only failed emails can be retried",
+				"code":  "EMAIL_NOT_RETRYABLE",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to retry email",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	after, _ := h.emailService.GetOutboxMessage(uint(id))
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditEmailRetry, model.AuditTargetEmail, idStr, before, after)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email queued for retry",
+	})
+}
+
+// EmailTemplateRequest represents an email template override or preview request
+type EmailTemplateRequest struct {
+	Subject string `json:"subject" binding:"required"`
+	HTML    string `json:"html" binding:"required"`
+	Text    string `json:"text" binding:"required"`
+}
+
+// ListTemplates returns all email templates
+func (h *AdminEmailHandler) ListTemplates(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"templates": h.emailService.ListTemplates(),
+	})
+}
+
+// GetTemplate returns the active source of a template in one language
+func (h *AdminEmailHandler) GetTemplate(c *gin.Context) {
+	source, overridden, err := h.emailService.GetTemplateSource(c.Param("name"), c.Param("language"))
+	if err != nil {
+		respondEmailTemplateError(c, err, "Failed to fetch email template")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":       c.Param("name"),
+		"language":   c.Param("language"),
+		"overridden": overridden,
+		"template":   source,
+	})
+}
+
+// UpdateTemplate stores an admin override of a template
+func (h *AdminEmailHandler) UpdateTemplate(c *gin.Context) {
+	var req EmailTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	source := &service.EmailTemplateSource{
+		Subject: req.Subject,
+		HTML:    req.HTML,
+		Text:    req.Text,
+	}
+	before, _, _ := h.emailService.GetTemplateSource(c.Param("name"), c.Param("language"))
+	if err := h.emailService.SaveTemplateOverride(c.Param("name"), c.Param("language"), source); err != nil {
+		respondEmailTemplateError(c, err, "Failed to save email template")
+		return
+	}
+
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditEmailTemplateUpdate, model.AuditTargetEmailTemplate, c.Param("name")+"/"+c.Param("language"), before, source)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email template saved",
+	})
+}
+
+// ResetTemplate removes an admin override, restoring the built-in template
+func (h *AdminEmailHandler) ResetTemplate(c *gin.Context) {
+	before, _, _ := h.emailService.GetTemplateSource(c.Param("name"), c.Param("language"))
+	if err := h.emailService.ResetTemplateOverride(c.Param("name"), c.Param("language")); err != nil {
+		respondEmailTemplateError(c, err, "Failed to reset email template")
+		return
+	}
+
+	after, _, _ := h.emailService.GetTemplateSource(c.Param("name"), c.Param("language"))
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditEmailTemplateReset, model.AuditTargetEmailTemplate, c.Param("name")+"/"+c.Param("language"), before, after)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email template reset to default",
+	})
+}
+
+// PreviewTemplate renders a template with sample data. The request body is optional;
+// when given, the submitted (unsaved) template is rendered instead of the active one.
+func (h *AdminEmailHandler) PreviewTemplate(c *gin.Context) {
+	var source *service.EmailTemplateSource
+	if c.Request.ContentLength > 0 {
+		var req EmailTemplateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request body",
+				"code":  "INVALID_REQUEST",
+			})
+			return
+		}
+		source = &service.EmailTemplateSource{
+			Subject: req.Subject,
+			HTML:    req.HTML,
+			Text:    req.Text,
+		}
+	}
+
+	rendered, err := h.emailService.PreviewTemplate(c.Param("name"), c.Param("language"), source)
+	if err != nil {
+		respondEmailTemplateError(c, err, "Failed to render email template")
+		return
+	}
+
+	c.JSON(http.StatusOK, rendered)
+}
+
+// respondEmailTemplateError maps email template errors to responses
+func respondEmailTemplateError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrEmailTemplateNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Email template not found",
+			"code":  "NOT_FOUND",
+		})
+	case errors.Is(err, service.ErrUnsupportedLanguage):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unsupported language",
+			"code":  "UNSUPPORTED_LANGUAGE",
+		})
+	case errors.Is(err, service.ErrInvalidEmailTemplate):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+			"code":  "INVALID_TEMPLATE",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": message,
+			"code":  "INTERNAL_ERROR",
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lite-blog/backend/internal/api/middleware"
+	"github.com/lite-blog/backend/internal/service"
+)
+
+type EmailChangeHandler struct {
+	emailChangeService *service.EmailChangeService
+}
+
+func NewEmailChangeHandler(emailChangeService *service.EmailChangeService) *EmailChangeHandler {
+	return &EmailChangeHandler{
+		emailChangeService: emailChangeService,
+	}
+}
+
+// ChangeEmailRequest represents the change email request body
+type ChangeEmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// EmailChangeTokenRequest represents the confirm or cancel email change request body
+type EmailChangeTokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// Status returns the current email and any change waiting for confirmation
+func (h *EmailChangeHandler) Status(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	resp := gin.H{
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+	}
+	if pending := h.emailChangeService.Pending(user.ID); pending != nil {
+		resp["pending_email"] = pending.NewEmail
+		resp["pending_expires_at"] = pending.ExpiresAt.Format(time.RFC3339)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Request starts changing the current user's email. The change applies once
+// it is confirmed from the new address.
+func (h *EmailChangeHandler) Request(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	var req ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	change, err := h.emailChangeService.Request(c.Request.Context(), user, req.Email)
+	if err != nil {
+		switch err {
+		case service.ErrEmailUnchanged:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "This is already your email",
+				"code":  "EMAIL_UNCHANGED",
+			})
+		case service.ErrEmailAlreadyExists:
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Email already registered",
+				"code":  "EMAIL_EXISTS",
+			})
+		case service.ErrEmailDomainNotAllowed:
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "This email domain is not allowed",
+				"code":  "EMAIL_DOMAIN_NOT_ALLOWED",
+			})
+		case service.ErrTooManyRequests:
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Please wait before requesting another email change",
+				"code":  "TOO_MANY_REQUESTS",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to request email change",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":            "Check your new email to confirm the change",
+		"pending_email":      change.NewEmail,
+		"pending_expires_at": change.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+// Confirm applies an email change from the link sent to the new address
+func (h *EmailChangeHandler) Confirm(c *gin.Context) {
+	var req EmailChangeTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	user, err := h.emailChangeService.Confirm(c.Request.Context(), req.Token)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidToken, service.ErrUserNotFound:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid or expired confirmation link",
+				"code":  "INVALID_TOKEN",
+			})
+		case service.ErrEmailAlreadyExists:
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Email already registered",
+				"code":  "EMAIL_EXISTS",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to change email",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email changed",
+		"email":   user.Email,
+	})
+}
+
+// Cancel drops a pending email change from the link sent to the old address
+func (h *EmailChangeHandler) Cancel(c *gin.Context) {
+	var req EmailChangeTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	if err := h.emailChangeService.Cancel(req.Token); err != nil {
+		switch err {
+		case service.ErrInvalidToken:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid or already used cancel link",
+				"code":  "INVALID_TOKEN",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to cancel email change",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email change cancelled",
+	})
+}
+
+// CancelPending drops the current user's pending email change
+func (h *EmailChangeHandler) CancelPending(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	if err := h.emailChangeService.CancelForUser(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to cancel email change",
+			"code":  "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email change cancelled",
+	})
+}
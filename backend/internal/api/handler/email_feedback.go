@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/service"
+	"github.com/lite-blog/backend/pkg/sns"
+)
+
+// maxSNSMessageSize bounds webhook bodies; SNS messages are at most 256 KB
+const maxSNSMessageSize = 256 * 1024
+
+// EmailFeedbackHandler handles provider bounce/complaint webhooks and suppression management
+type EmailFeedbackHandler struct {
+	feedbackService *service.EmailFeedbackService
+	auditService    *service.AuditService
+}
+
+func NewEmailFeedbackHandler(feedbackService *service.EmailFeedbackService, auditService *service.AuditService) *EmailFeedbackHandler {
+	return &EmailFeedbackHandler{
+		feedbackService: feedbackService,
+		auditService:    auditService,
+	}
+}
+
+// SESWebhook receives SES bounce and complaint notifications delivered by SNS
+func (h *EmailFeedbackHandler) SESWebhook(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSNSMessageSize+1))
+	if err != nil || len(body) > maxSNSMessageSize {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	err = h.feedbackService.HandleSNSMessage(c.Request.Context(), body)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrSNSWebhookDisabled):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Webhook not configured",
+				"code":  "NOT_FOUND",
+			})
+		case errors.Is(err, sns.ErrInvalidMessage):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid SNS message",
+				"code":  "INVALID_REQUEST",
+			})
+		case errors.Is(err, service.ErrSNSTopicNotAllowed),
+			errors.Is(err, sns.ErrInvalidCertURL),
+			errors.Is(err, sns.ErrInvalidSignature),
+			errors.Is(err, sns.ErrUnsupportedVersion),
+			errors.Is(err, sns.ErrMessageExpired):
+			slog.WarnContext(c.Request.Context(), "Rejected SNS message", "error", err)
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Invalid SNS message signature",
+				"code":  "INVALID_SIGNATURE",
+			})
+		default:
+			// A 5xx makes SNS retry the delivery later
+			slog.ErrorContext(c.Request.Context(), "Failed to process SNS message", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to process notification",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "OK",
+	})
+}
+
+// ListSuppressionsRequest represents the list suppressions request
+type ListSuppressionsRequest struct {
+	Reason   string `form:"reason" binding:"omitempty,oneof=bounce complaint"`
+	Page     int    `form:"page,default=1"`
+	PageSize int    `form:"page_size,default=20"`
+}
+
+// SuppressionListResponse represents the paginated suppression list response
+type SuppressionListResponse struct {
+	Suppressions []model.EmailSuppression `json:"suppressions"`
+	Total        int64                    `json:"total"`
+	Page         int                      `json:"page"`
+	PageSize     int                      `json:"page_size"`
+	TotalPages   int                      `json:"total_pages"`
+}
+
+// ListSuppressions returns a paginated list of suppressed addresses, e.g. ?reason=complaint
+func (h *EmailFeedbackHandler) ListSuppressions(c *gin.Context) {
+	var req ListSuppressionsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid query parameters",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.PageSize < 1 || req.PageSize > 100 {
+		req.PageSize = 20
+	}
+
+	suppressions, total, err := h.feedbackService.ListSuppressions(req.Reason, req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch suppressions",
+			"code":  "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	totalPages := int(total) / req.PageSize
+	if int(total)%req.PageSize > 0 {
+		totalPages++
+	}
+
+	c.JSON(http.StatusOK, SuppressionListResponse{
+		Suppressions: suppressions,
+		Total:        total,
+		Page:         req.Page,
+		PageSize:     req.PageSize,
+		TotalPages:   totalPages,
+	})
+}
+
+// DeleteSuppression lets a suppressed address receive email again
+func (h *EmailFeedbackHandler) DeleteSuppression(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid suppression ID",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	suppression, err := h.feedbackService.DeleteSuppression(uint(id))
+	if err != nil {
+		if err == service.ErrSuppressionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Suppression not found",
+				"code":  "NOT_FOUND",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to delete suppression",
+			"code":  "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditEmailSuppressionDelete, model.AuditTargetEmailSuppression, idStr, suppression, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Suppression removed",
+	})
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lite-blog/backend/internal/api/middleware"
+	"github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/service"
+)
+
+// impersonatorCookiePath limits the saved admin session to the endpoint that restores it
+const impersonatorCookiePath = "/api/auth/impersonation"
+
+// ImpersonationHandler lets admins view the site as a user and switch back
+type ImpersonationHandler struct {
+	impersonationService *service.ImpersonationService
+	auditService         *service.AuditService
+	cfg                  *config.Config
+}
+
+func NewImpersonationHandler(impersonationService *service.ImpersonationService, auditService *service.AuditService, cfg *config.Config) *ImpersonationHandler {
+	return &ImpersonationHandler{
+		impersonationService: impersonationService,
+		auditService:         auditService,
+		cfg:                  cfg,
+	}
+}
+
+// Start signs the admin in as a user. The admin's own session is kept in a
+// separate cookie until the impersonation ends.
+func (h *ImpersonationHandler) Start(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	admin := middleware.GetUserFromContext(c)
+	adminToken, err := c.Cookie(middleware.CookieNameToken)
+	if admin == nil || err != nil {
+		// Access tokens can't be swapped for a browser session
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Impersonation requires a browser session",
+			"code":  "SESSION_REQUIRED",
+		})
+		return
+	}
+
+	target, token, err := h.impersonationService.Start(admin, uint(id))
+	if err != nil {
+		switch err {
+		case service.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+				"code":  "NOT_FOUND",
+			})
+		case service.ErrCannotImpersonateSelf:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Cannot impersonate yourself",
+				"code":  "CANNOT_IMPERSONATE_SELF",
+			})
+		case service.ErrCannotImpersonateAdmin:
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Admins can't be impersonated",
+				"code":  "CANNOT_IMPERSONATE_ADMIN",
+			})
+		case service.ErrUserDisabled:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "User account is disabled",
+				"code":  "ACCOUNT_DISABLED",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to impersonate user",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	expiresAt := time.Now().Add(service.ImpersonationTTL)
+	maxAge := int(service.ImpersonationTTL.Seconds())
+	secure := isSecureRequest(c)
+	c.SetCookie(middleware.CookieNameImpersonatorToken, adminToken, maxAge, impersonatorCookiePath, "", secure, true)
+	c.SetCookie(middleware.CookieNameToken, token, maxAge, "/", "", secure, true)
+
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditUserImpersonate, model.AuditTargetUser, idStr, nil, gin.H{
+		"expires_at": expiresAt,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Now viewing the site as " + target.Email,
+		"user":       buildUserResponse(target),
+		"expires_at": expiresAt.Format(time.RFC3339),
+	})
+}
+
+// End stops impersonating and restores the admin's own session. If that
+// session has expired or was revoked meanwhile, the admin is signed out.
+func (h *ImpersonationHandler) End(c *gin.Context) {
+	sessionToken, _ := c.Cookie(middleware.CookieNameToken)
+	adminToken, _ := c.Cookie(middleware.CookieNameImpersonatorToken)
+
+	admin, targetID, restored, err := h.impersonationService.End(sessionToken, adminToken)
+	if err != nil {
+		clearImpersonatorCookie(c)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Not impersonating a user",
+			"code":  "NOT_IMPERSONATING",
+		})
+		return
+	}
+
+	clearImpersonatorCookie(c)
+	secure := isSecureRequest(c)
+	if restored != "" {
+		c.SetCookie(middleware.CookieNameToken, restored, h.cfg.JWT.ExpireHours*3600, "/", "", secure, true)
+	} else {
+		c.SetCookie(middleware.CookieNameToken, "", -1, "/", "", secure, true)
+	}
+
+	h.auditService.Record(c.Request.Context(), service.AuditActor{
+		UserID:    admin.ID,
+		Email:     admin.Email,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}, model.AuditUserImpersonateEnd, model.AuditTargetUser, strconv.FormatUint(uint64(targetID), 10), nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Impersonation ended",
+		"restored": restored != "",
+	})
+}
+
+// clearImpersonatorCookie deletes the saved admin session
+func clearImpersonatorCookie(c *gin.Context) {
+	c.SetCookie(middleware.CookieNameImpersonatorToken, "", -1, impersonatorCookiePath, "", isSecureRequest(c), true)
+}
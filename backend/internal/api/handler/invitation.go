@@ -0,0 +1,280 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lite-blog/backend/internal/api/middleware"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/service"
+)
+
+type InvitationHandler struct {
+	registrationService *service.RegistrationService
+}
+
+func NewInvitationHandler(registrationService *service.RegistrationService) *InvitationHandler {
+	return &InvitationHandler{
+		registrationService: registrationService,
+	}
+}
+
+// Registration returns the registration mode, so the sign-up page can tell
+// users whether they need an invitation
+func (h *InvitationHandler) Registration(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"mode": h.registrationService.Mode(),
+	})
+}
+
+// Lookup returns who an invitation is for, so the sign-up page can prefill the email
+func (h *InvitationHandler) Lookup(c *gin.Context) {
+	invitation, err := h.registrationService.LookupInvitation(c.Param("token"))
+	if err != nil {
+		if !respondSignupNotAllowed(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to fetch invitation",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"email":      invitation.Email,
+		"expires_at": invitation.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+// respondSignupNotAllowed responds to errors for sign-ups the registration
+// mode or invitation doesn't allow. It returns false for other errors.
+func respondSignupNotAllowed(c *gin.Context, err error) bool {
+	switch err {
+	case service.ErrRegistrationClosed:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Registration is closed",
+			"code":  "REGISTRATION_CLOSED",
+		})
+	case service.ErrInvitationRequired:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "An invitation is required to sign up",
+			"code":  "INVITATION_REQUIRED",
+		})
+	case service.ErrEmailDomainNotAllowed:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Sign-up is not allowed for this email domain",
+			"code":  "EMAIL_DOMAIN_NOT_ALLOWED",
+		})
+	case service.ErrInvitationInvalid:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid or expired invitation",
+			"code":  "INVALID_INVITATION",
+		})
+	case service.ErrInvitationEmailMismatch:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "This invitation is for a different email",
+			"code":  "INVITATION_EMAIL_MISMATCH",
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+type AdminInvitationHandler struct {
+	registrationService *service.RegistrationService
+	auditService        *service.AuditService
+}
+
+func NewAdminInvitationHandler(registrationService *service.RegistrationService, auditService *service.AuditService) *AdminInvitationHandler {
+	return &AdminInvitationHandler{
+		registrationService: registrationService,
+		auditService:        auditService,
+	}
+}
+
+// CreateInvitationRequest represents the create invitation request body. Zero
+// values use the defaults: any email, one use, expiring after seven days.
+type CreateInvitationRequest struct {
+	Email         string   `json:"email" binding:"omitempty,email"`
+	Roles         []string `json:"roles"`
+	MemberDays    int      `json:"member_days" binding:"min=0,max=3650"`
+	MaxUses       int      `json:"max_uses" binding:"min=0,max=1000"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=365"`
+	Note          string   `json:"note" binding:"max=255"`
+}
+
+// ListInvitationsRequest represents the list invitations request
+type ListInvitationsRequest struct {
+	Page     int `form:"page,default=1"`
+	PageSize int `form:"page_size,default=10"`
+}
+
+// InvitationResponse represents an invitation in responses. Token and URL are
+// only set when the invitation is created.
+type InvitationResponse struct {
+	model.Invitation
+	Roles []string `json:"roles"`
+	Token string   `json:"token,omitempty"`
+	URL   string   `json:"url,omitempty"`
+}
+
+// InvitationListResponse represents the paginated invitation list response
+type InvitationListResponse struct {
+	Invitations []InvitationResponse `json:"invitations"`
+	Total       int64                `json:"total"`
+	Page        int                  `json:"page"`
+	PageSize    int                  `json:"page_size"`
+	TotalPages  int                  `json:"total_pages"`
+}
+
+// List returns a paginated list of invitations and who used them
+func (h *AdminInvitationHandler) List(c *gin.Context) {
+	var req ListInvitationsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid query parameters",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	// Validate pagination
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.PageSize < 1 || req.PageSize > 50 {
+		req.PageSize = 10
+	}
+
+	invitations, total, err := h.registrationService.ListInvitations(req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch invitations",
+			"code":  "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	items := make([]InvitationResponse, 0, len(invitations))
+	for _, invitation := range invitations {
+		items = append(items, InvitationResponse{Invitation: invitation, Roles: invitation.RoleList()})
+	}
+
+	totalPages := int(total) / req.PageSize
+	if int(total)%req.PageSize > 0 {
+		totalPages++
+	}
+
+	c.JSON(http.StatusOK, InvitationListResponse{
+		Invitations: items,
+		Total:       total,
+		Page:        req.Page,
+		PageSize:    req.PageSize,
+		TotalPages:  totalPages,
+	})
+}
+
+// Create creates an invitation and returns its link, which is only shown once
+func (h *AdminInvitationHandler) Create(c *gin.Context) {
+	var req CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	currentUser := middleware.GetUserFromContext(c)
+	// Granting roles through an invitation needs the same permission as
+	// granting them directly
+	if len(req.Roles) > 0 && !currentUser.HasPermission(model.PermissionRoleManage) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Insufficient permissions",
+			"code":  "FORBIDDEN",
+		})
+		return
+	}
+
+	invitation, token, err := h.registrationService.CreateInvitation(currentUser, service.InvitationOptions{
+		Email:         req.Email,
+		Roles:         req.Roles,
+		MemberDays:    req.MemberDays,
+		MaxUses:       req.MaxUses,
+		ExpiresInDays: req.ExpiresInDays,
+		Note:          req.Note,
+	})
+	if err != nil {
+		switch err {
+		case service.ErrRoleNotFound:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Role not found",
+				"code":  "ROLE_NOT_FOUND",
+			})
+		case service.ErrInvitationAdminRole:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invitations can't grant the admin role",
+				"code":  "ADMIN_ROLE_NOT_ALLOWED",
+			})
+		case service.ErrInvitationEmailRequired:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invitations that grant roles must be for a specific email",
+				"code":  "EMAIL_REQUIRED",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to create invitation",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	// The token is left out, so the audit log never holds a usable link
+	audited := InvitationResponse{Invitation: *invitation, Roles: invitation.RoleList()}
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditInvitationCreate, model.AuditTargetInvitation, strconv.FormatUint(uint64(invitation.ID), 10), nil, audited)
+
+	c.JSON(http.StatusCreated, InvitationResponse{
+		Invitation: *invitation,
+		Roles:      invitation.RoleList(),
+		Token:      token,
+		URL:        h.registrationService.InvitationURL(token),
+	})
+}
+
+// Revoke stops an invitation from being used
+func (h *AdminInvitationHandler) Revoke(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid invitation ID",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	if err := h.registrationService.RevokeInvitation(uint(id)); err != nil {
+		switch err {
+		case service.ErrInvitationNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Invitation not found",
+				"code":  "NOT_FOUND",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to revoke invitation",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditInvitationRevoke, model.AuditTargetInvitation, c.Param("id"), nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Invitation revoked",
+	})
+}
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lite-blog/backend/pkg/jwt"
+)
+
+type JWKSHandler struct {
+	keys *jwt.KeySet
+}
+
+func NewJWKSHandler(keys *jwt.KeySet) *JWKSHandler {
+	return &JWKSHandler{
+		keys: keys,
+	}
+}
+
+// Keys returns the public keys that verify our tokens, so other services can
+// check them without holding a secret
+func (h *JWKSHandler) Keys(c *gin.Context) {
+	// Short enough that verifiers pick up a new key soon after a rotation
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.PublicKeys())
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lite-blog/backend/internal/service"
+)
+
+// MagicLinkRequest represents the magic link request body
+type MagicLinkRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Language string `json:"language"`
+}
+
+// ConsumeMagicLinkRequest represents the consume magic link request body
+type ConsumeMagicLinkRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// RequestMagicLink emails a single-use sign-in link. The response is the same
+// whether or not the email has an account.
+func (h *AuthHandler) RequestMagicLink(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	// Normalize email
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+
+	// Fall back to the browser language for emails
+	language := req.Language
+	if language == "" {
+		language = c.GetHeader("Accept-Language")
+	}
+
+	err := h.magicLinkService.Request(c.Request.Context(), req.Email, language, c.ClientIP())
+	if err != nil {
+		switch err {
+		case service.ErrTooManyRequests:
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many sign-in links requested, please try again later",
+				"code":  "TOO_MANY_REQUESTS",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to send sign-in link",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "If this email can sign in, a sign-in link has been sent",
+	})
+}
+
+// ConsumeMagicLink redeems a sign-in link and sets the session cookie
+func (h *AuthHandler) ConsumeMagicLink(c *gin.Context) {
+	var req ConsumeMagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	user, token, err := h.magicLinkService.Consume(c.Request.Context(), req.Token)
+	if err != nil {
+		if respondSignupNotAllowed(c, err) {
+			return
+		}
+
+		switch err {
+		case service.ErrMFARequired:
+			h.setMFATokenCookie(c, token)
+			c.JSON(http.StatusOK, gin.H{
+				"message":      "Two-factor authentication required",
+				"mfa_required": true,
+			})
+		case service.ErrInvalidToken:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid or expired sign-in link",
+				"code":  "INVALID_TOKEN",
+			})
+		case service.ErrMagicLinkAccountConflict:
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "This email's account isn't verified yet. Verify it from the registration email or sign in with its password",
+				"code":  "ACCOUNT_CONFLICT",
+			})
+		case service.ErrUserDisabled:
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Your account has been disabled",
+				"code":  "ACCOUNT_DISABLED",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Login failed",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	h.setTokenCookie(c, token)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Login successful",
+		"user":    buildUserResponse(user),
+	})
+}
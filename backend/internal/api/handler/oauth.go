@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lite-blog/backend/internal/api/middleware"
+	"github.com/lite-blog/backend/internal/service"
+)
+
+// oauthCookiePath scopes the sign-in state cookie to the OAuth routes
+const oauthCookiePath = "/api/auth/oauth"
+
+// OAuthProviders lists the configured sign-in providers for the login page
+func (h *AuthHandler) OAuthProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"providers": h.oauthService.Providers(),
+	})
+}
+
+// OAuthLogin redirects to the provider, e.g. /api/auth/oauth/github/login?redirect=/articles
+func (h *AuthHandler) OAuthLogin(c *gin.Context) {
+	authURL, state, err := h.oauthService.Begin(c.Request.Context(), c.Param("provider"), c.Query("redirect"))
+	if err != nil {
+		switch err {
+		case service.ErrOAuthProviderNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Sign-in provider not found",
+				"code":  "NOT_FOUND",
+			})
+		case service.ErrOAuthFailed:
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error": "Sign-in provider is unavailable",
+				"code":  "PROVIDER_ERROR",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to start sign-in",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	// Lax lets the cookie come back on the top-level redirect from the provider
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(middleware.CookieNameOAuthState, state, int(service.OAuthStateTTL.Seconds()), oauthCookiePath, "", isSecureRequest(c), true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OAuthCallback completes a provider sign-in and redirects back to the site.
+// Failures redirect to the login page with an oauth_error code.
+func (h *AuthHandler) OAuthCallback(c *gin.Context) {
+	state, _ := c.Cookie(middleware.CookieNameOAuthState)
+	c.SetCookie(middleware.CookieNameOAuthState, "", -1, oauthCookiePath, "", isSecureRequest(c), true)
+
+	// The user declined or the provider failed
+	if c.Query("error") != "" {
+		redirectOAuthError(c, "access_denied")
+		return
+	}
+
+	_, token, redirect, err := h.oauthService.Complete(c.Request.Context(), c.Param("provider"), state, c.Query("state"), c.Query("code"))
+	if err != nil {
+		switch err {
+		case service.ErrMFARequired:
+			h.setMFATokenCookie(c, token)
+			c.Redirect(http.StatusFound, "/login?mfa_required=1&redirect="+url.QueryEscape(redirect))
+		case service.ErrOAuthStateInvalid:
+			redirectOAuthError(c, "invalid_state")
+		case service.ErrOAuthEmailNotVerified:
+			redirectOAuthError(c, "email_not_verified")
+		case service.ErrOAuthAccountConflict:
+			redirectOAuthError(c, "account_conflict")
+		case service.ErrUserDisabled:
+			redirectOAuthError(c, "account_disabled")
+		case service.ErrRegistrationClosed:
+			redirectOAuthError(c, "registration_closed")
+		case service.ErrInvitationRequired:
+			redirectOAuthError(c, "invitation_required")
+		case service.ErrEmailDomainNotAllowed:
+			redirectOAuthError(c, "email_domain_not_allowed")
+		default:
+			redirectOAuthError(c, "provider_error")
+		}
+		return
+	}
+
+	h.setTokenCookie(c, token)
+	c.Redirect(http.StatusFound, redirect)
+}
+
+func redirectOAuthError(c *gin.Context, code string) {
+	c.Redirect(http.StatusFound, "/login?oauth_error="+code)
+}
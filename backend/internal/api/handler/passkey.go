@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lite-blog/backend/internal/api/middleware"
+	"github.com/lite-blog/backend/internal/service"
+	"github.com/lite-blog/backend/pkg/webauthn"
+)
+
+// FinishPasskeyRegistrationRequest represents the finish passkey registration request body
+type FinishPasskeyRegistrationRequest struct {
+	Name       string                         `json:"name" binding:"max=100"`
+	Credential *webauthn.RegistrationResponse `json:"credential" binding:"required"`
+}
+
+// RenamePasskeyRequest represents the rename passkey request body
+type RenamePasskeyRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// BeginPasskeyRegistration returns WebAuthn options for adding a passkey to the current user
+func (h *AuthHandler) BeginPasskeyRegistration(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	options, err := h.passkeyService.BeginRegistration(user.ID)
+	if err != nil {
+		respondPasskeyError(c, err, "Failed to start passkey registration")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"publicKey": options,
+	})
+}
+
+// FinishPasskeyRegistration verifies the new credential and stores it
+func (h *AuthHandler) FinishPasskeyRegistration(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	var req FinishPasskeyRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	passkey, err := h.passkeyService.FinishRegistration(c.Request.Context(), user.ID, req.Name, req.Credential)
+	if err != nil {
+		respondPasskeyError(c, err, "Failed to register passkey")
+		return
+	}
+
+	c.JSON(http.StatusCreated, passkey)
+}
+
+// BeginPasskeyLogin returns WebAuthn options for signing in with a passkey
+func (h *AuthHandler) BeginPasskeyLogin(c *gin.Context) {
+	options, err := h.passkeyService.BeginLogin()
+	if err != nil {
+		respondPasskeyError(c, err, "Failed to start passkey login")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"publicKey": options,
+	})
+}
+
+// FinishPasskeyLogin verifies a passkey assertion and sets the session cookie
+func (h *AuthHandler) FinishPasskeyLogin(c *gin.Context) {
+	var req webauthn.AssertionResponse
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	user, token, err := h.passkeyService.FinishLogin(c.Request.Context(), &req)
+	if err != nil {
+		switch err {
+		case service.ErrMFARequired:
+			h.setMFATokenCookie(c, token)
+			c.JSON(http.StatusOK, gin.H{
+				"message":      "Two-factor authentication required",
+				"mfa_required": true,
+			})
+		case service.ErrPasskeyInvalid:
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Passkey not recognized",
+				"code":  "INVALID_PASSKEY",
+			})
+		case service.ErrUserDisabled:
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Your account has been disabled",
+				"code":  "ACCOUNT_DISABLED",
+			})
+		default:
+			respondPasskeyError(c, err, "Login failed")
+		}
+		return
+	}
+
+	h.setTokenCookie(c, token)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Login successful",
+		"user":    buildUserResponse(user),
+	})
+}
+
+// ListPasskeys returns the current user's passkeys
+func (h *AuthHandler) ListPasskeys(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	passkeys, err := h.passkeyService.ListPasskeys(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch passkeys",
+			"code":  "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"passkeys": passkeys,
+	})
+}
+
+// RenamePasskey renames one of the current user's passkeys
+func (h *AuthHandler) RenamePasskey(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid passkey ID",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	var req RenamePasskeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	passkey, err := h.passkeyService.RenamePasskey(user.ID, uint(id), req.Name)
+	if err != nil {
+		respondPasskeyError(c, err, "Failed to rename passkey")
+		return
+	}
+
+	c.JSON(http.StatusOK, passkey)
+}
+
+// DeletePasskey removes one of the current user's passkeys
+func (h *AuthHandler) DeletePasskey(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid passkey ID",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	if err := h.passkeyService.DeletePasskey(user.ID, uint(id)); err != nil {
+		respondPasskeyError(c, err, "Failed to delete passkey")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Passkey removed",
+	})
+}
+
+// respondPasskeyError maps passkey errors to responses
+func respondPasskeyError(c *gin.Context, err error, message string) {
+	switch err {
+	case service.ErrPasskeysUnavailable:
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Passkeys require the site URL to use HTTPS",
+			"code":  "PASSKEYS_UNAVAILABLE",
+		})
+	case service.ErrPasskeyChallengeInvalid:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Passkey request expired, please try again",
+			"code":  "INVALID_CHALLENGE",
+		})
+	case service.ErrPasskeyInvalid:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Passkey verification failed",
+			"code":  "INVALID_PASSKEY",
+		})
+	case service.ErrPasskeyExists:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "This passkey is already registered",
+			"code":  "PASSKEY_EXISTS",
+		})
+	case service.ErrPasskeyNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Passkey not found",
+			"code":  "NOT_FOUND",
+		})
+	case service.ErrUserNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+			"code":  "NOT_FOUND",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": message,
+			"code":  "INTERNAL_ERROR",
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lite-blog/backend/internal/api/middleware"
+	"github.com/lite-blog/backend/internal/service"
+	"github.com/lite-blog/backend/pkg/password"
+)
+
+// PasswordPolicy returns the rules new passwords must follow, so forms can
+// check them before submitting
+func (h *AuthHandler) PasswordPolicy(c *gin.Context) {
+	policy := h.passwordPolicy.Policy()
+	c.JSON(http.StatusOK, gin.H{
+		"min_length":    policy.MinLength,
+		"max_bytes":     password.MaxBytes,
+		"min_classes":   policy.MinClasses,
+		"block_common":  policy.BlockCommon,
+		"history_count": h.passwordPolicy.HistoryCount(),
+	})
+}
+
+// ChangePassword sets a new password for the current user. Other sessions are
+// signed out; this one gets a fresh cookie.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	token, err := h.authService.ChangePassword(c.Request.Context(), user, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		if respondWeakPassword(c, err) {
+			return
+		}
+
+		switch err {
+		case service.ErrInvalidCredentials:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Current password is incorrect",
+				"code":  "INVALID_PASSWORD",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to change password",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	h.setTokenCookie(c, token)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password changed. You have been signed out everywhere else.",
+	})
+}
+
+// PasswordResetRequest represents the password reset request body
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest represents the reset password request body
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"` // Checked against the password policy
+}
+
+// RequestPasswordReset emails a link to set a new password. The response is
+// the same whether or not the email has an account.
+func (h *AuthHandler) RequestPasswordReset(c *gin.Context) {
+	var req PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	// Normalize email
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+
+	if err := h.passwordReset.Request(c.Request.Context(), req.Email, c.ClientIP()); err != nil {
+		switch err {
+		case service.ErrTooManyRequests:
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many reset links requested, please try again later",
+				"code":  "TOO_MANY_REQUESTS",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to send reset link",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "If this email has an account, a link to reset the password has been sent",
+	})
+}
+
+// ResetPassword sets a new password with an emailed reset link. All sessions
+// are signed out; the user signs in again with the new password.
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	if err := h.passwordReset.Reset(c.Request.Context(), req.Token, req.NewPassword); err != nil {
+		if respondWeakPassword(c, err) {
+			return
+		}
+
+		switch err {
+		case service.ErrInvalidToken:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid or expired reset link",
+				"code":  "INVALID_TOKEN",
+			})
+		case service.ErrUserDisabled:
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Your account has been disabled",
+				"code":  "ACCOUNT_DISABLED",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to reset password",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password reset. You have been signed out everywhere; sign in with your new password.",
+	})
+}
+
+// respondWeakPassword responds with the policy violations of a rejected
+// password. It returns false for other errors.
+func respondWeakPassword(c *gin.Context, err error) bool {
+	var weak *service.PasswordPolicyError
+	if !errors.As(err, &weak) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":      "Password does not meet the requirements",
+		"code":       "WEAK_PASSWORD",
+		"violations": weak.Violations,
+	})
+	return true
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -10,10 +11,11 @@ import (
 
 type SettingHandler struct {
 	settingService *service.SettingService
+	auditService   *service.AuditService
 }
 
-func NewSettingHandler(settingService *service.SettingService) *SettingHandler {
-	return &SettingHandler{settingService: settingService}
+func NewSettingHandler(settingService *service.SettingService, auditService *service.AuditService) *SettingHandler {
+	return &SettingHandler{settingService: settingService, auditService: auditService}
 }
 
 // GetSiteSettings returns public site settings
@@ -41,6 +43,7 @@ func (h *SettingHandler) UpdateSiteSettings(c *gin.Context) {
 		return
 	}
 
+	before, _ := h.settingService.GetSiteSettings()
 	if err := h.settingService.UpdateSiteSettings(&req); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to update site settings",
@@ -59,5 +62,76 @@ func (h *SettingHandler) UpdateSiteSettings(c *gin.Context) {
 		return
 	}
 
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditSiteSettingsUpdate, model.AuditTargetSettings, "site", before, settings)
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// GetSecuritySettings returns the security policy settings (admin only)
+func (h *SettingHandler) GetSecuritySettings(c *gin.Context) {
+	settings, err := h.settingService.GetSecuritySettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch security settings",
+			"code":  "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSecuritySettings updates the security policy settings (admin only).
+// Fields left out of the request keep their stored values.
+func (h *SettingHandler) UpdateSecuritySettings(c *gin.Context) {
+	req, err := h.settingService.GetSecuritySettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch security settings",
+			"code":  "INTERNAL_ERROR",
+		})
+		return
+	}
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	before, _ := h.settingService.GetSecuritySettings()
+	if err := h.settingService.UpdateSecuritySettings(req); err != nil {
+		switch err {
+		case service.ErrInvalidChallengeDifficulty:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Challenge difficulty must be between %d and %d", model.MinChallengeDifficulty, model.MaxChallengeDifficulty),
+				"code":  "INVALID_REQUEST",
+			})
+		case service.ErrInvalidRegistrationMode:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Registration mode must be open, closed, invite or domain",
+				"code":  "INVALID_REQUEST",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to update security settings",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	settings, err := h.settingService.GetSecuritySettings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Settings updated but failed to fetch",
+			"code":  "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditSecuritySettingsUpdate, model.AuditTargetSettings, "security", before, settings)
+
 	c.JSON(http.StatusOK, settings)
 }
@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lite-blog/backend/internal/api/middleware"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/service"
+)
+
+type SubscriptionHandler struct {
+	newsletterService *service.NewsletterService
+}
+
+func NewSubscriptionHandler(newsletterService *service.NewsletterService) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		newsletterService: newsletterService,
+	}
+}
+
+// SubscribeRequest represents the subscribe request body.
+// Email may be omitted by logged-in users to subscribe their account email.
+type SubscribeRequest struct {
+	Email     string `json:"email" binding:"omitempty,email"`
+	Frequency string `json:"frequency" binding:"omitempty,oneof=instant daily weekly"`
+	Language  string `json:"language"`
+}
+
+// Subscribe subscribes an email address to new posts
+func (h *SubscriptionHandler) Subscribe(c *gin.Context) {
+	var req SubscribeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	user := middleware.GetUserFromContext(c)
+	if req.Email == "" && user == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Email is required",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	language := req.Language
+	if language == "" {
+		language = c.GetHeader("Accept-Language")
+	}
+
+	err := h.newsletterService.Subscribe(c.Request.Context(), req.Email, model.SubscriptionFrequency(req.Frequency), language, user)
+	if err != nil {
+		if err == service.ErrInvalidFrequency {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid subscription frequency",
+				"code":  "INVALID_REQUEST",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to subscribe",
+			"code":  "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Subscription received. If confirmation is required, please check your inbox.",
+	})
+}
+
+// Confirm activates a subscription from the link in the confirmation email
+func (h *SubscriptionHandler) Confirm(c *gin.Context) {
+	lang := pageLanguage(c)
+
+	err := h.newsletterService.Confirm(c.Query("token"))
+	switch err {
+	case nil:
+		renderSubscriptionPage(c, http.StatusOK, lang, "confirmed", "")
+	case service.ErrSubscriptionTokenExpired:
+		renderSubscriptionPage(c, http.StatusBadRequest, lang, "expired", "")
+	case service.ErrInvalidSubscriptionToken:
+		renderSubscriptionPage(c, http.StatusBadRequest, lang, "invalid", "")
+	default:
+		renderSubscriptionPage(c, http.StatusInternalServerError, lang, "error", "")
+	}
+}
+
+// UnsubscribePage shows a confirmation button. Unsubscribing only happens on POST
+// so link scanners that prefetch URLs in emails can't unsubscribe people.
+func (h *SubscriptionHandler) UnsubscribePage(c *gin.Context) {
+	renderSubscriptionPage(c, http.StatusOK, pageLanguage(c), "unsubscribe", c.Query("token"))
+}
+
+// Unsubscribe opts a subscriber out. It serves both the button on the unsubscribe
+// page and RFC 8058 one-click requests sent by mail clients.
+func (h *SubscriptionHandler) Unsubscribe(c *gin.Context) {
+	lang := pageLanguage(c)
+
+	token := c.Query("token")
+	if token == "" {
+		token = c.PostForm("token")
+	}
+
+	err := h.newsletterService.Unsubscribe(token)
+	switch err {
+	case nil:
+		renderSubscriptionPage(c, http.StatusOK, lang, "unsubscribed", "")
+	case service.ErrInvalidSubscriptionToken:
+		renderSubscriptionPage(c, http.StatusBadRequest, lang, "invalid", "")
+	default:
+		renderSubscriptionPage(c, http.StatusInternalServerError, lang, "error", "")
+	}
+}
+
+// AdminSubscriptionHandler handles admin management of newsletter subscribers
+type AdminSubscriptionHandler struct {
+	newsletterService *service.NewsletterService
+}
+
+func NewAdminSubscriptionHandler(newsletterService *service.NewsletterService) *AdminSubscriptionHandler {
+	return &AdminSubscriptionHandler{
+		newsletterService: newsletterService,
+	}
+}
+
+// ListSubscribersRequest represents the list subscribers request
+type ListSubscribersRequest struct {
+	Status   string `form:"status" binding:"omitempty,oneof=pending active unsubscribed"`
+	Page     int    `form:"page,default=1"`
+	PageSize int    `form:"page_size,default=20"`
+}
+
+// SubscriberListResponse represents the paginated subscriber list response
+type SubscriberListResponse struct {
+	Subscribers []model.Subscriber `json:"subscribers"`
+	Total       int64              `json:"total"`
+	Page        int                `json:"page"`
+	PageSize    int                `json:"page_size"`
+	TotalPages  int                `json:"total_pages"`
+}
+
+// List returns a paginated list of subscribers, e.g. ?status=active
+func (h *AdminSubscriptionHandler) List(c *gin.Context) {
+	var req ListSubscribersRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid query parameters",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.PageSize < 1 || req.PageSize > 100 {
+		req.PageSize = 20
+	}
+
+	subscribers, total, err := h.newsletterService.ListSubscribers(req.Status, req.Page, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to fetch subscribers",
+			"code":  "INTERNAL_ERROR",
+		})
+		return
+	}
+
+	totalPages := int(total) / req.PageSize
+	if int(total)%req.PageSize > 0 {
+		totalPages++
+	}
+
+	c.JSON(http.StatusOK, SubscriberListResponse{
+		Subscribers: subscribers,
+		Total:       total,
+		Page:        req.Page,
+		PageSize:    req.PageSize,
+		TotalPages:  totalPages,
+	})
+}
+
+// subscriptionPageText holds the localized text of the subscription landing pages
+var subscriptionPageText = map[string]map[string][2]string{
+	"zh": {
+		"confirmed":    {"订阅成功", "您已成功订阅，新文章发布时我们会通知您。"},
+		"expired":      {"链接已过期", "确认链接已过期，请重新订阅。"},
+		"invalid":      {"链接无效", "此链接无效或已被使用。"},
+		"error":        {"出错了", "处理您的请求时出错，请稍后重试。"},
+		"unsubscribe":  {"退订", "确定不再接收新文章邮件吗？"},
+		"unsubscribed": {"已退订", "您已退订，将不会再收到新文章邮件。"},
+		"button":       {"确认退订"},
+	},
+	"en": {
+		"confirmed":    {"Subscription confirmed", "You're subscribed. We'll email you when new posts are published."},
+		"expired":      {"Link expired", "This confirmation link has expired. Please subscribe again."},
+		"invalid":      {"Invalid link", "This link is invalid or has already been used."},
+		"error":        {"Something went wrong", "We couldn't process your request. Please try again later."},
+		"unsubscribe":  {"Unsubscribe", "Stop receiving emails about new posts?"},
+		"unsubscribed": {"Unsubscribed", "You've been unsubscribed and won't receive new post emails anymore."},
+		"button":       {"Unsubscribe"},
+	},
+}
+
+var subscriptionPage = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Title}}</title>
+</head>
+<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; background: #f8fafc; color: #1a1a2e; margin: 0; padding: 80px 20px; text-align: center;">
+    <div style="max-width: 420px; margin: 0 auto; background: #ffffff; border-radius: 16px; padding: 40px; box-shadow: 0 10px 30px rgba(0,0,0,0.08);">
+        <h1 style="font-size: 22px; margin: 0 0 12px;">{{.Title}}</h1>
+        <p style="color: #475569; margin: 0;">{{.Message}}</p>
+        {{if .Token}}
+        <form method="POST" action="?token={{.Token}}" style="margin-top: 28px;">
+            <button type="submit" style="background: #667eea; color: #ffffff; border: 0; border-radius: 10px; padding: 12px 32px; font-size: 15px; cursor: pointer;">{{.Button}}</button>
+        </form>
+        {{end}}
+    </div>
+</body>
+</html>
+`))
+
+// renderSubscriptionPage renders a small standalone page, since these links are opened from emails
+func renderSubscriptionPage(c *gin.Context, status int, lang, key, token string) {
+	text := subscriptionPageText[lang]
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	subscriptionPage.Execute(c.Writer, gin.H{
+		"Lang":    lang,
+		"Title":   text[key][0],
+		"Message": text[key][1],
+		"Token":   token,
+		"Button":  text["button"][0],
+	})
+}
+
+func pageLanguage(c *gin.Context) string {
+	if lang := service.NormalizeLanguage(c.GetHeader("Accept-Language")); lang != "" {
+		return lang
+	}
+	return service.DefaultLanguage
+}
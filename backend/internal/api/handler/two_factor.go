@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lite-blog/backend/internal/api/middleware"
+	"github.com/lite-blog/backend/internal/service"
+)
+
+// TwoFactorCodeRequest carries a TOTP code or a recovery code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// DisableTwoFactorRequest represents the disable two-factor request body
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// LoginTwoFactor completes a login for users with two-factor authentication
+func (h *AuthHandler) LoginTwoFactor(c *gin.Context) {
+	mfaToken, err := c.Cookie(middleware.CookieNameMFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Two-factor login expired, please sign in again",
+			"code":  "INVALID_TOKEN",
+		})
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	user, token, err := h.twoFactorService.CompleteLogin(mfaToken, req.Code)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidToken, service.ErrMFANotEnabled:
+			h.clearMFATokenCookie(c)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Two-factor login expired, please sign in again",
+				"code":  "INVALID_TOKEN",
+			})
+		case service.ErrUserDisabled:
+			h.clearMFATokenCookie(c)
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Your account has been disabled",
+				"code":  "ACCOUNT_DISABLED",
+			})
+		default:
+			respondTwoFactorError(c, err, "Login failed")
+		}
+		return
+	}
+
+	h.clearMFATokenCookie(c)
+	h.setTokenCookie(c, token)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Login successful",
+		"user":    buildUserResponse(user),
+	})
+}
+
+// TwoFactorStatus returns the current user's two-factor authentication state
+func (h *AuthHandler) TwoFactorStatus(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.twoFactorService.Status(user))
+}
+
+// SetupTwoFactor starts enrolling an authenticator app
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	setup, err := h.twoFactorService.Setup(user.ID)
+	if err != nil {
+		respondTwoFactorError(c, err, "Failed to set up two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+// EnableTwoFactor confirms enrollment and returns the recovery codes
+func (h *AuthHandler) EnableTwoFactor(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	codes, err := h.twoFactorService.Enable(user.ID, req.Code)
+	if err != nil {
+		respondTwoFactorError(c, err, "Failed to enable two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns off two-factor authentication
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	if err := h.twoFactorService.Disable(user.ID, req.Password, req.Code); err != nil {
+		respondTwoFactorError(c, err, "Failed to disable two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Not authenticated",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	codes, err := h.twoFactorService.RegenerateRecoveryCodes(user.ID, req.Code)
+	if err != nil {
+		respondTwoFactorError(c, err, "Failed to regenerate recovery codes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// respondTwoFactorError maps two-factor errors to responses
+func respondTwoFactorError(c *gin.Context, err error, message string) {
+	switch err {
+	case service.ErrInvalidMFACode:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid authentication code",
+			"code":  "INVALID_MFA_CODE",
+		})
+	case service.ErrInvalidCredentials:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Incorrect password",
+			"code":  "INVALID_CREDENTIALS",
+		})
+	case service.ErrTooManyRequests:
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": "Too many failed attempts, please try again later",
+			"code":  "TOO_MANY_REQUESTS",
+		})
+	case service.ErrMFAAlreadyEnabled:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Two-factor authentication is already enabled",
+			"code":  "MFA_ALREADY_ENABLED",
+		})
+	case service.ErrMFANotEnabled:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Two-factor authentication is not enabled",
+			"code":  "MFA_NOT_ENABLED",
+		})
+	case service.ErrMFASetupRequired:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Start two-factor setup first",
+			"code":  "MFA_SETUP_REQUIRED",
+		})
+	case service.ErrMFARequiredByPolicy:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Two-factor authentication is required for administrators",
+			"code":  "MFA_REQUIRED_BY_POLICY",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": message,
+			"code":  "INTERNAL_ERROR",
+		})
+	}
+}
+
+// setMFATokenCookie stores the pending two-factor login in a short-lived HttpOnly cookie
+func (h *AuthHandler) setMFATokenCookie(c *gin.Context, token string) {
+	c.SetCookie(
+		middleware.CookieNameMFAToken,
+		token,
+		int(service.MFATokenTTL.Seconds()),
+		"/api/auth",
+		"",
+		isSecureRequest(c),
+		true,
+	)
+}
+
+// clearMFATokenCookie clears the pending two-factor login cookie
+func (h *AuthHandler) clearMFATokenCookie(c *gin.Context) {
+	c.SetCookie(middleware.CookieNameMFAToken, "", -1, "/api/auth", "", isSecureRequest(c), true)
+}
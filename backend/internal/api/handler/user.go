@@ -3,28 +3,69 @@ package handler
 import (
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lite-blog/backend/internal/api/middleware"
 	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
 	"github.com/lite-blog/backend/internal/service"
 )
 
 type AdminUserHandler struct {
-	userService *service.UserService
+	userService  *service.UserService
+	auditService *service.AuditService
 }
 
-func NewAdminUserHandler(userService *service.UserService) *AdminUserHandler {
+func NewAdminUserHandler(userService *service.UserService, auditService *service.AuditService) *AdminUserHandler {
 	return &AdminUserHandler{
-		userService: userService,
+		userService:  userService,
+		auditService: auditService,
 	}
 }
 
-// ListUsersRequest represents the list users request
+// ListUsersRequest represents the list users request. Order is "asc" or
+// "desc"; the list is newest first by default.
 type ListUsersRequest struct {
-	Page     int `form:"page,default=1"`
-	PageSize int `form:"page_size,default=10"`
+	Page          int    `form:"page,default=1"`
+	PageSize      int    `form:"page_size,default=10"`
+	Search        string `form:"q" binding:"max=255"`
+	Role          string `form:"role"`
+	Status        *int   `form:"status" binding:"omitempty,oneof=0 1"`
+	EmailVerified *bool  `form:"email_verified"`
+	Membership    string `form:"membership" binding:"omitempty,oneof=active expired none"`
+	Sort          string `form:"sort" binding:"omitempty,oneof=created_at email member_expire_at id"`
+	Order         string `form:"order" binding:"omitempty,oneof=asc desc"`
+}
+
+func (r *ListUsersRequest) filter() repository.UserFilter {
+	return repository.UserFilter{
+		Search:        strings.TrimSpace(r.Search),
+		Role:          r.Role,
+		Status:        r.Status,
+		EmailVerified: r.EmailVerified,
+		Membership:    r.Membership,
+		Sort:          r.Sort,
+		Ascending:     r.Order == "asc",
+	}
+}
+
+// BulkUserRequest represents a bulk user action. RoleCode is needed to assign
+// a role and Days to extend memberships.
+type BulkUserRequest struct {
+	Action   string `json:"action" binding:"required,oneof=disable assign_role extend_membership"`
+	UserIDs  []uint `json:"user_ids" binding:"required,min=1,max=100,dive,min=1"`
+	RoleCode string `json:"role_code"`
+	Days     int    `json:"days" binding:"omitempty,min=1,max=3650"`
+}
+
+// BulkUserResultResponse is the outcome of a bulk action for one user
+type BulkUserResultResponse struct {
+	UserID uint   `json:"user_id"`
+	OK     bool   `json:"ok"`
+	Code   string `json:"code,omitempty"`
+	Error  string `json:"error,omitempty"`
 }
 
 // UserListResponse represents the paginated user list response
@@ -70,7 +111,7 @@ func (h *AdminUserHandler) List(c *gin.Context) {
 		req.PageSize = 10
 	}
 
-	users, total, err := h.userService.ListUsers(req.Page, req.PageSize)
+	users, total, err := h.userService.ListUsers(req.filter(), req.Page, req.PageSize)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to fetch users",
@@ -93,6 +134,112 @@ func (h *AdminUserHandler) List(c *gin.Context) {
 	})
 }
 
+// Bulk applies one action to many users in a single transaction and reports
+// the result for each user
+func (h *AdminUserHandler) Bulk(c *gin.Context) {
+	var req BulkUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	currentUser := middleware.GetUserFromContext(c)
+	if currentUser == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Authentication required",
+			"code":  "AUTH_REQUIRED",
+		})
+		return
+	}
+
+	// Assigning roles needs the same permission as it does for one user
+	auditAction := model.AuditUserStatus
+	switch req.Action {
+	case service.BulkActionAssignRole:
+		if !currentUser.HasPermission(model.PermissionRoleManage) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Insufficient permissions",
+				"code":  "FORBIDDEN",
+			})
+			return
+		}
+		auditAction = model.AuditUserRoleAssign
+	case service.BulkActionExtendMembership:
+		auditAction = model.AuditUserMembership
+	}
+
+	// Each user is changed once, however often they are listed
+	ids := make([]uint, 0, len(req.UserIDs))
+	seen := make(map[uint]bool, len(req.UserIDs))
+	before := make(map[uint]*service.UserDetail, len(req.UserIDs))
+	for _, id := range req.UserIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+		before[id], _ = h.userService.GetUserByID(id)
+	}
+
+	results, err := h.userService.BulkUpdate(ids, service.BulkUserAction{
+		Action:   req.Action,
+		RoleCode: req.RoleCode,
+		Days:     req.Days,
+	}, currentUser.ID)
+	if err != nil {
+		switch err {
+		case service.ErrRoleNotFound:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Role not found",
+				"code":  "ROLE_NOT_FOUND",
+			})
+		case service.ErrInvalidBulkAction:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid bulk action",
+				"code":  "INVALID_REQUEST",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to update users",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	actor := auditActor(c)
+	succeeded := 0
+	items := make([]BulkUserResultResponse, len(results))
+	for i, result := range results {
+		items[i] = BulkUserResultResponse{UserID: result.UserID, OK: result.Err == nil}
+		switch result.Err {
+		case nil:
+			succeeded++
+			targetID := strconv.FormatUint(uint64(result.UserID), 10)
+			after, _ := h.userService.GetUserByID(result.UserID)
+			h.auditService.Record(c.Request.Context(), actor, auditAction, model.AuditTargetUser, targetID, before[result.UserID], after)
+		case service.ErrUserNotFound:
+			items[i].Code = "NOT_FOUND"
+			items[i].Error = "User not found"
+		case service.ErrCannotDisableSelf:
+			items[i].Code = "FORBIDDEN"
+			items[i].Error = "Cannot disable your own account"
+		default:
+			items[i].Code = "INTERNAL_ERROR"
+			items[i].Error = result.Err.Error()
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results":   items,
+		"succeeded": succeeded,
+		"failed":    len(items) - succeeded,
+	})
+}
+
 // GetByID returns a user by ID
 func (h *AdminUserHandler) GetByID(c *gin.Context) {
 	idStr := c.Param("id")
@@ -155,6 +302,7 @@ func (h *AdminUserHandler) UpdateStatus(c *gin.Context) {
 		return
 	}
 
+	before, _ := h.userService.GetUserByID(uint(id))
 	err = h.userService.UpdateUserStatus(uint(id), req.Status, currentUser.ID)
 	if err != nil {
 		switch err {
@@ -182,6 +330,9 @@ func (h *AdminUserHandler) UpdateStatus(c *gin.Context) {
 		statusText = "disabled"
 	}
 
+	after, _ := h.userService.GetUserByID(uint(id))
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditUserStatus, model.AuditTargetUser, idStr, before, after)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "User " + statusText + " successfully",
 	})
@@ -208,6 +359,7 @@ func (h *AdminUserHandler) UpdateMembership(c *gin.Context) {
 		return
 	}
 
+	before, _ := h.userService.GetUserByID(uint(id))
 	err = h.userService.UpdateMembership(uint(id), req.ExpireAt)
 	if err != nil {
 		if err == service.ErrUserNotFound {
@@ -224,6 +376,9 @@ func (h *AdminUserHandler) UpdateMembership(c *gin.Context) {
 		return
 	}
 
+	after, _ := h.userService.GetUserByID(uint(id))
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditUserMembership, model.AuditTargetUser, idStr, before, after)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Membership updated successfully",
 	})
@@ -250,6 +405,7 @@ func (h *AdminUserHandler) AssignRole(c *gin.Context) {
 		return
 	}
 
+	before, _ := h.userService.GetUserByID(uint(id))
 	err = h.userService.AssignRole(uint(id), req.RoleCode)
 	if err != nil {
 		switch err {
@@ -272,6 +428,9 @@ func (h *AdminUserHandler) AssignRole(c *gin.Context) {
 		return
 	}
 
+	after, _ := h.userService.GetUserByID(uint(id))
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditUserRoleAssign, model.AuditTargetUser, idStr, before, after)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Role assigned successfully",
 	})
@@ -308,6 +467,7 @@ func (h *AdminUserHandler) RemoveRole(c *gin.Context) {
 		return
 	}
 
+	before, _ := h.userService.GetUserByID(uint(id))
 	err = h.userService.RemoveRole(uint(id), req.RoleCode, currentUser.ID)
 	if err != nil {
 		switch err {
@@ -335,11 +495,52 @@ func (h *AdminUserHandler) RemoveRole(c *gin.Context) {
 		return
 	}
 
+	after, _ := h.userService.GetUserByID(uint(id))
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditUserRoleRemove, model.AuditTargetUser, idStr, before, after)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Role removed successfully",
 	})
 }
 
+// Unlock lifts a user's sign-in lockout
+func (h *AdminUserHandler) Unlock(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	before, _ := h.userService.GetUserByID(uint(id))
+	err = h.userService.UnlockUser(uint(id))
+	if err != nil {
+		switch err {
+		case service.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "User not found",
+				"code":  "NOT_FOUND",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to unlock user",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	after, _ := h.userService.GetUserByID(uint(id))
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditUserUnlock, model.AuditTargetUser, idStr, before, after)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User unlocked successfully",
+	})
+}
+
 // Delete deletes a user
 func (h *AdminUserHandler) Delete(c *gin.Context) {
 	idStr := c.Param("id")
@@ -362,7 +563,8 @@ func (h *AdminUserHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	err = h.userService.DeleteUser(uint(id), currentUser.ID)
+	before, _ := h.userService.GetUserByID(uint(id))
+	err = h.userService.DeleteUser(c.Request.Context(), uint(id), currentUser.ID)
 	if err != nil {
 		switch err {
 		case service.ErrUserNotFound:
@@ -384,6 +586,8 @@ func (h *AdminUserHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditUserDelete, model.AuditTargetUser, idStr, before, nil)
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "User deleted successfully",
 	})
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/service"
+)
+
+// userImportMaxBytes is the largest CSV file a user import accepts
+const userImportMaxBytes = 64 << 20
+
+// ImportUsersRequest represents the user import options
+type ImportUsersRequest struct {
+	DryRun bool `form:"dry_run"`
+}
+
+// Import creates or updates users from a CSV file, sent as the request body
+// or as the "file" field of a multipart form. With ?dry_run=true the file is
+// only validated.
+func (h *AdminUserHandler) Import(c *gin.Context) {
+	var req ImportUsersRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid query parameters",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, userImportMaxBytes)
+	file, err := importFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing CSV file",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	report, err := h.userService.ImportUsersCSV(file, req.DryRun)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case err == service.ErrInvalidImportFile:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "The file needs a header row with an email column",
+				"code":  "INVALID_FILE",
+			})
+		case errors.As(err, &tooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("The file is larger than %d MB", userImportMaxBytes>>20),
+				"code":  "FILE_TOO_LARGE",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to import users",
+				"code":  "INTERNAL_ERROR",
+			})
+		}
+		return
+	}
+
+	if !report.DryRun {
+		h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditUserImport, model.AuditTargetUser, "", nil, gin.H{
+			"rows":    report.Rows,
+			"created": report.Created,
+			"updated": report.Updated,
+			"failed":  report.Failed,
+		})
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// importFile returns the uploaded CSV without reading it into memory
+func importFile(c *gin.Context) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return c.Request.Body, nil
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+	}
+}
+
+// Export downloads the users matching the list filters and their membership
+// state as CSV
+func (h *AdminUserHandler) Export(c *gin.Context) {
+	var req ListUsersRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid query parameters",
+			"code":  "INVALID_REQUEST",
+		})
+		return
+	}
+
+	h.auditService.Record(c.Request.Context(), auditActor(c), model.AuditUserExport, model.AuditTargetUser, "", nil, gin.H{
+		"filters": c.Request.URL.RawQuery,
+	})
+
+	filename := fmt.Sprintf("users-%s.csv", time.Now().UTC().Format("20060102"))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := h.userService.WriteUsersCSV(c.Writer, req.filter()); err != nil {
+		// Headers are already sent, so the download just ends early
+		slog.ErrorContext(c.Request.Context(), "Failed to write user export", "error", err)
+	}
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lite-blog/backend/internal/model"
@@ -14,13 +15,76 @@ const (
 	ContextKeyUser = "user"
 	// ContextKeyClaims is the key for storing JWT claims in context
 	ContextKeyClaims = "claims"
+	// ContextKeyAccessToken is the key for storing the personal access token a request used
+	ContextKeyAccessToken = "access_token"
+	// ContextKeyImpersonator is the key for storing the admin impersonating the user
+	ContextKeyImpersonator = "impersonator"
 	// CookieNameToken is the name of the JWT cookie
 	CookieNameToken = "token"
+	// CookieNameMFAToken is the name of the cookie holding a pending two-factor login
+	CookieNameMFAToken = "mfa_token"
+	// CookieNameOAuthState is the name of the cookie holding an in-progress provider sign-in
+	CookieNameOAuthState = "oauth_state"
+	// CookieNameImpersonatorToken is the name of the cookie holding an admin's
+	// own session while they impersonate a user
+	CookieNameImpersonatorToken = "impersonator_token"
 )
 
-// AuthMiddleware creates a middleware that validates JWT tokens
-func AuthMiddleware(jwtSecret string, userRepo *repository.UserRepository) gin.HandlerFunc {
+// AccessTokenAuthenticator authenticates personal access tokens
+type AccessTokenAuthenticator interface {
+	Authenticate(token string) (*model.User, *model.AccessToken, error)
+}
+
+// SessionRefresher re-issues the session cookie of a user whose roles changed
+// after the session's token was issued
+type SessionRefresher interface {
+	RefreshSession(c *gin.Context, user *model.User, claims *jwt.Claims)
+}
+
+// AuthMiddleware creates a middleware that validates JWT tokens. Personal access
+// tokens sent as "Authorization: Bearer" are accepted too, but only on routes
+// that pass the scopes a token needs; routes without scopes are for browser
+// sessions only.
+func AuthMiddleware(keys *jwt.KeySet, userRepo *repository.UserRepository, tokenAuth AccessTokenAuthenticator, refresher SessionRefresher, scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if bearer := bearerToken(c); bearer != "" {
+			user, token, err := tokenAuth.Authenticate(bearer)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"error": "Invalid or expired token",
+					"code":  "INVALID_TOKEN",
+				})
+				return
+			}
+
+			if len(scopes) == 0 {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error": "Access tokens can't be used for this endpoint",
+					"code":  "ACCESS_TOKEN_NOT_ALLOWED",
+				})
+				return
+			}
+			if !hasScopes(token, scopes) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error": "Access token is missing the " + strings.Join(scopes, ", ") + " scope",
+					"code":  "INSUFFICIENT_SCOPE",
+				})
+				return
+			}
+
+			if user.Status == model.UserStatusDisabled {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error": "Account is disabled",
+					"code":  "ACCOUNT_DISABLED",
+				})
+				return
+			}
+
+			setAccessTokenUser(c, user, token)
+			c.Next()
+			return
+		}
+
 		// Get token from cookie
 		tokenString, err := c.Cookie(CookieNameToken)
 		if err != nil {
@@ -32,8 +96,9 @@ func AuthMiddleware(jwtSecret string, userRepo *repository.UserRepository) gin.H
 		}
 
 		// Validate token
-		claims, err := jwt.ValidateToken(tokenString, jwtSecret)
-		if err != nil {
+		// Restricted tokens (e.g. a pending two-factor login) are not sessions
+		claims, err := jwt.ValidateToken(tokenString, keys)
+		if err != nil || claims.Purpose != "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "Invalid or expired token",
 				"code":  "INVALID_TOKEN",
@@ -42,7 +107,7 @@ func AuthMiddleware(jwtSecret string, userRepo *repository.UserRepository) gin.H
 		}
 
 		// Load user from database
-		user, err := userRepo.FindByID(claims.UserID)
+		user, err := userRepo.FindSessionUser(claims.UserID)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "User not found",
@@ -51,6 +116,15 @@ func AuthMiddleware(jwtSecret string, userRepo *repository.UserRepository) gin.H
 			return
 		}
 
+		// Changing the password revokes sessions issued before it
+		if claims.SessionVersion != user.SessionVersion {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Session has been revoked",
+				"code":  "SESSION_REVOKED",
+			})
+			return
+		}
+
 		// Check if user is disabled
 		if user.Status == model.UserStatusDisabled {
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
@@ -60,18 +134,63 @@ func AuthMiddleware(jwtSecret string, userRepo *repository.UserRepository) gin.H
 			return
 		}
 
+		// Impersonated sessions end when the admin loses access and can't
+		// change anything
+		var impersonator *model.User
+		if claims.ImpersonatorID != 0 {
+			impersonator = findImpersonator(userRepo, claims)
+			if impersonator == nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"error": "Session has been revoked",
+					"code":  "SESSION_REVOKED",
+				})
+				return
+			}
+			if !isReadOnlyMethod(c.Request.Method) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error": "Impersonated sessions are read-only",
+					"code":  "IMPERSONATION_READ_ONLY",
+				})
+				return
+			}
+		}
+
+		// Roles are checked against the database, so a removed role stops
+		// working at once. A session issued before the change gets a fresh
+		// cookie with the current roles.
+		if claims.RolesVersion != user.RolesVersion {
+			refresher.RefreshSession(c, user, claims)
+		}
+
+		// The session may predate an email or role change
+		claims.Email = user.Email
+		claims.Roles = user.GetRoleCodes()
+
 		// Store user and claims in context
 		c.Set(ContextKeyUser, user)
 		c.Set(ContextKeyClaims, claims)
+		if impersonator != nil {
+			c.Set(ContextKeyImpersonator, impersonator)
+		}
 
 		c.Next()
 	}
 }
 
 // OptionalAuthMiddleware creates a middleware that optionally validates JWT tokens
-// It doesn't abort if no token is present, but will set user if token is valid
-func OptionalAuthMiddleware(jwtSecret string, userRepo *repository.UserRepository) gin.HandlerFunc {
+// It doesn't abort if no token is present, but will set user if token is valid.
+// Like AuthMiddleware, it only accepts access tokens with the given scopes.
+func OptionalAuthMiddleware(keys *jwt.KeySet, userRepo *repository.UserRepository, tokenAuth AccessTokenAuthenticator, refresher SessionRefresher, scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if bearer := bearerToken(c); bearer != "" {
+			user, token, err := tokenAuth.Authenticate(bearer)
+			if err == nil && len(scopes) > 0 && hasScopes(token, scopes) && user.Status != model.UserStatusDisabled {
+				setAccessTokenUser(c, user, token)
+			}
+			c.Next()
+			return
+		}
+
 		// Get token from cookie (don't fail if not present)
 		tokenString, err := c.Cookie(CookieNameToken)
 		if err != nil {
@@ -80,15 +199,15 @@ func OptionalAuthMiddleware(jwtSecret string, userRepo *repository.UserRepositor
 		}
 
 		// Validate token
-		claims, err := jwt.ValidateToken(tokenString, jwtSecret)
-		if err != nil {
+		claims, err := jwt.ValidateToken(tokenString, keys)
+		if err != nil || claims.Purpose != "" {
 			c.Next()
 			return
 		}
 
-		// Load user from database
-		user, err := userRepo.FindByID(claims.UserID)
-		if err != nil {
+		// Load user from database, ignoring revoked sessions
+		user, err := userRepo.FindSessionUser(claims.UserID)
+		if err != nil || claims.SessionVersion != user.SessionVersion {
 			c.Next()
 			return
 		}
@@ -99,14 +218,94 @@ func OptionalAuthMiddleware(jwtSecret string, userRepo *repository.UserRepositor
 			return
 		}
 
+		var impersonator *model.User
+		if claims.ImpersonatorID != 0 {
+			impersonator = findImpersonator(userRepo, claims)
+			if impersonator == nil {
+				c.Next()
+				return
+			}
+			if !isReadOnlyMethod(c.Request.Method) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error": "Impersonated sessions are read-only",
+					"code":  "IMPERSONATION_READ_ONLY",
+				})
+				return
+			}
+		}
+
+		// Roles are checked against the database, so a removed role stops
+		// working at once. A session issued before the change gets a fresh
+		// cookie with the current roles.
+		if claims.RolesVersion != user.RolesVersion {
+			refresher.RefreshSession(c, user, claims)
+		}
+
+		// The session may predate an email or role change
+		claims.Email = user.Email
+		claims.Roles = user.GetRoleCodes()
+
 		// Store user and claims in context
 		c.Set(ContextKeyUser, user)
 		c.Set(ContextKeyClaims, claims)
+		if impersonator != nil {
+			c.Set(ContextKeyImpersonator, impersonator)
+		}
 
 		c.Next()
 	}
 }
 
+// bearerToken returns the token from an "Authorization: Bearer" header
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
+
+// findImpersonator loads the admin holding an impersonated session. It returns
+// nil once they are disabled or may no longer manage users.
+func findImpersonator(userRepo *repository.UserRepository, claims *jwt.Claims) *model.User {
+	impersonator, err := userRepo.FindSessionUser(claims.ImpersonatorID)
+	if err != nil || impersonator.Status == model.UserStatusDisabled {
+		return nil
+	}
+	if !impersonator.IsAdmin() || !impersonator.HasPermission(model.PermissionUserManage) {
+		return nil
+	}
+	return impersonator
+}
+
+// isReadOnlyMethod checks if a request method can't change anything
+func isReadOnlyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// hasScopes checks if an access token was granted all the scopes
+func hasScopes(token *model.AccessToken, scopes []string) bool {
+	for _, scope := range scopes {
+		if !token.HasScope(scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// setAccessTokenUser stores the user of an access token request in the context.
+// Claims are built from the user's current roles, so role checks work as they
+// do for sessions.
+func setAccessTokenUser(c *gin.Context, user *model.User, token *model.AccessToken) {
+	c.Set(ContextKeyUser, user)
+	c.Set(ContextKeyClaims, &jwt.Claims{
+		UserID: user.ID,
+		Email:  user.Email,
+		Roles:  user.GetRoleCodes(),
+	})
+	c.Set(ContextKeyAccessToken, token)
+}
+
 // GetUserFromContext retrieves the user from the context
 func GetUserFromContext(c *gin.Context) *model.User {
 	if user, exists := c.Get(ContextKeyUser); exists {
@@ -126,3 +325,25 @@ func GetClaimsFromContext(c *gin.Context) *jwt.Claims {
 	}
 	return nil
 }
+
+// GetAccessTokenFromContext retrieves the access token the request was
+// authenticated with, or nil for session requests
+func GetAccessTokenFromContext(c *gin.Context) *model.AccessToken {
+	if token, exists := c.Get(ContextKeyAccessToken); exists {
+		if t, ok := token.(*model.AccessToken); ok {
+			return t
+		}
+	}
+	return nil
+}
+
+// GetImpersonatorFromContext retrieves the admin impersonating the current
+// user, or nil if the session isn't impersonated
+func GetImpersonatorFromContext(c *gin.Context) *model.User {
+	if impersonator, exists := c.Get(ContextKeyImpersonator); exists {
+		if u, ok := impersonator.(*model.User); ok {
+			return u
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lite-blog/backend/pkg/logger"
+)
+
+// HeaderRequestID is the header a request ID is read from and echoed in
+const HeaderRequestID = "X-Request-ID"
+
+// maxRequestIDLength bounds request IDs passed in by clients or proxies
+const maxRequestIDLength = 64
+
+// RequestID gives every request an ID, stored in the request's context so
+// that logs written while serving it carry the ID. An ID set by a proxy is
+// kept if it looks safe to log.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(HeaderRequestID)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		c.Request = c.Request.WithContext(logger.WithRequestID(c.Request.Context(), id))
+		c.Header(HeaderRequestID, id)
+		c.Next()
+	}
+}
+
+// validRequestID checks that an ID is short and can't forge log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// AccessLog logs each request once it has been served. Requests are logged by
+// their route, such as /api/auth/invitations/:token, rather than their path:
+// path parameters and query strings may hold tokens or email addresses.
+// Requests that match no route are logged with an empty route.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Int("bytes", max(c.Writer.Size(), 0)), // -1 when nothing was written
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if user := GetUserFromContext(c); user != nil {
+			attrs = append(attrs, slog.Uint64("user_id", uint64(user.ID)))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// Recovery turns a panic in a handler into a 500 response and logs it with
+// its stack trace
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			// The client went away; there is nobody to respond to
+			if err, ok := r.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(r)
+			}
+
+			slog.ErrorContext(c.Request.Context(), "Handler panicked",
+				"panic", fmt.Sprint(r),
+				"stack", string(debug.Stack()),
+			)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "Internal server error",
+				"code":  "INTERNAL_ERROR",
+			})
+		}()
+		c.Next()
+	}
+}
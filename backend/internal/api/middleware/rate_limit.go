@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lite-blog/backend/internal/config"
+)
+
+// RateLimitKey decides whose requests share a bucket
+type RateLimitKey int
+
+const (
+	// RateLimitByIP gives each client IP a bucket
+	RateLimitByIP RateLimitKey = iota
+	// RateLimitByUser gives each signed-in user a bucket, falling back to the IP
+	RateLimitByUser
+	// RateLimitByToken gives each access token a bucket, falling back to the user, then the IP
+	RateLimitByToken
+)
+
+// rateLimitCleanupInterval is how often idle buckets are dropped
+const rateLimitCleanupInterval = time.Minute
+
+// RateLimiter is an in-memory token bucket rate limiter for one policy
+type RateLimiter struct {
+	rate  float64 // Tokens added per second
+	burst float64
+	key   RateLimitKey
+
+	mu          sync.Mutex
+	buckets     map[string]*rateLimitBucket
+	lastCleanup time.Time
+}
+
+type rateLimitBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter creates a limiter for a policy
+func NewRateLimiter(policy config.RateLimitPolicyConfig, key RateLimitKey) *RateLimiter {
+	return &RateLimiter{
+		rate:    float64(policy.Requests) / float64(policy.PeriodSeconds),
+		burst:   float64(policy.Burst),
+		key:     key,
+		buckets: make(map[string]*rateLimitBucket),
+	}
+}
+
+// take spends a token from the key's bucket. It returns whether the request is
+// allowed, the tokens left and how long until the bucket is full again, or
+// until the next token if none are left.
+func (l *RateLimiter) take(key string, now time.Time) (bool, int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cleanup(now)
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &rateLimitBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.updated).Seconds()*l.rate)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		return false, 0, l.seconds(1 - bucket.tokens)
+	}
+	bucket.tokens--
+	return true, int(bucket.tokens), l.seconds(l.burst - bucket.tokens)
+}
+
+// seconds returns how long it takes to refill some tokens
+func (l *RateLimiter) seconds(tokens float64) time.Duration {
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// cleanup drops buckets that have refilled, since they are the same as new ones
+func (l *RateLimiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < rateLimitCleanupInterval {
+		return
+	}
+	l.lastCleanup = now
+	full := l.seconds(l.burst)
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.updated) > full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// keyFor returns the bucket key for a request
+func (l *RateLimiter) keyFor(c *gin.Context) string {
+	if l.key == RateLimitByToken {
+		if token := GetAccessTokenFromContext(c); token != nil {
+			return "token:" + strconv.FormatUint(uint64(token.ID), 10)
+		}
+	}
+	if l.key == RateLimitByUser || l.key == RateLimitByToken {
+		if user := GetUserFromContext(c); user != nil {
+			return "user:" + strconv.FormatUint(uint64(user.ID), 10)
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimit creates a middleware that limits requests with the limiter. It
+// sets the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers,
+// and Retry-After when the limit is hit. Limiters keyed by user or token must
+// come after the auth middleware.
+func RateLimit(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, remaining, reset := limiter.take(limiter.keyFor(c), time.Now())
+		resetSeconds := int(math.Ceil(reset.Seconds()))
+
+		c.Header("RateLimit-Limit", strconv.Itoa(int(limiter.burst)))
+		c.Header("RateLimit-Remaining", strconv.Itoa(remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(resetSeconds))
+
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(resetSeconds))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": "Too many requests, please slow down",
+				"code":  "TOO_MANY_REQUESTS",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -4,14 +4,14 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/lite-blog/backend/pkg/jwt"
 )
 
-// RequireRole creates a middleware that requires specific roles
+// RequireRole creates a middleware that requires specific roles. Roles are
+// those loaded from the database for this request, not the token's.
 func RequireRole(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		claims := GetClaimsFromContext(c)
-		if claims == nil {
+		user := GetUserFromContext(c)
+		if user == nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "Authentication required",
 				"code":  "AUTH_REQUIRED",
@@ -22,7 +22,7 @@ func RequireRole(roles ...string) gin.HandlerFunc {
 		// Check if user has any of the required roles
 		hasRole := false
 		for _, requiredRole := range roles {
-			if claims.HasRole(requiredRole) {
+			if user.HasRole(requiredRole) {
 				hasRole = true
 				break
 			}
@@ -45,6 +45,31 @@ func RequireAdmin() gin.HandlerFunc {
 	return RequireRole("admin")
 }
 
+// RequirePermission creates a middleware that requires a permission granted
+// by one of the user's roles
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := GetUserFromContext(c)
+		if user == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Authentication required",
+				"code":  "AUTH_REQUIRED",
+			})
+			return
+		}
+
+		if !user.HasPermission(permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "You don't have permission to access this resource",
+				"code":  "FORBIDDEN",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // RequireVerifiedEmail creates a middleware that requires verified email
 func RequireVerifiedEmail() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -69,23 +94,40 @@ func RequireVerifiedEmail() gin.HandlerFunc {
 	}
 }
 
+// RequireOwnSession creates a middleware that rejects impersonated sessions.
+// It guards personal data and credentials, which an impersonating admin has
+// no reason to see.
+func RequireOwnSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if GetImpersonatorFromContext(c) != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Not available while impersonating a user",
+				"code":  "IMPERSONATION_FORBIDDEN",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // HasRole checks if the current user has a specific role
 func HasRole(c *gin.Context, role string) bool {
-	claims := GetClaimsFromContext(c)
-	if claims == nil {
+	user := GetUserFromContext(c)
+	if user == nil {
 		return false
 	}
-	return claims.HasRole(role)
+	return user.HasRole(role)
 }
 
 // HasAnyRole checks if the current user has any of the specified roles
 func HasAnyRole(c *gin.Context, roles ...string) bool {
-	claims := GetClaimsFromContext(c)
-	if claims == nil {
+	user := GetUserFromContext(c)
+	if user == nil {
 		return false
 	}
 	for _, role := range roles {
-		if claims.HasRole(role) {
+		if user.HasRole(role) {
 			return true
 		}
 	}
@@ -94,12 +136,9 @@ func HasAnyRole(c *gin.Context, roles ...string) bool {
 
 // GetUserRoles returns the roles of the current user
 func GetUserRoles(c *gin.Context) []string {
-	claims, exists := c.Get(ContextKeyClaims)
-	if !exists {
+	user := GetUserFromContext(c)
+	if user == nil {
 		return nil
 	}
-	if jwtClaims, ok := claims.(*jwt.Claims); ok {
-		return jwtClaims.Roles
-	}
-	return nil
+	return user.GetRoleCodes()
 }
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TwoFactorPolicy reports whether administrators must use two-factor authentication
+type TwoFactorPolicy interface {
+	IsAdmin2FARequired() bool
+}
+
+// RequireAdminTwoFactor blocks admins without two-factor authentication when the
+// site requires it. They can still enroll through /api/auth/2fa, which is outside
+// the admin routes.
+func RequireAdminTwoFactor(policy TwoFactorPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := GetUserFromContext(c)
+		if user != nil && user.IsAdmin() && !user.TOTPEnabled && policy.IsAdmin2FARequired() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Two-factor authentication is required for administrators",
+				"code":  "MFA_ENROLLMENT_REQUIRED",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
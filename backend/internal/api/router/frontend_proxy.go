@@ -2,7 +2,7 @@ package router
 
 import (
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -31,7 +31,7 @@ func newFrontendProxy(target string) (*httputil.ReverseProxy, error) {
 	}
 
 	proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
-		log.Printf("frontend proxy error: %v", err)
+		slog.ErrorContext(req.Context(), "Frontend proxy error", "error", err)
 		http.Error(rw, "frontend unavailable", http.StatusBadGateway)
 	}
 
@@ -0,0 +1,114 @@
+package router
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/pkg/jwt"
+)
+
+// newJWTKeySet loads the keys that sign and verify tokens. Without configured
+// keys it signs with the legacy secret, so existing sessions stay valid.
+func newJWTKeySet(cfg *config.JWTConfig) (*jwt.KeySet, error) {
+	legacy := jwt.NewHMACKey("", []byte(cfg.Secret))
+	if len(cfg.Keys) == 0 {
+		return jwt.NewKeySet(legacy)
+	}
+
+	var signing *jwt.Key
+	var others []*jwt.Key
+	for i, kc := range cfg.Keys {
+		if kc.ID == "" {
+			return nil, fmt.Errorf("jwt: key %d has no id", i)
+		}
+		key, err := loadJWTKey(kc)
+		if err != nil {
+			return nil, fmt.Errorf("jwt: key %q: %w", kc.ID, err)
+		}
+
+		if signing == nil && (kc.ID == cfg.SigningKey || cfg.SigningKey == "") {
+			signing = key
+		} else {
+			others = append(others, key)
+		}
+	}
+	if signing == nil {
+		return nil, fmt.Errorf("jwt: signing key %q is not configured", cfg.SigningKey)
+	}
+
+	if cfg.Secret != "" && !cfg.RetireSecret {
+		others = append(others, legacy)
+	}
+	return jwt.NewKeySet(signing, others...)
+}
+
+// loadJWTKey reads a configured key's secret or PEM file
+func loadJWTKey(kc config.JWTKeyConfig) (*jwt.Key, error) {
+	switch kc.Algorithm {
+	case jwt.AlgorithmHS256:
+		if kc.Secret == "" {
+			return nil, fmt.Errorf("HS256 keys need a secret")
+		}
+		return jwt.NewHMACKey(kc.ID, []byte(kc.Secret)), nil
+	case jwt.AlgorithmRS256, jwt.AlgorithmEdDSA:
+		if kc.PrivateKeyFile != "" {
+			data, err := os.ReadFile(kc.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			return jwt.ParsePrivateKeyPEM(kc.ID, kc.Algorithm, data)
+		}
+		if kc.PublicKeyFile != "" {
+			data, err := os.ReadFile(kc.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			return jwt.ParsePublicKeyPEM(kc.ID, kc.Algorithm, data)
+		}
+		return nil, fmt.Errorf("%s keys need a private_key_file or public_key_file", kc.Algorithm)
+	default:
+		return nil, fmt.Errorf("%w: %q", jwt.ErrUnsupportedAlg, kc.Algorithm)
+	}
+}
+
+// placeholderSecrets are example values from the Docker files and sample
+// config, which anyone could sign with
+var placeholderSecrets = map[string]bool{
+	"change-this-in-production": true,
+	"your-newsletter-secret":    true,
+	"your-oauth-state-secret":   true,
+	"your-challenge-secret":     true,
+}
+
+// resolveSecrets fills in the unsubscribe link, OAuth state and challenge
+// secrets that aren't configured with keys derived from the JWT signing key,
+// so upgrades work without new settings, and refuses placeholder values
+func resolveSecrets(cfg *config.Config, keys *jwt.KeySet) error {
+	for _, secret := range []struct {
+		setting string
+		purpose string
+		value   *string
+	}{
+		{"email.newsletter.signing_secret", "newsletter-unsubscribe", &cfg.Email.Newsletter.SigningSecret},
+		{"oauth.state_secret", "oauth-state", &cfg.OAuth.StateSecret},
+		{"challenge.secret", "pow-challenge", &cfg.Challenge.Secret},
+	} {
+		if placeholderSecrets[*secret.value] {
+			return fmt.Errorf("%s is set to the placeholder %q", secret.setting, *secret.value)
+		}
+		if *secret.value != "" {
+			continue
+		}
+
+		key, err := keys.DeriveSecret(secret.purpose)
+		if err != nil {
+			return fmt.Errorf("%s: %w", secret.setting, err)
+		}
+		*secret.value = string(key)
+		slog.Warn("Secret not set, using a key derived from the JWT signing key; rotating that key invalidates what it signed",
+			"setting", secret.setting)
+	}
+	return nil
+}
@@ -1,64 +1,159 @@
 package router
 
 import (
-	"log"
+	"log/slog"
 	"net/http/httputil"
+	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lite-blog/backend/internal/api/handler"
 	"github.com/lite-blog/backend/internal/api/middleware"
 	"github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/internal/model"
 	"github.com/lite-blog/backend/internal/repository"
 	"github.com/lite-blog/backend/internal/service"
+	"github.com/lite-blog/backend/pkg/sns"
+	"github.com/lite-blog/backend/pkg/worker"
 	"gorm.io/gorm"
 )
 
-func Setup(cfg *config.Config, db *gorm.DB) *gin.Engine {
+// Setup builds the router. Background jobs run in workers, which the caller
+// shuts down after the server stops.
+func Setup(cfg *config.Config, db *gorm.DB, workers *worker.Group) *gin.Engine {
 	// Set Gin mode
 	gin.SetMode(cfg.Server.Mode)
 
-	r := gin.Default()
+	// Logging and panic recovery come first, so every request is logged with its ID
+	r := gin.New()
+	r.Use(middleware.RequestID())
+	r.Use(middleware.AccessLog())
+	r.Use(middleware.Recovery())
+
+	// Only believe X-Forwarded-For from configured proxies, so clients can't
+	// pick their own IP for rate limits and login throttling
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		slog.Error("Invalid trusted proxies", "error", err)
+		os.Exit(1)
+	}
 
 	var frontendProxy *httputil.ReverseProxy
 	if cfg.Server.FrontendProxy != "" {
 		proxy, err := newFrontendProxy(cfg.Server.FrontendProxy)
 		if err != nil {
-			log.Fatalf("failed to init frontend proxy: %v", err)
+			slog.Error("Failed to init frontend proxy", "error", err)
+			os.Exit(1)
 		}
 		frontendProxy = proxy
 	}
 
 	// Apply global middleware
 	r.Use(middleware.CORS(&cfg.CORS))
-	r.Use(gin.Recovery())
+
+	// Rate limits; each call creates a separate limiter for the named policy
+	rateLimit := func(policy string, key middleware.RateLimitKey) gin.HandlerFunc {
+		if cfg.RateLimit.Disabled {
+			return func(c *gin.Context) { c.Next() }
+		}
+		return middleware.RateLimit(middleware.NewRateLimiter(cfg.RateLimit.Policy(policy), key))
+	}
+	r.Use(rateLimit("global", middleware.RateLimitByIP))
+
+	jwtKeys, err := newJWTKeySet(&cfg.JWT)
+	if err != nil {
+		slog.Error("Failed to load JWT keys", "error", err)
+		os.Exit(1)
+	}
+	if err := resolveSecrets(cfg, jwtKeys); err != nil {
+		slog.Error("Invalid secret", "error", err)
+		os.Exit(1)
+	}
 
 	// Initialize repositories
-	userRepo := repository.NewUserRepository(db)
+	userRepo := repository.NewUserRepository(db, userCacheTTL(&cfg.JWT))
 	roleRepo := repository.NewRoleRepository(db)
 	articleRepo := repository.NewArticleRepository(db)
 	commentRepo := repository.NewCommentRepository(db)
 	settingRepo := repository.NewSettingRepository(db)
+	emailOutboxRepo := repository.NewEmailOutboxRepository(db)
+	subscriberRepo := repository.NewSubscriberRepository(db)
+	emailSuppressionRepo := repository.NewEmailSuppressionRepository(db)
+	recoveryCodeRepo := repository.NewRecoveryCodeRepository(db)
+	passkeyRepo := repository.NewPasskeyRepository(db)
+	passkeyChallengeRepo := repository.NewPasskeyChallengeRepository(db)
+	userIdentityRepo := repository.NewUserIdentityRepository(db)
+	magicLinkRepo := repository.NewMagicLinkRepository(db)
+	passwordResetRepo := repository.NewPasswordResetRepository(db)
+	accessTokenRepo := repository.NewAccessTokenRepository(db)
+	invitationRepo := repository.NewInvitationRepository(db)
+	emailChangeRepo := repository.NewEmailChangeRepository(db)
+	passwordHistoryRepo := repository.NewPasswordHistoryRepository(db)
+	auditLogRepo := repository.NewAuditLogRepository(db)
 
 	// Initialize services
 	settingService := service.NewSettingService(settingRepo)
-	emailService := service.NewEmailService(&cfg.Email, settingService)
-	authService := service.NewAuthService(userRepo, roleRepo, emailService, cfg)
-	articleService := service.NewArticleService(articleRepo)
+	auditService := service.NewAuditService(auditLogRepo)
+	emailService := service.NewEmailService(&cfg.Email, emailOutboxRepo, emailSuppressionRepo, settingService, settingService)
+	emailFeedbackService := service.NewEmailFeedbackService(&cfg.Email.AWS, sns.NewVerifier(), emailSuppressionRepo, userRepo, subscriberRepo)
+	loginGuard := service.NewLoginGuard(newLoginAttemptStore(cfg, db), &cfg.Login)
+	registrationService := service.NewRegistrationService(invitationRepo, userRepo, roleRepo, settingService, settingService)
+	passwordPolicy := service.NewPasswordPolicy(passwordHistoryRepo, &cfg.Password)
+	authService := service.NewAuthService(userRepo, roleRepo, emailService, loginGuard, registrationService, passwordPolicy, jwtKeys, cfg)
+	twoFactorService := service.NewTwoFactorService(userRepo, recoveryCodeRepo, settingService, settingService, jwtKeys, cfg)
+	passkeyService := service.NewPasskeyService(userRepo, passkeyRepo, passkeyChallengeRepo, settingService, jwtKeys, cfg)
+	oauthService := service.NewOAuthService(userRepo, roleRepo, userIdentityRepo, settingService, registrationService, jwtKeys, cfg)
+	magicLinkService := service.NewMagicLinkService(userRepo, roleRepo, magicLinkRepo, emailService, settingService, registrationService, jwtKeys, cfg)
+	passwordResetService := service.NewPasswordResetService(userRepo, passwordResetRepo, emailService, passwordPolicy)
+	impersonationService := service.NewImpersonationService(userRepo, jwtKeys)
+	accessTokenService := service.NewAccessTokenService(accessTokenRepo, userRepo)
+	challengeService := service.NewChallengeService(settingService, cfg)
+	emailChangeService := service.NewEmailChangeService(userRepo, emailChangeRepo, emailService, registrationService)
+	newsletterService := service.NewNewsletterService(subscriberRepo, articleRepo, emailService, workers, cfg)
+	articleService := service.NewArticleService(articleRepo, newsletterService)
 	commentService := service.NewCommentService(commentRepo, articleRepo)
-	userService := service.NewUserService(userRepo, roleRepo)
+	userService := service.NewUserService(userRepo, roleRepo, loginGuard)
+	accountService := service.NewAccountService(userRepo, commentRepo, subscriberRepo, accessTokenRepo, passkeyRepo, userIdentityRepo, emailService, loginGuard, cfg)
 
 	// Initialize handlers
-	authHandler := handler.NewAuthHandler(authService, cfg)
+	authHandler := handler.NewAuthHandler(authService, twoFactorService, passkeyService, oauthService, magicLinkService, passwordResetService, challengeService, passwordPolicy, cfg)
+	accessTokenHandler := handler.NewAccessTokenHandler(accessTokenService)
+	emailChangeHandler := handler.NewEmailChangeHandler(emailChangeService)
+	accountHandler := handler.NewAccountHandler(accountService)
 	articleHandler := handler.NewArticleHandler(articleService)
-	commentHandler := handler.NewCommentHandler(commentService)
-	settingHandler := handler.NewSettingHandler(settingService)
-	adminArticleHandler := handler.NewAdminArticleHandler(articleService)
-	adminCommentHandler := handler.NewAdminCommentHandler(commentService)
-	adminUserHandler := handler.NewAdminUserHandler(userService)
+	commentHandler := handler.NewCommentHandler(commentService, challengeService)
+	challengeHandler := handler.NewChallengeHandler(challengeService)
+	invitationHandler := handler.NewInvitationHandler(registrationService)
+	adminInvitationHandler := handler.NewAdminInvitationHandler(registrationService, auditService)
+	settingHandler := handler.NewSettingHandler(settingService, auditService)
+	adminArticleHandler := handler.NewAdminArticleHandler(articleService, auditService)
+	adminCommentHandler := handler.NewAdminCommentHandler(commentService, auditService)
+	adminUserHandler := handler.NewAdminUserHandler(userService, auditService)
+	adminEmailHandler := handler.NewAdminEmailHandler(emailService, auditService)
+	subscriptionHandler := handler.NewSubscriptionHandler(newsletterService)
+	adminSubscriptionHandler := handler.NewAdminSubscriptionHandler(newsletterService)
+	emailFeedbackHandler := handler.NewEmailFeedbackHandler(emailFeedbackService, auditService)
+	adminAuditLogHandler := handler.NewAdminAuditLogHandler(auditService)
+	impersonationHandler := handler.NewImpersonationHandler(impersonationService, auditService, cfg)
+	jwksHandler := handler.NewJWKSHandler(jwtKeys)
+
+	// Start background email sender, newsletter digests and account deletions
+	workers.Go("email outbox", emailService.RunOutbox)
+	workers.Go("newsletter digests", newsletterService.RunDigests)
+	workers.Go("account deletions", accountService.RunDeletions)
+	// The SMTP provider keeps a connection open; quit it once the outbox has stopped
+	workers.OnShutdown("email provider", emailService.Close)
 
 	// Create auth middleware
-	authMiddleware := middleware.AuthMiddleware(cfg.JWT.Secret, userRepo)
-	optionalAuthMiddleware := middleware.OptionalAuthMiddleware(cfg.JWT.Secret, userRepo)
+	authMiddleware := middleware.AuthMiddleware(jwtKeys, userRepo, accessTokenService, authHandler)
+	optionalAuthMiddleware := middleware.OptionalAuthMiddleware(jwtKeys, userRepo, accessTokenService, authHandler)
+
+	// Personal access tokens only work on routes that name the scope they need
+	tokenAuthMiddleware := func(scope string) gin.HandlerFunc {
+		return middleware.AuthMiddleware(jwtKeys, userRepo, accessTokenService, authHandler, scope)
+	}
+
+	// Personal data and credentials stay out of reach of impersonating admins
+	ownSession := middleware.RequireOwnSession()
 
 	// Health check endpoint
 	r.GET("/ping", func(c *gin.Context) {
@@ -67,26 +162,83 @@ func Setup(cfg *config.Config, db *gorm.DB) *gin.Engine {
 		})
 	})
 
+	// Public keys for verifying our tokens
+	r.GET("/.well-known/jwks.json", jwksHandler.Keys)
+
 	// API routes
 	api := r.Group("/api")
 	{
 		// Auth routes
 		auth := api.Group("/auth")
+		auth.Use(rateLimit("auth", middleware.RateLimitByIP))
 		{
-			auth.POST("/register", authHandler.Register)
+			auth.POST("/register", rateLimit("register", middleware.RateLimitByIP), authHandler.Register)
+			auth.GET("/registration", invitationHandler.Registration)
+			auth.GET("/invitations/:token", invitationHandler.Lookup)
 			auth.POST("/login", authHandler.Login)
+			auth.POST("/login/2fa", authHandler.LoginTwoFactor)
+			auth.POST("/magic-link", authHandler.RequestMagicLink)
+			auth.POST("/magic-link/consume", authHandler.ConsumeMagicLink)
 			auth.POST("/logout", authHandler.Logout)
-			auth.GET("/me", authMiddleware, authHandler.Me)
+			auth.DELETE("/impersonation", impersonationHandler.End)
+			auth.GET("/me", tokenAuthMiddleware(model.ScopeProfileRead), authHandler.Me)
 			auth.POST("/verify-email", authHandler.VerifyEmail)
 			auth.POST("/resend-verification", authMiddleware, authHandler.ResendVerification)
+			auth.PUT("/language", authMiddleware, authHandler.UpdateLanguage)
+			auth.GET("/password-policy", authHandler.PasswordPolicy)
+			auth.POST("/change-password", authMiddleware, authHandler.ChangePassword)
+			auth.POST("/password-reset", authHandler.RequestPasswordReset)
+			auth.POST("/password-reset/confirm", authHandler.ResetPassword)
+
+			// Email change
+			auth.GET("/email", authMiddleware, ownSession, emailChangeHandler.Status)
+			auth.POST("/email", authMiddleware, ownSession, emailChangeHandler.Request)
+			auth.DELETE("/email", authMiddleware, ownSession, emailChangeHandler.CancelPending)
+			auth.POST("/email/confirm", emailChangeHandler.Confirm)
+			auth.POST("/email/cancel", emailChangeHandler.Cancel)
+
+			// Personal data export and account deletion
+			auth.GET("/account/export", authMiddleware, ownSession, accountHandler.Export)
+			auth.GET("/account/deletion", authMiddleware, ownSession, accountHandler.DeletionStatus)
+			auth.POST("/account/deletion", authMiddleware, ownSession, accountHandler.ScheduleDeletion)
+			auth.DELETE("/account/deletion", authMiddleware, ownSession, accountHandler.CancelDeletion)
+
+			// Two-factor authentication
+			auth.GET("/2fa", authMiddleware, ownSession, authHandler.TwoFactorStatus)
+			auth.POST("/2fa/setup", authMiddleware, ownSession, authHandler.SetupTwoFactor)
+			auth.POST("/2fa/enable", authMiddleware, ownSession, authHandler.EnableTwoFactor)
+			auth.POST("/2fa/disable", authMiddleware, ownSession, authHandler.DisableTwoFactor)
+			auth.POST("/2fa/recovery-codes", authMiddleware, ownSession, authHandler.RegenerateRecoveryCodes)
+
+			// WebAuthn passkeys
+			auth.POST("/webauthn/login/begin", authHandler.BeginPasskeyLogin)
+			auth.POST("/webauthn/login/finish", authHandler.FinishPasskeyLogin)
+			auth.POST("/webauthn/register/begin", authMiddleware, ownSession, authHandler.BeginPasskeyRegistration)
+			auth.POST("/webauthn/register/finish", authMiddleware, ownSession, authHandler.FinishPasskeyRegistration)
+			auth.GET("/webauthn/credentials", authMiddleware, ownSession, authHandler.ListPasskeys)
+			auth.PUT("/webauthn/credentials/:id", authMiddleware, ownSession, authHandler.RenamePasskey)
+			auth.DELETE("/webauthn/credentials/:id", authMiddleware, ownSession, authHandler.DeletePasskey)
+
+			// OAuth/OIDC sign-in
+			auth.GET("/oauth/providers", authHandler.OAuthProviders)
+			auth.GET("/oauth/:provider/login", authHandler.OAuthLogin)
+			auth.GET("/oauth/:provider/callback", authHandler.OAuthCallback)
+
+			// Personal access tokens
+			auth.GET("/tokens", authMiddleware, ownSession, accessTokenHandler.List)
+			auth.POST("/tokens", authMiddleware, ownSession, accessTokenHandler.Create)
+			auth.DELETE("/tokens/:id", authMiddleware, ownSession, accessTokenHandler.Revoke)
 		}
 
+		// Proof-of-work challenges for registration and comments
+		api.GET("/challenges", rateLimit("auth", middleware.RateLimitByIP), challengeHandler.Issue)
+
 		// Public site settings
 		api.GET("/settings", settingHandler.GetSiteSettings)
 
 		// Public article routes (with optional auth for content masking)
 		articles := api.Group("/articles")
-		articles.Use(optionalAuthMiddleware)
+		articles.Use(middleware.OptionalAuthMiddleware(jwtKeys, userRepo, accessTokenService, authHandler, model.ScopeArticleRead))
 		{
 			articles.GET("", articleHandler.List)
 			articles.GET("/:slug", articleHandler.GetBySlug)
@@ -96,39 +248,101 @@ func Setup(cfg *config.Config, db *gorm.DB) *gin.Engine {
 		comments := api.Group("/comments")
 		{
 			comments.GET("/article/:articleId", optionalAuthMiddleware, commentHandler.List)
-			comments.POST("/article/:articleId", authMiddleware, commentHandler.Create)
+			comments.POST("/article/:articleId", tokenAuthMiddleware(model.ScopeCommentWrite), rateLimit("comment", middleware.RateLimitByUser), commentHandler.Create)
+		}
+
+		// Newsletter subscription routes
+		subscriptions := api.Group("/subscriptions")
+		{
+			subscriptions.POST("", optionalAuthMiddleware, subscriptionHandler.Subscribe)
+			subscriptions.GET("/confirm", subscriptionHandler.Confirm)
+			subscriptions.GET("/unsubscribe", subscriptionHandler.UnsubscribePage)
+			subscriptions.POST("/unsubscribe", subscriptionHandler.Unsubscribe)
+		}
+
+		// Provider webhooks
+		api.POST("/webhooks/ses", emailFeedbackHandler.SESWebhook)
+
+		// The admin API shares one limit per access token or user
+		adminRateLimit := rateLimit("api", middleware.RateLimitByToken)
+
+		// Admin article management, which also accepts access tokens so CI can publish
+		adminArticles := api.Group("/admin/articles")
+		adminArticles.Use(tokenAuthMiddleware(model.ScopeArticleWrite))
+		adminArticles.Use(adminRateLimit)
+		adminArticles.Use(middleware.RequireAdmin())
+		adminArticles.Use(middleware.RequireAdminTwoFactor(settingService))
+		adminArticles.Use(middleware.RequirePermission(model.PermissionArticleManage))
+		{
+			adminArticles.GET("", adminArticleHandler.List)
+			adminArticles.GET("/:id", adminArticleHandler.GetByID)
+			adminArticles.POST("", adminArticleHandler.Create)
+			adminArticles.PUT("/:id", adminArticleHandler.Update)
+			adminArticles.DELETE("/:id", adminArticleHandler.Delete)
+			adminArticles.POST("/:id/publish", adminArticleHandler.Publish)
+			adminArticles.POST("/:id/unpublish", adminArticleHandler.Unpublish)
 		}
 
 		// Admin routes
 		admin := api.Group("/admin")
 		admin.Use(authMiddleware)
+		admin.Use(adminRateLimit)
 		admin.Use(middleware.RequireAdmin())
+		admin.Use(middleware.RequireAdminTwoFactor(settingService))
 		{
-			// Article management
-			admin.GET("/articles", adminArticleHandler.List)
-			admin.GET("/articles/:id", adminArticleHandler.GetByID)
-			admin.POST("/articles", adminArticleHandler.Create)
-			admin.PUT("/articles/:id", adminArticleHandler.Update)
-			admin.DELETE("/articles/:id", adminArticleHandler.Delete)
-			admin.POST("/articles/:id/publish", adminArticleHandler.Publish)
-			admin.POST("/articles/:id/unpublish", adminArticleHandler.Unpublish)
-
 			// Comment management
-			admin.DELETE("/comments/:id", adminCommentHandler.Delete)
+			admin.DELETE("/comments/:id", middleware.RequirePermission(model.PermissionCommentManage), adminCommentHandler.Delete)
 
 			// Site settings management
 			admin.GET("/settings", settingHandler.GetSiteSettings)
 			admin.PUT("/settings", settingHandler.UpdateSiteSettings)
+			admin.GET("/settings/security", settingHandler.GetSecuritySettings)
+			admin.PUT("/settings/security", settingHandler.UpdateSecuritySettings)
 
 			// User management
-			admin.GET("/users", adminUserHandler.List)
-			admin.GET("/users/:id", adminUserHandler.GetByID)
-			admin.PUT("/users/:id/status", adminUserHandler.UpdateStatus)
-			admin.PUT("/users/:id/membership", adminUserHandler.UpdateMembership)
-			admin.POST("/users/:id/roles", adminUserHandler.AssignRole)
-			admin.DELETE("/users/:id/roles", adminUserHandler.RemoveRole)
-			admin.DELETE("/users/:id", adminUserHandler.Delete)
-			admin.GET("/roles", adminUserHandler.GetRoles)
+			requireUserManage := middleware.RequirePermission(model.PermissionUserManage)
+			requireRoleManage := middleware.RequirePermission(model.PermissionRoleManage)
+			admin.GET("/users", requireUserManage, adminUserHandler.List)
+			admin.POST("/users/bulk", requireUserManage, adminUserHandler.Bulk)
+			admin.GET("/users/export", requireUserManage, adminUserHandler.Export)
+			// Imports can assign roles
+			admin.POST("/users/import", requireUserManage, requireRoleManage, adminUserHandler.Import)
+			admin.GET("/users/:id", requireUserManage, adminUserHandler.GetByID)
+			admin.PUT("/users/:id/status", requireUserManage, adminUserHandler.UpdateStatus)
+			admin.PUT("/users/:id/membership", requireUserManage, adminUserHandler.UpdateMembership)
+			admin.POST("/users/:id/roles", requireRoleManage, adminUserHandler.AssignRole)
+			admin.DELETE("/users/:id/roles", requireRoleManage, adminUserHandler.RemoveRole)
+			admin.POST("/users/:id/unlock", requireUserManage, adminUserHandler.Unlock)
+			admin.DELETE("/users/:id", requireUserManage, adminUserHandler.Delete)
+			admin.POST("/users/:id/impersonate", requireUserManage, impersonationHandler.Start)
+			admin.GET("/roles", requireRoleManage, adminUserHandler.GetRoles)
+
+			// Invitations
+			admin.GET("/invitations", adminInvitationHandler.List)
+			admin.POST("/invitations", adminInvitationHandler.Create)
+			admin.DELETE("/invitations/:id", adminInvitationHandler.Revoke)
+
+			// Email outbox
+			admin.GET("/emails", adminEmailHandler.List)
+			// Bodies are redacted, but still hold the recipients' personal mail
+			admin.GET("/emails/:id", requireUserManage, adminEmailHandler.GetByID)
+			admin.POST("/emails/:id/retry", adminEmailHandler.Retry)
+			admin.GET("/email-suppressions", emailFeedbackHandler.ListSuppressions)
+			admin.DELETE("/email-suppressions/:id", emailFeedbackHandler.DeleteSuppression)
+
+			// Email templates
+			admin.GET("/email-templates", adminEmailHandler.ListTemplates)
+			admin.GET("/email-templates/:name/:language", adminEmailHandler.GetTemplate)
+			admin.PUT("/email-templates/:name/:language", adminEmailHandler.UpdateTemplate)
+			admin.DELETE("/email-templates/:name/:language", adminEmailHandler.ResetTemplate)
+			admin.POST("/email-templates/:name/:language/preview", adminEmailHandler.PreviewTemplate)
+
+			// Newsletter subscribers
+			admin.GET("/subscribers", adminSubscriptionHandler.List)
+
+			// Audit log of privileged actions
+			admin.GET("/audit-log", adminAuditLogHandler.List)
+			admin.GET("/audit-log/export", adminAuditLogHandler.Export)
 		}
 	}
 
@@ -160,3 +374,31 @@ func Setup(cfg *config.Config, db *gorm.DB) *gin.Engine {
 
 	return r
 }
+
+// newLoginAttemptStore picks where failed login attempts are kept
+func newLoginAttemptStore(cfg *config.Config, db *gorm.DB) service.LoginAttemptStore {
+	switch cfg.Login.Store {
+	case "database", "db":
+		return repository.NewLoginAttemptRepository(db)
+	case "", "memory":
+		return repository.NewMemoryLoginAttemptStore()
+	default:
+		slog.Warn("Unknown login attempt store, using memory", "store", cfg.Login.Store)
+		return repository.NewMemoryLoginAttemptStore()
+	}
+}
+
+// defaultUserCacheTTL is how long signed-in users are cached when not configured
+const defaultUserCacheTTL = 10 * time.Second
+
+// userCacheTTL returns how long signed-in users are cached; zero disables the cache
+func userCacheTTL(cfg *config.JWTConfig) time.Duration {
+	switch {
+	case cfg.UserCacheSeconds < 0:
+		return 0
+	case cfg.UserCacheSeconds > 0:
+		return time.Duration(cfg.UserCacheSeconds) * time.Second
+	default:
+		return defaultUserCacheTTL
+	}
+}
@@ -6,22 +6,85 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	CORS     CORSConfig     `mapstructure:"cors"`
-	Email    EmailConfig    `mapstructure:"email"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Database  DatabaseConfig  `mapstructure:"database"`
+	JWT       JWTConfig       `mapstructure:"jwt"`
+	CORS      CORSConfig      `mapstructure:"cors"`
+	Email     EmailConfig     `mapstructure:"email"`
+	OAuth     OAuthConfig     `mapstructure:"oauth"`
+	Login     LoginConfig     `mapstructure:"login"`
+	Password  PasswordConfig  `mapstructure:"password"`
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	Account   AccountConfig   `mapstructure:"account"`
+	Challenge ChallengeConfig `mapstructure:"challenge"`
+	Log       LogConfig       `mapstructure:"log"`
 }
 
 type ServerConfig struct {
 	Port          int    `mapstructure:"port"`
 	Mode          string `mapstructure:"mode"`
 	FrontendProxy string `mapstructure:"frontend_proxy"`
+	// TrustedProxies lists the proxy IPs/CIDRs whose X-Forwarded-For header is
+	// believed when finding the client IP. When empty, no proxy is trusted.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	// Timeouts in seconds. Zero uses the default; negative disables.
+	ReadTimeoutSeconds     int `mapstructure:"read_timeout_seconds"`
+	WriteTimeoutSeconds    int `mapstructure:"write_timeout_seconds"`
+	IdleTimeoutSeconds     int `mapstructure:"idle_timeout_seconds"`
+	ShutdownTimeoutSeconds int `mapstructure:"shutdown_timeout_seconds"` // Wait for requests and background jobs on shutdown
+}
+
+// Server timeouts used when the config doesn't set them
+const (
+	DefaultReadTimeout     = 30 * time.Second
+	DefaultWriteTimeout    = 60 * time.Second
+	DefaultIdleTimeout     = 120 * time.Second
+	DefaultShutdownTimeout = 30 * time.Second
+)
+
+// ReadTimeout returns how long reading a request may take; zero means no limit
+func (c *ServerConfig) ReadTimeout() time.Duration {
+	return timeoutSeconds(c.ReadTimeoutSeconds, DefaultReadTimeout)
+}
+
+// WriteTimeout returns how long writing a response may take; zero means no limit
+func (c *ServerConfig) WriteTimeout() time.Duration {
+	return timeoutSeconds(c.WriteTimeoutSeconds, DefaultWriteTimeout)
+}
+
+// IdleTimeout returns how long an idle keep-alive connection is kept open;
+// zero means no limit
+func (c *ServerConfig) IdleTimeout() time.Duration {
+	return timeoutSeconds(c.IdleTimeoutSeconds, DefaultIdleTimeout)
+}
+
+// ShutdownTimeout returns how long shutdown waits for in-flight requests and
+// background jobs; zero means no limit
+func (c *ServerConfig) ShutdownTimeout() time.Duration {
+	return timeoutSeconds(c.ShutdownTimeoutSeconds, DefaultShutdownTimeout)
+}
+
+func timeoutSeconds(seconds int, fallback time.Duration) time.Duration {
+	switch {
+	case seconds < 0:
+		return 0
+	case seconds > 0:
+		return time.Duration(seconds) * time.Second
+	default:
+		return fallback
+	}
+}
+
+// LogConfig controls the structured logs written to stdout
+type LogConfig struct {
+	Level  string `mapstructure:"level"`  // debug, info, warn or error; defaults to info
+	Format string `mapstructure:"format"` // json or text; defaults to json
 }
 
 type DatabaseConfig struct {
@@ -31,6 +94,27 @@ type DatabaseConfig struct {
 type JWTConfig struct {
 	Secret      string `mapstructure:"secret"`
 	ExpireHours int    `mapstructure:"expire_hours"`
+	// Keys, when set, sign tokens instead of Secret. Tokens carry the signing
+	// key's ID, and every listed key keeps verifying, so keys can be rotated
+	// without signing everyone out.
+	Keys         []JWTKeyConfig `mapstructure:"keys"`
+	SigningKey   string         `mapstructure:"signing_key"`   // ID of the key to sign with; defaults to the first
+	RetireSecret bool           `mapstructure:"retire_secret"` // Stop accepting tokens signed with Secret
+	// UserCacheSeconds is how long a signed-in user, with their roles, is
+	// cached between requests. Changes made on this instance apply at once;
+	// other instances see them after this long. Negative disables the cache.
+	UserCacheSeconds int `mapstructure:"user_cache_seconds"`
+}
+
+// JWTKeyConfig is one signing key. HS256 keys use Secret; RS256 and EdDSA
+// keys use PEM files. A key with only a public key file verifies old tokens
+// but can't sign.
+type JWTKeyConfig struct {
+	ID             string `mapstructure:"id"`
+	Algorithm      string `mapstructure:"algorithm"` // HS256, RS256 or EdDSA
+	Secret         string `mapstructure:"secret"`
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+	PublicKeyFile  string `mapstructure:"public_key_file"`
 }
 
 type CORSConfig struct {
@@ -41,14 +125,137 @@ type CORSConfig struct {
 }
 
 type EmailConfig struct {
-	Provider string         `mapstructure:"provider"`
-	From     string         `mapstructure:"from"`
-	SiteURL  string         `mapstructure:"site_url"`
-	AWS      AWSEmailConfig `mapstructure:"aws"`
+	Provider   string           `mapstructure:"provider"`
+	From       string           `mapstructure:"from"`
+	SiteURL    string           `mapstructure:"site_url"`
+	AWS        AWSEmailConfig   `mapstructure:"aws"`
+	SMTP       SMTPEmailConfig  `mapstructure:"smtp"`
+	Outbox     OutboxConfig     `mapstructure:"outbox"`
+	Newsletter NewsletterConfig `mapstructure:"newsletter"`
 }
 
 type AWSEmailConfig struct {
 	Region string `mapstructure:"region"`
+	// SNSTopicARNs lists the SNS topics allowed to post SES bounce/complaint
+	// notifications to the webhook. The webhook is disabled when empty.
+	SNSTopicARNs            []string `mapstructure:"sns_topic_arns"`
+	ConfirmSNSSubscriptions bool     `mapstructure:"confirm_sns_subscriptions"`
+}
+
+type SMTPEmailConfig struct {
+	Host               string `mapstructure:"host"`
+	Port               int    `mapstructure:"port"`
+	Username           string `mapstructure:"username"`
+	Password           string `mapstructure:"password"`
+	Encryption         string `mapstructure:"encryption"` // none, starttls, tls
+	Auth               string `mapstructure:"auth"`       // plain, login
+	HeloName           string `mapstructure:"helo_name"`
+	TimeoutSeconds     int    `mapstructure:"timeout_seconds"`
+	IdleTimeoutSeconds int    `mapstructure:"idle_timeout_seconds"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+type NewsletterConfig struct {
+	DigestCheckMinutes int `mapstructure:"digest_check_minutes"`
+	BatchSize          int `mapstructure:"batch_size"`
+	// SigningSecret signs unsubscribe links. Defaults to a key derived from
+	// the JWT signing key. Changing it, or rotating that key while it's
+	// unset, breaks the links in emails already sent.
+	SigningSecret string `mapstructure:"signing_secret"`
+}
+
+type OAuthConfig struct {
+	// Providers maps a provider ID, used in login URLs, to its settings.
+	// Providers without a client ID are disabled.
+	Providers map[string]OAuthProviderConfig `mapstructure:"providers"`
+	// StateSecret signs the state carried through the provider's login page.
+	// Defaults to a key derived from the JWT signing key.
+	StateSecret string `mapstructure:"state_secret"`
+}
+
+type OAuthProviderConfig struct {
+	Type         string   `mapstructure:"type"` // oidc, google, github; defaults to the provider ID if that is a preset, else oidc
+	Name         string   `mapstructure:"name"` // Shown on the login button
+	Issuer       string   `mapstructure:"issuer"`
+	ClientID     string   `mapstructure:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret"`
+	Scopes       []string `mapstructure:"scopes"`
+}
+
+// LoginConfig limits password sign-in attempts. Zero values use the defaults.
+type LoginConfig struct {
+	Store                string `mapstructure:"store"` // memory or database
+	MaxAccountFailures   int    `mapstructure:"max_account_failures"`
+	MaxIPFailures        int    `mapstructure:"max_ip_failures"`
+	FailureWindowMinutes int    `mapstructure:"failure_window_minutes"`
+	LockoutMinutes       int    `mapstructure:"lockout_minutes"`
+	FreeAttempts         int    `mapstructure:"free_attempts"` // failures before delays start
+	BaseDelaySeconds     int    `mapstructure:"base_delay_seconds"`
+	MaxDelaySeconds      int    `mapstructure:"max_delay_seconds"`
+}
+
+// PasswordConfig is the policy for new passwords. Zero values use the defaults.
+type PasswordConfig struct {
+	MinLength    int  `mapstructure:"min_length"`
+	MinClasses   int  `mapstructure:"min_classes"`   // Of lowercase, uppercase, digits and symbols
+	AllowCommon  bool `mapstructure:"allow_common"`  // Skip the bundled list of common passwords
+	HistoryCount int  `mapstructure:"history_count"` // Recent passwords that can't be reused; -1 allows reuse
+}
+
+// AccountConfig controls self-service account deletion. Zero values use the defaults.
+type AccountConfig struct {
+	DeletionGraceDays    int `mapstructure:"deletion_grace_days"`    // Days before a deletion request is carried out
+	DeletionCheckMinutes int `mapstructure:"deletion_check_minutes"` // How often due deletions are processed
+}
+
+// ChallengeConfig holds the key that signs proof-of-work challenges. It
+// defaults to a key derived from the JWT signing key.
+type ChallengeConfig struct {
+	Secret string `mapstructure:"secret"`
+}
+
+// RateLimitConfig overrides the built-in rate limit policies by name
+type RateLimitConfig struct {
+	Disabled bool                             `mapstructure:"disabled"`
+	Policies map[string]RateLimitPolicyConfig `mapstructure:"policies"`
+}
+
+// RateLimitPolicyConfig is a token bucket: it holds Burst requests and refills
+// at Requests per PeriodSeconds
+type RateLimitPolicyConfig struct {
+	Requests      int `mapstructure:"requests"`
+	PeriodSeconds int `mapstructure:"period_seconds"`
+	Burst         int `mapstructure:"burst"` // defaults to Requests
+}
+
+// DefaultRateLimitPolicies are used for policies the config doesn't set
+var DefaultRateLimitPolicies = map[string]RateLimitPolicyConfig{
+	"global":   {Requests: 600, PeriodSeconds: 60, Burst: 200}, // Every request, including the frontend, per IP
+	"auth":     {Requests: 30, PeriodSeconds: 60, Burst: 15},   // /api/auth, per IP
+	"register": {Requests: 10, PeriodSeconds: 3600, Burst: 5},  // Account registration, per IP
+	"comment":  {Requests: 10, PeriodSeconds: 60, Burst: 5},    // Posting comments, per user
+	"api":      {Requests: 120, PeriodSeconds: 60, Burst: 60},  // Admin API, per access token or user
+}
+
+// Policy returns the named policy, falling back to its default
+func (c *RateLimitConfig) Policy(name string) RateLimitPolicyConfig {
+	policy, ok := c.Policies[name]
+	if !ok || policy.Requests <= 0 || policy.PeriodSeconds <= 0 {
+		policy = DefaultRateLimitPolicies[name]
+	}
+	if policy.Burst <= 0 {
+		policy.Burst = policy.Requests
+	}
+	return policy
+}
+
+type OutboxConfig struct {
+	MaxAttempts         int `mapstructure:"max_attempts"`
+	BatchSize           int `mapstructure:"batch_size"`
+	PollIntervalSeconds int `mapstructure:"poll_interval_seconds"`
+	BaseBackoffSeconds  int `mapstructure:"base_backoff_seconds"`
+	MaxBackoffSeconds   int `mapstructure:"max_backoff_seconds"`
+	RatePerSecond       int `mapstructure:"rate_per_second"`
 }
 
 func Load() *Config {
@@ -83,10 +290,74 @@ func Load() *Config {
 		config.JWT.Secret = secret
 	}
 
+	if secret := os.Getenv("NEWSLETTER_SIGNING_SECRET"); secret != "" {
+		config.Email.Newsletter.SigningSecret = secret
+	}
+
+	if secret := os.Getenv("OAUTH_STATE_SECRET"); secret != "" {
+		config.OAuth.StateSecret = secret
+	}
+
+	if secret := os.Getenv("CHALLENGE_SECRET"); secret != "" {
+		config.Challenge.Secret = secret
+	}
+
 	if region := os.Getenv("AWS_REGION"); region != "" {
 		config.Email.AWS.Region = region
 	}
 
+	if topics := os.Getenv("SES_SNS_TOPIC_ARNS"); topics != "" {
+		config.Email.AWS.SNSTopicARNs = strings.Split(topics, ",")
+	}
+
+	if provider := os.Getenv("EMAIL_PROVIDER"); provider != "" {
+		config.Email.Provider = provider
+	}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		config.Email.SMTP.Host = host
+	}
+
+	if port := os.Getenv("SMTP_PORT"); port != "" {
+		if p, err := strconv.Atoi(port); err == nil {
+			config.Email.SMTP.Port = p
+		}
+	}
+
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		config.Email.SMTP.Username = username
+	}
+
+	if password := os.Getenv("SMTP_PASSWORD"); password != "" {
+		config.Email.SMTP.Password = password
+	}
+
+	// OAUTH_<ID>_CLIENT_ID etc. configure sign-in providers, e.g. OAUTH_GITHUB_CLIENT_ID
+	for _, id := range []string{"github", "google", "oidc"} {
+		prefix := "OAUTH_" + strings.ToUpper(id) + "_"
+		provider, ok := config.OAuth.Providers[id]
+		if clientID := os.Getenv(prefix + "CLIENT_ID"); clientID != "" {
+			provider.ClientID = clientID
+			ok = true
+		}
+		if clientSecret := os.Getenv(prefix + "CLIENT_SECRET"); clientSecret != "" {
+			provider.ClientSecret = clientSecret
+		}
+		if issuer := os.Getenv(prefix + "ISSUER"); issuer != "" {
+			provider.Issuer = issuer
+		}
+		if ok {
+			if config.OAuth.Providers == nil {
+				config.OAuth.Providers = make(map[string]OAuthProviderConfig)
+			}
+			config.OAuth.Providers[id] = provider
+		}
+	}
+
+	if store := os.Getenv("LOGIN_ATTEMPT_STORE"); store != "" {
+		config.Login.Store = store
+	}
+
 	// Docker environment overrides
 	if dbPath := os.Getenv("DATABASE_PATH"); dbPath != "" {
 		config.Database.Path = dbPath
@@ -102,10 +373,22 @@ func Load() *Config {
 		config.Server.Mode = mode
 	}
 
+	if level := os.Getenv("LOG_LEVEL"); level != "" {
+		config.Log.Level = level
+	}
+
+	if format := os.Getenv("LOG_FORMAT"); format != "" {
+		config.Log.Format = format
+	}
+
 	if frontend := os.Getenv("FRONTEND_PROXY"); frontend != "" {
 		config.Server.FrontendProxy = frontend
 	}
 
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		config.Server.TrustedProxies = strings.Split(proxies, ",")
+	}
+
 	if origins := os.Getenv("CORS_ORIGINS"); origins != "" {
 		config.CORS.AllowedOrigins = strings.Split(origins, ",")
 	}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// AccessTokenPrefix starts every personal access token, so leaked tokens are easy to spot
+const AccessTokenPrefix = "lbp_"
+
+// Access token scopes
+const (
+	ScopeProfileRead  = "profile:read"  // Read the owner's profile
+	ScopeArticleRead  = "article:read"  // Read articles with the owner's access, e.g. member-only content
+	ScopeArticleWrite = "article:write" // Create, edit and publish articles (admins only)
+	ScopeCommentWrite = "comment:write" // Post comments
+)
+
+// AccessTokenScopes lists the scopes a token can be granted
+var AccessTokenScopes = []string{
+	ScopeProfileRead,
+	ScopeArticleRead,
+	ScopeArticleWrite,
+	ScopeCommentWrite,
+}
+
+// AccessToken is a personal access token for API automation. It acts as its
+// owner, limited to its scopes. Only the token hash is stored.
+type AccessToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	TokenHash  string     `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	Prefix     string     `gorm:"size:16" json:"prefix"` // Start of the token, to tell tokens apart
+	Scopes     string     `gorm:"size:255" json:"-"`     // Space separated
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ScopeList returns the token's scopes
+func (t *AccessToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+// HasScope checks if the token was granted a scope
+func (t *AccessToken) HasScope(scope string) bool {
+	for _, s := range t.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExpired checks if the token has expired
+func (t *AccessToken) IsExpired() bool {
+	return t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+}
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrAuditLogAppendOnly is returned when something tries to change or remove an audit log entry
+var ErrAuditLogAppendOnly = errors.New("audit log entries can't be changed or deleted")
+
+// Audit log actions
+const (
+	AuditUserStatus             = "user.status"
+	AuditUserMembership         = "user.membership"
+	AuditUserRoleAssign         = "user.role.assign"
+	AuditUserRoleRemove         = "user.role.remove"
+	AuditUserUnlock             = "user.unlock"
+	AuditUserDelete             = "user.delete"
+	AuditUserImpersonate        = "user.impersonate"
+	AuditUserImpersonateEnd     = "user.impersonate.end"
+	AuditUserImport             = "user.import"
+	AuditUserExport             = "user.export"
+	AuditArticleCreate          = "article.create"
+	AuditArticleUpdate          = "article.update"
+	AuditArticleDelete          = "article.delete"
+	AuditArticlePublish         = "article.publish"
+	AuditArticleUnpublish       = "article.unpublish"
+	AuditCommentDelete          = "comment.delete"
+	AuditSiteSettingsUpdate     = "settings.site.update"
+	AuditSecuritySettingsUpdate = "settings.security.update"
+	AuditInvitationCreate       = "invitation.create"
+	AuditInvitationRevoke       = "invitation.revoke"
+	AuditEmailRetry             = "email.retry"
+	AuditEmailTemplateUpdate    = "email_template.update"
+	AuditEmailTemplateReset     = "email_template.reset"
+	AuditEmailSuppressionDelete = "email_suppression.delete"
+)
+
+// Audit log target types
+const (
+	AuditTargetUser             = "user"
+	AuditTargetArticle          = "article"
+	AuditTargetComment          = "comment"
+	AuditTargetSettings         = "settings"
+	AuditTargetInvitation       = "invitation"
+	AuditTargetEmail            = "email"
+	AuditTargetEmailTemplate    = "email_template"
+	AuditTargetEmailSuppression = "email_suppression"
+)
+
+// AuditLog records a privileged action: who did what to which object, and
+// how the object changed. Entries are never updated or deleted.
+type AuditLog struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	ActorID       uint      `gorm:"not null;index" json:"actor_id"`
+	ActorEmail    string    `gorm:"size:255" json:"actor_email"` // As it was at the time
+	AccessTokenID *uint     `json:"access_token_id,omitempty"`   // Set when the actor used a personal access token
+	Action        string    `gorm:"size:50;not null;index" json:"action"`
+	TargetType    string    `gorm:"size:50;not null;index:idx_audit_logs_target" json:"target_type"`
+	TargetID      string    `gorm:"size:100;index:idx_audit_logs_target" json:"target_id"`
+	Changes       string    `gorm:"type:text" json:"-"` // JSON object of changed fields, each with before and after values
+	IP            string    `gorm:"size:45" json:"ip"`
+	UserAgent     string    `gorm:"size:512" json:"user_agent"`
+	CreatedAt     time.Time `gorm:"index" json:"created_at"`
+}
+
+// BeforeUpdate keeps audit log entries from being changed
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
+
+// BeforeDelete keeps audit log entries from being deleted
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
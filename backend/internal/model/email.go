@@ -0,0 +1,70 @@
+package model
+
+import (
+	"time"
+)
+
+// EmailStatus defines the delivery status of an outbox message
+type EmailStatus string
+
+const (
+	EmailStatusPending EmailStatus = "pending" // Waiting to be sent (or retried)
+	EmailStatusSending EmailStatus = "sending" // Claimed by the sender
+	EmailStatusSent    EmailStatus = "sent"    // Delivered to the provider
+	EmailStatusFailed  EmailStatus = "failed"  // Dead-lettered after max attempts
+)
+
+// Outbox priorities; higher priority messages are sent first so transactional
+// mail is not stuck behind a large newsletter
+const (
+	EmailPriorityBulk          = 0
+	EmailPriorityTransactional = 10
+)
+
+// EmailOutbox represents an email queued for delivery by the background sender
+type EmailOutbox struct {
+	ID            uint        `gorm:"primaryKey" json:"id"`
+	Category      string      `gorm:"size:50;index" json:"category"`
+	From          string      `gorm:"size:255" json:"from"`
+	To            string      `gorm:"size:255;not null;index" json:"to"`
+	Subject       string      `gorm:"size:500" json:"subject"`
+	HTMLBody      string      `gorm:"type:text" json:"html_body,omitempty"`
+	TextBody      string      `gorm:"type:text" json:"text_body,omitempty"`
+	Headers       string      `gorm:"type:text" json:"-"` // JSON encoded extra headers
+	Status        EmailStatus `gorm:"size:20;default:'pending';index" json:"status"`
+	Priority      int         `gorm:"index" json:"priority"`
+	Attempts      int         `gorm:"default:0" json:"attempts"`
+	MaxAttempts   int         `gorm:"default:8" json:"max_attempts"`
+	NextAttemptAt time.Time   `gorm:"index" json:"next_attempt_at"`
+	LockedUntil   *time.Time  `json:"-"`
+	LastError     string      `gorm:"type:text" json:"last_error,omitempty"`
+	SentAt        *time.Time  `json:"sent_at,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+// TableName overrides the table name
+func (EmailOutbox) TableName() string {
+	return "email_outbox"
+}
+
+// SuppressionReason defines why an address no longer receives email
+type SuppressionReason string
+
+const (
+	SuppressionReasonBounce    SuppressionReason = "bounce"    // Hard (permanent) bounce
+	SuppressionReasonComplaint SuppressionReason = "complaint" // Recipient marked a message as spam
+)
+
+// EmailSuppression is an address that must not be emailed again, e.g. after a hard bounce
+type EmailSuppression struct {
+	ID           uint              `gorm:"primaryKey" json:"id"`
+	Email        string            `gorm:"uniqueIndex;size:255;not null" json:"email"`
+	Reason       SuppressionReason `gorm:"size:20;index" json:"reason"`
+	Detail       string            `gorm:"type:text" json:"detail,omitempty"`
+	FeedbackID   string            `gorm:"size:255" json:"feedback_id,omitempty"` // Provider's bounce/complaint ID
+	UserID       *uint             `gorm:"index" json:"user_id,omitempty"`
+	SubscriberID *uint             `gorm:"index" json:"subscriber_id,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// Registration modes
+const (
+	RegistrationModeOpen   = "open"   // Anyone can sign up
+	RegistrationModeClosed = "closed" // Nobody can sign up
+	RegistrationModeInvite = "invite" // Sign-up needs an invitation
+	RegistrationModeDomain = "domain" // Sign-up is limited to allowed email domains, or an invitation
+)
+
+// RegistrationModes lists the valid registration modes
+var RegistrationModes = []string{
+	RegistrationModeOpen,
+	RegistrationModeClosed,
+	RegistrationModeInvite,
+	RegistrationModeDomain,
+}
+
+// Invitation is an admin-generated sign-up link. It can be limited to one
+// email and grants roles and membership to the accounts it creates. Only the
+// token hash is stored.
+type Invitation struct {
+	ID          uint            `gorm:"primaryKey" json:"id"`
+	TokenHash   string          `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	Email       string          `gorm:"size:255;index" json:"email,omitempty"` // Only this email can use the invitation, if set
+	Roles       string          `gorm:"size:255" json:"-"`                     // Space separated role codes granted on verification
+	MemberDays  int             `gorm:"default:0" json:"member_days"`          // Days of membership granted on verification
+	MaxUses     int             `gorm:"default:1" json:"max_uses"`
+	UseCount    int             `gorm:"default:0" json:"use_count"`
+	Note        string          `gorm:"size:255" json:"note"`
+	CreatedByID uint            `gorm:"index" json:"created_by_id"`
+	ExpiresAt   time.Time       `gorm:"index" json:"expires_at"`
+	RevokedAt   *time.Time      `json:"revoked_at,omitempty"`
+	Uses        []InvitationUse `json:"uses,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// InvitationUse records an account created with an invitation. The
+// invitation's roles and membership are only granted once the account's email
+// is verified.
+type InvitationUse struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	InvitationID uint       `gorm:"not null;index" json:"invitation_id"`
+	UserID       uint       `gorm:"not null;index" json:"user_id"`
+	Email        string     `gorm:"size:255" json:"email"`
+	GrantedAt    *time.Time `json:"granted_at,omitempty"` // When the roles and membership were granted
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// RoleList returns the role codes the invitation grants
+func (i *Invitation) RoleList() []string {
+	return strings.Fields(i.Roles)
+}
+
+// IsUsable checks if the invitation can still create an account at the given time
+func (i *Invitation) IsUsable(now time.Time) bool {
+	return i.RevokedAt == nil && now.Before(i.ExpiresAt) && i.UseCount < i.MaxUses
+}
@@ -1,7 +1,7 @@
 package model
 
 import (
-	"log"
+	"log/slog"
 	"os"
 
 	"golang.org/x/crypto/bcrypt"
@@ -10,27 +10,48 @@ import (
 
 // Migrate runs database migrations
 func Migrate(db *gorm.DB) error {
-	log.Println("Running database migrations...")
+	slog.Info("Running database migrations")
 
 	err := db.AutoMigrate(
 		&User{},
+		&RecoveryCode{},
+		&PasswordHistory{},
+		&UserIdentity{},
+		&MagicLink{},
+		&PasswordReset{},
+		&EmailChange{},
+		&AccessToken{},
+		&Invitation{},
+		&InvitationUse{},
+		&LoginAttempt{},
+		&Passkey{},
+		&PasskeyChallenge{},
 		&Role{},
 		&Permission{},
 		&Article{},
 		&Comment{},
 		&Setting{},
+		&EmailOutbox{},
+		&Subscriber{},
+		&EmailSuppression{},
+		&AuditLog{},
 	)
 	if err != nil {
 		return err
 	}
 
-	log.Println("Database migrations completed successfully")
+	// User imports look emails up regardless of case
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email))").Error; err != nil {
+		return err
+	}
+
+	slog.Info("Database migrations completed")
 	return nil
 }
 
 // Seed seeds the database with initial data
 func Seed(db *gorm.DB) error {
-	log.Println("Seeding database...")
+	slog.Info("Seeding database")
 
 	// Seed roles
 	if err := seedRoles(db); err != nil {
@@ -52,7 +73,7 @@ func Seed(db *gorm.DB) error {
 		return err
 	}
 
-	log.Println("Database seeding completed successfully")
+	slog.Info("Database seeding completed")
 	return nil
 }
 
@@ -75,7 +96,7 @@ func seedSiteSettings(db *gorm.DB) error {
 			if err := db.Create(&Setting{Key: key, Value: value}).Error; err != nil {
 				return err
 			}
-			log.Printf("Created setting: %s", key)
+			slog.Info("Created setting", "key", key)
 		}
 	}
 
@@ -98,7 +119,7 @@ func seedRoles(db *gorm.DB) error {
 			if err := db.Create(&role).Error; err != nil {
 				return err
 			}
-			log.Printf("Created role: %s", role.Code)
+			slog.Info("Created role", "role", role.Code)
 		}
 	}
 
@@ -121,7 +142,7 @@ func seedPermissions(db *gorm.DB) error {
 			if err := db.Create(&perm).Error; err != nil {
 				return err
 			}
-			log.Printf("Created permission: %s", perm.Code)
+			slog.Info("Created permission", "permission", perm.Code)
 		}
 	}
 
@@ -153,7 +174,7 @@ func assignAdminPermissions(db *gorm.DB) error {
 		return err
 	}
 
-	log.Println("Assigned all permissions to admin role")
+	slog.Info("Assigned all permissions to admin role")
 	return nil
 }
 
@@ -164,7 +185,7 @@ func CreateAdminFromEnv(db *gorm.DB) error {
 	adminPassword := os.Getenv("ADMIN_PASSWORD")
 
 	if adminEmail == "" || adminPassword == "" {
-		log.Println("ADMIN_EMAIL or ADMIN_PASSWORD not set, skipping admin user creation")
+		slog.Info("ADMIN_EMAIL or ADMIN_PASSWORD not set, skipping admin user creation")
 		return nil
 	}
 
@@ -172,7 +193,7 @@ func CreateAdminFromEnv(db *gorm.DB) error {
 	var existingUser User
 	result := db.Where("email = ?", adminEmail).First(&existingUser)
 	if result.Error == nil {
-		log.Printf("Admin user %s already exists, skipping creation", adminEmail)
+		slog.Info("Admin user already exists, skipping creation", "email", adminEmail)
 		return nil
 	}
 
@@ -201,6 +222,6 @@ func CreateAdminFromEnv(db *gorm.DB) error {
 		return err
 	}
 
-	log.Printf("Created admin user: %s", adminEmail)
+	slog.Info("Created admin user", "email", adminEmail)
 	return nil
 }
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"time"
+)
+
+// Passkey is a WebAuthn credential a user can sign in with
+type Passkey struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	UserID         uint       `gorm:"not null;index" json:"user_id"`
+	CredentialID   string     `gorm:"uniqueIndex;size:1400;not null" json:"-"` // base64url
+	PublicKey      []byte     `gorm:"not null" json:"-"`                       // COSE_Key
+	SignCount      uint32     `gorm:"default:0" json:"-"`
+	AAGUID         string     `gorm:"size:32" json:"-"`  // Authenticator model, hex
+	Transports     string     `gorm:"size:255" json:"-"` // Comma separated, passed back to the browser as hints
+	Name           string     `gorm:"size:100;not null" json:"name"`
+	BackupEligible bool       `gorm:"default:false" json:"backup_eligible"` // Synced passkey, e.g. in a password manager
+	BackedUp       bool       `gorm:"default:false" json:"backed_up"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// PasskeyChallengePurpose defines which ceremony a challenge was issued for
+type PasskeyChallengePurpose string
+
+const (
+	PasskeyChallengeRegistration PasskeyChallengePurpose = "registration"
+	PasskeyChallengeLogin        PasskeyChallengePurpose = "login"
+)
+
+// PasskeyChallenge is an outstanding WebAuthn challenge. It is deleted when
+// used so a signed response can't be replayed.
+type PasskeyChallenge struct {
+	ID        uint                    `gorm:"primaryKey"`
+	Challenge string                  `gorm:"uniqueIndex;size:64;not null"` // base64url
+	Purpose   PasskeyChallengePurpose `gorm:"size:20;not null"`
+	UserID    *uint                   // Set for registration
+	ExpiresAt time.Time               `gorm:"index"`
+	CreatedAt time.Time
+}
@@ -42,3 +42,34 @@ func DefaultSiteSettings() *SiteSettings {
 		LogoURL:           "",
 	}
 }
+
+// SecuritySettings holds admin-only security policy settings. They are managed
+// separately from SiteSettings, which is public.
+type SecuritySettings struct {
+	RequireAdmin2FA      bool `json:"require_admin_2fa"`       // Admins must enable two-factor authentication
+	AllowMagicLinkSignup bool `json:"allow_magic_link_signup"` // Magic links to unknown emails create an account
+	ChallengeEnabled     bool `json:"challenge_enabled"`       // Registration and comments require a proof-of-work challenge
+	ChallengeDifficulty  int  `json:"challenge_difficulty"`    // Base challenge difficulty in leading zero bits
+
+	RegistrationMode    string   `json:"registration_mode"`     // open, closed, invite or domain
+	AllowedEmailDomains []string `json:"allowed_email_domains"` // Domains that can sign up in domain mode
+}
+
+// Challenge difficulty bounds; each extra bit doubles the expected work
+const (
+	MinChallengeDifficulty     = 8
+	MaxChallengeDifficulty     = 24
+	DefaultChallengeDifficulty = 16
+)
+
+// DefaultSecuritySettings returns default security settings
+func DefaultSecuritySettings() *SecuritySettings {
+	return &SecuritySettings{
+		RequireAdmin2FA:      false,
+		AllowMagicLinkSignup: false,
+		ChallengeEnabled:     false,
+		ChallengeDifficulty:  DefaultChallengeDifficulty,
+		RegistrationMode:     RegistrationModeOpen,
+		AllowedEmailDomains:  []string{},
+	}
+}
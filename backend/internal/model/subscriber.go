@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+)
+
+// SubscriberStatus defines the status of a newsletter subscription
+type SubscriberStatus string
+
+const (
+	SubscriberStatusPending      SubscriberStatus = "pending"      // Waiting for double opt-in confirmation
+	SubscriberStatusActive       SubscriberStatus = "active"       // Receives new-post emails
+	SubscriberStatusUnsubscribed SubscriberStatus = "unsubscribed" // Opted out
+)
+
+// SubscriptionFrequency defines how often a subscriber is emailed
+type SubscriptionFrequency string
+
+const (
+	FrequencyInstant SubscriptionFrequency = "instant" // One email per published article
+	FrequencyDaily   SubscriptionFrequency = "daily"   // Daily digest
+	FrequencyWeekly  SubscriptionFrequency = "weekly"  // Weekly digest
+)
+
+// Subscriber represents a newsletter subscriber, with or without a user account
+type Subscriber struct {
+	ID                 uint                  `gorm:"primaryKey" json:"id"`
+	Email              string                `gorm:"uniqueIndex;size:255;not null" json:"email"`
+	UserID             *uint                 `gorm:"index" json:"user_id,omitempty"`
+	Status             SubscriberStatus      `gorm:"size:20;default:'pending';index" json:"status"`
+	Frequency          SubscriptionFrequency `gorm:"size:20;default:'instant';index" json:"frequency"`
+	Language           string                `gorm:"size:10" json:"language"`
+	ConfirmToken       *string               `gorm:"size:64;index" json:"-"`
+	ConfirmExpireAt    *time.Time            `json:"-"`
+	ConfirmationSentAt *time.Time            `json:"-"`
+	ConfirmedAt        *time.Time            `json:"confirmed_at,omitempty"`
+	UnsubscribedAt     *time.Time            `json:"unsubscribed_at,omitempty"`
+	LastDigestAt       *time.Time            `json:"last_digest_at,omitempty"`
+	CreatedAt          time.Time             `json:"created_at"`
+	UpdatedAt          time.Time             `json:"updated_at"`
+}
+
+// IsActive checks if the subscriber should receive emails
+func (s *Subscriber) IsActive() bool {
+	return s.Status == SubscriberStatusActive
+}
@@ -16,19 +16,101 @@ type User struct {
 	EmailVerificationExpireAt *time.Time     `json:"-"`
 	EmailVerificationSentAt   *time.Time     `json:"-"`
 	MemberExpireAt            *time.Time     `json:"member_expire_at,omitempty"`
-	Status                    int            `gorm:"default:0" json:"status"` // 0: active, 1: disabled
+	Language                  string         `gorm:"size:10" json:"language"` // Preferred language for emails
+	TOTPSecret                *string        `gorm:"size:64" json:"-"`
+	TOTPEnabled               bool           `gorm:"default:false" json:"totp_enabled"`
+	TOTPLastCounter           int64          `gorm:"default:0" json:"-"` // Last accepted time step, to reject replayed codes
+	TOTPFailedAttempts        int            `gorm:"default:0" json:"-"`
+	TOTPLockedUntil           *time.Time     `json:"-"`
+	SessionVersion            int            `gorm:"default:0" json:"-"`                           // Sessions issued for an older version are revoked
+	RolesVersion              int            `gorm:"default:0" json:"-"`                           // Bumped when roles change, so sessions are re-issued with the current roles
+	Status                    int            `gorm:"default:0" json:"status"`                      // 0: active, 1: disabled
+	DeletionScheduledAt       *time.Time     `gorm:"index" json:"deletion_scheduled_at,omitempty"` // The account is anonymized after this time
 	Roles                     []Role         `gorm:"many2many:user_roles;" json:"roles,omitempty"`
 	CreatedAt                 time.Time      `json:"created_at"`
 	UpdatedAt                 time.Time      `json:"updated_at"`
 	DeletedAt                 gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// RecoveryCode is a hashed one-time code that can replace a TOTP code when the authenticator is lost
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null;index" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// PasswordHistory is a hash of a password the user had before, so it isn't reused
+type PasswordHistory struct {
+	ID           uint      `gorm:"primaryKey"`
+	UserID       uint      `gorm:"not null;index"`
+	PasswordHash string    `gorm:"size:255;not null"`
+	CreatedAt    time.Time `gorm:"index"`
+}
+
+// MagicLink is a single-use passwordless sign-in link sent by email. Only the
+// token hash is stored.
+type MagicLink struct {
+	ID        uint      `gorm:"primaryKey"`
+	Email     string    `gorm:"size:255;not null;index"`
+	TokenHash string    `gorm:"uniqueIndex;size:64;not null"`
+	Language  string    `gorm:"size:10"` // Email language, kept for accounts the link creates
+	RequestIP string    `gorm:"size:45;index"`
+	ExpiresAt time.Time `gorm:"index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// PasswordReset is a single-use link sent by email to set a new password.
+// Only the token hash is stored.
+type PasswordReset struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"uniqueIndex;size:64;not null"`
+	RequestIP string    `gorm:"size:45;index"`
+	ExpiresAt time.Time `gorm:"index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// EmailChange is a pending change of a user's email address. It applies once
+// the new address is confirmed; the old address gets a link to cancel it.
+// Only token hashes are stored.
+type EmailChange struct {
+	ID              uint      `gorm:"primaryKey"`
+	UserID          uint      `gorm:"not null;index"`
+	NewEmail        string    `gorm:"size:255;not null"`
+	TokenHash       string    `gorm:"uniqueIndex;size:64;not null"` // Confirmation link sent to the new address
+	CancelTokenHash string    `gorm:"uniqueIndex;size:64;not null"` // Cancel link sent to the old address
+	ExpiresAt       time.Time `gorm:"index"`
+	CreatedAt       time.Time
+}
+
+// LoginAttempt tracks failed password sign-ins for one account or IP address
+type LoginAttempt struct {
+	ID            uint       `gorm:"primaryKey" json:"-"`
+	Key           string     `gorm:"uniqueIndex;size:300;not null" json:"key"` // "account:<email>" or "ip:<address>"
+	Failures      int        `gorm:"default:0" json:"failures"`
+	WindowStart   time.Time  `json:"window_start"`
+	LastFailureAt time.Time  `gorm:"index" json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+// IsLocked checks if the key is locked out at the given time
+func (a *LoginAttempt) IsLocked(now time.Time) bool {
+	return a.LockedUntil != nil && now.Before(*a.LockedUntil)
+}
+
 // UserStatus constants
 const (
 	UserStatusActive   = 0
 	UserStatusDisabled = 1
 )
 
+// DeletedUserName is shown instead of the author of content left by a deleted account
+const DeletedUserName = "deleted user"
+
 // IsMember checks if the user has an active membership
 // A user is considered a member if they have the member role OR have an active membership expiration date
 func (u *User) IsMember() bool {
@@ -63,6 +145,19 @@ func (u *User) HasRole(roleCode string) bool {
 	return false
 }
 
+// HasPermission checks if any of the user's roles grants a permission. The
+// roles' permissions must be loaded.
+func (u *User) HasPermission(permissionCode string) bool {
+	for _, role := range u.Roles {
+		for _, permission := range role.Permissions {
+			if permission.Code == permissionCode {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // GetRoleCodes returns a slice of role codes for the user
 func (u *User) GetRoleCodes() []string {
 	codes := make([]string, len(u.Roles))
@@ -106,3 +201,15 @@ const (
 	PermissionCommentManage = "comment.manage"
 	PermissionRoleManage    = "role.manage"
 )
+
+// UserIdentity links a user to an account at an external sign-in provider
+type UserIdentity struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	Provider    string     `gorm:"size:50;not null;uniqueIndex:idx_identity_provider_subject" json:"provider"`
+	Subject     string     `gorm:"size:255;not null;uniqueIndex:idx_identity_provider_subject" json:"-"` // Account ID at the provider
+	Email       string     `gorm:"size:255" json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+type AccessTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewAccessTokenRepository(db *gorm.DB) *AccessTokenRepository {
+	return &AccessTokenRepository{db: db}
+}
+
+// Create creates a new access token
+func (r *AccessTokenRepository) Create(token *model.AccessToken) error {
+	return r.db.Create(token).Error
+}
+
+// FindByID finds an access token by ID
+func (r *AccessTokenRepository) FindByID(id uint) (*model.AccessToken, error) {
+	var token model.AccessToken
+	err := r.db.First(&token, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// FindByTokenHash finds an access token by its hash
+func (r *AccessTokenRepository) FindByTokenHash(tokenHash string) (*model.AccessToken, error) {
+	var token model.AccessToken
+	err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// FindByUserID returns a user's access tokens, newest first
+func (r *AccessTokenRepository) FindByUserID(userID uint) ([]model.AccessToken, error) {
+	var tokens []model.AccessToken
+	err := r.db.Where("user_id = ?", userID).Order("id DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// CountByUserID counts a user's access tokens
+func (r *AccessTokenRepository) CountByUserID(userID uint) int64 {
+	var count int64
+	r.db.Model(&model.AccessToken{}).Where("user_id = ?", userID).Count(&count)
+	return count
+}
+
+// UpdateLastUsed records when a token was last used
+func (r *AccessTokenRepository) UpdateLastUsed(id uint, usedAt time.Time) error {
+	return r.db.Model(&model.AccessToken{}).Where("id = ?", id).Update("last_used_at", usedAt).Error
+}
+
+// Delete deletes an access token
+func (r *AccessTokenRepository) Delete(id uint) error {
+	return r.db.Delete(&model.AccessToken{}, id).Error
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/lite-blog/backend/internal/model"
 	"gorm.io/gorm"
 )
@@ -76,6 +78,16 @@ func (r *ArticleRepository) FindPublished(page, pageSize int) ([]model.Article,
 	return articles, total, nil
 }
 
+// FindPublishedSince finds published, non-hidden articles published after the given time
+func (r *ArticleRepository) FindPublishedSince(since time.Time) ([]model.Article, error) {
+	var articles []model.Article
+	err := r.db.Where("status = ? AND visibility != ? AND published_at > ?",
+		model.ArticleStatusPublished, model.VisibilityHidden, since).
+		Order("published_at ASC").
+		Find(&articles).Error
+	return articles, err
+}
+
 // FindAll finds all articles with pagination (for admin)
 func (r *ArticleRepository) FindAll(page, pageSize int) ([]model.Article, int64, error) {
 	var articles []model.Article
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// AuditLogFilter narrows the audit log; zero fields match everything
+type AuditLogFilter struct {
+	ActorID    uint
+	Action     string
+	TargetType string
+	TargetID   string
+	From       *time.Time
+	To         *time.Time
+}
+
+// AuditLogRepository appends to and reads the audit log. It has no way to
+// change or delete entries.
+type AuditLogRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditLogRepository(db *gorm.DB) *AuditLogRepository {
+	return &AuditLogRepository{db: db}
+}
+
+func (r *AuditLogRepository) Create(entry *model.AuditLog) error {
+	return r.db.Create(entry).Error
+}
+
+// List returns a page of entries matching the filter, newest first
+func (r *AuditLogRepository) List(filter AuditLogFilter, page, pageSize int) ([]model.AuditLog, int64, error) {
+	var entries []model.AuditLog
+	var total int64
+
+	query := r.filtered(filter)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := query.Order("id DESC").Offset(offset).Limit(pageSize).Find(&entries).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
+
+// Each calls fn with batches of entries matching the filter, oldest first
+func (r *AuditLogRepository) Each(filter AuditLogFilter, batchSize int, fn func([]model.AuditLog) error) error {
+	var batch []model.AuditLog
+	return r.filtered(filter).FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+		return fn(batch)
+	}).Error
+}
+
+func (r *AuditLogRepository) filtered(filter AuditLogFilter) *gorm.DB {
+	query := r.db.Model(&model.AuditLog{})
+	if filter.ActorID != 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	return query
+}
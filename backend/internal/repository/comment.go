@@ -66,6 +66,21 @@ func (r *CommentRepository) FindByArticleID(articleID uint, page, pageSize int)
 	return comments, total, nil
 }
 
+// FindByUserID finds all comments by a user with the article they are on
+func (r *CommentRepository) FindByUserID(userID uint) ([]model.Comment, error) {
+	var comments []model.Comment
+	err := r.db.Preload("Article", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped().Select("id", "title", "slug")
+	}).
+		Where("user_id = ?", userID).
+		Order("created_at ASC").
+		Find(&comments).Error
+	if err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
 // FindReplies finds all replies to a comment
 func (r *CommentRepository) FindReplies(parentID uint) ([]model.Comment, error) {
 	var comments []model.Comment
@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+type EmailOutboxRepository struct {
+	db *gorm.DB
+}
+
+func NewEmailOutboxRepository(db *gorm.DB) *EmailOutboxRepository {
+	return &EmailOutboxRepository{db: db}
+}
+
+// Create queues a new message
+func (r *EmailOutboxRepository) Create(message *model.EmailOutbox) error {
+	return r.db.Create(message).Error
+}
+
+// CreateBatch queues many messages at once
+func (r *EmailOutboxRepository) CreateBatch(messages []model.EmailOutbox) error {
+	return r.db.CreateInBatches(messages, 100).Error
+}
+
+// FindByID finds a message by ID
+func (r *EmailOutboxRepository) FindByID(id uint) (*model.EmailOutbox, error) {
+	var message model.EmailOutbox
+	err := r.db.First(&message, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// ClaimDue marks up to limit due messages as sending and returns them.
+// Messages stuck in sending whose lease expired (e.g. after a crash) are claimed again.
+func (r *EmailOutboxRepository) ClaimDue(now time.Time, limit int, lease time.Duration) ([]model.EmailOutbox, error) {
+	var messages []model.EmailOutbox
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("(status = ? AND next_attempt_at <= ?) OR (status = ? AND locked_until < ?)",
+			model.EmailStatusPending, now, model.EmailStatusSending, now).
+			Order("priority DESC, next_attempt_at ASC").
+			Limit(limit).
+			Find(&messages).Error
+		if err != nil || len(messages) == 0 {
+			return err
+		}
+
+		ids := make([]uint, len(messages))
+		for i := range messages {
+			ids[i] = messages[i].ID
+		}
+
+		lockedUntil := now.Add(lease)
+		for i := range messages {
+			messages[i].Status = model.EmailStatusSending
+			messages[i].LockedUntil = &lockedUntil
+		}
+		return tx.Model(&model.EmailOutbox{}).
+			Where("id IN ?", ids).
+			Updates(map[string]interface{}{
+				"status":       model.EmailStatusSending,
+				"locked_until": lockedUntil,
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// MarkSent records a successful delivery
+func (r *EmailOutboxRepository) MarkSent(id uint, attempts int, sentAt time.Time) error {
+	return r.db.Model(&model.EmailOutbox{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":       model.EmailStatusSent,
+		"attempts":     attempts,
+		"sent_at":      sentAt,
+		"locked_until": nil,
+		"last_error":   "",
+	}).Error
+}
+
+// MarkAttemptFailed records a failed attempt and either schedules a retry or dead-letters the message
+func (r *EmailOutboxRepository) MarkAttemptFailed(id uint, attempts int, status model.EmailStatus, nextAttemptAt time.Time, lastError string) error {
+	return r.db.Model(&model.EmailOutbox{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          status,
+		"attempts":        attempts,
+		"next_attempt_at": nextAttemptAt,
+		"locked_until":    nil,
+		"last_error":      lastError,
+	}).Error
+}
+
+// Release puts a claimed message back into the queue without counting an attempt
+func (r *EmailOutboxRepository) Release(id uint) error {
+	return r.db.Model(&model.EmailOutbox{}).
+		Where("id = ? AND status = ?", id, model.EmailStatusSending).
+		Updates(map[string]interface{}{
+			"status":       model.EmailStatusPending,
+			"locked_until": nil,
+		}).Error
+}
+
+// Requeue resets a message so the sender picks it up again immediately
+func (r *EmailOutboxRepository) Requeue(id uint, now time.Time) error {
+	return r.db.Model(&model.EmailOutbox{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          model.EmailStatusPending,
+		"attempts":        0,
+		"next_attempt_at": now,
+		"locked_until":    nil,
+	}).Error
+}
+
+// List lists messages with pagination, optionally filtered by status
+func (r *EmailOutboxRepository) List(status string, page, pageSize int) ([]model.EmailOutbox, int64, error) {
+	var messages []model.EmailOutbox
+	var total int64
+
+	query := r.db.Model(&model.EmailOutbox{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := query.Omit("html_body", "text_body").
+		Order("created_at DESC").
+		Offset(offset).
+		Limit(pageSize).
+		Find(&messages).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return messages, total, nil
+}
+
+type EmailSuppressionRepository struct {
+	db *gorm.DB
+}
+
+func NewEmailSuppressionRepository(db *gorm.DB) *EmailSuppressionRepository {
+	return &EmailSuppressionRepository{db: db}
+}
+
+// Upsert records a suppression, updating the reason if the address is already suppressed
+func (r *EmailSuppressionRepository) Upsert(suppression *model.EmailSuppression) error {
+	var existing model.EmailSuppression
+	err := r.db.Where("email = ?", suppression.Email).First(&existing).Error
+	if err == gorm.ErrRecordNotFound {
+		return r.db.Create(suppression).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	suppression.ID = existing.ID
+	suppression.CreatedAt = existing.CreatedAt
+	return r.db.Save(suppression).Error
+}
+
+// FindByID finds a suppression by ID
+func (r *EmailSuppressionRepository) FindByID(id uint) (*model.EmailSuppression, error) {
+	var suppression model.EmailSuppression
+	err := r.db.First(&suppression, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &suppression, nil
+}
+
+// IsSuppressed checks if an address is suppressed
+func (r *EmailSuppressionRepository) IsSuppressed(email string) bool {
+	var count int64
+	r.db.Model(&model.EmailSuppression{}).Where("email = ?", strings.ToLower(email)).Count(&count)
+	return count > 0
+}
+
+// FindSuppressed returns which of the given addresses are suppressed
+func (r *EmailSuppressionRepository) FindSuppressed(emails []string) (map[string]bool, error) {
+	lower := make([]string, len(emails))
+	for i, email := range emails {
+		lower[i] = strings.ToLower(email)
+	}
+
+	var suppressed []string
+	err := r.db.Model(&model.EmailSuppression{}).Where("email IN ?", lower).Pluck("email", &suppressed).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]bool, len(suppressed))
+	for _, email := range suppressed {
+		result[email] = true
+	}
+	return result, nil
+}
+
+// Delete removes a suppression so the address can be emailed again
+func (r *EmailSuppressionRepository) Delete(id uint) error {
+	return r.db.Delete(&model.EmailSuppression{}, id).Error
+}
+
+// List lists suppressions with pagination, optionally filtered by reason
+func (r *EmailSuppressionRepository) List(reason string, page, pageSize int) ([]model.EmailSuppression, int64, error) {
+	var suppressions []model.EmailSuppression
+	var total int64
+
+	query := r.db.Model(&model.EmailSuppression{})
+	if reason != "" {
+		query = query.Where("reason = ?", reason)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := query.Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&suppressions).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return suppressions, total, nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+type EmailChangeRepository struct {
+	db *gorm.DB
+}
+
+func NewEmailChangeRepository(db *gorm.DB) *EmailChangeRepository {
+	return &EmailChangeRepository{db: db}
+}
+
+// Create replaces the user's pending email change, also purging expired changes
+func (r *EmailChangeRepository) Create(change *model.EmailChange) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? OR expires_at < ?", change.UserID, time.Now()).Delete(&model.EmailChange{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(change).Error
+	})
+}
+
+// FindByUserID finds the user's pending email change
+func (r *EmailChangeRepository) FindByUserID(userID uint) (*model.EmailChange, error) {
+	var change model.EmailChange
+	err := r.db.Where("user_id = ?", userID).Order("id DESC").First(&change).Error
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// FindByTokenHash finds an email change by its confirmation token hash
+func (r *EmailChangeRepository) FindByTokenHash(tokenHash string) (*model.EmailChange, error) {
+	var change model.EmailChange
+	err := r.db.Where("token_hash = ?", tokenHash).First(&change).Error
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// FindByCancelTokenHash finds an email change by its cancel token hash
+func (r *EmailChangeRepository) FindByCancelTokenHash(tokenHash string) (*model.EmailChange, error) {
+	var change model.EmailChange
+	err := r.db.Where("cancel_token_hash = ?", tokenHash).First(&change).Error
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// Delete removes an email change. It reports false if it was already gone, so
+// a change can't be applied twice even by concurrent requests.
+func (r *EmailChangeRepository) Delete(id uint) (bool, error) {
+	result := r.db.Delete(&model.EmailChange{}, id)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeleteByUserID removes the user's pending email change
+func (r *EmailChangeRepository) DeleteByUserID(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&model.EmailChange{}).Error
+}
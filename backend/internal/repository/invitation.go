@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+type InvitationRepository struct {
+	db *gorm.DB
+}
+
+func NewInvitationRepository(db *gorm.DB) *InvitationRepository {
+	return &InvitationRepository{db: db}
+}
+
+// Create creates a new invitation
+func (r *InvitationRepository) Create(invitation *model.Invitation) error {
+	return r.db.Create(invitation).Error
+}
+
+// FindByID finds an invitation by ID
+func (r *InvitationRepository) FindByID(id uint) (*model.Invitation, error) {
+	var invitation model.Invitation
+	err := r.db.First(&invitation, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// FindByTokenHash finds an invitation by its token hash
+func (r *InvitationRepository) FindByTokenHash(tokenHash string) (*model.Invitation, error) {
+	var invitation model.Invitation
+	err := r.db.Where("token_hash = ?", tokenHash).First(&invitation).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// List returns invitations with the accounts that used them, newest first
+func (r *InvitationRepository) List(page, pageSize int) ([]model.Invitation, int64, error) {
+	var invitations []model.Invitation
+	var total int64
+
+	r.db.Model(&model.Invitation{}).Count(&total)
+
+	offset := (page - 1) * pageSize
+	err := r.db.Preload("Uses").Offset(offset).Limit(pageSize).Order("id DESC").Find(&invitations).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return invitations, total, nil
+}
+
+// Reserve takes one use of a usable invitation. It reports false if the
+// invitation was used up, revoked or expired, so concurrent sign-ups can't
+// exceed its uses.
+func (r *InvitationRepository) Reserve(id uint, now time.Time) (bool, error) {
+	result := r.db.Model(&model.Invitation{}).
+		Where("id = ? AND use_count < max_uses AND revoked_at IS NULL AND expires_at > ?", id, now).
+		Update("use_count", gorm.Expr("use_count + 1"))
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Release gives back a reserved use when the sign-up failed
+func (r *InvitationRepository) Release(id uint) error {
+	return r.db.Model(&model.Invitation{}).
+		Where("id = ? AND use_count > 0", id).
+		Update("use_count", gorm.Expr("use_count - 1")).Error
+}
+
+// Revoke stops an invitation from being used
+func (r *InvitationRepository) Revoke(id uint, revokedAt time.Time) error {
+	return r.db.Model(&model.Invitation{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", revokedAt).Error
+}
+
+// CreateUse records an account created with an invitation
+func (r *InvitationRepository) CreateUse(use *model.InvitationUse) error {
+	return r.db.Create(use).Error
+}
+
+// FindUngrantedUses returns the uses by a user whose roles and membership
+// haven't been granted yet, oldest first
+func (r *InvitationRepository) FindUngrantedUses(userID uint) ([]model.InvitationUse, error) {
+	var uses []model.InvitationUse
+	err := r.db.Where("user_id = ? AND granted_at IS NULL", userID).Order("id ASC").Find(&uses).Error
+	return uses, err
+}
+
+// MarkUseGranted records that a use's roles and membership were granted. It
+// reports false if another request got there first.
+func (r *InvitationRepository) MarkUseGranted(id uint, grantedAt time.Time) (bool, error) {
+	result := r.db.Model(&model.InvitationUse{}).
+		Where("id = ? AND granted_at IS NULL", id).
+		Update("granted_at", grantedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+// LoginAttemptRepository stores failed sign-in attempts in the database, so
+// limits are shared between instances and survive restarts
+type LoginAttemptRepository struct {
+	db *gorm.DB
+}
+
+func NewLoginAttemptRepository(db *gorm.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+// Get returns the attempts for a key, or nil if there are none
+func (r *LoginAttemptRepository) Get(key string) (*model.LoginAttempt, error) {
+	var attempt model.LoginAttempt
+	err := r.db.Where("key = ?", key).First(&attempt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// RecordFailure counts a failure for a key and returns the updated attempts
+func (r *LoginAttemptRepository) RecordFailure(key string, now time.Time, window time.Duration) (*model.LoginAttempt, error) {
+	var attempt model.LoginAttempt
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("key = ?", key).First(&attempt).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		attempt.Key = key
+		recordFailure(&attempt, now, window)
+		return tx.Save(&attempt).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// Lock locks a key out until the given time
+func (r *LoginAttemptRepository) Lock(key string, until time.Time) error {
+	return r.db.Model(&model.LoginAttempt{}).Where("key = ?", key).Update("locked_until", until).Error
+}
+
+// Delete clears the attempts for a key
+func (r *LoginAttemptRepository) Delete(key string) error {
+	return r.db.Where("key = ?", key).Delete(&model.LoginAttempt{}).Error
+}
+
+// DeleteStale deletes unlocked attempts with no failure since before
+func (r *LoginAttemptRepository) DeleteStale(before time.Time) error {
+	return r.db.Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", before, before).
+		Delete(&model.LoginAttempt{}).Error
+}
+
+// MemoryLoginAttemptStore stores failed sign-in attempts in memory. Limits
+// are per instance and reset on restart.
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]*model.LoginAttempt
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{attempts: make(map[string]*model.LoginAttempt)}
+}
+
+// Get returns the attempts for a key, or nil if there are none
+func (s *MemoryLoginAttemptStore) Get(key string) (*model.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if attempt, ok := s.attempts[key]; ok {
+		copied := *attempt
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+// RecordFailure counts a failure for a key and returns the updated attempts
+func (s *MemoryLoginAttemptStore) RecordFailure(key string, now time.Time, window time.Duration) (*model.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt = &model.LoginAttempt{Key: key}
+		s.attempts[key] = attempt
+	}
+	recordFailure(attempt, now, window)
+	copied := *attempt
+	return &copied, nil
+}
+
+// Lock locks a key out until the given time
+func (s *MemoryLoginAttemptStore) Lock(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if attempt, ok := s.attempts[key]; ok {
+		attempt.LockedUntil = &until
+	}
+	return nil
+}
+
+// Delete clears the attempts for a key
+func (s *MemoryLoginAttemptStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+// DeleteStale deletes unlocked attempts with no failure since before
+func (s *MemoryLoginAttemptStore) DeleteStale(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, attempt := range s.attempts {
+		if attempt.LastFailureAt.Before(before) && !attempt.IsLocked(before) {
+			delete(s.attempts, key)
+		}
+	}
+	return nil
+}
+
+// recordFailure adds a failure, starting over when the window has passed or
+// a lockout has ended
+func recordFailure(attempt *model.LoginAttempt, now time.Time, window time.Duration) {
+	lockEnded := attempt.LockedUntil != nil && !attempt.IsLocked(now)
+	windowEnded := now.Sub(attempt.WindowStart) > window && !attempt.IsLocked(now)
+	if attempt.Failures == 0 || lockEnded || windowEnded {
+		attempt.Failures = 0
+		attempt.WindowStart = now
+		attempt.LockedUntil = nil
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+type MagicLinkRepository struct {
+	db *gorm.DB
+}
+
+func NewMagicLinkRepository(db *gorm.DB) *MagicLinkRepository {
+	return &MagicLinkRepository{db: db}
+}
+
+// Create stores a magic link, deleting links that expired more than a day ago
+func (r *MagicLinkRepository) Create(link *model.MagicLink) error {
+	if err := r.db.Where("expires_at < ?", time.Now().Add(-24*time.Hour)).Delete(&model.MagicLink{}).Error; err != nil {
+		return err
+	}
+	return r.db.Create(link).Error
+}
+
+// FindByTokenHash finds a magic link by its token hash
+func (r *MagicLinkRepository) FindByTokenHash(tokenHash string) (*model.MagicLink, error) {
+	var link model.MagicLink
+	err := r.db.Where("token_hash = ?", tokenHash).First(&link).Error
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// MarkUsed marks an unused link as used. It reports false if the link was
+// already used, so a link can't be redeemed twice even by concurrent requests.
+func (r *MagicLinkRepository) MarkUsed(id uint, usedAt time.Time) (bool, error) {
+	result := r.db.Model(&model.MagicLink{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", usedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CountByEmailSince counts links requested for an email since a time
+func (r *MagicLinkRepository) CountByEmailSince(email string, since time.Time) int64 {
+	var count int64
+	r.db.Model(&model.MagicLink{}).Where("email = ? AND created_at > ?", email, since).Count(&count)
+	return count
+}
+
+// CountByIPSince counts links requested from an IP address since a time
+func (r *MagicLinkRepository) CountByIPSince(ip string, since time.Time) int64 {
+	var count int64
+	r.db.Model(&model.MagicLink{}).Where("request_ip = ? AND created_at > ?", ip, since).Count(&count)
+	return count
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+type PasskeyRepository struct {
+	db *gorm.DB
+}
+
+func NewPasskeyRepository(db *gorm.DB) *PasskeyRepository {
+	return &PasskeyRepository{db: db}
+}
+
+// Create creates a new passkey
+func (r *PasskeyRepository) Create(passkey *model.Passkey) error {
+	return r.db.Create(passkey).Error
+}
+
+// Update updates a passkey
+func (r *PasskeyRepository) Update(passkey *model.Passkey) error {
+	return r.db.Save(passkey).Error
+}
+
+// FindByID finds a passkey by ID
+func (r *PasskeyRepository) FindByID(id uint) (*model.Passkey, error) {
+	var passkey model.Passkey
+	err := r.db.First(&passkey, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &passkey, nil
+}
+
+// FindByCredentialID finds a passkey by its base64url WebAuthn credential ID
+func (r *PasskeyRepository) FindByCredentialID(credentialID string) (*model.Passkey, error) {
+	var passkey model.Passkey
+	err := r.db.Where("credential_id = ?", credentialID).First(&passkey).Error
+	if err != nil {
+		return nil, err
+	}
+	return &passkey, nil
+}
+
+// FindByUserID returns a user's passkeys, oldest first
+func (r *PasskeyRepository) FindByUserID(userID uint) ([]model.Passkey, error) {
+	var passkeys []model.Passkey
+	err := r.db.Where("user_id = ?", userID).Order("id ASC").Find(&passkeys).Error
+	return passkeys, err
+}
+
+// UpdateSignCount records a login, but only if the sign count is still the one
+// that was verified, so concurrent logins with a cloned key can't both succeed
+func (r *PasskeyRepository) UpdateSignCount(id uint, oldCount, newCount uint32, backedUp bool, usedAt time.Time) (bool, error) {
+	result := r.db.Model(&model.Passkey{}).
+		Where("id = ? AND sign_count = ?", id, oldCount).
+		Updates(map[string]interface{}{
+			"sign_count":   newCount,
+			"backed_up":    backedUp,
+			"last_used_at": usedAt,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Delete deletes a passkey
+func (r *PasskeyRepository) Delete(id uint) error {
+	return r.db.Delete(&model.Passkey{}, id).Error
+}
+
+type PasskeyChallengeRepository struct {
+	db *gorm.DB
+}
+
+func NewPasskeyChallengeRepository(db *gorm.DB) *PasskeyChallengeRepository {
+	return &PasskeyChallengeRepository{db: db}
+}
+
+// Create stores a challenge, cleaning up expired ones on the way
+func (r *PasskeyChallengeRepository) Create(challenge *model.PasskeyChallenge) error {
+	if err := r.db.Where("expires_at < ?", time.Now()).Delete(&model.PasskeyChallenge{}).Error; err != nil {
+		return err
+	}
+	return r.db.Create(challenge).Error
+}
+
+// Consume deletes and returns an unexpired challenge. Only one caller can
+// consume a challenge, even concurrently.
+func (r *PasskeyChallengeRepository) Consume(challenge string, purpose model.PasskeyChallengePurpose) (*model.PasskeyChallenge, error) {
+	var found model.PasskeyChallenge
+	err := r.db.Where("challenge = ? AND purpose = ? AND expires_at > ?", challenge, purpose, time.Now()).
+		First(&found).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := r.db.Delete(&model.PasskeyChallenge{}, found.ID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &found, nil
+}
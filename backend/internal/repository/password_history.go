@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"github.com/lite-blog/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+type PasswordHistoryRepository struct {
+	db *gorm.DB
+}
+
+func NewPasswordHistoryRepository(db *gorm.DB) *PasswordHistoryRepository {
+	return &PasswordHistoryRepository{db: db}
+}
+
+// Add records a password hash the user had, keeping only the newest keep entries
+func (r *PasswordHistoryRepository) Add(userID uint, passwordHash string, keep int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&model.PasswordHistory{UserID: userID, PasswordHash: passwordHash}).Error; err != nil {
+			return err
+		}
+		newest := tx.Model(&model.PasswordHistory{}).
+			Select("id").
+			Where("user_id = ?", userID).
+			Order("id DESC").
+			Limit(keep)
+		return tx.Where("user_id = ? AND id NOT IN (?)", userID, newest).Delete(&model.PasswordHistory{}).Error
+	})
+}
+
+// FindRecent finds the user's most recent previous passwords
+func (r *PasswordHistoryRepository) FindRecent(userID uint, limit int) ([]model.PasswordHistory, error) {
+	var history []model.PasswordHistory
+	err := r.db.Where("user_id = ?", userID).Order("id DESC").Limit(limit).Find(&history).Error
+	return history, err
+}
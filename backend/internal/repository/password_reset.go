@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+type PasswordResetRepository struct {
+	db *gorm.DB
+}
+
+func NewPasswordResetRepository(db *gorm.DB) *PasswordResetRepository {
+	return &PasswordResetRepository{db: db}
+}
+
+// Create stores a reset link, deleting links that expired more than a day ago
+func (r *PasswordResetRepository) Create(reset *model.PasswordReset) error {
+	if err := r.db.Where("expires_at < ?", time.Now().Add(-24*time.Hour)).Delete(&model.PasswordReset{}).Error; err != nil {
+		return err
+	}
+	return r.db.Create(reset).Error
+}
+
+// FindByTokenHash finds a reset link by its token hash
+func (r *PasswordResetRepository) FindByTokenHash(tokenHash string) (*model.PasswordReset, error) {
+	var reset model.PasswordReset
+	err := r.db.Where("token_hash = ?", tokenHash).First(&reset).Error
+	if err != nil {
+		return nil, err
+	}
+	return &reset, nil
+}
+
+// MarkUsed marks an unused link as used. It reports false if the link was
+// already used, so a link can't be redeemed twice even by concurrent requests.
+func (r *PasswordResetRepository) MarkUsed(id uint, usedAt time.Time) (bool, error) {
+	result := r.db.Model(&model.PasswordReset{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", usedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeleteByUserID deletes a user's reset links, once one of them was used
+func (r *PasswordResetRepository) DeleteByUserID(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&model.PasswordReset{}).Error
+}
+
+// CountByUserSince counts links requested for a user since a time
+func (r *PasswordResetRepository) CountByUserSince(userID uint, since time.Time) int64 {
+	var count int64
+	r.db.Model(&model.PasswordReset{}).Where("user_id = ? AND created_at > ?", userID, since).Count(&count)
+	return count
+}
+
+// CountByIPSince counts links requested from an IP address since a time
+func (r *PasswordResetRepository) CountByIPSince(ip string, since time.Time) int64 {
+	var count int64
+	r.db.Model(&model.PasswordReset{}).Where("request_ip = ? AND created_at > ?", ip, since).Count(&count)
+	return count
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+type RecoveryCodeRepository struct {
+	db *gorm.DB
+}
+
+func NewRecoveryCodeRepository(db *gorm.DB) *RecoveryCodeRepository {
+	return &RecoveryCodeRepository{db: db}
+}
+
+// ReplaceForUser deletes a user's recovery codes and stores new ones
+func (r *RecoveryCodeRepository) ReplaceForUser(userID uint, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]model.RecoveryCode, len(codeHashes))
+		for i, hash := range codeHashes {
+			codes[i] = model.RecoveryCode{UserID: userID, CodeHash: hash}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// DeleteForUser deletes all recovery codes of a user
+func (r *RecoveryCodeRepository) DeleteForUser(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error
+}
+
+// Use marks an unused code as used. It reports false if no unused code matched,
+// so a code can't be redeemed twice even by concurrent requests.
+func (r *RecoveryCodeRepository) Use(userID uint, codeHash string, usedAt time.Time) (bool, error) {
+	result := r.db.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", usedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CountUnused counts the recovery codes a user has left
+func (r *RecoveryCodeRepository) CountUnused(userID uint) int64 {
+	var count int64
+	r.db.Model(&model.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count)
+	return count
+}
@@ -47,6 +47,11 @@ func (r *SettingRepository) Upsert(key, value string) error {
 	return r.db.Save(&setting).Error
 }
 
+// Delete removes a setting by key
+func (r *SettingRepository) Delete(key string) error {
+	return r.db.Where("key = ?", key).Delete(&model.Setting{}).Error
+}
+
 // UpdateMultiple updates multiple settings at once
 func (r *SettingRepository) UpdateMultiple(settings map[string]string) error {
 	return r.db.Transaction(func(tx *gorm.DB) error {
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+type SubscriberRepository struct {
+	db *gorm.DB
+}
+
+func NewSubscriberRepository(db *gorm.DB) *SubscriberRepository {
+	return &SubscriberRepository{db: db}
+}
+
+// Create creates a new subscriber
+func (r *SubscriberRepository) Create(subscriber *model.Subscriber) error {
+	return r.db.Create(subscriber).Error
+}
+
+// Update updates a subscriber
+func (r *SubscriberRepository) Update(subscriber *model.Subscriber) error {
+	return r.db.Save(subscriber).Error
+}
+
+// FindByID finds a subscriber by ID
+func (r *SubscriberRepository) FindByID(id uint) (*model.Subscriber, error) {
+	var subscriber model.Subscriber
+	err := r.db.First(&subscriber, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &subscriber, nil
+}
+
+// FindByEmail finds a subscriber by email
+func (r *SubscriberRepository) FindByEmail(email string) (*model.Subscriber, error) {
+	var subscriber model.Subscriber
+	err := r.db.Where("email = ?", email).First(&subscriber).Error
+	if err != nil {
+		return nil, err
+	}
+	return &subscriber, nil
+}
+
+// FindByConfirmToken finds a subscriber by double opt-in token
+func (r *SubscriberRepository) FindByConfirmToken(token string) (*model.Subscriber, error) {
+	var subscriber model.Subscriber
+	err := r.db.Where("confirm_token = ?", token).First(&subscriber).Error
+	if err != nil {
+		return nil, err
+	}
+	return &subscriber, nil
+}
+
+// FindActiveAfter returns up to limit active subscribers with the given frequency
+// and an ID greater than afterID, so large lists can be walked in batches
+func (r *SubscriberRepository) FindActiveAfter(frequency model.SubscriptionFrequency, afterID uint, limit int) ([]model.Subscriber, error) {
+	var subscribers []model.Subscriber
+	err := r.db.Where("status = ? AND frequency = ? AND id > ?", model.SubscriberStatusActive, frequency, afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&subscribers).Error
+	return subscribers, err
+}
+
+// FindDigestDue returns up to limit active subscribers with the given frequency whose
+// last digest (or confirmation, if they never got one) is older than cutoff
+func (r *SubscriberRepository) FindDigestDue(frequency model.SubscriptionFrequency, cutoff time.Time, afterID uint, limit int) ([]model.Subscriber, error) {
+	var subscribers []model.Subscriber
+	err := r.db.Where("status = ? AND frequency = ? AND id > ? AND COALESCE(last_digest_at, confirmed_at) <= ?",
+		model.SubscriberStatusActive, frequency, afterID, cutoff).
+		Order("id ASC").
+		Limit(limit).
+		Find(&subscribers).Error
+	return subscribers, err
+}
+
+// UpdateLastDigestAt records when a digest was queued for a subscriber
+func (r *SubscriberRepository) UpdateLastDigestAt(id uint, at time.Time) error {
+	return r.db.Model(&model.Subscriber{}).Where("id = ?", id).Update("last_digest_at", at).Error
+}
+
+// List lists subscribers with pagination, optionally filtered by status
+func (r *SubscriberRepository) List(status string, page, pageSize int) ([]model.Subscriber, int64, error) {
+	var subscribers []model.Subscriber
+	var total int64
+
+	query := r.db.Model(&model.Subscriber{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := query.Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&subscribers).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return subscribers, total, nil
+}
@@ -1,16 +1,23 @@
 package repository
 
 import (
+	"strings"
+	"time"
+
 	"github.com/lite-blog/backend/internal/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository struct {
-	db *gorm.DB
+	db    *gorm.DB
+	cache *userCache
 }
 
-func NewUserRepository(db *gorm.DB) *UserRepository {
-	return &UserRepository{db: db}
+// NewUserRepository returns a user repository. FindSessionUser caches users
+// for cacheTTL; zero disables the cache.
+func NewUserRepository(db *gorm.DB, cacheTTL time.Duration) *UserRepository {
+	return &UserRepository{db: db, cache: newUserCache(cacheTTL)}
 }
 
 func (r *UserRepository) Create(user *model.User) error {
@@ -50,22 +57,203 @@ func (r *UserRepository) FindByVerificationToken(token string) (*model.User, err
 	return &user, nil
 }
 
+// FindSessionUser finds a user with their roles and the roles' permissions,
+// for authenticating a request. Results are cached briefly; every change made
+// through the repository drops the user from the cache.
+func (r *UserRepository) FindSessionUser(id uint) (*model.User, error) {
+	if user := r.cache.get(id); user != nil {
+		return user, nil
+	}
+
+	generation := r.cache.loadGeneration()
+	var user model.User
+	err := r.db.Preload("Roles.Permissions").First(&user, id).Error
+	if err != nil {
+		return nil, err
+	}
+	r.cache.put(&user, generation)
+	return r.cache.copy(&user), nil
+}
+
+// credentialColumns are the sign-in secrets and session state, which only
+// UpdatePassword and UpdateTwoFactor write
+var credentialColumns = []string{
+	"password_hash",
+	"session_version",
+	"totp_secret",
+	"totp_enabled",
+	"totp_last_counter",
+	"totp_failed_attempts",
+	"totp_locked_until",
+}
+
+// Update saves a user's own fields. Roles and the roles version are left
+// alone, since the user may have been loaded before a role change; only
+// AssignRole and RemoveRole change them. The password, two-factor and session
+// columns are left alone too, so a stale copy can't undo a password change.
 func (r *UserRepository) Update(user *model.User) error {
-	return r.db.Save(user).Error
+	defer r.cache.forget(user.ID)
+	return r.db.Omit(append([]string{clause.Associations, "roles_version"}, credentialColumns...)...).Save(user).Error
+}
+
+// UpdatePassword sets a user's password hash and revokes their sessions by
+// bumping the session version, which is read back into user
+func (r *UserRepository) UpdatePassword(user *model.User, passwordHash string) error {
+	defer r.cache.forget(user.ID)
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"password_hash":   passwordHash,
+			"session_version": gorm.Expr("session_version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+		user.PasswordHash = passwordHash
+		return tx.Model(&model.User{}).Where("id = ?", user.ID).Select("session_version").Row().Scan(&user.SessionVersion)
+	})
+}
+
+// UpdateTwoFactor saves a user's two-factor authentication fields
+func (r *UserRepository) UpdateTwoFactor(user *model.User) error {
+	defer r.cache.forget(user.ID)
+	return r.db.Model(user).
+		Select("totp_secret", "totp_enabled", "totp_last_counter", "totp_failed_attempts", "totp_locked_until").
+		Updates(user).Error
 }
 
 func (r *UserRepository) Delete(id uint) error {
+	defer r.cache.forget(id)
 	return r.db.Delete(&model.User{}, id).Error
 }
 
-func (r *UserRepository) List(page, pageSize int) ([]model.User, int64, error) {
+// FindDeletionDue finds users whose scheduled deletion time has passed
+func (r *UserRepository) FindDeletionDue(now time.Time, limit int) ([]model.User, error) {
+	var users []model.User
+	err := r.db.Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", now).
+		Order("deletion_scheduled_at ASC").
+		Limit(limit).
+		Find(&users).Error
+	return users, err
+}
+
+// Anonymize erases a user's personal data and soft deletes the account. The
+// row stays, under placeholderEmail, so the user's comments still point to it.
+func (r *UserRepository) Anonymize(id uint, placeholderEmail string) error {
+	defer r.cache.forget(id)
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var user model.User
+		if err := tx.First(&user, id).Error; err != nil {
+			return err
+		}
+
+		// Sign-in methods and other data that only exists for the account
+		for _, record := range []interface{}{
+			&model.RecoveryCode{},
+			&model.PasswordHistory{},
+			&model.Passkey{},
+			&model.UserIdentity{},
+			&model.AccessToken{},
+			&model.EmailChange{},
+			&model.PasswordReset{},
+		} {
+			if err := tx.Where("user_id = ?", id).Delete(record).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Exec("DELETE FROM user_roles WHERE user_id = ?", id).Error; err != nil {
+			return err
+		}
+
+		// Data that holds the email address
+		if err := tx.Where("email = ?", user.Email).Delete(&model.MagicLink{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? OR email = ?", id, user.Email).Delete(&model.Subscriber{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where(&model.EmailOutbox{To: user.Email}).Delete(&model.EmailOutbox{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.InvitationUse{}).Where("user_id = ?", id).Update("email", "").Error; err != nil {
+			return err
+		}
+		// Suppressions stay, so a bounced address isn't emailed again if reused
+		if err := tx.Model(&model.EmailSuppression{}).Where("user_id = ?", id).Update("user_id", nil).Error; err != nil {
+			return err
+		}
+
+		err := tx.Model(&user).Updates(map[string]interface{}{
+			"email":                        placeholderEmail,
+			"password_hash":                "",
+			"email_verified":               false,
+			"email_verification_token":     nil,
+			"email_verification_expire_at": nil,
+			"email_verification_sent_at":   nil,
+			"member_expire_at":             nil,
+			"language":                     "",
+			"totp_secret":                  nil,
+			"totp_enabled":                 false,
+			"totp_last_counter":            0,
+			"totp_failed_attempts":         0,
+			"totp_locked_until":            nil,
+			"status":                       model.UserStatusDisabled,
+			"deletion_scheduled_at":        nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&user).Error
+	})
+}
+
+// Membership states a user list can be filtered by
+const (
+	MembershipActive  = "active"  // Membership hasn't expired yet
+	MembershipExpired = "expired" // Membership has expired
+	MembershipNone    = "none"    // Never had a membership
+)
+
+// UserSortColumns are the columns a user list can be sorted by
+var UserSortColumns = map[string]string{
+	"created_at":       "created_at",
+	"email":            "email",
+	"member_expire_at": "member_expire_at",
+	"id":               "id",
+}
+
+// UserFilter narrows and sorts the user list; zero fields match everything
+type UserFilter struct {
+	Search        string // Part of the email address
+	Role          string // Role code
+	Status        *int
+	EmailVerified *bool
+	Membership    string // MembershipActive, MembershipExpired or MembershipNone
+	Sort          string // Key of UserSortColumns, newest first if empty
+	Ascending     bool
+}
+
+// List returns a page of users matching the filter
+func (r *UserRepository) List(filter UserFilter, page, pageSize int) ([]model.User, int64, error) {
 	var users []model.User
 	var total int64
 
-	r.db.Model(&model.User{}).Count(&total)
+	query := r.filtered(filter)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	column, ok := UserSortColumns[filter.Sort]
+	if !ok {
+		column = "created_at"
+	}
+	direction := "DESC"
+	if filter.Ascending {
+		direction = "ASC"
+	}
 
 	offset := (page - 1) * pageSize
-	err := r.db.Preload("Roles").Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&users).Error
+	err := query.Preload("Roles").Offset(offset).Limit(pageSize).
+		Order(column + " " + direction).Order("id " + direction).Find(&users).Error
 	if err != nil {
 		return nil, 0, err
 	}
@@ -73,14 +261,99 @@ func (r *UserRepository) List(page, pageSize int) ([]model.User, int64, error) {
 	return users, total, nil
 }
 
+// Each calls fn with batches of users matching the filter, in ID order. The
+// filter's sort is ignored.
+func (r *UserRepository) Each(filter UserFilter, batchSize int, fn func([]model.User) error) error {
+	var batch []model.User
+	return r.filtered(filter).Preload("Roles").FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+		return fn(batch)
+	}).Error
+}
+
+// FindByEmails returns the users with any of the emails, which must be
+// lowercase. Emails match regardless of case, and deleted users are included,
+// since their rows still hold the address.
+func (r *UserRepository) FindByEmails(emails []string) ([]model.User, error) {
+	var users []model.User
+	err := r.db.Unscoped().Preload("Roles").Where("LOWER(email) IN ?", emails).Find(&users).Error
+	return users, err
+}
+
+func (r *UserRepository) filtered(filter UserFilter) *gorm.DB {
+	query := r.db.Model(&model.User{})
+	if filter.Search != "" {
+		query = query.Where("email LIKE ? ESCAPE '\\'", "%"+escapeLike(filter.Search)+"%")
+	}
+	if filter.Role != "" {
+		query = query.Where("id IN (?)", r.db.Table("user_roles").
+			Select("user_roles.user_id").
+			Joins("JOIN roles ON roles.id = user_roles.role_id").
+			Where("roles.code = ?", filter.Role))
+	}
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+	if filter.EmailVerified != nil {
+		query = query.Where("email_verified = ?", *filter.EmailVerified)
+	}
+	switch filter.Membership {
+	case MembershipActive:
+		query = query.Where("member_expire_at > ?", time.Now())
+	case MembershipExpired:
+		query = query.Where("member_expire_at <= ?", time.Now())
+	case MembershipNone:
+		query = query.Where("member_expire_at IS NULL")
+	}
+	return query
+}
+
+// escapeLike escapes LIKE wildcards so they match literally
+func escapeLike(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+}
+
+// Transaction runs fn with a repository whose changes are committed together,
+// or rolled back if fn returns an error
+func (r *UserRepository) Transaction(fn func(repo *UserRepository) error) error {
+	// The transaction's repository doesn't cache, and the shared cache is
+	// cleared once it ends, so no uncommitted or stale users are served
+	defer r.cache.clear()
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&UserRepository{db: tx})
+	})
+}
+
 func (r *UserRepository) UpdateStatus(id uint, status int) error {
+	defer r.cache.forget(id)
 	return r.db.Model(&model.User{}).Where("id = ?", id).Update("status", status).Error
 }
 
+// AssignRole gives a user a role and bumps their roles version, so their
+// sessions are re-issued with it
 func (r *UserRepository) AssignRole(userID uint, roleID uint) error {
-	return r.db.Exec("INSERT OR IGNORE INTO user_roles (user_id, role_id) VALUES (?, ?)", userID, roleID).Error
+	defer r.cache.forget(userID)
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec("INSERT OR IGNORE INTO user_roles (user_id, role_id) VALUES (?, ?)", userID, roleID)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return bumpRolesVersion(tx, userID)
+	})
 }
 
+// RemoveRole takes a role from a user and bumps their roles version
 func (r *UserRepository) RemoveRole(userID uint, roleID uint) error {
-	return r.db.Exec("DELETE FROM user_roles WHERE user_id = ? AND role_id = ?", userID, roleID).Error
+	defer r.cache.forget(userID)
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec("DELETE FROM user_roles WHERE user_id = ? AND role_id = ?", userID, roleID)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return bumpRolesVersion(tx, userID)
+	})
+}
+
+func bumpRolesVersion(tx *gorm.DB, userID uint) error {
+	return tx.Model(&model.User{}).Where("id = ?", userID).
+		UpdateColumn("roles_version", gorm.Expr("roles_version + 1")).Error
 }
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+)
+
+// userCache keeps recently loaded users for a short time. It hands out
+// copies, so callers can change a user without touching the cached one.
+type userCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[uint]userCacheEntry
+	// generation counts forgets, so a user loaded before one isn't cached
+	generation uint64
+}
+
+type userCacheEntry struct {
+	user      *model.User
+	expiresAt time.Time
+}
+
+// userCacheSweepSize is how many entries the cache holds before it drops expired ones
+const userCacheSweepSize = 1000
+
+// newUserCache returns a cache, or nil (which caches nothing) if ttl is not positive
+func newUserCache(ttl time.Duration) *userCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &userCache{ttl: ttl, entries: make(map[uint]userCacheEntry)}
+}
+
+func (c *userCache) get(id uint) *model.User {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[id]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, id)
+		return nil
+	}
+	return c.copy(entry.user)
+}
+
+// loadGeneration returns the generation to pass to put for a user about to be
+// loaded from the database
+func (c *userCache) loadGeneration() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// put caches a user loaded at the given generation. If any user was forgotten
+// since, the loaded row may predate that change and is not cached.
+func (c *userCache) put(user *model.User, generation uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+
+	now := time.Now()
+	if len(c.entries) >= userCacheSweepSize {
+		for id, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, id)
+			}
+		}
+	}
+	c.entries[user.ID] = userCacheEntry{user: c.copy(user), expiresAt: now.Add(c.ttl)}
+}
+
+func (c *userCache) forget(id uint) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	delete(c.entries, id)
+}
+
+func (c *userCache) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.entries = make(map[uint]userCacheEntry)
+}
+
+// copy returns a copy of user with its own role list. Roles and their
+// permissions are shared and must not be changed.
+func (c *userCache) copy(user *model.User) *model.User {
+	if c == nil {
+		return user
+	}
+	clone := *user
+	clone.Roles = append([]model.Role(nil), user.Roles...)
+	return &clone
+}
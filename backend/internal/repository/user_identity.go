@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"github.com/lite-blog/backend/internal/model"
+	"gorm.io/gorm"
+)
+
+type UserIdentityRepository struct {
+	db *gorm.DB
+}
+
+func NewUserIdentityRepository(db *gorm.DB) *UserIdentityRepository {
+	return &UserIdentityRepository{db: db}
+}
+
+// Create creates a new identity
+func (r *UserIdentityRepository) Create(identity *model.UserIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+// Update updates an identity
+func (r *UserIdentityRepository) Update(identity *model.UserIdentity) error {
+	return r.db.Save(identity).Error
+}
+
+// FindByProviderSubject finds the identity for an account at a provider
+func (r *UserIdentityRepository) FindByProviderSubject(provider, subject string) (*model.UserIdentity, error) {
+	var identity model.UserIdentity
+	err := r.db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+// FindByUserID returns the identities linked to a user
+func (r *UserIdentityRepository) FindByUserID(userID uint) ([]model.UserIdentity, error) {
+	var identities []model.UserIdentity
+	err := r.db.Where("user_id = ?", userID).Order("id ASC").Find(&identities).Error
+	return identities, err
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+)
+
+var (
+	ErrAccessTokenInvalid      = errors.New("invalid or expired access token")
+	ErrAccessTokenNotFound     = errors.New("access token not found")
+	ErrAccessTokenScopeInvalid = errors.New("invalid access token scope")
+	ErrAccessTokenLimit        = errors.New("too many access tokens")
+)
+
+const (
+	// maxAccessTokensPerUser bounds how many tokens one user can have
+	maxAccessTokensPerUser = 20
+
+	// accessTokenTouchInterval limits how often last-used times are written
+	accessTokenTouchInterval = time.Minute
+)
+
+// AccessTokenService manages personal access tokens
+type AccessTokenService struct {
+	tokenRepo *repository.AccessTokenRepository
+	userRepo  *repository.UserRepository
+}
+
+func NewAccessTokenService(tokenRepo *repository.AccessTokenRepository, userRepo *repository.UserRepository) *AccessTokenService {
+	return &AccessTokenService{
+		tokenRepo: tokenRepo,
+		userRepo:  userRepo,
+	}
+}
+
+// Create creates a token for the user and returns it with the plaintext token,
+// which is only shown this once. An expiry of zero days means it never expires.
+func (s *AccessTokenService) Create(user *model.User, name string, scopes []string, expiresInDays int) (*model.AccessToken, string, error) {
+	scopes, err := s.validateScopes(user, scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	if s.tokenRepo.CountByUserID(user.ID) >= maxAccessTokensPerUser {
+		return nil, "", ErrAccessTokenLimit
+	}
+
+	random, err := generateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	plaintext := model.AccessTokenPrefix + random
+
+	token := &model.AccessToken{
+		UserID:    user.ID,
+		Name:      strings.TrimSpace(name),
+		TokenHash: hashAccessToken(plaintext),
+		Prefix:    plaintext[:len(model.AccessTokenPrefix)+8],
+		Scopes:    strings.Join(scopes, " "),
+	}
+	if expiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, expiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := s.tokenRepo.Create(token); err != nil {
+		return nil, "", err
+	}
+	return token, plaintext, nil
+}
+
+// List returns the user's tokens
+func (s *AccessTokenService) List(userID uint) ([]model.AccessToken, error) {
+	return s.tokenRepo.FindByUserID(userID)
+}
+
+// Revoke deletes one of the user's tokens
+func (s *AccessTokenService) Revoke(userID, id uint) error {
+	token, err := s.tokenRepo.FindByID(id)
+	if err != nil || token.UserID != userID {
+		return ErrAccessTokenNotFound
+	}
+	return s.tokenRepo.Delete(id)
+}
+
+// Authenticate returns the owner of a valid token and records its use
+func (s *AccessTokenService) Authenticate(plaintext string) (*model.User, *model.AccessToken, error) {
+	if !strings.HasPrefix(plaintext, model.AccessTokenPrefix) {
+		return nil, nil, ErrAccessTokenInvalid
+	}
+
+	token, err := s.tokenRepo.FindByTokenHash(hashAccessToken(plaintext))
+	if err != nil || token.IsExpired() {
+		return nil, nil, ErrAccessTokenInvalid
+	}
+
+	user, err := s.userRepo.FindSessionUser(token.UserID)
+	if err != nil {
+		return nil, nil, ErrAccessTokenInvalid
+	}
+
+	now := time.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > accessTokenTouchInterval {
+		if err := s.tokenRepo.UpdateLastUsed(token.ID, now); err == nil {
+			token.LastUsedAt = &now
+		}
+	}
+	return user, token, nil
+}
+
+// validateScopes checks the requested scopes exist and the user may grant them,
+// returning them without duplicates
+func (s *AccessTokenService) validateScopes(user *model.User, scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, ErrAccessTokenScopeInvalid
+	}
+
+	seen := make(map[string]bool, len(scopes))
+	valid := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if seen[scope] {
+			continue
+		}
+		if !isAccessTokenScope(scope) {
+			return nil, ErrAccessTokenScopeInvalid
+		}
+		// A token can't do more than its owner
+		if scope == model.ScopeArticleWrite && !user.IsAdmin() {
+			return nil, ErrAccessTokenScopeInvalid
+		}
+		seen[scope] = true
+		valid = append(valid, scope)
+	}
+	return valid, nil
+}
+
+func isAccessTokenScope(scope string) bool {
+	for _, s := range model.AccessTokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// hashAccessToken hashes a token for storage. The tokens are random enough that
+// a fast hash is sufficient.
+func hashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
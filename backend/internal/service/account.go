@@ -0,0 +1,326 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+)
+
+var (
+	ErrDeletionConfirmMismatch = errors.New("confirmation does not match the account email")
+	ErrCannotDeleteAdmin       = errors.New("admins cannot delete their own account")
+	ErrDeletionNotScheduled    = errors.New("account deletion is not scheduled")
+)
+
+const (
+	// defaultDeletionGraceDays is how long a deleted account can be restored
+	defaultDeletionGraceDays = 14
+	// defaultDeletionCheckInterval is how often due deletions are processed
+	defaultDeletionCheckInterval = time.Hour
+	// deletionBatchSize is how many accounts are anonymized per query
+	deletionBatchSize = 100
+)
+
+// AccountExport is a copy of the personal data kept about a user. Sign-in
+// sessions are signed cookies and aren't stored, so it lists the access
+// tokens, passkeys and linked accounts that can start one instead.
+type AccountExport struct {
+	ExportedAt     time.Time                  `json:"exported_at"`
+	Profile        AccountExportProfile       `json:"profile"`
+	Comments       []AccountExportComment     `json:"comments"`
+	Newsletter     *model.Subscriber          `json:"newsletter"`
+	AccessTokens   []AccountExportAccessToken `json:"access_tokens"`
+	Passkeys       []model.Passkey            `json:"passkeys"`
+	LinkedAccounts []model.UserIdentity       `json:"linked_accounts"`
+}
+
+// AccountExportProfile is the account itself, with its roles and membership
+type AccountExportProfile struct {
+	ID                  uint       `json:"id"`
+	Email               string     `json:"email"`
+	EmailVerified       bool       `json:"email_verified"`
+	Language            string     `json:"language"`
+	Roles               []string   `json:"roles"`
+	IsMember            bool       `json:"is_member"`
+	MemberExpireAt      *time.Time `json:"member_expire_at,omitempty"`
+	TOTPEnabled         bool       `json:"totp_enabled"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// AccountExportComment is a comment with the article it is on
+type AccountExportComment struct {
+	ID           uint      `json:"id"`
+	ArticleID    uint      `json:"article_id"`
+	ArticleTitle string    `json:"article_title"`
+	ArticleSlug  string    `json:"article_slug"`
+	ParentID     *uint     `json:"parent_id,omitempty"`
+	Content      string    `json:"content"`
+	IsDeleted    bool      `json:"is_deleted"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// AccountExportAccessToken is a personal access token, without the secret
+type AccountExportAccessToken struct {
+	model.AccessToken
+	Scopes []string `json:"scopes"`
+}
+
+// AccountService lets users download their data and delete their account.
+// Deletion waits out a grace period, during which the user can still sign
+// in and cancel, then anonymizes the account.
+type AccountService struct {
+	userRepo        *repository.UserRepository
+	commentRepo     *repository.CommentRepository
+	subscriberRepo  *repository.SubscriberRepository
+	accessTokenRepo *repository.AccessTokenRepository
+	passkeyRepo     *repository.PasskeyRepository
+	identityRepo    *repository.UserIdentityRepository
+	emailService    *EmailService
+	loginGuard      *LoginGuard
+	cfg             *config.Config
+}
+
+func NewAccountService(
+	userRepo *repository.UserRepository,
+	commentRepo *repository.CommentRepository,
+	subscriberRepo *repository.SubscriberRepository,
+	accessTokenRepo *repository.AccessTokenRepository,
+	passkeyRepo *repository.PasskeyRepository,
+	identityRepo *repository.UserIdentityRepository,
+	emailService *EmailService,
+	loginGuard *LoginGuard,
+	cfg *config.Config,
+) *AccountService {
+	return &AccountService{
+		userRepo:        userRepo,
+		commentRepo:     commentRepo,
+		subscriberRepo:  subscriberRepo,
+		accessTokenRepo: accessTokenRepo,
+		passkeyRepo:     passkeyRepo,
+		identityRepo:    identityRepo,
+		emailService:    emailService,
+		loginGuard:      loginGuard,
+		cfg:             cfg,
+	}
+}
+
+// Export collects the personal data kept about the user
+func (s *AccountService) Export(user *model.User) (*AccountExport, error) {
+	export := &AccountExport{
+		ExportedAt: time.Now().UTC(),
+		Profile: AccountExportProfile{
+			ID:                  user.ID,
+			Email:               user.Email,
+			EmailVerified:       user.EmailVerified,
+			Language:            user.Language,
+			Roles:               user.GetRoleCodes(),
+			IsMember:            user.IsMember(),
+			MemberExpireAt:      user.MemberExpireAt,
+			TOTPEnabled:         user.TOTPEnabled,
+			DeletionScheduledAt: user.DeletionScheduledAt,
+			CreatedAt:           user.CreatedAt,
+			UpdatedAt:           user.UpdatedAt,
+		},
+		Comments:       []AccountExportComment{},
+		AccessTokens:   []AccountExportAccessToken{},
+		Passkeys:       []model.Passkey{},
+		LinkedAccounts: []model.UserIdentity{},
+	}
+
+	comments, err := s.commentRepo.FindByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, comment := range comments {
+		export.Comments = append(export.Comments, AccountExportComment{
+			ID:           comment.ID,
+			ArticleID:    comment.ArticleID,
+			ArticleTitle: comment.Article.Title,
+			ArticleSlug:  comment.Article.Slug,
+			ParentID:     comment.ParentID,
+			Content:      comment.Content,
+			IsDeleted:    comment.IsDeleted,
+			CreatedAt:    comment.CreatedAt,
+			UpdatedAt:    comment.UpdatedAt,
+		})
+	}
+
+	if subscriber, err := s.subscriberRepo.FindByEmail(user.Email); err == nil {
+		export.Newsletter = subscriber
+	}
+
+	tokens, err := s.accessTokenRepo.FindByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		export.AccessTokens = append(export.AccessTokens, AccountExportAccessToken{AccessToken: token, Scopes: token.ScopeList()})
+	}
+
+	passkeys, err := s.passkeyRepo.FindByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	export.Passkeys = append(export.Passkeys, passkeys...)
+
+	identities, err := s.identityRepo.FindByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	export.LinkedAccounts = append(export.LinkedAccounts, identities...)
+
+	return export, nil
+}
+
+// WriteExportZip writes the export as a ZIP archive with one JSON file per section
+func WriteExportZip(w io.Writer, export *AccountExport) error {
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", export.Profile},
+		{"comments.json", export.Comments},
+		{"newsletter.json", export.Newsletter},
+		{"access_tokens.json", export.AccessTokens},
+		{"passkeys.json", export.Passkeys},
+		{"linked_accounts.json", export.LinkedAccounts},
+	}
+	for _, file := range files {
+		f, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// ScheduleDeletion schedules the user's account for deletion after the grace
+// period. confirmEmail must match the account email, so it isn't deleted by
+// accident. Scheduling again keeps the original date.
+func (s *AccountService) ScheduleDeletion(ctx context.Context, user *model.User, confirmEmail string) (*time.Time, error) {
+	if !strings.EqualFold(strings.TrimSpace(confirmEmail), user.Email) {
+		return nil, ErrDeletionConfirmMismatch
+	}
+	// Admins give up the role first, so a site can't lose its last admin
+	if user.IsAdmin() {
+		return nil, ErrCannotDeleteAdmin
+	}
+	if user.DeletionScheduledAt != nil {
+		return user.DeletionScheduledAt, nil
+	}
+
+	graceDays := s.graceDays()
+	deleteAt := time.Now().AddDate(0, 0, graceDays)
+	user.DeletionScheduledAt = &deleteAt
+	if err := s.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+
+	if err := s.emailService.SendAccountDeletionScheduled(ctx, user.Email, user.Language, deleteAt, graceDays); err != nil {
+		slog.ErrorContext(ctx, "Failed to queue account deletion email", "user_id", user.ID, "error", err)
+	}
+	slog.InfoContext(ctx, "User scheduled account deletion", "user_id", user.ID, "delete_at", deleteAt)
+	return &deleteAt, nil
+}
+
+// CancelDeletion keeps the user's account
+func (s *AccountService) CancelDeletion(ctx context.Context, user *model.User) error {
+	if user.DeletionScheduledAt == nil {
+		return ErrDeletionNotScheduled
+	}
+	user.DeletionScheduledAt = nil
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "User cancelled account deletion", "user_id", user.ID)
+	return nil
+}
+
+// RunDeletions anonymizes accounts whose grace period has passed until ctx is cancelled
+func (s *AccountService) RunDeletions(ctx context.Context) {
+	interval := defaultDeletionCheckInterval
+	if s.cfg.Account.DeletionCheckMinutes > 0 {
+		interval = time.Duration(s.cfg.Account.DeletionCheckMinutes) * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.ProcessDeletions(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDeletions anonymizes all accounts that are due. It stops between
+// accounts when ctx is cancelled; the rest are picked up next time.
+func (s *AccountService) ProcessDeletions(ctx context.Context) {
+	for ctx.Err() == nil {
+		users, err := s.userRepo.FindDeletionDue(time.Now(), deletionBatchSize)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to find accounts due for deletion", "error", err)
+			return
+		}
+		if len(users) == 0 {
+			return
+		}
+		for i := range users {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := anonymizeUser(ctx, s.userRepo, s.loginGuard, &users[i]); err != nil {
+				// Stop rather than retry the same batch forever
+				slog.ErrorContext(ctx, "Failed to delete account", "user_id", users[i].ID, "error", err)
+				return
+			}
+			slog.InfoContext(ctx, "Deleted account after its grace period", "user_id", users[i].ID)
+		}
+	}
+}
+
+func (s *AccountService) graceDays() int {
+	if s.cfg.Account.DeletionGraceDays > 0 {
+		return s.cfg.Account.DeletionGraceDays
+	}
+	return defaultDeletionGraceDays
+}
+
+// anonymizeUser erases the user's personal data and soft deletes the account.
+// Their comments stay, attributed to a deleted user.
+func anonymizeUser(ctx context.Context, userRepo *repository.UserRepository, loginGuard *LoginGuard, user *model.User) error {
+	if err := userRepo.Anonymize(user.ID, fmt.Sprintf("deleted-%d@deleted.invalid", user.ID)); err != nil {
+		return err
+	}
+	// Failed sign-ins may be kept in memory rather than the database
+	if err := loginGuard.Unlock(user.Email); err != nil {
+		slog.WarnContext(ctx, "Failed to clear login attempts for deleted user", "user_id", user.ID, "error", err)
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"log/slog"
 	"regexp"
 	"strings"
 	"time"
@@ -16,13 +18,20 @@ var (
 	ErrInvalidSlug     = errors.New("invalid slug format")
 )
 
+// PublishNotifier is notified when an article is published for the first time
+type PublishNotifier interface {
+	NotifyArticlePublished(article *model.Article)
+}
+
 type ArticleService struct {
-	articleRepo *repository.ArticleRepository
+	articleRepo     *repository.ArticleRepository
+	publishNotifier PublishNotifier
 }
 
-func NewArticleService(articleRepo *repository.ArticleRepository) *ArticleService {
+func NewArticleService(articleRepo *repository.ArticleRepository, publishNotifier PublishNotifier) *ArticleService {
 	return &ArticleService{
-		articleRepo: articleRepo,
+		articleRepo:     articleRepo,
+		publishNotifier: publishNotifier,
 	}
 }
 
@@ -143,6 +152,9 @@ func (s *ArticleService) PublishArticle(id uint) (*model.Article, error) {
 		return nil, ErrArticleNotFound
 	}
 
+	// Republishing an unpublished article should not email subscribers again
+	firstPublish := article.PublishedAt == nil
+
 	now := time.Now()
 	article.Status = model.ArticleStatusPublished
 	article.PublishedAt = &now
@@ -151,6 +163,10 @@ func (s *ArticleService) PublishArticle(id uint) (*model.Article, error) {
 		return nil, err
 	}
 
+	if firstPublish && s.publishNotifier != nil {
+		s.publishNotifier.NotifyArticlePublished(article)
+	}
+
 	return article, nil
 }
 
@@ -185,7 +201,7 @@ func (s *ArticleService) GetArticleByID(id uint) (*model.Article, error) {
 }
 
 // GetArticleBySlug gets an article by slug and applies content masking based on user role
-func (s *ArticleService) GetArticleBySlug(slug string, user *model.User) (*ArticleResponse, error) {
+func (s *ArticleService) GetArticleBySlug(ctx context.Context, slug string, user *model.User) (*ArticleResponse, error) {
 	article, err := s.articleRepo.FindBySlug(slug)
 	if err != nil {
 		return nil, ErrArticleNotFound
@@ -196,18 +212,14 @@ func (s *ArticleService) GetArticleBySlug(slug string, user *model.User) (*Artic
 		return nil, ErrArticleNotFound
 	}
 
-	// Debug: Log user membership status
+	// Check if we should show preview
+	isPreview := article.ShouldShowPreview(user)
 	if user != nil {
-		println("[DEBUG] User:", user.Email, "IsMember:", user.IsMember(), "IsAdmin:", user.IsAdmin(), "Roles count:", len(user.Roles))
-		for _, r := range user.Roles {
-			println("[DEBUG] Role:", r.Code)
-		}
+		slog.DebugContext(ctx, "Serving article", "article_id", article.ID, "user_id", user.ID,
+			"member", user.IsMember(), "admin", user.IsAdmin(), "preview", isPreview)
 	} else {
-		println("[DEBUG] User is nil (guest)")
+		slog.DebugContext(ctx, "Serving article to guest", "article_id", article.ID, "preview", isPreview)
 	}
-
-	// Check if we should show preview
-	isPreview := article.ShouldShowPreview(user)
 	content := article.Content
 
 	if isPreview {
@@ -253,7 +265,7 @@ func (s *ArticleService) ListPublishedArticles(page, pageSize int) ([]ArticleLis
 	items := make([]ArticleListItem, len(articles))
 	for i, article := range articles {
 		// Generate excerpt (first 200 chars)
-		excerpt := s.generateExcerpt(article.Content, 200)
+		excerpt := generateExcerpt(article.Content, 200)
 
 		items[i] = ArticleListItem{
 			ID:          article.ID,
@@ -284,7 +296,7 @@ func (s *ArticleService) ListAllArticles(page, pageSize int) ([]ArticleListItem,
 
 	items := make([]ArticleListItem, len(articles))
 	for i, article := range articles {
-		excerpt := s.generateExcerpt(article.Content, 200)
+		excerpt := generateExcerpt(article.Content, 200)
 
 		items[i] = ArticleListItem{
 			ID:          article.ID,
@@ -330,9 +342,9 @@ func (s *ArticleService) isValidSlug(slug string) bool {
 }
 
 // generateExcerpt generates a short excerpt from content
-func (s *ArticleService) generateExcerpt(content string, maxLength int) string {
+func generateExcerpt(content string, maxLength int) string {
 	// Remove markdown formatting for cleaner excerpt
-	content = s.stripMarkdown(content)
+	content = stripMarkdown(content)
 
 	runes := []rune(content)
 	if len(runes) <= maxLength {
@@ -352,7 +364,7 @@ func (s *ArticleService) generateExcerpt(content string, maxLength int) string {
 }
 
 // stripMarkdown removes common markdown formatting
-func (s *ArticleService) stripMarkdown(content string) string {
+func stripMarkdown(content string) string {
 	// Remove headers
 	content = regexp.MustCompile(`(?m)^#{1,6}\s*`).ReplaceAllString(content, "")
 	// Remove bold/italic
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+)
+
+// auditUserAgentMaxLength is the longest user agent kept, matching the column size
+const auditUserAgentMaxLength = 512
+
+// auditExportBatchSize is how many entries are read at a time for a CSV export
+const auditExportBatchSize = 500
+
+// auditIgnoredFields change on every update, so they are left out of diffs
+var auditIgnoredFields = []string{"updated_at"}
+
+// AuditActor is who performed an audited action, and from where
+type AuditActor struct {
+	UserID        uint
+	Email         string
+	AccessTokenID *uint
+	IP            string
+	UserAgent     string
+}
+
+// AuditChange is a field's value before and after an action. A field that
+// didn't exist on one side, e.g. because the object was created or deleted,
+// is null there.
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditLogEntry is an audit log entry with its changes decoded
+type AuditLogEntry struct {
+	model.AuditLog
+	Changes map[string]AuditChange `json:"changes"`
+}
+
+// AuditService keeps the append-only log of privileged actions
+type AuditService struct {
+	auditRepo *repository.AuditLogRepository
+}
+
+func NewAuditService(auditRepo *repository.AuditLogRepository) *AuditService {
+	return &AuditService{
+		auditRepo: auditRepo,
+	}
+}
+
+// Record appends an entry for an action on a target. before and after are
+// snapshots of the target, encoded as JSON objects, or nil where it didn't
+// exist; only the fields that differ are kept. The action has already
+// happened, so failures are logged rather than returned.
+func (s *AuditService) Record(ctx context.Context, actor AuditActor, action, targetType, targetID string, before, after interface{}) {
+	if len(actor.UserAgent) > auditUserAgentMaxLength {
+		actor.UserAgent = actor.UserAgent[:auditUserAgentMaxLength]
+	}
+
+	changes, err := auditChanges(before, after)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to diff audit log entry", "action", action, "target_type", targetType, "target_id", targetID, "error", err)
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to encode audit log entry", "action", action, "target_type", targetType, "target_id", targetID, "error", err)
+		data = []byte("{}")
+	}
+
+	entry := &model.AuditLog{
+		ActorID:       actor.UserID,
+		ActorEmail:    actor.Email,
+		AccessTokenID: actor.AccessTokenID,
+		Action:        action,
+		TargetType:    targetType,
+		TargetID:      targetID,
+		Changes:       string(data),
+		IP:            actor.IP,
+		UserAgent:     actor.UserAgent,
+	}
+	if err := s.auditRepo.Create(entry); err != nil {
+		slog.ErrorContext(ctx, "Failed to write audit log entry", "action", action, "target_type", targetType, "target_id", targetID,
+			"actor_id", actor.UserID, "error", err)
+	}
+}
+
+// List returns a page of audit log entries, newest first
+func (s *AuditService) List(filter repository.AuditLogFilter, page, pageSize int) ([]AuditLogEntry, int64, error) {
+	logs, total, err := s.auditRepo.List(filter, page, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]AuditLogEntry, len(logs))
+	for i, entry := range logs {
+		entries[i] = AuditLogEntry{AuditLog: entry, Changes: map[string]AuditChange{}}
+		if entry.Changes != "" {
+			if err := json.Unmarshal([]byte(entry.Changes), &entries[i].Changes); err != nil {
+				slog.Warn("Failed to decode audit log entry", "entry_id", entry.ID, "error", err)
+			}
+		}
+	}
+	return entries, total, nil
+}
+
+// WriteCSV writes the audit log entries matching the filter as CSV, oldest first
+func (s *AuditService) WriteCSV(w io.Writer, filter repository.AuditLogFilter) error {
+	writer := csv.NewWriter(w)
+	header := []string{"id", "created_at", "actor_id", "actor_email", "access_token_id", "action", "target_type", "target_id", "ip", "user_agent", "changes"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	err := s.auditRepo.Each(filter, auditExportBatchSize, func(batch []model.AuditLog) error {
+		for _, entry := range batch {
+			tokenID := ""
+			if entry.AccessTokenID != nil {
+				tokenID = strconv.FormatUint(uint64(*entry.AccessTokenID), 10)
+			}
+			row := []string{
+				strconv.FormatUint(uint64(entry.ID), 10),
+				entry.CreatedAt.UTC().Format(time.RFC3339),
+				strconv.FormatUint(uint64(entry.ActorID), 10),
+				entry.ActorEmail,
+				tokenID,
+				entry.Action,
+				entry.TargetType,
+				entry.TargetID,
+				entry.IP,
+				entry.UserAgent,
+				entry.Changes,
+			}
+			for i := range row {
+				row[i] = csvSafe(row[i])
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// auditChanges returns the fields that differ between two snapshots
+func auditChanges(before, after interface{}) (map[string]AuditChange, error) {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]AuditChange)
+	for name, value := range beforeFields {
+		if !reflect.DeepEqual(value, afterFields[name]) {
+			changes[name] = AuditChange{Before: value, After: afterFields[name]}
+		}
+	}
+	for name, value := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			changes[name] = AuditChange{After: value}
+		}
+	}
+	for _, name := range auditIgnoredFields {
+		delete(changes, name)
+	}
+	return changes, nil
+}
+
+// auditFields encodes a snapshot and returns its top-level fields
+func auditFields(snapshot interface{}) (map[string]interface{}, error) {
+	if snapshot == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		// Not an object; compare it as a whole
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"value": value}, nil
+	}
+	return fields, nil
+}
+
+// csvSafe keeps spreadsheet apps from running a cell as a formula, since
+// values such as user agents come from clients
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
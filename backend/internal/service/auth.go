@@ -1,9 +1,11 @@
 package service
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"log/slog"
 	"time"
 
 	"github.com/lite-blog/backend/internal/config"
@@ -24,33 +26,73 @@ var (
 )
 
 type AuthService struct {
-	userRepo     *repository.UserRepository
-	roleRepo     *repository.RoleRepository
-	emailService *EmailService
-	cfg          *config.Config
+	userRepo       *repository.UserRepository
+	roleRepo       *repository.RoleRepository
+	emailService   *EmailService
+	loginGuard     *LoginGuard
+	registration   *RegistrationService
+	passwordPolicy *PasswordPolicy
+	jwtKeys        *jwt.KeySet
+	cfg            *config.Config
 }
 
 func NewAuthService(
 	userRepo *repository.UserRepository,
 	roleRepo *repository.RoleRepository,
 	emailService *EmailService,
+	loginGuard *LoginGuard,
+	registration *RegistrationService,
+	passwordPolicy *PasswordPolicy,
+	jwtKeys *jwt.KeySet,
 	cfg *config.Config,
 ) *AuthService {
 	return &AuthService{
-		userRepo:     userRepo,
-		roleRepo:     roleRepo,
-		emailService: emailService,
-		cfg:          cfg,
+		userRepo:       userRepo,
+		roleRepo:       roleRepo,
+		emailService:   emailService,
+		loginGuard:     loginGuard,
+		registration:   registration,
+		passwordPolicy: passwordPolicy,
+		jwtKeys:        jwtKeys,
+		cfg:            cfg,
 	}
 }
 
-// Register creates a new user account
-func (s *AuthService) Register(email, password string) (*model.User, error) {
+// Register creates a new user account. The registration mode decides who may
+// sign up; an invitation token lets invited users in, and its roles are granted
+// once the email is verified. A password that breaks the policy returns a *PasswordPolicyError.
+func (s *AuthService) Register(ctx context.Context, email, password, language, invitationToken string) (*model.User, error) {
 	// Check if email already exists
 	if s.userRepo.ExistsByEmail(email) {
 		return nil, ErrEmailAlreadyExists
 	}
+	if err := s.passwordPolicy.Check(password, email); err != nil {
+		return nil, err
+	}
+
+	invitation, err := s.registration.BeginSignup(email, invitationToken)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.createUser(email, password, language)
+	if err != nil {
+		s.registration.CancelSignup(invitation)
+		return nil, err
+	}
+	if err := s.registration.CompleteSignup(invitation, user); err != nil {
+		slog.ErrorContext(ctx, "Failed to apply invitation", "invitation_id", invitation.ID, "user_id", user.ID, "error", err)
+	}
+
+	// Queue verification email; the outbox retries delivery in the background
+	if err := s.emailService.SendVerificationEmail(ctx, email, *user.EmailVerificationToken, user.Language); err != nil {
+		slog.ErrorContext(ctx, "Failed to queue verification email", "user_id", user.ID, "error", err)
+	}
 
+	return user, nil
+}
+
+// createUser saves a new unverified user with the default role
+func (s *AuthService) createUser(email, password, language string) (*model.User, error) {
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -75,6 +117,7 @@ func (s *AuthService) Register(email, password string) (*model.User, error) {
 		EmailVerificationToken:    &token,
 		EmailVerificationExpireAt: &expireAt,
 		EmailVerificationSentAt:   &sentAt,
+		Language:                  NormalizeLanguage(language),
 		Status:                    model.UserStatusActive,
 	}
 
@@ -89,9 +132,6 @@ func (s *AuthService) Register(email, password string) (*model.User, error) {
 		return nil, err
 	}
 
-	// Send verification email (async)
-	go s.emailService.SendVerificationEmail(email, token)
-
 	return user, nil
 }
 
@@ -113,11 +153,19 @@ func (s *AuthService) VerifyEmail(token string) error {
 	user.EmailVerificationToken = nil
 	user.EmailVerificationExpireAt = nil
 
-	return s.userRepo.Update(user)
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	// The address is proven now, so the invitations it signed up with apply
+	if err := s.registration.GrantInvitations(user); err != nil {
+		slog.Error("Failed to grant invitations", "user_id", user.ID, "error", err)
+	}
+	return nil
 }
 
 // ResendVerification resends the verification email
-func (s *AuthService) ResendVerification(userID uint) error {
+func (s *AuthService) ResendVerification(ctx context.Context, userID uint) error {
 	user, err := s.userRepo.FindByID(userID)
 	if err != nil {
 		return ErrUserNotFound
@@ -151,17 +199,23 @@ func (s *AuthService) ResendVerification(userID uint) error {
 		return err
 	}
 
-	// Send verification email (async)
-	go s.emailService.SendVerificationEmail(user.Email, token)
-
-	return nil
+	// Queue verification email; the outbox retries delivery in the background
+	return s.emailService.SendVerificationEmail(ctx, user.Email, token, user.Language)
 }
 
-// Login authenticates a user and returns a JWT token
-func (s *AuthService) Login(email, password string) (*model.User, string, error) {
+// Login authenticates a user and returns a JWT token. If the user has two-factor
+// authentication enabled, it returns ErrMFARequired with a pending MFA token instead.
+// In domain mode unverified accounts get ErrEmailNotVerified and a new link.
+// After repeated failures for the email or IP it returns a *LoginThrottleError.
+func (s *AuthService) Login(ctx context.Context, email, password, ip string) (*model.User, string, error) {
+	if err := s.loginGuard.Check(ctx, email, ip); err != nil {
+		return nil, "", err
+	}
+
 	// Find user by email
 	user, err := s.userRepo.FindByEmail(email)
 	if err != nil {
+		s.recordLoginFailure(ctx, nil, email, ip)
 		return nil, "", ErrInvalidCredentials
 	}
 
@@ -172,17 +226,31 @@ func (s *AuthService) Login(email, password string) (*model.User, string, error)
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		s.recordLoginFailure(ctx, user, email, ip)
 		return nil, "", ErrInvalidCredentials
 	}
+	s.loginGuard.RecordSuccess(ctx, email)
 
-	// Generate JWT token
-	token, err := jwt.GenerateToken(
-		user.ID,
-		user.Email,
-		user.GetRoleCodes(),
-		s.cfg.JWT.Secret,
-		s.cfg.JWT.ExpireHours,
-	)
+	// Domain mode only lets in people with an address at an allowed domain,
+	// which an unverified account hasn't shown. Send a fresh link instead.
+	if !user.EmailVerified && s.registration.Mode() == model.RegistrationModeDomain {
+		if err := s.ResendVerification(ctx, user.ID); err != nil && err != ErrTooManyRequests {
+			slog.ErrorContext(ctx, "Failed to resend verification email", "user_id", user.ID, "error", err)
+		}
+		return nil, "", ErrEmailNotVerified
+	}
+
+	// With two-factor authentication the session is only issued once a code is
+	// given; hand out a short-lived token for that second step instead
+	if user.TOTPEnabled {
+		mfaToken, err := jwt.GeneratePurposeToken(user.ID, jwt.PurposeMFA, s.jwtKeys, MFATokenTTL)
+		if err != nil {
+			return nil, "", err
+		}
+		return user, mfaToken, ErrMFARequired
+	}
+
+	token, err := generateSessionToken(user, s.jwtKeys, s.cfg)
 	if err != nil {
 		return nil, "", err
 	}
@@ -190,11 +258,126 @@ func (s *AuthService) Login(email, password string) (*model.User, string, error)
 	return user, token, nil
 }
 
+// recordLoginFailure counts a failed login and tells the owner if it locked
+// their account. Unknown emails are counted too, so they look the same.
+func (s *AuthService) recordLoginFailure(ctx context.Context, user *model.User, email, ip string) {
+	lockout, err := s.loginGuard.RecordFailure(ctx, email, ip)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to record login failure", "error", err)
+		return
+	}
+	if lockout == nil || user == nil {
+		return
+	}
+
+	slog.WarnContext(ctx, "Locked user out after failed logins", "user_id", user.ID, "failures", lockout.Failures)
+	minutes := int(s.loginGuard.LockoutDuration() / time.Minute)
+	if err := s.emailService.SendAccountLocked(ctx, user.Email, user.Language, ip, lockout.Failures, minutes); err != nil {
+		slog.ErrorContext(ctx, "Failed to queue lockout email", "user_id", user.ID, "error", err)
+	}
+}
+
+// ChangePassword replaces the user's password after checking the current one.
+// It revokes the user's other sessions and returns a new token for this one.
+// A new password that breaks the policy returns a *PasswordPolicyError.
+func (s *AuthService) ChangePassword(ctx context.Context, user *model.User, currentPassword, newPassword string) (string, error) {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)); err != nil {
+		return "", ErrInvalidCredentials
+	}
+	if err := s.passwordPolicy.CheckChange(user, newPassword); err != nil {
+		return "", err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	oldHash := user.PasswordHash
+	if err := s.userRepo.UpdatePassword(user, string(hashedPassword)); err != nil {
+		return "", err
+	}
+	if err := s.passwordPolicy.Remember(user.ID, oldHash); err != nil {
+		slog.ErrorContext(ctx, "Failed to record password history", "user_id", user.ID, "error", err)
+	}
+
+	slog.InfoContext(ctx, "User changed their password", "user_id", user.ID)
+	return generateSessionToken(user, s.jwtKeys, s.cfg)
+}
+
+// RefreshSession re-issues a session token with the user's current roles. The
+// new token expires with the old one.
+func (s *AuthService) RefreshSession(user *model.User, claims *jwt.Claims) (string, error) {
+	refreshed := *claims
+	refreshed.Email = user.Email
+	refreshed.Roles = user.GetRoleCodes()
+	refreshed.RolesVersion = user.RolesVersion
+	return s.jwtKeys.Sign(&refreshed)
+}
+
+// UpdateLanguage updates a user's preferred language for emails
+func (s *AuthService) UpdateLanguage(userID uint, language string) error {
+	language = NormalizeLanguage(language)
+	if language == "" {
+		return ErrUnsupportedLanguage
+	}
+
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	user.Language = language
+	return s.userRepo.Update(user)
+}
+
 // GetUserByID returns a user by ID
 func (s *AuthService) GetUserByID(id uint) (*model.User, error) {
 	return s.userRepo.FindByID(id)
 }
 
+// generateSessionToken generates the JWT session token for a user
+func generateSessionToken(user *model.User, keys *jwt.KeySet, cfg *config.Config) (string, error) {
+	return jwt.GenerateToken(
+		user.ID,
+		user.Email,
+		user.GetRoleCodes(),
+		user.SessionVersion,
+		user.RolesVersion,
+		keys,
+		cfg.JWT.ExpireHours,
+	)
+}
+
+// createVerifiedUser creates an account for an email that was verified some
+// other way, such as by a sign-in provider or a magic link. It gets an unusable
+// random password until the user sets one with a password reset link.
+func createVerifiedUser(userRepo *repository.UserRepository, roleRepo *repository.RoleRepository, email, language string) (*model.User, error) {
+	password, err := generateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &model.User{
+		Email:         email,
+		PasswordHash:  string(hashedPassword),
+		EmailVerified: true,
+		Language:      NormalizeLanguage(language),
+		Status:        model.UserStatusActive,
+	}
+	if userRole, err := roleRepo.FindByCode(model.RoleCodeUser); err == nil {
+		user.Roles = []model.Role{*userRole}
+	}
+	if err := userRepo.Create(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
 // generateRandomToken generates a random base64-encoded token
 func generateRandomToken(length int) (string, error) {
 	b := make([]byte, length)
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"errors"
+	"math/bits"
+	"sync"
+	"time"
+
+	"github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/pkg/pow"
+)
+
+var (
+	ErrChallengeRequired          = errors.New("a proof-of-work challenge is required")
+	ErrChallengeInvalid           = errors.New("proof-of-work challenge is invalid or expired")
+	ErrChallengePurposeInvalid    = errors.New("unknown challenge purpose")
+	ErrInvalidChallengeDifficulty = errors.New("challenge difficulty is out of range")
+)
+
+// Challenge purposes; a solved challenge only works for the purpose it was issued for
+const (
+	ChallengePurposeRegister = "register"
+	ChallengePurposeComment  = "comment"
+)
+
+const (
+	// ChallengeTTL is how long the client has to solve and submit a challenge
+	ChallengeTTL = 5 * time.Minute
+	// challengeWindow is the period over which challenge activity is counted
+	challengeWindow = 10 * time.Minute
+	// challengeQuietIP and challengeQuietGlobal are the activity per window
+	// that doesn't raise the difficulty
+	challengeQuietIP     = 10
+	challengeQuietGlobal = 200
+	// challengeMaxBoost caps how far abuse raises the difficulty above the base
+	challengeMaxBoost = 6
+	// challengeFailureWeight counts a failed solution as this many issued challenges
+	challengeFailureWeight = 5
+)
+
+// ChallengePolicy provides the challenge settings
+type ChallengePolicy interface {
+	GetChallengePolicy() (bool, int)
+}
+
+// ChallengeIssue is returned to the client; Challenge is nil when challenges are off
+type ChallengeIssue struct {
+	Required bool `json:"required"`
+	*pow.Challenge
+	Algorithm string `json:"algorithm,omitempty"`
+}
+
+// ChallengeService issues and verifies proof-of-work challenges that protect
+// registration and comments from bots. The difficulty rises automatically
+// while an IP, or the site as a whole, requests or fails many challenges.
+type ChallengeService struct {
+	policy ChallengePolicy
+	key    []byte
+
+	mu          sync.Mutex
+	windowStart time.Time
+	previous    challengeActivity
+	current     challengeActivity
+	used        map[string]time.Time
+}
+
+// challengeActivity counts challenges issued and failed in one window
+type challengeActivity struct {
+	global int
+	byIP   map[string]int
+}
+
+func NewChallengeService(policy ChallengePolicy, cfg *config.Config) *ChallengeService {
+	return &ChallengeService{
+		policy:      policy,
+		key:         []byte(cfg.Challenge.Secret),
+		windowStart: time.Now(),
+		current:     challengeActivity{byIP: make(map[string]int)},
+		previous:    challengeActivity{byIP: make(map[string]int)},
+		used:        make(map[string]time.Time),
+	}
+}
+
+// Issue returns a new challenge for purpose, sized to the recent activity of ip
+func (s *ChallengeService) Issue(purpose, ip string) (*ChallengeIssue, error) {
+	if !validChallengePurpose(purpose) {
+		return nil, ErrChallengePurposeInvalid
+	}
+	enabled, base := s.policy.GetChallengePolicy()
+	if !enabled {
+		return &ChallengeIssue{Required: false}, nil
+	}
+
+	s.mu.Lock()
+	s.rotate(time.Now())
+	difficulty := s.difficulty(base, ip)
+	s.record(ip, 1)
+	s.mu.Unlock()
+
+	challenge, err := pow.Issue(s.key, purpose, difficulty, ChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &ChallengeIssue{Required: true, Challenge: challenge, Algorithm: "sha256"}, nil
+}
+
+// Verify checks a solved challenge for purpose. It always succeeds while
+// challenges are disabled. Each challenge can only be used once.
+func (s *ChallengeService) Verify(purpose, ip, token, solution string) error {
+	enabled, _ := s.policy.GetChallengePolicy()
+	if !enabled {
+		return nil
+	}
+	if token == "" {
+		return ErrChallengeRequired
+	}
+
+	claims, err := pow.Verify(s.key, purpose, token, solution)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.rotate(now)
+
+	if err == nil {
+		if _, replayed := s.used[claims.ID]; replayed {
+			err = ErrChallengeInvalid
+		} else {
+			s.used[claims.ID] = time.Unix(claims.ExpiresAt, 0)
+		}
+	}
+	if err != nil {
+		s.record(ip, challengeFailureWeight)
+		return ErrChallengeInvalid
+	}
+	return nil
+}
+
+// difficulty raises the base once the IP, or the site as a whole, gets busier
+// than the quiet level, and again for every doubling beyond it
+func (s *ChallengeService) difficulty(base int, ip string) int {
+	if base < model.MinChallengeDifficulty || base > model.MaxChallengeDifficulty {
+		base = model.DefaultChallengeDifficulty
+	}
+
+	ipActivity := max(s.current.byIP[ip], s.previous.byIP[ip])
+	globalActivity := max(s.current.global, s.previous.global)
+	boost := max(activityBoost(ipActivity, challengeQuietIP), activityBoost(globalActivity, challengeQuietGlobal))
+	if boost > challengeMaxBoost {
+		boost = challengeMaxBoost
+	}
+
+	return min(base+boost, pow.MaxDifficulty)
+}
+
+// activityBoost is the number of extra bits for activity against a quiet level
+func activityBoost(activity, quiet int) int {
+	if activity <= quiet {
+		return 0
+	}
+	return bits.Len(uint(activity / quiet))
+}
+
+// record adds weight to the activity of ip and the site
+func (s *ChallengeService) record(ip string, weight int) {
+	s.current.global += weight
+	s.current.byIP[ip] += weight
+}
+
+// rotate starts a new activity window when the current one is over, and
+// forgets used challenges once they've expired
+func (s *ChallengeService) rotate(now time.Time) {
+	if now.Sub(s.windowStart) < challengeWindow {
+		return
+	}
+	if now.Sub(s.windowStart) < 2*challengeWindow {
+		s.previous = s.current
+	} else {
+		s.previous = challengeActivity{byIP: make(map[string]int)}
+	}
+	s.current = challengeActivity{byIP: make(map[string]int)}
+	s.windowStart = now
+
+	for id, expiresAt := range s.used {
+		if now.After(expiresAt) {
+			delete(s.used, id)
+		}
+	}
+}
+
+func validChallengePurpose(purpose string) bool {
+	return purpose == ChallengePurposeRegister || purpose == ChallengePurposeComment
+}
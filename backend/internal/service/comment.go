@@ -45,6 +45,7 @@ type CommentResponse struct {
 	ArticleID uint               `json:"article_id"`
 	UserID    uint               `json:"user_id"`
 	UserEmail string             `json:"user_email"`
+	UserDeleted bool             `json:"user_deleted,omitempty"` // The author deleted their account
 	ParentID  *uint              `json:"parent_id,omitempty"`
 	Content   string             `json:"content"`
 	IsDeleted bool               `json:"is_deleted"`
@@ -131,6 +132,16 @@ func (s *CommentService) GetCommentsByArticle(articleID uint, page, pageSize int
 	return responses, total, nil
 }
 
+// GetComment returns a comment by ID
+func (s *CommentService) GetComment(commentID uint) (*CommentResponse, error) {
+	comment, err := s.commentRepo.FindByID(commentID)
+	if err != nil {
+		return nil, ErrCommentNotFound
+	}
+	response := s.toCommentResponse(*comment)
+	return &response, nil
+}
+
 // DeleteComment soft-deletes a comment (admin only)
 func (s *CommentService) DeleteComment(commentID uint) error {
 	return s.commentRepo.SoftDelete(commentID)
@@ -164,6 +175,10 @@ func (s *CommentService) toCommentResponse(comment model.Comment) CommentRespons
 
 	if comment.User.ID != 0 {
 		response.UserEmail = comment.User.Email
+	} else {
+		// Deleted accounts aren't loaded, their comments stay
+		response.UserEmail = model.DeletedUserName
+		response.UserDeleted = true
 	}
 
 	return response
@@ -3,13 +3,12 @@ package service
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/ses"
-	"github.com/aws/aws-sdk-go-v2/service/ses/types"
 	appconfig "github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
 )
 
 // SiteInfoGetter is an interface for getting site info
@@ -20,30 +19,49 @@ type SiteInfoGetter interface {
 }
 
 type EmailService struct {
-	cfg            *appconfig.EmailConfig
-	sesClient      *ses.Client
-	siteInfoGetter SiteInfoGetter
+	cfg             *appconfig.EmailConfig
+	provider        EmailProvider
+	outboxRepo      *repository.EmailOutboxRepository
+	suppressionRepo *repository.EmailSuppressionRepository
+	siteInfoGetter  SiteInfoGetter
+	templateStore   EmailTemplateStore
+	outboxWake      chan struct{}
+	lastSentAt      time.Time // Only used by the outbox sender goroutine
 }
 
-func NewEmailService(cfg *appconfig.EmailConfig, siteInfoGetter SiteInfoGetter) *EmailService {
-	svc := &EmailService{
-		cfg:            cfg,
-		siteInfoGetter: siteInfoGetter,
-	}
+func NewEmailService(
+	cfg *appconfig.EmailConfig,
+	outboxRepo *repository.EmailOutboxRepository,
+	suppressionRepo *repository.EmailSuppressionRepository,
+	siteInfoGetter SiteInfoGetter,
+	templateStore EmailTemplateStore,
+) *EmailService {
+	return NewEmailServiceWithProvider(cfg, NewEmailProvider(cfg), outboxRepo, suppressionRepo, siteInfoGetter, templateStore)
+}
 
-	// Initialize SES client if provider is SES
-	if cfg.Provider == "ses" {
-		awsCfg, err := config.LoadDefaultConfig(context.Background(),
-			config.WithRegion(cfg.AWS.Region),
-		)
-		if err != nil {
-			log.Printf("Warning: Failed to load AWS config: %v", err)
-		} else {
-			svc.sesClient = ses.NewFromConfig(awsCfg)
-		}
+// NewEmailServiceWithProvider creates an email service that sends through the given provider
+func NewEmailServiceWithProvider(
+	cfg *appconfig.EmailConfig,
+	provider EmailProvider,
+	outboxRepo *repository.EmailOutboxRepository,
+	suppressionRepo *repository.EmailSuppressionRepository,
+	siteInfoGetter SiteInfoGetter,
+	templateStore EmailTemplateStore,
+) *EmailService {
+	return &EmailService{
+		cfg:             cfg,
+		provider:        provider,
+		outboxRepo:      outboxRepo,
+		suppressionRepo: suppressionRepo,
+		siteInfoGetter:  siteInfoGetter,
+		templateStore:   templateStore,
+		outboxWake:      make(chan struct{}, 1),
 	}
+}
 
-	return svc
+// Close releases provider resources such as pooled SMTP connections
+func (s *EmailService) Close() error {
+	return s.provider.Close()
 }
 
 func (s *EmailService) getSiteName() string {
@@ -73,145 +91,144 @@ func (s *EmailService) getEmailFrom() string {
 }
 
 // SendVerificationEmail sends an email verification link to the user
-func (s *EmailService) SendVerificationEmail(email, token string) error {
-	siteName := s.getSiteName()
-	siteURL := s.getSiteURL()
-	verifyURL := fmt.Sprintf("%s/verify-email?token=%s", siteURL, token)
-
-	subject := fmt.Sprintf("验证您的邮箱 - %s", siteName)
-	htmlBody := fmt.Sprintf(`
-<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>邮箱验证</title>
-</head>
-<body style="font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, 'Helvetica Neue', Arial, sans-serif; line-height: 1.6; color: #1a1a2e; background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); margin: 0; padding: 40px 20px; min-height: 100vh;">
-    <div style="max-width: 480px; margin: 0 auto;">
-        <!-- Logo/Brand -->
-        <div style="text-align: center; margin-bottom: 32px;">
-            <div style="display: inline-block; background: rgba(255,255,255,0.2); backdrop-filter: blur(10px); padding: 12px 24px; border-radius: 50px;">
-                <span style="color: #fff; font-size: 20px; font-weight: 700; letter-spacing: -0.5px;">%s</span>
-            </div>
-        </div>
-
-        <!-- Main Card -->
-        <div style="background: #ffffff; border-radius: 24px; box-shadow: 0 20px 60px rgba(0,0,0,0.15); overflow: hidden;">
-            <!-- Icon Section -->
-            <div style="padding: 48px 40px 32px; text-align: center; background: linear-gradient(180deg, #f8fafc 0%%, #ffffff 100%%);">
-                <div style="width: 80px; height: 80px; margin: 0 auto 24px; background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); border-radius: 50%%; display: flex; align-items: center; justify-content: center; box-shadow: 0 10px 30px rgba(102,126,234,0.4);">
-                    <span style="font-size: 36px;">✉️</span>
-                </div>
-                <h1 style="color: #1a1a2e; margin: 0 0 8px; font-size: 26px; font-weight: 700;">验证您的邮箱</h1>
-                <p style="color: #64748b; margin: 0; font-size: 15px;">只需一步即可完成注册</p>
-            </div>
-
-            <!-- Content Section -->
-            <div style="padding: 0 40px 40px;">
-                <p style="color: #475569; font-size: 15px; margin: 0 0 28px; text-align: center;">
-                    感谢您注册 <strong>%s</strong>！<br>
-                    点击下方按钮验证您的邮箱地址。
-                </p>
-
-                <!-- CTA Button -->
-                <div style="text-align: center; margin-bottom: 28px;">
-                    <a href="%s" style="display: inline-block; background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: #ffffff; padding: 16px 48px; text-decoration: none; border-radius: 12px; font-weight: 600; font-size: 16px; box-shadow: 0 8px 24px rgba(102,126,234,0.4); transition: transform 0.2s;">
-                        立即验证
-                    </a>
-                </div>
-
-                <!-- Divider -->
-                <div style="display: flex; align-items: center; margin: 28px 0;">
-                    <div style="flex: 1; height: 1px; background: #e2e8f0;"></div>
-                    <span style="padding: 0 16px; color: #94a3b8; font-size: 12px;">或复制链接</span>
-                    <div style="flex: 1; height: 1px; background: #e2e8f0;"></div>
-                </div>
-
-                <!-- Link Box -->
-                <div style="background: #f8fafc; border: 1px solid #e2e8f0; border-radius: 10px; padding: 14px 16px; word-break: break-all;">
-                    <a href="%s" style="color: #667eea; font-size: 13px; text-decoration: none;">%s</a>
-                </div>
-            </div>
-        </div>
-
-        <!-- Footer -->
-        <div style="text-align: center; margin-top: 32px;">
-            <p style="color: rgba(255,255,255,0.8); font-size: 13px; margin: 0 0 8px;">
-                ⏱️ 此链接将在 30 分钟后过期
-            </p>
-            <p style="color: rgba(255,255,255,0.6); font-size: 12px; margin: 0;">
-                如果您没有注册账号，请忽略此邮件。
-            </p>
-        </div>
-    </div>
-</body>
-</html>
-`, siteName, siteName, verifyURL, verifyURL, verifyURL)
-
-	textBody := fmt.Sprintf(`
-欢迎注册 %s！
-
-感谢您的注册。请点击以下链接验证您的邮箱地址：
-
-%s
-
-此链接将在 30 分钟后过期。
-
-如果您没有注册账号，请忽略此邮件。
-`, siteName, verifyURL)
-
-	return s.sendEmail(email, subject, htmlBody, textBody)
-}
-
-// sendEmail sends an email using the configured provider
-func (s *EmailService) sendEmail(to, subject, htmlBody, textBody string) error {
-	// Log for development/debugging
-	log.Printf("Sending email to: %s", to)
-	log.Printf("Subject: %s", subject)
-
-	if s.cfg.Provider == "ses" && s.sesClient != nil {
-		return s.sendViaSES(to, subject, htmlBody, textBody)
-	}
+func (s *EmailService) SendVerificationEmail(ctx context.Context, email, token, language string) error {
+	verifyURL := fmt.Sprintf("%s/verify-email?token=%s", s.getSiteURL(), token)
 
-	// Fallback: just log the email content (for development)
-	log.Printf("Email content (HTML):\n%s", htmlBody)
-	log.Printf("Email content (Text):\n%s", textBody)
-	log.Println("Email would be sent in production (SES not configured)")
-	return nil
-}
-
-func (s *EmailService) sendViaSES(to, subject, htmlBody, textBody string) error {
-	emailFrom := s.getEmailFrom()
-	input := &ses.SendEmailInput{
-		Destination: &types.Destination{
-			ToAddresses: []string{to},
-		},
-		Message: &types.Message{
-			Body: &types.Body{
-				Html: &types.Content{
-					Charset: aws.String("UTF-8"),
-					Data:    aws.String(htmlBody),
-				},
-				Text: &types.Content{
-					Charset: aws.String("UTF-8"),
-					Data:    aws.String(textBody),
-				},
-			},
-			Subject: &types.Content{
-				Charset: aws.String("UTF-8"),
-				Data:    aws.String(subject),
+	return s.sendTemplate(ctx, EmailTemplateVerification, email, language, map[string]interface{}{
+		"VerifyURL":     verifyURL,
+		"ExpireMinutes": 30,
+	})
+}
+
+// SendMagicLink sends a single-use sign-in link
+func (s *EmailService) SendMagicLink(ctx context.Context, email, token, language string, expireMinutes int) error {
+	loginURL := fmt.Sprintf("%s/magic-link?token=%s", s.getSiteURL(), token)
+
+	return s.sendTemplate(ctx, EmailTemplateMagicLink, email, language, map[string]interface{}{
+		"LoginURL":      loginURL,
+		"ExpireMinutes": expireMinutes,
+	})
+}
+
+// SendPasswordReset sends a single-use link to set a new password
+func (s *EmailService) SendPasswordReset(ctx context.Context, email, token, language string, expireMinutes int) error {
+	resetURL := fmt.Sprintf("%s/reset-password?token=%s", s.getSiteURL(), token)
+
+	return s.sendTemplate(ctx, EmailTemplatePasswordReset, email, language, map[string]interface{}{
+		"ResetURL":      resetURL,
+		"ExpireMinutes": expireMinutes,
+	})
+}
+
+// SendAccountLocked tells a user their account was locked after failed sign-in attempts
+func (s *EmailService) SendAccountLocked(ctx context.Context, email, language, ip string, failures, lockoutMinutes int) error {
+	return s.sendTemplate(ctx, EmailTemplateAccountLocked, email, language, map[string]interface{}{
+		"Failures":       failures,
+		"IPAddress":      ip,
+		"LockoutMinutes": lockoutMinutes,
+	})
+}
+
+// SendEmailChangeConfirmation sends the link that confirms a new email address
+func (s *EmailService) SendEmailChangeConfirmation(ctx context.Context, newEmail, token, language string, expireHours int) error {
+	confirmURL := fmt.Sprintf("%s/confirm-email-change?token=%s", s.getSiteURL(), token)
+
+	return s.sendTemplate(ctx, EmailTemplateEmailChangeConfirm, newEmail, language, map[string]interface{}{
+		"NewEmail":    newEmail,
+		"ConfirmURL":  confirmURL,
+		"ExpireHours": expireHours,
+	})
+}
+
+// SendEmailChangeNotice tells the old address about a requested email change
+func (s *EmailService) SendEmailChangeNotice(ctx context.Context, oldEmail, newEmail, cancelToken, language string) error {
+	cancelURL := fmt.Sprintf("%s/cancel-email-change?token=%s", s.getSiteURL(), cancelToken)
+
+	return s.sendTemplate(ctx, EmailTemplateEmailChangeNotice, oldEmail, language, map[string]interface{}{
+		"NewEmail":  newEmail,
+		"CancelURL": cancelURL,
+	})
+}
+
+// SendAccountDeletionScheduled tells a user when their account will be deleted
+func (s *EmailService) SendAccountDeletionScheduled(ctx context.Context, email, language string, deleteAt time.Time, graceDays int) error {
+	return s.sendTemplate(ctx, EmailTemplateAccountDeletion, email, language, map[string]interface{}{
+		"DeletionDate": deleteAt.Format("2006-01-02"),
+		"GraceDays":    graceDays,
+	})
+}
+
+// SendSubscriptionConfirmation sends the double opt-in link to a new newsletter subscriber
+func (s *EmailService) SendSubscriptionConfirmation(ctx context.Context, email, token, language string, expireMinutes int) error {
+	confirmURL := fmt.Sprintf("%s/api/subscriptions/confirm?token=%s", s.getSiteURL(), token)
+
+	return s.sendTemplate(ctx, EmailTemplateSubscriptionConfirm, email, language, map[string]interface{}{
+		"ConfirmURL":    confirmURL,
+		"ExpireMinutes": expireMinutes,
+	})
+}
+
+// BulkRecipient is one recipient of a bulk (newsletter) email
+type BulkRecipient struct {
+	Email          string
+	Language       string
+	UnsubscribeURL string
+	Data           map[string]interface{}
+}
+
+// SendBulkTemplate renders a template for each recipient and queues the results at bulk
+// priority, with List-Unsubscribe headers so mail clients can offer one-click unsubscribe
+func (s *EmailService) SendBulkTemplate(ctx context.Context, name string, recipients []BulkRecipient) error {
+	from := s.getEmailFrom()
+	msgs := make([]*EmailMessage, 0, len(recipients))
+	renderers := make(map[string]*emailTemplateRenderer, len(SupportedLanguages))
+	for _, recipient := range recipients {
+		data := make(map[string]interface{}, len(recipient.Data)+1)
+		for key, value := range recipient.Data {
+			data[key] = value
+		}
+		data["UnsubscribeURL"] = recipient.UnsubscribeURL
+
+		// Resolve each language's template once for the whole batch
+		language := NormalizeLanguage(recipient.Language)
+		renderer, ok := renderers[language]
+		if !ok {
+			var err error
+			renderer, err = s.templateRenderer(ctx, name, language)
+			if err != nil {
+				return err
+			}
+			renderers[language] = renderer
+		}
+		rendered, err := renderer.render(ctx, data)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, &EmailMessage{
+			From:     from,
+			To:       recipient.Email,
+			Subject:  rendered.Subject,
+			HTMLBody: rendered.HTMLBody,
+			TextBody: rendered.TextBody,
+			Headers: map[string]string{
+				"List-Unsubscribe":      "<" + recipient.UnsubscribeURL + ">",
+				"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
 			},
-		},
-		Source: aws.String(emailFrom),
+		})
 	}
 
-	_, err := s.sesClient.SendEmail(context.Background(), input)
-	if err != nil {
-		log.Printf("Failed to send email via SES: %v", err)
-		return err
-	}
+	return s.enqueueBatch(ctx, name, model.EmailPriorityBulk, msgs)
+}
 
-	log.Printf("Email sent successfully to %s via SES", to)
-	return nil
+// sendEmail queues an email in the outbox for delivery by the configured provider
+func (s *EmailService) sendEmail(ctx context.Context, category, to, subject, htmlBody, textBody string) error {
+	slog.DebugContext(ctx, "Queueing email", "category", category, "to", to, "subject", subject)
+
+	return s.enqueue(ctx, category, model.EmailPriorityTransactional, &EmailMessage{
+		From:     s.getEmailFrom(),
+		To:       to,
+		Subject:  subject,
+		HTMLBody: htmlBody,
+		TextBody: textBody,
+	})
 }
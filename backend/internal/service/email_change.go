@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+)
+
+var ErrEmailUnchanged = errors.New("new email is the same as the current email")
+
+const (
+	// EmailChangeTTL is how long the confirmation link for a new email works
+	EmailChangeTTL = 24 * time.Hour
+	// emailChangeResendInterval is the minimum time between change requests
+	emailChangeResendInterval = time.Minute
+)
+
+// EmailChangeService changes users' email addresses. A change is only applied
+// after the user confirms it from the new address.
+type EmailChangeService struct {
+	userRepo        *repository.UserRepository
+	emailChangeRepo *repository.EmailChangeRepository
+	emailService    *EmailService
+	registration    *RegistrationService
+}
+
+func NewEmailChangeService(
+	userRepo *repository.UserRepository,
+	emailChangeRepo *repository.EmailChangeRepository,
+	emailService *EmailService,
+	registration *RegistrationService,
+) *EmailChangeService {
+	return &EmailChangeService{
+		userRepo:        userRepo,
+		emailChangeRepo: emailChangeRepo,
+		emailService:    emailService,
+		registration:    registration,
+	}
+}
+
+// Request starts a change to newEmail, replacing any pending change. The
+// confirmation link goes to the new address and a notice with a cancel link
+// goes to the current one.
+func (s *EmailChangeService) Request(ctx context.Context, user *model.User, newEmail string) (*model.EmailChange, error) {
+	newEmail = strings.ToLower(strings.TrimSpace(newEmail))
+	if newEmail == user.Email {
+		return nil, ErrEmailUnchanged
+	}
+	if s.userRepo.ExistsByEmail(newEmail) {
+		return nil, ErrEmailAlreadyExists
+	}
+	if err := s.registration.CheckEmailDomain(newEmail); err != nil {
+		return nil, err
+	}
+	if pending, err := s.emailChangeRepo.FindByUserID(user.ID); err == nil && time.Since(pending.CreatedAt) < emailChangeResendInterval {
+		return nil, ErrTooManyRequests
+	}
+
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	cancelToken, err := generateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	change := &model.EmailChange{
+		UserID:          user.ID,
+		NewEmail:        newEmail,
+		TokenHash:       hashEmailChangeToken(token),
+		CancelTokenHash: hashEmailChangeToken(cancelToken),
+		ExpiresAt:       time.Now().Add(EmailChangeTTL),
+	}
+	if err := s.emailChangeRepo.Create(change); err != nil {
+		return nil, err
+	}
+
+	if err := s.emailService.SendEmailChangeConfirmation(ctx, newEmail, token, user.Language, int(EmailChangeTTL/time.Hour)); err != nil {
+		return nil, err
+	}
+	if err := s.emailService.SendEmailChangeNotice(ctx, user.Email, newEmail, cancelToken, user.Language); err != nil {
+		slog.ErrorContext(ctx, "Failed to queue email change notice", "user_id", user.ID, "error", err)
+	}
+	return change, nil
+}
+
+// Pending returns the user's unexpired pending change, or nil if there is none
+func (s *EmailChangeService) Pending(userID uint) *model.EmailChange {
+	change, err := s.emailChangeRepo.FindByUserID(userID)
+	if err != nil || time.Now().After(change.ExpiresAt) {
+		return nil
+	}
+	return change
+}
+
+// Confirm applies the change confirmed from the new address. Following the
+// link proves the user owns the new email, so it counts as verified. Sessions
+// keep working, since they identify the user by ID.
+func (s *EmailChangeService) Confirm(ctx context.Context, token string) (*model.User, error) {
+	change, err := s.emailChangeRepo.FindByTokenHash(hashEmailChangeToken(token))
+	if err != nil || time.Now().After(change.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+	deleted, err := s.emailChangeRepo.Delete(change.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !deleted {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.userRepo.FindByID(change.UserID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	// Someone may have signed up with the address since the change was requested
+	if s.userRepo.ExistsByEmail(change.NewEmail) {
+		return nil, ErrEmailAlreadyExists
+	}
+
+	user.Email = change.NewEmail
+	user.EmailVerified = true
+	user.EmailVerificationToken = nil
+	user.EmailVerificationExpireAt = nil
+	if err := s.userRepo.Update(user); err != nil {
+		// The unique index catches a sign-up racing with the check above
+		if s.userRepo.ExistsByEmail(change.NewEmail) {
+			return nil, ErrEmailAlreadyExists
+		}
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "User changed email", "user_id", user.ID)
+	return user, nil
+}
+
+// Cancel drops a pending change from the link sent to the old address
+func (s *EmailChangeService) Cancel(cancelToken string) error {
+	change, err := s.emailChangeRepo.FindByCancelTokenHash(hashEmailChangeToken(cancelToken))
+	if err != nil {
+		return ErrInvalidToken
+	}
+	_, err = s.emailChangeRepo.Delete(change.ID)
+	return err
+}
+
+// CancelForUser drops the user's pending change
+func (s *EmailChangeService) CancelForUser(userID uint) error {
+	return s.emailChangeRepo.DeleteByUserID(userID)
+}
+
+// hashEmailChangeToken returns the stored form of an email change token
+func hashEmailChangeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/mail"
+	"strings"
+	"time"
+
+	appconfig "github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+	"github.com/lite-blog/backend/pkg/sns"
+)
+
+var (
+	ErrSNSWebhookDisabled  = errors.New("SNS webhook is not configured")
+	ErrSNSTopicNotAllowed  = errors.New("SNS topic is not allowed")
+	ErrSuppressionNotFound = errors.New("email suppression not found")
+)
+
+// sesNotification is the subset of an SES bounce/complaint notification we use.
+// SES feedback notifications set notificationType; event publishing sets eventType.
+type sesNotification struct {
+	NotificationType string `json:"notificationType"`
+	EventType        string `json:"eventType"`
+	Bounce           *struct {
+		BounceType        string `json:"bounceType"`
+		BounceSubType     string `json:"bounceSubType"`
+		FeedbackID        string `json:"feedbackId"`
+		BouncedRecipients []struct {
+			EmailAddress   string `json:"emailAddress"`
+			DiagnosticCode string `json:"diagnosticCode"`
+		} `json:"bouncedRecipients"`
+	} `json:"bounce"`
+	Complaint *struct {
+		FeedbackID            string `json:"feedbackId"`
+		ComplaintFeedbackType string `json:"complaintFeedbackType"`
+		ComplainedRecipients  []struct {
+			EmailAddress string `json:"emailAddress"`
+		} `json:"complainedRecipients"`
+	} `json:"complaint"`
+}
+
+// EmailFeedbackService processes bounce and complaint feedback and manages suppressed addresses
+type EmailFeedbackService struct {
+	cfg             *appconfig.AWSEmailConfig
+	verifier        *sns.Verifier
+	suppressionRepo *repository.EmailSuppressionRepository
+	userRepo        *repository.UserRepository
+	subscriberRepo  *repository.SubscriberRepository
+}
+
+func NewEmailFeedbackService(
+	cfg *appconfig.AWSEmailConfig,
+	verifier *sns.Verifier,
+	suppressionRepo *repository.EmailSuppressionRepository,
+	userRepo *repository.UserRepository,
+	subscriberRepo *repository.SubscriberRepository,
+) *EmailFeedbackService {
+	return &EmailFeedbackService{
+		cfg:             cfg,
+		verifier:        verifier,
+		suppressionRepo: suppressionRepo,
+		userRepo:        userRepo,
+		subscriberRepo:  subscriberRepo,
+	}
+}
+
+// HandleSNSMessage verifies an SNS message posted to the webhook and processes it
+func (s *EmailFeedbackService) HandleSNSMessage(ctx context.Context, body []byte) error {
+	if len(s.cfg.SNSTopicARNs) == 0 {
+		return ErrSNSWebhookDisabled
+	}
+
+	msg, err := sns.ParseMessage(body)
+	if err != nil {
+		return err
+	}
+	if !s.isAllowedTopic(msg.TopicArn) {
+		return ErrSNSTopicNotAllowed
+	}
+	if err := s.verifier.Verify(msg); err != nil {
+		return err
+	}
+
+	switch msg.Type {
+	case sns.TypeSubscriptionConfirmation:
+		if !s.cfg.ConfirmSNSSubscriptions {
+			slog.WarnContext(ctx, "Received SNS subscription confirmation; confirm it manually", "topic_arn", msg.TopicArn, "subscribe_url", msg.SubscribeURL)
+			return nil
+		}
+		if err := s.verifier.ConfirmSubscription(ctx, msg); err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "Confirmed SNS subscription", "topic_arn", msg.TopicArn)
+		return nil
+	case sns.TypeUnsubscribeConfirmation:
+		slog.WarnContext(ctx, "SNS subscription was removed", "topic_arn", msg.TopicArn)
+		return nil
+	case sns.TypeNotification:
+		return s.handleSESNotification(ctx, []byte(msg.Message))
+	default:
+		return sns.ErrInvalidMessage
+	}
+}
+
+// handleSESNotification suppresses hard-bounced and complaining recipients
+func (s *EmailFeedbackService) handleSESNotification(ctx context.Context, data []byte) error {
+	var notification sesNotification
+	if err := json.Unmarshal(data, &notification); err != nil {
+		return sns.ErrInvalidMessage
+	}
+
+	kind := notification.NotificationType
+	if kind == "" {
+		kind = notification.EventType
+	}
+
+	switch kind {
+	case "Bounce":
+		bounce := notification.Bounce
+		if bounce == nil {
+			return sns.ErrInvalidMessage
+		}
+		// Transient bounces (full mailbox, etc.) are retried by SES and don't mean the address is bad
+		if bounce.BounceType != "Permanent" {
+			slog.InfoContext(ctx, "Ignoring transient bounce", "bounce_type", bounce.BounceType, "bounce_subtype", bounce.BounceSubType,
+				"recipients", len(bounce.BouncedRecipients))
+			return nil
+		}
+		for _, recipient := range bounce.BouncedRecipients {
+			detail := bounce.BounceSubType
+			if recipient.DiagnosticCode != "" {
+				detail += ": " + recipient.DiagnosticCode
+			}
+			if err := s.Suppress(ctx, recipient.EmailAddress, model.SuppressionReasonBounce, detail, bounce.FeedbackID); err != nil {
+				return err
+			}
+		}
+	case "Complaint":
+		complaint := notification.Complaint
+		if complaint == nil {
+			return sns.ErrInvalidMessage
+		}
+		for _, recipient := range complaint.ComplainedRecipients {
+			if err := s.Suppress(ctx, recipient.EmailAddress, model.SuppressionReasonComplaint, complaint.ComplaintFeedbackType, complaint.FeedbackID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Suppress stops all future email to an address, linking it to the matching user
+// and subscriber. Subscribers are unsubscribed so they drop out of newsletters.
+func (s *EmailFeedbackService) Suppress(ctx context.Context, address string, reason model.SuppressionReason, detail, feedbackID string) error {
+	email := normalizeAddress(address)
+	if email == "" {
+		return nil
+	}
+
+	suppression := &model.EmailSuppression{
+		Email:      email,
+		Reason:     reason,
+		Detail:     detail,
+		FeedbackID: feedbackID,
+	}
+
+	if user, err := s.userRepo.FindByEmail(email); err == nil {
+		suppression.UserID = &user.ID
+	}
+	if subscriber, err := s.subscriberRepo.FindByEmail(email); err == nil {
+		suppression.SubscriberID = &subscriber.ID
+		if subscriber.Status != model.SubscriberStatusUnsubscribed {
+			now := time.Now()
+			subscriber.Status = model.SubscriberStatusUnsubscribed
+			subscriber.UnsubscribedAt = &now
+			if err := s.subscriberRepo.Update(subscriber); err != nil {
+				return err
+			}
+		}
+	}
+
+	slog.InfoContext(ctx, "Suppressing email address", "email", email, "reason", reason)
+	return s.suppressionRepo.Upsert(suppression)
+}
+
+// ListSuppressions returns a paginated list of suppressed addresses, optionally filtered by reason
+func (s *EmailFeedbackService) ListSuppressions(reason string, page, pageSize int) ([]model.EmailSuppression, int64, error) {
+	return s.suppressionRepo.List(reason, page, pageSize)
+}
+
+// DeleteSuppression allows an address to receive email again, e.g. after the
+// recipient fixed their mailbox. It returns the removed suppression.
+func (s *EmailFeedbackService) DeleteSuppression(id uint) (*model.EmailSuppression, error) {
+	suppression, err := s.suppressionRepo.FindByID(id)
+	if err != nil {
+		return nil, ErrSuppressionNotFound
+	}
+	return suppression, s.suppressionRepo.Delete(id)
+}
+
+func (s *EmailFeedbackService) isAllowedTopic(topicArn string) bool {
+	for _, allowed := range s.cfg.SNSTopicARNs {
+		if strings.TrimSpace(allowed) == topicArn {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeAddress extracts and lowercases the address from values like "Name <a@b.com>"
+func normalizeAddress(address string) string {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		address = parsed.Address
+	}
+	return strings.ToLower(strings.TrimSpace(address))
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	appconfig "github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/internal/repository"
+	"github.com/lite-blog/backend/pkg/sns"
+	"github.com/lite-blog/backend/pkg/sns/snstest"
+)
+
+const feedbackTopicArn = "arn:aws:sns:us-east-1:123456789012:ses-feedback"
+
+const permanentBounce = `{
+	"notificationType": "Bounce",
+	"bounce": {
+		"bounceType": "Permanent",
+		"bounceSubType": "General",
+		"feedbackId": "feedback-1",
+		"bouncedRecipients": [{"emailAddress": "Gone@Example.com", "diagnosticCode": "550 5.1.1 user unknown"}]
+	}
+}`
+
+// newFeedbackService returns a service that trusts server's signatures and
+// takes feedback from feedbackTopicArn
+func newFeedbackService(env *testEnv, server *snstest.Server) *EmailFeedbackService {
+	env.cfg.Email.AWS = appconfig.AWSEmailConfig{SNSTopicARNs: []string{feedbackTopicArn}, ConfirmSNSSubscriptions: true}
+	return NewEmailFeedbackService(&env.cfg.Email.AWS, server.Verifier(), repository.NewEmailSuppressionRepository(env.db),
+		env.userRepo, repository.NewSubscriberRepository(env.db))
+}
+
+func newSNSServer(t *testing.T) *snstest.Server {
+	t.Helper()
+	server := snstest.NewServer()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func postSNS(t *testing.T, service *EmailFeedbackService, msg *sns.Message) error {
+	t.Helper()
+	body, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service.HandleSNSMessage(context.Background(), body)
+}
+
+func TestHandleSNSMessageSuppressesBouncedAddress(t *testing.T) {
+	env := newTestEnv(t)
+	server := newSNSServer(t)
+	service := newFeedbackService(env, server)
+
+	if err := postSNS(t, service, server.Notification(feedbackTopicArn, permanentBounce)); err != nil {
+		t.Fatalf("HandleSNSMessage: %v", err)
+	}
+	if !service.suppressionRepo.IsSuppressed("gone@example.com") {
+		t.Error("bounced address was not suppressed")
+	}
+}
+
+func TestHandleSNSMessageRejectsTopicOutsideAllowlist(t *testing.T) {
+	env := newTestEnv(t)
+	server := newSNSServer(t)
+	service := newFeedbackService(env, server)
+
+	msg := server.Notification("arn:aws:sns:us-east-1:999999999999:someone-else", permanentBounce)
+	if err := postSNS(t, service, msg); err != ErrSNSTopicNotAllowed {
+		t.Fatalf("error = %v, want ErrSNSTopicNotAllowed", err)
+	}
+	if service.suppressionRepo.IsSuppressed("gone@example.com") {
+		t.Error("a notification from another topic suppressed an address")
+	}
+}
+
+func TestHandleSNSMessageRejectsInvalidMessages(t *testing.T) {
+	env := newTestEnv(t)
+	server := newSNSServer(t)
+	service := newFeedbackService(env, server)
+
+	tampered := server.Notification(feedbackTopicArn, `{"notificationType":"Bounce"}`)
+	tampered.Message = permanentBounce
+	replayed := server.Notification(feedbackTopicArn, permanentBounce)
+	replayed.Timestamp = time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	server.Sign(replayed, "2")
+
+	for name, tc := range map[string]struct {
+		msg  *sns.Message
+		want error
+	}{
+		"tampered": {tampered, sns.ErrInvalidSignature},
+		"replayed": {replayed, sns.ErrMessageExpired},
+	} {
+		if err := postSNS(t, service, tc.msg); !errors.Is(err, tc.want) {
+			t.Errorf("%s: error = %v, want %v", name, err, tc.want)
+		}
+	}
+	if service.suppressionRepo.IsSuppressed("gone@example.com") {
+		t.Error("an invalid notification suppressed an address")
+	}
+}
+
+func TestHandleSNSMessageDisabledWithoutTopics(t *testing.T) {
+	env := newTestEnv(t)
+	server := newSNSServer(t)
+	service := newFeedbackService(env, server)
+	env.cfg.Email.AWS.SNSTopicARNs = nil
+
+	if err := postSNS(t, service, server.Notification(feedbackTopicArn, permanentBounce)); err != ErrSNSWebhookDisabled {
+		t.Errorf("error = %v, want ErrSNSWebhookDisabled", err)
+	}
+}
+
+func TestHandleSNSMessageConfirmsSubscription(t *testing.T) {
+	env := newTestEnv(t)
+	server := newSNSServer(t)
+	service := newFeedbackService(env, server)
+
+	msg := server.SubscriptionConfirmation(feedbackTopicArn)
+	if err := postSNS(t, service, msg); err != nil {
+		t.Fatalf("HandleSNSMessage: %v", err)
+	}
+	if !server.Confirmed(msg.Token) {
+		t.Error("subscription was not confirmed")
+	}
+
+	env.cfg.Email.AWS.ConfirmSNSSubscriptions = false
+	msg = server.SubscriptionConfirmation(feedbackTopicArn)
+	if err := postSNS(t, service, msg); err != nil {
+		t.Fatalf("HandleSNSMessage: %v", err)
+	}
+	if server.Confirmed(msg.Token) {
+		t.Error("subscription was confirmed with confirm_sns_subscriptions off")
+	}
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+)
+
+var (
+	ErrEmailNotFound     = errors.New("email not found")
+	ErrEmailNotRetryable = errors.New("only failed emails can be retried")
+)
+
+const (
+	defaultOutboxMaxAttempts  = 8
+	defaultOutboxBatchSize    = 20
+	defaultOutboxPollInterval = 5 * time.Second
+	defaultOutboxBaseBackoff  = 30 * time.Second
+	defaultOutboxMaxBackoff   = time.Hour
+
+	// outboxLease is how long a claimed message stays reserved for the sender.
+	// Messages still marked sending after that (e.g. the process died) are retried.
+	outboxLease = 5 * time.Minute
+)
+
+// enqueue stores a message in the outbox; the background sender delivers it
+func (s *EmailService) enqueue(ctx context.Context, category string, priority int, msg *EmailMessage) error {
+	// Suppressed addresses are skipped silently; bouncing again would hurt our sending reputation
+	if s.suppressionRepo != nil && s.suppressionRepo.IsSuppressed(msg.To) {
+		slog.InfoContext(ctx, "Not queueing email to suppressed address", "category", category, "to", msg.To)
+		return nil
+	}
+
+	message, err := s.newOutboxMessage(category, priority, msg)
+	if err != nil {
+		return err
+	}
+	if err := s.outboxRepo.Create(message); err != nil {
+		slog.ErrorContext(ctx, "Failed to queue email", "category", category, "to", msg.To, "error", err)
+		return err
+	}
+
+	s.wakeOutbox()
+	return nil
+}
+
+// enqueueBatch stores many messages in the outbox at once
+func (s *EmailService) enqueueBatch(ctx context.Context, category string, priority int, msgs []*EmailMessage) error {
+	suppressed := map[string]bool{}
+	if s.suppressionRepo != nil && len(msgs) > 0 {
+		to := make([]string, len(msgs))
+		for i, msg := range msgs {
+			to[i] = msg.To
+		}
+		var err error
+		if suppressed, err = s.suppressionRepo.FindSuppressed(to); err != nil {
+			return err
+		}
+	}
+
+	messages := make([]model.EmailOutbox, 0, len(msgs))
+	for _, msg := range msgs {
+		if suppressed[strings.ToLower(msg.To)] {
+			continue
+		}
+		message, err := s.newOutboxMessage(category, priority, msg)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, *message)
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+	if err := s.outboxRepo.CreateBatch(messages); err != nil {
+		slog.ErrorContext(ctx, "Failed to queue emails", "category", category, "count", len(messages), "error", err)
+		return err
+	}
+
+	s.wakeOutbox()
+	return nil
+}
+
+func (s *EmailService) newOutboxMessage(category string, priority int, msg *EmailMessage) (*model.EmailOutbox, error) {
+	headers := ""
+	if len(msg.Headers) > 0 {
+		data, err := json.Marshal(msg.Headers)
+		if err != nil {
+			return nil, err
+		}
+		headers = string(data)
+	}
+
+	return &model.EmailOutbox{
+		Category:      category,
+		From:          msg.From,
+		To:            msg.To,
+		Subject:       msg.Subject,
+		HTMLBody:      msg.HTMLBody,
+		TextBody:      msg.TextBody,
+		Headers:       headers,
+		Status:        model.EmailStatusPending,
+		Priority:      priority,
+		MaxAttempts:   s.outboxMaxAttempts(),
+		NextAttemptAt: time.Now(),
+	}, nil
+}
+
+// RunOutbox runs the background sender until ctx is cancelled
+func (s *EmailService) RunOutbox(ctx context.Context) {
+	ticker := time.NewTicker(s.outboxPollInterval())
+	defer ticker.Stop()
+
+	for {
+		s.ProcessOutbox(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.outboxWake:
+		}
+	}
+}
+
+// ProcessOutbox sends all messages that are currently due
+func (s *EmailService) ProcessOutbox(ctx context.Context) {
+	for ctx.Err() == nil {
+		messages, err := s.outboxRepo.ClaimDue(time.Now(), s.outboxBatchSize(), outboxLease)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to claim outbox messages", "error", err)
+			return
+		}
+		if len(messages) == 0 {
+			return
+		}
+
+		for i := range messages {
+			s.throttle(ctx)
+			if ctx.Err() != nil {
+				// Hand unsent messages back instead of waiting for the lease to expire
+				for _, message := range messages[i:] {
+					s.outboxRepo.Release(message.ID)
+				}
+				return
+			}
+			s.deliver(ctx, &messages[i])
+		}
+	}
+}
+
+// throttle spaces out sends to stay under the configured rate, so large
+// newsletters don't exceed provider sending limits
+func (s *EmailService) throttle(ctx context.Context) {
+	if s.cfg.Outbox.RatePerSecond <= 0 {
+		return
+	}
+
+	interval := time.Second / time.Duration(s.cfg.Outbox.RatePerSecond)
+	if wait := time.Until(s.lastSentAt.Add(interval)); wait > 0 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+	}
+	s.lastSentAt = time.Now()
+}
+
+// deliver attempts to send a claimed message and records the outcome
+func (s *EmailService) deliver(ctx context.Context, message *model.EmailOutbox) {
+	msg := &EmailMessage{
+		From:     message.From,
+		To:       message.To,
+		Subject:  message.Subject,
+		HTMLBody: message.HTMLBody,
+		TextBody: message.TextBody,
+	}
+	if message.Headers != "" {
+		if err := json.Unmarshal([]byte(message.Headers), &msg.Headers); err != nil {
+			slog.WarnContext(ctx, "Invalid headers on outbox message", "message_id", message.ID, "error", err)
+		}
+	}
+
+	// The address may have bounced since the message was queued
+	if s.suppressionRepo != nil && s.suppressionRepo.IsSuppressed(message.To) {
+		if err := s.outboxRepo.MarkAttemptFailed(message.ID, message.Attempts, model.EmailStatusFailed, time.Now(), "recipient address is suppressed"); err != nil {
+			slog.ErrorContext(ctx, "Failed to record suppressed outbox message", "message_id", message.ID, "error", err)
+		}
+		return
+	}
+
+	// A message that has started sending is finished even during shutdown, so
+	// it isn't cut off halfway and sent twice
+	attempts := message.Attempts + 1
+	err := s.provider.Send(context.WithoutCancel(ctx), msg)
+	if err == nil {
+		if err := s.outboxRepo.MarkSent(message.ID, attempts, time.Now()); err != nil {
+			slog.ErrorContext(ctx, "Failed to mark outbox message as sent", "message_id", message.ID, "error", err)
+		}
+		return
+	}
+
+	status := model.EmailStatusPending
+	if attempts >= message.MaxAttempts {
+		status = model.EmailStatusFailed
+		slog.ErrorContext(ctx, "Giving up on email", "category", message.Category, "message_id", message.ID, "to", message.To,
+			"attempts", attempts, "error", err)
+	}
+	nextAttemptAt := time.Now().Add(s.outboxBackoff(attempts))
+	if err := s.outboxRepo.MarkAttemptFailed(message.ID, attempts, status, nextAttemptAt, err.Error()); err != nil {
+		slog.ErrorContext(ctx, "Failed to record failed attempt for outbox message", "message_id", message.ID, "error", err)
+	}
+}
+
+// outboxBackoff returns the exponential retry delay after the given number of attempts, with jitter
+func (s *EmailService) outboxBackoff(attempts int) time.Duration {
+	base := defaultOutboxBaseBackoff
+	if s.cfg.Outbox.BaseBackoffSeconds > 0 {
+		base = time.Duration(s.cfg.Outbox.BaseBackoffSeconds) * time.Second
+	}
+	max := defaultOutboxMaxBackoff
+	if s.cfg.Outbox.MaxBackoffSeconds > 0 {
+		max = time.Duration(s.cfg.Outbox.MaxBackoffSeconds) * time.Second
+	}
+
+	delay := base
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	// Up to 20% jitter so retries of a burst of failures don't line up
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// wakeOutbox nudges the sender so new messages don't wait for the next poll
+func (s *EmailService) wakeOutbox() {
+	select {
+	case s.outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *EmailService) outboxMaxAttempts() int {
+	if s.cfg.Outbox.MaxAttempts > 0 {
+		return s.cfg.Outbox.MaxAttempts
+	}
+	return defaultOutboxMaxAttempts
+}
+
+func (s *EmailService) outboxBatchSize() int {
+	if s.cfg.Outbox.BatchSize > 0 {
+		return s.cfg.Outbox.BatchSize
+	}
+	return defaultOutboxBatchSize
+}
+
+func (s *EmailService) outboxPollInterval() time.Duration {
+	if s.cfg.Outbox.PollIntervalSeconds > 0 {
+		return time.Duration(s.cfg.Outbox.PollIntervalSeconds) * time.Second
+	}
+	return defaultOutboxPollInterval
+}
+
+// ListOutbox returns a paginated list of outbox messages, optionally filtered by status
+func (s *EmailService) ListOutbox(status string, page, pageSize int) ([]model.EmailOutbox, int64, error) {
+	return s.outboxRepo.List(status, page, pageSize)
+}
+
+// outboxTokenPattern matches the tokens in verification, sign-in, email
+// change, subscription and invitation links, which work until they are used
+var outboxTokenPattern = regexp.MustCompile(`\b((?:token|invitation)=)[^&"'\s<>]+`)
+
+// GetOutboxMessage returns a single outbox message including its bodies, with
+// the tokens in their links redacted so admins can't use them
+func (s *EmailService) GetOutboxMessage(id uint) (*model.EmailOutbox, error) {
+	message, err := s.outboxRepo.FindByID(id)
+	if err != nil {
+		return nil, ErrEmailNotFound
+	}
+	message.HTMLBody = outboxTokenPattern.ReplaceAllString(message.HTMLBody, "${1}redacted")
+	message.TextBody = outboxTokenPattern.ReplaceAllString(message.TextBody, "${1}redacted")
+	return message, nil
+}
+
+// RetryOutboxMessage requeues a dead-lettered message with a fresh attempt budget
+func (s *EmailService) RetryOutboxMessage(id uint) error {
+	message, err := s.outboxRepo.FindByID(id)
+	if err != nil {
+		return ErrEmailNotFound
+	}
+	if message.Status != model.EmailStatusFailed {
+		return ErrEmailNotRetryable
+	}
+
+	if err := s.outboxRepo.Requeue(id, time.Now()); err != nil {
+		return err
+	}
+
+	s.wakeOutbox()
+	return nil
+}
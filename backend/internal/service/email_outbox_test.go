@@ -0,0 +1,39 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	appconfig "github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+)
+
+func TestGetOutboxMessageRedactsLinkTokens(t *testing.T) {
+	env := newTestEnv(t)
+	outboxRepo := repository.NewEmailOutboxRepository(env.db)
+	service := NewEmailServiceWithProvider(&appconfig.EmailConfig{}, nil, outboxRepo, nil, env.site, nil)
+
+	message := &model.EmailOutbox{
+		To:       "reader@example.com",
+		Subject:  "Sign in",
+		HTMLBody: `<a href="https://blog.example.com/magic-link?token=secret-1&amp;lang=en">Sign in</a>`,
+		TextBody: "Join: https://blog.example.com/register?invitation=inv_secret-2\nVerify: https://blog.example.com/verify-email?token=secret-3",
+	}
+	if err := outboxRepo.Create(message); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := service.GetOutboxMessage(message.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{got.HTMLBody, got.TextBody} {
+		if strings.Contains(body, "secret") {
+			t.Errorf("body still holds a token: %s", body)
+		}
+	}
+	if !strings.Contains(got.HTMLBody, "magic-link?token=redacted&amp;lang=en") {
+		t.Errorf("HTML body = %s, want the link kept with its token redacted", got.HTMLBody)
+	}
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+
+	appconfig "github.com/lite-blog/backend/internal/config"
+)
+
+// EmailMessage is a provider-agnostic email
+type EmailMessage struct {
+	From     string
+	To       string
+	Subject  string
+	HTMLBody string
+	TextBody string
+	Headers  map[string]string // Extra headers, e.g. List-Unsubscribe
+}
+
+// EmailProvider delivers email messages. SES and SMTP are interchangeable implementations.
+type EmailProvider interface {
+	Name() string
+	Send(ctx context.Context, msg *EmailMessage) error
+	Close() error
+}
+
+// NewEmailProvider creates the provider configured in EmailConfig.Provider.
+// It falls back to a logging provider when the configured one cannot be initialized.
+func NewEmailProvider(cfg *appconfig.EmailConfig) EmailProvider {
+	switch cfg.Provider {
+	case "ses":
+		provider, err := NewSESEmailProvider(&cfg.AWS)
+		if err != nil {
+			slog.Warn("Failed to load AWS config, logging emails instead", "error", err)
+			break
+		}
+		return provider
+	case "smtp":
+		if cfg.SMTP.Host == "" {
+			slog.Warn("SMTP provider selected but smtp.host is empty, logging emails instead")
+			break
+		}
+		return NewSMTPEmailProvider(&cfg.SMTP)
+	}
+	return &logEmailProvider{}
+}
+
+// logEmailProvider just logs the email content (for development)
+type logEmailProvider struct{}
+
+func (p *logEmailProvider) Name() string {
+	return "log"
+}
+
+func (p *logEmailProvider) Send(ctx context.Context, msg *EmailMessage) error {
+	slog.InfoContext(ctx, "Email not sent, no email provider configured", "to", msg.To, "subject", msg.Subject, "text", msg.TextBody)
+	slog.DebugContext(ctx, "Email HTML", "to", msg.To, "html", msg.HTMLBody)
+	return nil
+}
+
+func (p *logEmailProvider) Close() error {
+	return nil
+}
+
+// buildMIMEMessage renders msg as a multipart/alternative RFC 5322 message
+func buildMIMEMessage(msg *EmailMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	body := multipart.NewWriter(&buf)
+
+	headers := map[string]string{
+		"From":         msg.From,
+		"To":           msg.To,
+		"Subject":      mime.QEncoding.Encode("UTF-8", msg.Subject),
+		"Date":         time.Now().Format(time.RFC1123Z),
+		"Message-ID":   generateMessageID(msg.From),
+		"MIME-Version": "1.0",
+		"Content-Type": fmt.Sprintf("multipart/alternative; boundary=%q", body.Boundary()),
+	}
+	for key, value := range msg.Headers {
+		headers[textproto.CanonicalMIMEHeaderKey(key)] = value
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var out bytes.Buffer
+	for _, key := range keys {
+		value := headers[key]
+		if strings.ContainsAny(key, "\r\n:") || strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("invalid email header %q", key)
+		}
+		fmt.Fprintf(&out, "%s: %s\r\n", key, value)
+	}
+	out.WriteString("\r\n")
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=UTF-8", msg.TextBody},
+		{"text/html; charset=UTF-8", msg.HTMLBody},
+	}
+	for _, part := range parts {
+		if part.content == "" {
+			continue
+		}
+		w, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+
+	out.Write(buf.Bytes())
+	return out.Bytes(), nil
+}
+
+// generateMessageID generates a unique Message-ID using the sender's domain
+func generateMessageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(addr.Address, "@"); at >= 0 {
+			domain = addr.Address[at+1:]
+		}
+	}
+
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b), domain)
+}
+
+// envelopeAddress extracts the bare address from a header value like "Name <a@b.c>"
+func envelopeAddress(value string) (string, error) {
+	addr, err := mail.ParseAddress(value)
+	if err != nil {
+		return "", err
+	}
+	return addr.Address, nil
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ses"
+	"github.com/aws/aws-sdk-go-v2/service/ses/types"
+	appconfig "github.com/lite-blog/backend/internal/config"
+)
+
+// SESEmailProvider sends email through AWS SES
+type SESEmailProvider struct {
+	client *ses.Client
+}
+
+func NewSESEmailProvider(cfg *appconfig.AWSEmailConfig) (*SESEmailProvider, error) {
+	awsCfg, err := config.LoadDefaultConfig(context.Background(),
+		config.WithRegion(cfg.Region),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SESEmailProvider{
+		client: ses.NewFromConfig(awsCfg),
+	}, nil
+}
+
+func (p *SESEmailProvider) Name() string {
+	return "ses"
+}
+
+// Send sends a message via SES. Messages with extra headers go through
+// SendRawEmail since SendEmail cannot carry custom headers.
+func (p *SESEmailProvider) Send(ctx context.Context, msg *EmailMessage) error {
+	if len(msg.Headers) > 0 {
+		return p.sendRaw(ctx, msg)
+	}
+
+	input := &ses.SendEmailInput{
+		Destination: &types.Destination{
+			ToAddresses: []string{msg.To},
+		},
+		Message: &types.Message{
+			Body: &types.Body{
+				Html: &types.Content{
+					Charset: aws.String("UTF-8"),
+					Data:    aws.String(msg.HTMLBody),
+				},
+				Text: &types.Content{
+					Charset: aws.String("UTF-8"),
+					Data:    aws.String(msg.TextBody),
+				},
+			},
+			Subject: &types.Content{
+				Charset: aws.String("UTF-8"),
+				Data:    aws.String(msg.Subject),
+			},
+		},
+		Source: aws.String(msg.From),
+	}
+
+	_, err := p.client.SendEmail(ctx, input)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to send email via SES", "to", msg.To, "error", err)
+		return err
+	}
+
+	slog.InfoContext(ctx, "Email sent via SES", "to", msg.To)
+	return nil
+}
+
+func (p *SESEmailProvider) sendRaw(ctx context.Context, msg *EmailMessage) error {
+	data, err := buildMIMEMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.client.SendRawEmail(ctx, &ses.SendRawEmailInput{
+		Destinations: []string{msg.To},
+		RawMessage:   &types.RawMessage{Data: data},
+		Source:       aws.String(msg.From),
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to send email via SES", "to", msg.To, "error", err)
+		return err
+	}
+
+	slog.InfoContext(ctx, "Email sent via SES", "to", msg.To)
+	return nil
+}
+
+func (p *SESEmailProvider) Close() error {
+	return nil
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	appconfig "github.com/lite-blog/backend/internal/config"
+)
+
+const (
+	defaultSMTPTimeout     = 10 * time.Second
+	defaultSMTPIdleTimeout = 30 * time.Second
+)
+
+var ErrSMTPStartTLSUnsupported = errors.New("smtp server does not support STARTTLS")
+
+// SMTPEmailProvider sends email through an SMTP server. A single connection
+// is kept open and reused between messages until it has been idle for
+// IdleTimeoutSeconds.
+type SMTPEmailProvider struct {
+	cfg         *appconfig.SMTPEmailConfig
+	timeout     time.Duration
+	idleTimeout time.Duration
+
+	mu        sync.Mutex
+	conn      net.Conn
+	client    *smtp.Client
+	idleTimer *time.Timer
+}
+
+func NewSMTPEmailProvider(cfg *appconfig.SMTPEmailConfig) *SMTPEmailProvider {
+	p := &SMTPEmailProvider{
+		cfg:         cfg,
+		timeout:     defaultSMTPTimeout,
+		idleTimeout: defaultSMTPIdleTimeout,
+	}
+	if cfg.TimeoutSeconds > 0 {
+		p.timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+	}
+	if cfg.IdleTimeoutSeconds > 0 {
+		p.idleTimeout = time.Duration(cfg.IdleTimeoutSeconds) * time.Second
+	}
+	return p
+}
+
+func (p *SMTPEmailProvider) Name() string {
+	return "smtp"
+}
+
+// Send delivers a message, reusing the open connection when possible.
+// If a reused connection turns out to be dead, it reconnects once.
+func (p *SMTPEmailProvider) Send(ctx context.Context, msg *EmailMessage) error {
+	from, err := envelopeAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address: %w", err)
+	}
+	to, err := envelopeAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %w", err)
+	}
+	data, err := buildMIMEMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.idleTimer != nil {
+		p.idleTimer.Stop()
+	}
+
+	reused := p.client != nil
+	if reused {
+		// RSET doubles as a liveness check for the pooled connection
+		if err := p.withDeadline(ctx, p.client.Reset); err != nil {
+			p.closeLocked()
+			reused = false
+		}
+	}
+
+	if err := p.sendLocked(ctx, from, to, data); err != nil {
+		p.closeLocked()
+		if !reused {
+			slog.WarnContext(ctx, "Failed to send email via SMTP", "to", msg.To, "error", err)
+			return err
+		}
+		if err := p.sendLocked(ctx, from, to, data); err != nil {
+			p.closeLocked()
+			slog.WarnContext(ctx, "Failed to send email via SMTP", "to", msg.To, "error", err)
+			return err
+		}
+	}
+
+	p.idleTimer = time.AfterFunc(p.idleTimeout, func() { p.Close() })
+	slog.InfoContext(ctx, "Email sent via SMTP", "to", msg.To)
+	return nil
+}
+
+// Close quits the pooled connection, if any
+func (p *SMTPEmailProvider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.idleTimer != nil {
+		p.idleTimer.Stop()
+		p.idleTimer = nil
+	}
+	if p.client == nil {
+		return nil
+	}
+	p.withDeadline(context.Background(), p.client.Quit)
+	p.closeLocked()
+	return nil
+}
+
+func (p *SMTPEmailProvider) sendLocked(ctx context.Context, from, to string, data []byte) error {
+	if p.client == nil {
+		if err := p.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	return p.withDeadline(ctx, func() error {
+		if err := p.client.Mail(from); err != nil {
+			return err
+		}
+		if err := p.client.Rcpt(to); err != nil {
+			return err
+		}
+		w, err := p.client.Data()
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			w.Close()
+			return err
+		}
+		return w.Close()
+	})
+}
+
+// connect dials the server and performs TLS negotiation and authentication
+func (p *SMTPEmailProvider) connect(ctx context.Context) error {
+	addr := net.JoinHostPort(p.cfg.Host, strconv.Itoa(p.port()))
+	dialer := &net.Dialer{Timeout: p.timeout}
+	tlsConfig := &tls.Config{
+		ServerName:         p.cfg.Host,
+		InsecureSkipVerify: p.cfg.InsecureSkipVerify,
+	}
+
+	var conn net.Conn
+	var err error
+	if p.encryption() == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(p.timeout))
+
+	client, err := smtp.NewClient(conn, p.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	if err := p.handshake(client, tlsConfig); err != nil {
+		client.Close()
+		return err
+	}
+
+	p.conn = conn
+	p.client = client
+	return nil
+}
+
+func (p *SMTPEmailProvider) handshake(client *smtp.Client, tlsConfig *tls.Config) error {
+	if p.cfg.HeloName != "" {
+		if err := client.Hello(p.cfg.HeloName); err != nil {
+			return err
+		}
+	}
+
+	if p.encryption() == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return ErrSMTPStartTLSUnsupported
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if p.cfg.Username == "" {
+		return nil
+	}
+
+	var auth smtp.Auth
+	switch strings.ToLower(p.cfg.Auth) {
+	case "login":
+		auth = &loginAuth{username: p.cfg.Username, password: p.cfg.Password, host: p.cfg.Host}
+	default:
+		auth = smtp.PlainAuth("", p.cfg.Username, p.cfg.Password, p.cfg.Host)
+	}
+	return client.Auth(auth)
+}
+
+// withDeadline runs fn with the connection deadline bounded by both the
+// configured timeout and the context deadline
+func (p *SMTPEmailProvider) withDeadline(ctx context.Context, fn func() error) error {
+	deadline := time.Now().Add(p.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	p.conn.SetDeadline(deadline)
+	return fn()
+}
+
+func (p *SMTPEmailProvider) closeLocked() {
+	if p.client != nil {
+		p.client.Close()
+	}
+	p.client = nil
+	p.conn = nil
+}
+
+func (p *SMTPEmailProvider) encryption() string {
+	switch strings.ToLower(p.cfg.Encryption) {
+	case "tls", "ssl":
+		return "tls"
+	case "none":
+		return "none"
+	default:
+		return "starttls"
+	}
+}
+
+func (p *SMTPEmailProvider) port() int {
+	if p.cfg.Port > 0 {
+		return p.cfg.Port
+	}
+	if p.encryption() == "tls" {
+		return 465
+	}
+	return 587
+}
+
+// loginAuth implements the LOGIN authentication mechanism, which net/smtp
+// does not provide but many servers (e.g. Office 365) still require
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// Same rule as smtp.PlainAuth: never send credentials in clear text
+	// except to localhost
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN challenge: %q", fromServer)
+	}
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
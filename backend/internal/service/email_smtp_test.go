@@ -0,0 +1,618 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	appconfig "github.com/lite-blog/backend/internal/config"
+)
+
+// fakeSMTPServer is a minimal in-process SMTP server that records what the
+// provider sends
+type fakeSMTPServer struct {
+	listener net.Listener
+	tls      *tls.Config // STARTTLS is offered when set
+
+	mu          sync.Mutex
+	connections int
+	open        []net.Conn
+	commands    []string
+	auths       []string // "MECHANISM user:password"
+	startTLS    int
+	messages    []fakeSMTPMessage
+	quits       int
+}
+
+type fakeSMTPMessage struct {
+	from, to string
+	tls      bool
+	data     string
+}
+
+func newFakeSMTPServer(t *testing.T, withTLS bool) *fakeSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTPServer{listener: listener}
+	if withTLS {
+		s.tls = &tls.Config{Certificates: []tls.Certificate{selfSignedCert(t)}}
+	}
+	go s.serve()
+	t.Cleanup(func() {
+		listener.Close()
+		s.dropConnections()
+	})
+	return s
+}
+
+func (s *fakeSMTPServer) config() *appconfig.SMTPEmailConfig {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return &appconfig.SMTPEmailConfig{Host: host, Port: p, Encryption: "none"}
+}
+
+func (s *fakeSMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.connections++
+		s.open = append(s.open, conn)
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+// dropConnections closes every connection without a QUIT, like a server
+// restart or an idle timeout on the server side
+func (s *fakeSMTPServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.open {
+		conn.Close()
+	}
+	s.open = nil
+}
+
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	secure := false
+	var from, to string
+
+	reply := func(code int, lines ...string) {
+		for i, line := range lines {
+			sep := "-"
+			if i == len(lines)-1 {
+				sep = " "
+			}
+			text.PrintfLine("%d%s%s", code, sep, line)
+		}
+	}
+	// challenge sends a 334 prompt and returns the decoded answer
+	challenge := func(prompt string) (string, bool) {
+		reply(334, base64.StdEncoding.EncodeToString([]byte(prompt)))
+		line, err := text.ReadLine()
+		if err != nil {
+			return "", false
+		}
+		answer, err := base64.StdEncoding.DecodeString(line)
+		return string(answer), err == nil
+	}
+
+	reply(220, "fake ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		verb = strings.ToUpper(verb)
+		s.mu.Lock()
+		s.commands = append(s.commands, verb)
+		s.mu.Unlock()
+
+		switch verb {
+		case "EHLO":
+			extensions := []string{"fake", "8BITMIME", "AUTH PLAIN LOGIN"}
+			if s.tls != nil && !secure {
+				extensions = append(extensions, "STARTTLS")
+			}
+			reply(250, extensions...)
+		case "HELO", "NOOP", "RSET":
+			reply(250, "OK")
+		case "STARTTLS":
+			reply(220, "Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+			secure = true
+			s.mu.Lock()
+			s.startTLS++
+			s.mu.Unlock()
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			var credentials string
+			switch strings.ToUpper(mechanism) {
+			case "PLAIN":
+				decoded, err := base64.StdEncoding.DecodeString(initial)
+				if err != nil {
+					reply(501, "Bad encoding")
+					continue
+				}
+				parts := strings.Split(string(decoded), "\x00")
+				if len(parts) != 3 {
+					reply(501, "Bad PLAIN response")
+					continue
+				}
+				credentials = parts[1] + ":" + parts[2]
+			case "LOGIN":
+				username, ok := challenge("Username:")
+				if !ok {
+					reply(501, "Bad encoding")
+					continue
+				}
+				password, ok := challenge("Password:")
+				if !ok {
+					reply(501, "Bad encoding")
+					continue
+				}
+				credentials = username + ":" + password
+			default:
+				reply(504, "Unrecognized mechanism")
+				continue
+			}
+			s.mu.Lock()
+			s.auths = append(s.auths, strings.ToUpper(mechanism)+" "+credentials)
+			s.mu.Unlock()
+			reply(235, "Authenticated")
+		case "MAIL":
+			from = angleAddress(arg)
+			reply(250, "OK")
+		case "RCPT":
+			to = angleAddress(arg)
+			reply(250, "OK")
+		case "DATA":
+			reply(354, "Go ahead")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, fakeSMTPMessage{from: from, to: to, tls: secure, data: string(data)})
+			s.mu.Unlock()
+			reply(250, "Queued")
+		case "QUIT":
+			s.mu.Lock()
+			s.quits++
+			s.mu.Unlock()
+			reply(221, "Bye")
+			return
+		default:
+			reply(502, "Command not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) snapshot() fakeSMTPServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fakeSMTPServer{
+		connections: s.connections,
+		commands:    append([]string(nil), s.commands...),
+		auths:       append([]string(nil), s.auths...),
+		startTLS:    s.startTLS,
+		messages:    append([]fakeSMTPMessage(nil), s.messages...),
+		quits:       s.quits,
+	}
+}
+
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func testEmail(to string) *EmailMessage {
+	return &EmailMessage{
+		From:     "Lite Blog <noreply@example.com>",
+		To:       to,
+		Subject:  "Hello",
+		TextBody: "Hi there",
+		HTMLBody: "<p>Hi there</p>",
+	}
+}
+
+func TestSMTPEmailProviderAuth(t *testing.T) {
+	for _, tc := range []struct {
+		auth, mechanism string
+	}{
+		{"plain", "PLAIN"},
+		{"", "PLAIN"},
+		{"login", "LOGIN"},
+	} {
+		t.Run(tc.mechanism+"/"+tc.auth, func(t *testing.T) {
+			server := newFakeSMTPServer(t, false)
+			cfg := server.config()
+			cfg.Username = "mailer"
+			cfg.Password = "s3cret"
+			cfg.Auth = tc.auth
+			provider := NewSMTPEmailProvider(cfg)
+			defer provider.Close()
+
+			if err := provider.Send(context.Background(), testEmail("Reader <reader@example.com>")); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+
+			got := server.snapshot()
+			if len(got.auths) != 1 || got.auths[0] != tc.mechanism+" mailer:s3cret" {
+				t.Fatalf("auths = %q, want one %s login as mailer", got.auths, tc.mechanism)
+			}
+			if len(got.messages) != 1 {
+				t.Fatalf("got %d messages, want 1", len(got.messages))
+			}
+			msg := got.messages[0]
+			if msg.from != "noreply@example.com" || msg.to != "reader@example.com" {
+				t.Errorf("envelope = %q -> %q, want bare addresses", msg.from, msg.to)
+			}
+			if !strings.Contains(msg.data, "\nSubject: Hello\n") {
+				t.Errorf("message data has no Subject header:\n%s", msg.data)
+			}
+		})
+	}
+}
+
+func TestSMTPEmailProviderSkipsAuthWithoutUsername(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	provider := NewSMTPEmailProvider(server.config())
+	defer provider.Close()
+
+	if err := provider.Send(context.Background(), testEmail("reader@example.com")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := server.snapshot(); len(got.auths) != 0 {
+		t.Errorf("auths = %q, want none", got.auths)
+	}
+}
+
+func TestLoginAuthRefusesCleartextToRemoteHost(t *testing.T) {
+	auth := &loginAuth{username: "mailer", password: "s3cret", host: "smtp.example.com"}
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com"}); err == nil {
+		t.Error("Start over an unencrypted connection succeeded, want an error")
+	}
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "other.example.com", TLS: true}); err == nil {
+		t.Error("Start with the wrong host name succeeded, want an error")
+	}
+	if mechanism, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: true}); err != nil || mechanism != "LOGIN" {
+		t.Errorf("Start = %q, %v; want LOGIN", mechanism, err)
+	}
+}
+
+func TestSMTPEmailProviderStartTLS(t *testing.T) {
+	server := newFakeSMTPServer(t, true)
+	cfg := server.config()
+	cfg.Encryption = "starttls"
+	cfg.InsecureSkipVerify = true
+	cfg.Username = "mailer"
+	cfg.Password = "s3cret"
+	cfg.Auth = "login"
+	provider := NewSMTPEmailProvider(cfg)
+	defer provider.Close()
+
+	if err := provider.Send(context.Background(), testEmail("reader@example.com")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	got := server.snapshot()
+	if got.startTLS != 1 {
+		t.Fatalf("STARTTLS negotiated %d times, want 1", got.startTLS)
+	}
+	if len(got.messages) != 1 || !got.messages[0].tls {
+		t.Fatal("message was not sent over TLS")
+	}
+	if len(got.auths) != 1 || got.auths[0] != "LOGIN mailer:s3cret" {
+		t.Errorf("auths = %q, want one LOGIN after STARTTLS", got.auths)
+	}
+}
+
+func TestSMTPEmailProviderStartTLSUnsupported(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	cfg := server.config()
+	cfg.Encryption = "starttls"
+	cfg.Username = "mailer"
+	cfg.Password = "s3cret"
+	provider := NewSMTPEmailProvider(cfg)
+	defer provider.Close()
+
+	err := provider.Send(context.Background(), testEmail("reader@example.com"))
+	if err != ErrSMTPStartTLSUnsupported {
+		t.Fatalf("Send error = %v, want ErrSMTPStartTLSUnsupported", err)
+	}
+	if got := server.snapshot(); len(got.auths) != 0 || len(got.messages) != 0 {
+		t.Errorf("credentials or mail sent without TLS: auths=%q messages=%d", got.auths, len(got.messages))
+	}
+}
+
+func TestSMTPEmailProviderStartTLSVerifiesCertificate(t *testing.T) {
+	server := newFakeSMTPServer(t, true)
+	cfg := server.config()
+	cfg.Encryption = "starttls"
+	provider := NewSMTPEmailProvider(cfg)
+	defer provider.Close()
+
+	if err := provider.Send(context.Background(), testEmail("reader@example.com")); err == nil {
+		t.Fatal("Send accepted a self-signed certificate without insecure_skip_verify")
+	}
+	if got := server.snapshot(); len(got.messages) != 0 {
+		t.Errorf("got %d messages, want none", len(got.messages))
+	}
+}
+
+func TestSMTPEmailProviderReusesConnection(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	provider := NewSMTPEmailProvider(server.config())
+	defer provider.Close()
+
+	for _, to := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		if err := provider.Send(context.Background(), testEmail(to)); err != nil {
+			t.Fatalf("Send to %s: %v", to, err)
+		}
+	}
+
+	got := server.snapshot()
+	if got.connections != 1 {
+		t.Errorf("opened %d connections, want 1", got.connections)
+	}
+	if len(got.messages) != 3 {
+		t.Fatalf("got %d messages, want 3", len(got.messages))
+	}
+	if n := countCommand(got.commands, "RSET"); n != 2 {
+		t.Errorf("RSET sent %d times, want 2 (before each reused send)", n)
+	}
+}
+
+func TestSMTPEmailProviderReconnectsAfterIdleTimeout(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	provider := NewSMTPEmailProvider(server.config())
+	provider.idleTimeout = 20 * time.Millisecond
+	defer provider.Close()
+
+	if err := provider.Send(context.Background(), testEmail("a@example.com")); err != nil {
+		t.Fatalf("first Send: %v", err)
+	}
+	waitFor(t, func() bool { return server.snapshot().quits == 1 })
+
+	if err := provider.Send(context.Background(), testEmail("b@example.com")); err != nil {
+		t.Fatalf("second Send: %v", err)
+	}
+	got := server.snapshot()
+	if got.connections != 2 {
+		t.Errorf("opened %d connections, want 2", got.connections)
+	}
+	if len(got.messages) != 2 {
+		t.Errorf("got %d messages, want 2", len(got.messages))
+	}
+}
+
+func TestSMTPEmailProviderReconnectsAfterDroppedConnection(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	provider := NewSMTPEmailProvider(server.config())
+	defer provider.Close()
+
+	if err := provider.Send(context.Background(), testEmail("a@example.com")); err != nil {
+		t.Fatalf("first Send: %v", err)
+	}
+	server.dropConnections()
+
+	if err := provider.Send(context.Background(), testEmail("b@example.com")); err != nil {
+		t.Fatalf("Send after the server dropped the connection: %v", err)
+	}
+	got := server.snapshot()
+	if got.connections != 2 {
+		t.Errorf("opened %d connections, want 2", got.connections)
+	}
+	if len(got.messages) != 2 {
+		t.Errorf("got %d messages, want 2", len(got.messages))
+	}
+}
+
+func TestSMTPEmailProviderClose(t *testing.T) {
+	server := newFakeSMTPServer(t, false)
+	provider := NewSMTPEmailProvider(server.config())
+
+	if err := provider.Send(context.Background(), testEmail("a@example.com")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := provider.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	waitFor(t, func() bool { return server.snapshot().quits == 1 })
+	if err := provider.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+func TestBuildMIMEMessage(t *testing.T) {
+	data, err := buildMIMEMessage(&EmailMessage{
+		From:     "Lite Blog <noreply@example.com>",
+		To:       "reader@example.com",
+		Subject:  "Café news",
+		TextBody: "Hello, café\nA line that is long enough to need a soft line break when it is encoded as quoted-printable text.",
+		HTMLBody: "<p>Hello, café</p>",
+		Headers:  map[string]string{"list-unsubscribe": "<https://example.com/unsubscribe>"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("output is not a valid message: %v", err)
+	}
+	for key, want := range map[string]string{
+		"From":             "Lite Blog <noreply@example.com>",
+		"To":               "reader@example.com",
+		"Mime-Version":     "1.0",
+		"List-Unsubscribe": "<https://example.com/unsubscribe>",
+	} {
+		if got := msg.Header.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Café news" {
+		t.Errorf("Subject decodes to %q, %v; want %q", subject, err, "Café news")
+	}
+	if id := msg.Header.Get("Message-Id"); !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID = %q, want one on the sender's domain", id)
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", msg.Header.Get("Content-Type"))
+	}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	var parts []string
+	bodies := map[string]string{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		contentType := part.Header.Get("Content-Type")
+		body, err := io.ReadAll(part) // NextPart decodes quoted-printable
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, contentType)
+		bodies[contentType] = string(body)
+	}
+	if strings.Join(parts, ", ") != "text/plain; charset=UTF-8, text/html; charset=UTF-8" {
+		t.Fatalf("parts = %q, want text then HTML", parts)
+	}
+	if got := bodies["text/plain; charset=UTF-8"]; !strings.HasPrefix(got, "Hello, café\r\n") || !strings.Contains(got, "quoted-printable text.") {
+		t.Errorf("text part = %q", got)
+	}
+	if got := bodies["text/html; charset=UTF-8"]; got != "<p>Hello, café</p>" {
+		t.Errorf("HTML part = %q", got)
+	}
+	for _, line := range strings.Split(string(data), "\r\n") {
+		if len(line) > 998 {
+			t.Errorf("line longer than RFC 5322 allows: %d bytes", len(line))
+		}
+	}
+}
+
+func TestBuildMIMEMessageSkipsEmptyParts(t *testing.T) {
+	data, err := buildMIMEMessage(&EmailMessage{From: "noreply@example.com", To: "reader@example.com", Subject: "Hi", TextBody: "Only text"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "text/html") {
+		t.Error("message has an HTML part but no HTML body was given")
+	}
+}
+
+func TestBuildMIMEMessageRejectsHeaderInjection(t *testing.T) {
+	for name, msg := range map[string]*EmailMessage{
+		"header value": {From: "noreply@example.com", To: "reader@example.com", Headers: map[string]string{"X-Tag": "a\r\nBcc: victim@example.com"}},
+		"header name":  {From: "noreply@example.com", To: "reader@example.com", Headers: map[string]string{"X-Tag:\r\nBcc": "victim@example.com"}},
+		"recipient":    {From: "noreply@example.com", To: "reader@example.com\r\nBcc: victim@example.com"},
+	} {
+		if _, err := buildMIMEMessage(msg); err == nil {
+			t.Errorf("%s: header injection was accepted", name)
+		}
+	}
+
+	// Subjects are encoded, so a line break can't start a new header
+	data, err := buildMIMEMessage(&EmailMessage{From: "noreply@example.com", To: "reader@example.com", Subject: "Hi\r\nBcc: victim@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(string(data))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcc := msg.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("subject injected a Bcc header: %q", bcc)
+	}
+}
+
+// angleAddress returns the address in "FROM:<a@b.c> BODY=8BITMIME"
+func angleAddress(arg string) string {
+	start, end := strings.Index(arg, "<"), strings.Index(arg, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return arg[start+1 : end]
+}
+
+func countCommand(commands []string, verb string) int {
+	n := 0
+	for _, command := range commands {
+		if command == verb {
+			n++
+		}
+	}
+	return n
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the SMTP server")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,462 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log/slog"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+//go:embed templates/email
+var emailTemplateFS embed.FS
+
+var (
+	ErrEmailTemplateNotFound = errors.New("email template not found")
+	ErrUnsupportedLanguage   = errors.New("unsupported language")
+	ErrInvalidEmailTemplate  = errors.New("invalid email template")
+)
+
+// DefaultLanguage is used when a recipient has no (supported) preferred language
+const DefaultLanguage = "zh"
+
+// SupportedLanguages lists the locales emails can be rendered in, matching the frontend locales
+var SupportedLanguages = []string{"zh", "en"}
+
+// Email template names
+const (
+	EmailTemplateVerification        = "verification"
+	EmailTemplateSubscriptionConfirm = "subscription_confirm"
+	EmailTemplateNewPost             = "new_post"
+	EmailTemplateDigest              = "digest"
+	EmailTemplateMagicLink           = "magic_link"
+	EmailTemplatePasswordReset       = "password_reset"
+	EmailTemplateAccountLocked       = "account_locked"
+	EmailTemplateEmailChangeConfirm  = "email_change_confirm"
+	EmailTemplateEmailChangeNotice   = "email_change_notice"
+	EmailTemplateAccountDeletion     = "account_deletion"
+)
+
+// emailTemplateDef describes a built-in template and the sample data used for previews
+type emailTemplateDef struct {
+	Description string
+	Sample      map[string]interface{}
+}
+
+var emailTemplateDefs = map[string]emailTemplateDef{
+	EmailTemplateVerification: {
+		Description: "Sent after registration with a link to verify the email address",
+		Sample: map[string]interface{}{
+			"VerifyURL":     "https://example.com/verify-email?token=sample-token",
+			"ExpireMinutes": 30,
+		},
+	},
+	EmailTemplateMagicLink: {
+		Description: "Sent when someone asks for a passwordless sign-in link",
+		Sample: map[string]interface{}{
+			"LoginURL":      "https://example.com/magic-link?token=sample-token",
+			"ExpireMinutes": 15,
+		},
+	},
+	EmailTemplatePasswordReset: {
+		Description: "Sent when someone asks to reset their password, with a link to set a new one",
+		Sample: map[string]interface{}{
+			"ResetURL":      "https://example.com/reset-password?token=sample-token",
+			"ExpireMinutes": 30,
+		},
+	},
+	EmailTemplateAccountLocked: {
+		Description: "Sent when an account is locked after too many failed sign-in attempts",
+		Sample: map[string]interface{}{
+			"Failures":       5,
+			"IPAddress":      "203.0.113.7",
+			"LockoutMinutes": 15,
+		},
+	},
+	EmailTemplateEmailChangeConfirm: {
+		Description: "Sent to the new address when a user changes their email, with a link to confirm it",
+		Sample: map[string]interface{}{
+			"NewEmail":    "new@example.com",
+			"ConfirmURL":  "https://example.com/confirm-email-change?token=sample-token",
+			"ExpireHours": 24,
+		},
+	},
+	EmailTemplateEmailChangeNotice: {
+		Description: "Sent to the old address when a user changes their email, with a link to cancel it",
+		Sample: map[string]interface{}{
+			"NewEmail":  "new@example.com",
+			"CancelURL": "https://example.com/cancel-email-change?token=sample-token",
+		},
+	},
+	EmailTemplateAccountDeletion: {
+		Description: "Sent when a user asks to delete their account, with the date it will be deleted",
+		Sample: map[string]interface{}{
+			"DeletionDate": "2025-01-15",
+			"GraceDays":    14,
+		},
+	},
+	EmailTemplateSubscriptionConfirm: {
+		Description: "Sent to new newsletter subscribers to confirm their subscription (double opt-in)",
+		Sample: map[string]interface{}{
+			"ConfirmURL":    "https://example.com/api/subscriptions/confirm?token=sample-token",
+			"ExpireMinutes": 1440,
+		},
+	},
+	EmailTemplateNewPost: {
+		Description: "Sent to instant subscribers when an article is published",
+		Sample: map[string]interface{}{
+			"ArticleTitle":   "Hello World",
+			"ArticleURL":     "https://example.com/posts/hello-world",
+			"Preview":        "The first paragraph of the article...",
+			"UnsubscribeURL": "https://example.com/api/subscriptions/unsubscribe?token=sample-token",
+		},
+	},
+	EmailTemplateDigest: {
+		Description: "Daily or weekly summary of newly published articles",
+		Sample: map[string]interface{}{
+			"Frequency": "weekly",
+			"Articles": []DigestArticle{
+				{Title: "Hello World", Excerpt: "The first paragraph of the article...", URL: "https://example.com/posts/hello-world"},
+				{Title: "Second Post", Excerpt: "Another article excerpt...", URL: "https://example.com/posts/second-post"},
+			},
+			"UnsubscribeURL": "https://example.com/api/subscriptions/unsubscribe?token=sample-token",
+		},
+	},
+}
+
+// DigestArticle is one article listed in a digest email
+type DigestArticle struct {
+	Title   string
+	Excerpt string
+	URL     string
+}
+
+// EmailTemplateSource holds the raw template text of one template in one locale
+type EmailTemplateSource struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+// RenderedEmail is the result of rendering a template
+type RenderedEmail struct {
+	Subject  string `json:"subject"`
+	HTMLBody string `json:"html_body"`
+	TextBody string `json:"text_body"`
+}
+
+// EmailTemplateInfo describes a template and which locales have admin overrides
+type EmailTemplateInfo struct {
+	Name       string   `json:"name"`
+	Desc       string   `json:"description"`
+	Languages  []string `json:"languages"`
+	Overridden []string `json:"overridden"`
+}
+
+// EmailTemplateStore persists admin overrides of the built-in templates
+type EmailTemplateStore interface {
+	GetEmailTemplateOverride(name, language string) (*EmailTemplateSource, error)
+	SaveEmailTemplateOverride(name, language string, source *EmailTemplateSource) error
+	DeleteEmailTemplateOverride(name, language string) error
+}
+
+// NormalizeLanguage maps a language tag or Accept-Language header value
+// (e.g. "en-US,en;q=0.9") to a supported language, or "" if none matches
+func NormalizeLanguage(value string) string {
+	for _, part := range strings.Split(value, ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		tag = strings.ToLower(strings.SplitN(strings.ReplaceAll(tag, "_", "-"), "-", 2)[0])
+		for _, lang := range SupportedLanguages {
+			if tag == lang {
+				return lang
+			}
+		}
+	}
+	return ""
+}
+
+// RenderTemplate renders a template in the recipient's language, preferring an admin override.
+// A broken override falls back to the built-in template so mail keeps flowing.
+func (s *EmailService) RenderTemplate(ctx context.Context, name, language string, data map[string]interface{}) (*RenderedEmail, error) {
+	renderer, err := s.templateRenderer(ctx, name, language)
+	if err != nil {
+		return nil, err
+	}
+	return renderer.render(ctx, data)
+}
+
+// emailTemplateRenderer renders one template in one language. The site values
+// and the parsed templates are looked up once, so bulk sends reuse them for
+// every recipient.
+type emailTemplateRenderer struct {
+	name     string
+	language string
+	siteName string
+	siteURL  string
+	override *parsedEmailTemplate // nil without a usable admin override
+	fallback *parsedEmailTemplate // The built-in template, parsed when first needed
+}
+
+// templateRenderer resolves the active template for name in the recipient's language
+func (s *EmailService) templateRenderer(ctx context.Context, name, language string) (*emailTemplateRenderer, error) {
+	if _, ok := emailTemplateDefs[name]; !ok {
+		return nil, ErrEmailTemplateNotFound
+	}
+	language = NormalizeLanguage(language)
+	if language == "" {
+		language = DefaultLanguage
+	}
+
+	renderer := &emailTemplateRenderer{
+		name:     name,
+		language: language,
+		siteName: s.getSiteName(),
+		siteURL:  s.getSiteURL(),
+	}
+	if source := s.templateOverride(name, language); source != nil {
+		parsed, err := parseEmailTemplate(source)
+		if err != nil {
+			slog.WarnContext(ctx, "Email template override failed to parse, using default", "template", name, "language", language, "error", err)
+		}
+		renderer.override = parsed
+	}
+	return renderer, nil
+}
+
+// render renders the template for one recipient's data
+func (r *emailTemplateRenderer) render(ctx context.Context, data map[string]interface{}) (*RenderedEmail, error) {
+	data = templateData(r.siteName, r.siteURL, r.language, data)
+
+	if r.override != nil {
+		rendered, err := r.override.execute(data)
+		if err == nil {
+			return rendered, nil
+		}
+		slog.WarnContext(ctx, "Email template override failed to render, using default", "template", r.name, "language", r.language, "error", err)
+	}
+
+	if r.fallback == nil {
+		source, err := defaultEmailTemplate(r.name, r.language)
+		if err != nil {
+			return nil, err
+		}
+		if r.fallback, err = parseEmailTemplate(source); err != nil {
+			return nil, err
+		}
+	}
+	return r.fallback.execute(data)
+}
+
+// PreviewTemplate renders a template with sample data. When source is nil the
+// currently active template (override or default) is used.
+func (s *EmailService) PreviewTemplate(name, language string, source *EmailTemplateSource) (*RenderedEmail, error) {
+	def, ok := emailTemplateDefs[name]
+	if !ok {
+		return nil, ErrEmailTemplateNotFound
+	}
+	if !isSupportedLanguage(language) {
+		return nil, ErrUnsupportedLanguage
+	}
+
+	if source == nil {
+		var err error
+		source, _, err = s.GetTemplateSource(name, language)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data := make(map[string]interface{}, len(def.Sample))
+	for key, value := range def.Sample {
+		data[key] = value
+	}
+	rendered, err := renderEmailTemplate(source, templateData(s.getSiteName(), s.getSiteURL(), language, data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEmailTemplate, err)
+	}
+	return rendered, nil
+}
+
+// ListTemplates lists all built-in templates
+func (s *EmailService) ListTemplates() []EmailTemplateInfo {
+	names := make([]string, 0, len(emailTemplateDefs))
+	for name := range emailTemplateDefs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]EmailTemplateInfo, len(names))
+	for i, name := range names {
+		overridden := []string{}
+		for _, lang := range SupportedLanguages {
+			if s.templateOverride(name, lang) != nil {
+				overridden = append(overridden, lang)
+			}
+		}
+		items[i] = EmailTemplateInfo{
+			Name:       name,
+			Desc:       emailTemplateDefs[name].Description,
+			Languages:  SupportedLanguages,
+			Overridden: overridden,
+		}
+	}
+	return items
+}
+
+// GetTemplateSource returns the active template source and whether it is an admin override
+func (s *EmailService) GetTemplateSource(name, language string) (*EmailTemplateSource, bool, error) {
+	if _, ok := emailTemplateDefs[name]; !ok {
+		return nil, false, ErrEmailTemplateNotFound
+	}
+	if !isSupportedLanguage(language) {
+		return nil, false, ErrUnsupportedLanguage
+	}
+
+	if override := s.templateOverride(name, language); override != nil {
+		return override, true, nil
+	}
+	source, err := defaultEmailTemplate(name, language)
+	return source, false, err
+}
+
+// SaveTemplateOverride validates and stores an admin override
+func (s *EmailService) SaveTemplateOverride(name, language string, source *EmailTemplateSource) error {
+	if _, err := s.PreviewTemplate(name, language, source); err != nil {
+		return err
+	}
+	return s.templateStore.SaveEmailTemplateOverride(name, language, source)
+}
+
+// ResetTemplateOverride removes an admin override, restoring the built-in template
+func (s *EmailService) ResetTemplateOverride(name, language string) error {
+	if _, ok := emailTemplateDefs[name]; !ok {
+		return ErrEmailTemplateNotFound
+	}
+	if !isSupportedLanguage(language) {
+		return ErrUnsupportedLanguage
+	}
+	return s.templateStore.DeleteEmailTemplateOverride(name, language)
+}
+
+// sendTemplate renders a template and queues the result
+func (s *EmailService) sendTemplate(ctx context.Context, name, to, language string, data map[string]interface{}) error {
+	rendered, err := s.RenderTemplate(ctx, name, language, data)
+	if err != nil {
+		return err
+	}
+	return s.sendEmail(ctx, name, to, rendered.Subject, rendered.HTMLBody, rendered.TextBody)
+}
+
+// templateData adds the values every template can use
+func templateData(siteName, siteURL, language string, data map[string]interface{}) map[string]interface{} {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["SiteName"] = siteName
+	data["SiteURL"] = siteURL
+	data["Language"] = language
+	return data
+}
+
+func (s *EmailService) templateOverride(name, language string) *EmailTemplateSource {
+	if s.templateStore == nil {
+		return nil
+	}
+	source, err := s.templateStore.GetEmailTemplateOverride(name, language)
+	if err != nil {
+		return nil
+	}
+	return source
+}
+
+// defaultEmailTemplate loads a built-in template from the embedded files
+func defaultEmailTemplate(name, language string) (*EmailTemplateSource, error) {
+	read := func(ext string) (string, error) {
+		data, err := emailTemplateFS.ReadFile(fmt.Sprintf("templates/email/%s/%s.%s", language, name, ext))
+		if err != nil {
+			return "", ErrEmailTemplateNotFound
+		}
+		return string(data), nil
+	}
+
+	subject, err := read("subject")
+	if err != nil {
+		return nil, err
+	}
+	html, err := read("html")
+	if err != nil {
+		return nil, err
+	}
+	text, err := read("txt")
+	if err != nil {
+		return nil, err
+	}
+	return &EmailTemplateSource{Subject: subject, HTML: html, Text: text}, nil
+}
+
+// parsedEmailTemplate is a template source parsed for rendering. The subject
+// and text body use text/template and the HTML body html/template, so values
+// are escaped.
+type parsedEmailTemplate struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+func parseEmailTemplate(source *EmailTemplateSource) (*parsedEmailTemplate, error) {
+	subject, err := texttemplate.New("subject").Option("missingkey=error").Parse(source.Subject)
+	if err != nil {
+		return nil, err
+	}
+	text, err := texttemplate.New("text").Option("missingkey=error").Parse(source.Text)
+	if err != nil {
+		return nil, err
+	}
+	html, err := htmltemplate.New("html").Option("missingkey=error").Parse(source.HTML)
+	if err != nil {
+		return nil, err
+	}
+	return &parsedEmailTemplate{subject: subject, text: text, html: html}, nil
+}
+
+func (t *parsedEmailTemplate) execute(data map[string]interface{}) (*RenderedEmail, error) {
+	var subject, text, html bytes.Buffer
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return nil, err
+	}
+	if err := t.text.Execute(&text, data); err != nil {
+		return nil, err
+	}
+	if err := t.html.Execute(&html, data); err != nil {
+		return nil, err
+	}
+
+	return &RenderedEmail{
+		Subject:  strings.Join(strings.Fields(subject.String()), " "),
+		HTMLBody: html.String(),
+		TextBody: text.String(),
+	}, nil
+}
+
+// renderEmailTemplate parses and renders a template source once
+func renderEmailTemplate(source *EmailTemplateSource, data map[string]interface{}) (*RenderedEmail, error) {
+	parsed, err := parseEmailTemplate(source)
+	if err != nil {
+		return nil, err
+	}
+	return parsed.execute(data)
+}
+
+func isSupportedLanguage(language string) bool {
+	for _, lang := range SupportedLanguages {
+		if lang == language {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	appconfig "github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/internal/repository"
+)
+
+// countingTemplateStore has an English override of new_post and counts lookups
+type countingTemplateStore struct {
+	lookups int
+}
+
+func (s *countingTemplateStore) GetEmailTemplateOverride(name, language string) (*EmailTemplateSource, error) {
+	s.lookups++
+	if name != EmailTemplateNewPost || language != "en" {
+		return nil, errors.New("no override")
+	}
+	return &EmailTemplateSource{
+		Subject: "New: {{.ArticleTitle}}",
+		HTML:    `<p>{{.ArticleTitle}} on {{.SiteName}}</p><a href="{{.UnsubscribeURL}}">Unsubscribe</a>`,
+		Text:    "{{.ArticleTitle}} on {{.SiteName}}\n{{.UnsubscribeURL}}",
+	}, nil
+}
+
+func (s *countingTemplateStore) SaveEmailTemplateOverride(string, string, *EmailTemplateSource) error {
+	return nil
+}
+
+func (s *countingTemplateStore) DeleteEmailTemplateOverride(string, string) error {
+	return nil
+}
+
+func TestSendBulkTemplateResolvesTemplateOncePerLanguage(t *testing.T) {
+	env := newTestEnv(t)
+	outboxRepo := repository.NewEmailOutboxRepository(env.db)
+	store := &countingTemplateStore{}
+	service := NewEmailServiceWithProvider(&appconfig.EmailConfig{}, nil, outboxRepo, nil, env.site, store)
+
+	data := map[string]interface{}{"ArticleTitle": "Hello", "ArticleURL": testSiteURL + "/posts/hello", "Preview": "..."}
+	var recipients []BulkRecipient
+	for _, language := range []string{"en", "zh", "en-US", "zh", "en"} {
+		recipients = append(recipients, BulkRecipient{
+			Email:          language + "@example.com",
+			Language:       language,
+			UnsubscribeURL: testSiteURL + "/api/subscriptions/unsubscribe?token=" + language,
+			Data:           data,
+		})
+	}
+	if err := service.SendBulkTemplate(context.Background(), EmailTemplateNewPost, recipients); err != nil {
+		t.Fatalf("SendBulkTemplate: %v", err)
+	}
+	if store.lookups != 2 {
+		t.Errorf("override looked up %d times, want once per language", store.lookups)
+	}
+
+	messages, total, err := outboxRepo.List("", 1, 10)
+	if err != nil || total != int64(len(recipients)) {
+		t.Fatalf("queued %d messages (%v), want %d", total, err, len(recipients))
+	}
+	for _, listed := range messages {
+		message, err := outboxRepo.FindByID(listed.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		english := strings.HasPrefix(message.To, "en")
+		if got := message.Subject == "New: Hello"; got != english {
+			t.Errorf("%s got subject %q", message.To, message.Subject)
+		}
+		if !strings.Contains(message.TextBody, "token="+strings.TrimSuffix(message.To, "@example.com")) {
+			t.Errorf("%s got another recipient's unsubscribe link", message.To)
+		}
+	}
+}
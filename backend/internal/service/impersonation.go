@@ -0,0 +1,98 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+	"github.com/lite-blog/backend/pkg/jwt"
+)
+
+// ImpersonationTTL is how long an impersonated session lasts
+const ImpersonationTTL = time.Hour
+
+var (
+	ErrCannotImpersonateAdmin = errors.New("admins can't be impersonated")
+	ErrCannotImpersonateSelf  = errors.New("cannot impersonate yourself")
+	ErrImpersonationNotActive = errors.New("not impersonating a user")
+)
+
+// ImpersonationService lets admins view the site as another user for support.
+// Impersonated sessions carry the admin's ID and are read-only.
+type ImpersonationService struct {
+	userRepo *repository.UserRepository
+	jwtKeys  *jwt.KeySet
+}
+
+func NewImpersonationService(userRepo *repository.UserRepository, jwtKeys *jwt.KeySet) *ImpersonationService {
+	return &ImpersonationService{
+		userRepo: userRepo,
+		jwtKeys:  jwtKeys,
+	}
+}
+
+// Start issues a session token for the target user that is marked as held by admin
+func (s *ImpersonationService) Start(admin *model.User, targetID uint) (*model.User, string, error) {
+	if admin.ID == targetID {
+		return nil, "", ErrCannotImpersonateSelf
+	}
+
+	target, err := s.userRepo.FindSessionUser(targetID)
+	if err != nil {
+		return nil, "", ErrUserNotFound
+	}
+	// Admin sessions reach everyone's data, so they can't be borrowed
+	if target.IsAdmin() {
+		return nil, "", ErrCannotImpersonateAdmin
+	}
+	if target.Status == model.UserStatusDisabled {
+		return nil, "", ErrUserDisabled
+	}
+
+	token, err := jwt.GenerateImpersonationToken(
+		target.ID,
+		target.Email,
+		target.GetRoleCodes(),
+		target.SessionVersion,
+		target.RolesVersion,
+		admin.ID,
+		s.jwtKeys,
+		ImpersonationTTL,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	return target, token, nil
+}
+
+// End ends the impersonated session in sessionToken. It returns the admin,
+// the impersonated user's ID, and the admin's own session restored from
+// adminToken, or "" if that session is no longer valid.
+func (s *ImpersonationService) End(sessionToken, adminToken string) (*model.User, uint, string, error) {
+	claims, err := jwt.ValidateToken(sessionToken, s.jwtKeys)
+	if err != nil || claims.ImpersonatorID == 0 {
+		return nil, 0, "", ErrImpersonationNotActive
+	}
+
+	admin, err := s.userRepo.FindSessionUser(claims.ImpersonatorID)
+	if err != nil {
+		return nil, 0, "", ErrImpersonationNotActive
+	}
+
+	// Only hand back the admin's session if it is theirs and still valid
+	restored := ""
+	if adminToken != "" {
+		adminClaims, err := jwt.ValidateToken(adminToken, s.jwtKeys)
+		if err == nil &&
+			adminClaims.Purpose == "" &&
+			adminClaims.ImpersonatorID == 0 &&
+			adminClaims.UserID == admin.ID &&
+			adminClaims.SessionVersion == admin.SessionVersion &&
+			admin.Status != model.UserStatusDisabled {
+			restored = adminToken
+		}
+	}
+
+	return admin, claims.UserID, restored, nil
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/internal/model"
+)
+
+// ErrLoginThrottled is wrapped by LoginThrottleError
+var ErrLoginThrottled = errors.New("too many failed login attempts")
+
+// Login throttling defaults, used when the config leaves a value at zero
+const (
+	defaultLoginMaxAccountFailures = 5
+	defaultLoginMaxIPFailures      = 50
+	defaultLoginFailureWindow      = 15 * time.Minute
+	defaultLoginLockout            = 15 * time.Minute
+	defaultLoginFreeAttempts       = 2
+	defaultLoginBaseDelay          = time.Second
+	defaultLoginMaxDelay           = 30 * time.Second
+
+	// loginAttemptCleanupInterval is how often stale attempts are deleted
+	loginAttemptCleanupInterval = 10 * time.Minute
+)
+
+// LoginThrottleError is returned when a sign-in is refused because of earlier
+// failures. Locked is set for a lockout, otherwise the client has to wait
+// out a progressive delay.
+type LoginThrottleError struct {
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottleError) Error() string {
+	return fmt.Sprintf("%v, retry after %v", ErrLoginThrottled, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LoginThrottleError) Unwrap() error {
+	return ErrLoginThrottled
+}
+
+// LoginAttemptStore keeps failed sign-in attempts by key. It is implemented in
+// memory and in the database.
+type LoginAttemptStore interface {
+	// Get returns the attempts for a key, or nil if there are none
+	Get(key string) (*model.LoginAttempt, error)
+	// RecordFailure counts a failure and returns the updated attempts
+	RecordFailure(key string, now time.Time, window time.Duration) (*model.LoginAttempt, error)
+	// Lock locks a key out until the given time
+	Lock(key string, until time.Time) error
+	// Delete clears the attempts for a key
+	Delete(key string) error
+	// DeleteStale deletes unlocked attempts with no failure since before
+	DeleteStale(before time.Time) error
+}
+
+// LoginLockout reports that a failure locked an account out
+type LoginLockout struct {
+	Failures int
+	Until    time.Time
+}
+
+// LoginGuard limits password sign-in attempts per account and per IP address.
+// Account failures past the free attempts add a doubling delay before the next
+// try, and reaching either limit locks the account or IP out for a while. IPs
+// only get the lockout, with a higher limit, since many users can share one.
+type LoginGuard struct {
+	store LoginAttemptStore
+	cfg   *config.LoginConfig
+
+	mu          sync.Mutex
+	lastCleanup time.Time
+}
+
+func NewLoginGuard(store LoginAttemptStore, cfg *config.LoginConfig) *LoginGuard {
+	return &LoginGuard{
+		store: store,
+		cfg:   cfg,
+	}
+}
+
+// Check returns a *LoginThrottleError if a sign-in for the email from the IP
+// has to wait
+func (g *LoginGuard) Check(ctx context.Context, email, ip string) error {
+	now := time.Now()
+	var throttled *LoginThrottleError
+
+	for _, key := range []string{accountAttemptKey(email), ipAttemptKey(ip)} {
+		attempt, err := g.store.Get(key)
+		if err != nil {
+			// Don't lock everyone out if the store is down
+			slog.ErrorContext(ctx, "Failed to check login attempts", "error", err)
+			continue
+		}
+		if attempt != nil && attempt.IsLocked(now) {
+			wait := attempt.LockedUntil.Sub(now)
+			if throttled == nil || wait > throttled.RetryAfter {
+				throttled = &LoginThrottleError{Locked: true, RetryAfter: wait}
+			}
+		}
+	}
+	if throttled != nil {
+		return throttled
+	}
+
+	// Progressive delays only apply to the account
+	attempt, err := g.store.Get(accountAttemptKey(email))
+	if err != nil || attempt == nil || now.Sub(attempt.WindowStart) > g.failureWindow() {
+		return nil
+	}
+	if wait := attempt.LastFailureAt.Add(g.delay(attempt.Failures)).Sub(now); wait > 0 {
+		return &LoginThrottleError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed sign-in. It returns the lockout if this
+// failure locked the account.
+func (g *LoginGuard) RecordFailure(ctx context.Context, email, ip string) (*LoginLockout, error) {
+	now := time.Now()
+	g.cleanup(ctx, now)
+
+	ipAttempt, err := g.store.RecordFailure(ipAttemptKey(ip), now, g.failureWindow())
+	if err != nil {
+		return nil, err
+	}
+	if ipAttempt.Failures >= g.maxIPFailures() {
+		if err := g.store.Lock(ipAttemptKey(ip), now.Add(g.lockout())); err != nil {
+			return nil, err
+		}
+		slog.WarnContext(ctx, "Locked out IP after failed logins", "ip", ip, "failures", ipAttempt.Failures)
+	}
+
+	accountAttempt, err := g.store.RecordFailure(accountAttemptKey(email), now, g.failureWindow())
+	if err != nil {
+		return nil, err
+	}
+	if accountAttempt.Failures < g.maxAccountFailures() {
+		return nil, nil
+	}
+
+	until := now.Add(g.lockout())
+	if err := g.store.Lock(accountAttemptKey(email), until); err != nil {
+		return nil, err
+	}
+	return &LoginLockout{Failures: accountAttempt.Failures, Until: until}, nil
+}
+
+// RecordSuccess clears the account's failures. The IP's are kept, so signing
+// in to one's own account doesn't reset the limit for guessing others.
+func (g *LoginGuard) RecordSuccess(ctx context.Context, email string) {
+	if err := g.store.Delete(accountAttemptKey(email)); err != nil {
+		slog.ErrorContext(ctx, "Failed to clear login attempts", "error", err)
+	}
+}
+
+// Unlock lifts an account lockout and clears its failures
+func (g *LoginGuard) Unlock(email string) error {
+	return g.store.Delete(accountAttemptKey(email))
+}
+
+// LockedUntil returns when an account's lockout ends, or nil if it isn't locked
+func (g *LoginGuard) LockedUntil(email string) *time.Time {
+	attempt, err := g.store.Get(accountAttemptKey(email))
+	if err != nil || attempt == nil || !attempt.IsLocked(time.Now()) {
+		return nil
+	}
+	return attempt.LockedUntil
+}
+
+// LockoutDuration returns how long a lockout lasts
+func (g *LoginGuard) LockoutDuration() time.Duration {
+	return g.lockout()
+}
+
+// delay is how long to wait after a failure before the next attempt
+func (g *LoginGuard) delay(failures int) time.Duration {
+	excess := failures - g.freeAttempts()
+	if excess <= 0 {
+		return 0
+	}
+	delay := g.baseDelay()
+	for i := 1; i < excess && delay < g.maxDelay(); i++ {
+		delay *= 2
+	}
+	if delay > g.maxDelay() {
+		delay = g.maxDelay()
+	}
+	return delay
+}
+
+// cleanup deletes stale attempts now and then
+func (g *LoginGuard) cleanup(ctx context.Context, now time.Time) {
+	g.mu.Lock()
+	if now.Sub(g.lastCleanup) < loginAttemptCleanupInterval {
+		g.mu.Unlock()
+		return
+	}
+	g.lastCleanup = now
+	g.mu.Unlock()
+
+	// Keep attempts for a full window so delays still apply
+	if err := g.store.DeleteStale(now.Add(-g.failureWindow())); err != nil {
+		slog.ErrorContext(ctx, "Failed to delete stale login attempts", "error", err)
+	}
+}
+
+func accountAttemptKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+func (g *LoginGuard) maxAccountFailures() int {
+	if g.cfg.MaxAccountFailures > 0 {
+		return g.cfg.MaxAccountFailures
+	}
+	return defaultLoginMaxAccountFailures
+}
+
+func (g *LoginGuard) maxIPFailures() int {
+	if g.cfg.MaxIPFailures > 0 {
+		return g.cfg.MaxIPFailures
+	}
+	return defaultLoginMaxIPFailures
+}
+
+func (g *LoginGuard) failureWindow() time.Duration {
+	if g.cfg.FailureWindowMinutes > 0 {
+		return time.Duration(g.cfg.FailureWindowMinutes) * time.Minute
+	}
+	return defaultLoginFailureWindow
+}
+
+func (g *LoginGuard) lockout() time.Duration {
+	if g.cfg.LockoutMinutes > 0 {
+		return time.Duration(g.cfg.LockoutMinutes) * time.Minute
+	}
+	return defaultLoginLockout
+}
+
+func (g *LoginGuard) freeAttempts() int {
+	if g.cfg.FreeAttempts > 0 {
+		return g.cfg.FreeAttempts
+	}
+	return defaultLoginFreeAttempts
+}
+
+func (g *LoginGuard) baseDelay() time.Duration {
+	if g.cfg.BaseDelaySeconds > 0 {
+		return time.Duration(g.cfg.BaseDelaySeconds) * time.Second
+	}
+	return defaultLoginBaseDelay
+}
+
+func (g *LoginGuard) maxDelay() time.Duration {
+	if g.cfg.MaxDelaySeconds > 0 {
+		return time.Duration(g.cfg.MaxDelaySeconds) * time.Second
+	}
+	return defaultLoginMaxDelay
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+	"github.com/lite-blog/backend/pkg/jwt"
+)
+
+const (
+	// MagicLinkTTL is how long an emailed sign-in link stays valid
+	MagicLinkTTL = 15 * time.Minute
+
+	// Request limits, so the endpoint can't be used to flood an inbox
+	magicLinkEmailLimit  = 3
+	magicLinkEmailWindow = 15 * time.Minute
+	magicLinkIPLimit     = 10
+	magicLinkIPWindow    = time.Hour
+)
+
+// ErrMagicLinkAccountConflict is returned for a link to the email of an
+// unverified account, which may have been registered by someone else
+var ErrMagicLinkAccountConflict = errors.New("an unverified account already uses this email")
+
+// MagicLinkPolicy reports whether magic links may create new accounts
+type MagicLinkPolicy interface {
+	IsMagicLinkSignupAllowed() bool
+}
+
+// MagicLinkService signs users in with single-use links sent by email
+type MagicLinkService struct {
+	userRepo      *repository.UserRepository
+	roleRepo      *repository.RoleRepository
+	magicLinkRepo *repository.MagicLinkRepository
+	emailService  *EmailService
+	policy        MagicLinkPolicy
+	registration  *RegistrationService
+	jwtKeys       *jwt.KeySet
+	cfg           *config.Config
+}
+
+func NewMagicLinkService(
+	userRepo *repository.UserRepository,
+	roleRepo *repository.RoleRepository,
+	magicLinkRepo *repository.MagicLinkRepository,
+	emailService *EmailService,
+	policy MagicLinkPolicy,
+	registration *RegistrationService,
+	jwtKeys *jwt.KeySet,
+	cfg *config.Config,
+) *MagicLinkService {
+	return &MagicLinkService{
+		userRepo:      userRepo,
+		roleRepo:      roleRepo,
+		magicLinkRepo: magicLinkRepo,
+		emailService:  emailService,
+		policy:        policy,
+		registration:  registration,
+		jwtKeys:       jwtKeys,
+		cfg:           cfg,
+	}
+}
+
+// Request emails a sign-in link. To avoid revealing which emails have accounts,
+// it returns nil without sending anything when the email can't sign in.
+func (s *MagicLinkService) Request(ctx context.Context, email, language, ip string) error {
+	// Rate limits count per inbox, however the address is capitalized
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	now := time.Now()
+	if s.magicLinkRepo.CountByEmailSince(email, now.Add(-magicLinkEmailWindow)) >= magicLinkEmailLimit ||
+		s.magicLinkRepo.CountByIPSince(ip, now.Add(-magicLinkIPWindow)) >= magicLinkIPLimit {
+		return ErrTooManyRequests
+	}
+
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil {
+		if !s.policy.IsMagicLinkSignupAllowed() || s.registration.CheckSignup(email) != nil {
+			return nil
+		}
+		user = nil
+	} else if user.Status == model.UserStatusDisabled {
+		return nil
+	}
+
+	language = NormalizeLanguage(language)
+	if user != nil && user.Language != "" {
+		language = user.Language
+	}
+
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	link := &model.MagicLink{
+		Email:     email,
+		TokenHash: hashMagicLinkToken(token),
+		Language:  language,
+		RequestIP: ip,
+		ExpiresAt: now.Add(MagicLinkTTL),
+	}
+	if err := s.magicLinkRepo.Create(link); err != nil {
+		return err
+	}
+
+	return s.emailService.SendMagicLink(ctx, email, token, language, int(MagicLinkTTL/time.Minute))
+}
+
+// Consume redeems a sign-in link and returns the session token. A link for an
+// email without an account signs up a new, verified user if the site still
+// allows it. Links never sign in to unverified accounts. Like AuthService.Login,
+// it returns ErrMFARequired with a pending MFA token for two-factor accounts.
+func (s *MagicLinkService) Consume(ctx context.Context, token string) (*model.User, string, error) {
+	link, err := s.magicLinkRepo.FindByTokenHash(hashMagicLinkToken(token))
+	if err != nil || link.UsedAt != nil || time.Now().After(link.ExpiresAt) {
+		return nil, "", ErrInvalidToken
+	}
+	used, err := s.magicLinkRepo.MarkUsed(link.ID, time.Now())
+	if err != nil {
+		return nil, "", err
+	}
+	if !used {
+		return nil, "", ErrInvalidToken
+	}
+
+	user, err := s.userRepo.FindByEmail(link.Email)
+	if err != nil {
+		if !s.policy.IsMagicLinkSignupAllowed() {
+			return nil, "", ErrInvalidToken
+		}
+		// The registration mode may have changed since the link was sent
+		if err := s.registration.CheckSignup(link.Email); err != nil {
+			return nil, "", err
+		}
+		user, err = createVerifiedUser(s.userRepo, s.roleRepo, link.Email, link.Language)
+		if err != nil {
+			return nil, "", err
+		}
+		slog.InfoContext(ctx, "Created user from magic link sign-in", "user_id", user.ID)
+	}
+
+	if user.Status == model.UserStatusDisabled {
+		return nil, "", ErrUserDisabled
+	}
+
+	// Whoever registered an unverified account chose its password, and may not
+	// own the email. Signing the link's owner in would leave them sharing the
+	// account with that person, as with OAuth sign-in.
+	if !user.EmailVerified {
+		return nil, "", ErrMagicLinkAccountConflict
+	}
+
+	if user.TOTPEnabled {
+		mfaToken, err := jwt.GeneratePurposeToken(user.ID, jwt.PurposeMFA, s.jwtKeys, MFATokenTTL)
+		if err != nil {
+			return nil, "", err
+		}
+		return user, mfaToken, ErrMFARequired
+	}
+
+	sessionToken, err := generateSessionToken(user, s.jwtKeys, s.cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, sessionToken, nil
+}
+
+// hashMagicLinkToken hashes a link token for storage. The tokens are random
+// enough that a fast hash is sufficient.
+func hashMagicLinkToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+)
+
+func TestMagicLinkConsumeExistingAccount(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		verified bool
+		want     error
+	}{
+		{"verified account", true, nil},
+		{"unverified account", false, ErrMagicLinkAccountConflict},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			linkRepo := repository.NewMagicLinkRepository(env.db)
+			roleRepo := repository.NewRoleRepository(env.db)
+			service := NewMagicLinkService(env.userRepo, roleRepo, linkRepo, nil, nil,
+				NewRegistrationService(repository.NewInvitationRepository(env.db), env.userRepo, roleRepo, openRegistration{}, env.site), env.keys, env.cfg)
+
+			user := env.createUser(t, "reader@example.com", tc.verified)
+			link := &model.MagicLink{Email: user.Email, TokenHash: hashMagicLinkToken("token"), ExpiresAt: time.Now().Add(MagicLinkTTL)}
+			if err := linkRepo.Create(link); err != nil {
+				t.Fatal(err)
+			}
+
+			signedIn, _, err := service.Consume(context.Background(), "token")
+			if err != tc.want {
+				t.Fatalf("error = %v, want %v", err, tc.want)
+			}
+			if err == nil && signedIn.ID != user.ID {
+				t.Errorf("signed in as user %d, want %d", signedIn.ID, user.ID)
+			}
+
+			stored, err := env.userRepo.FindByID(user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.EmailVerified != tc.verified {
+				t.Errorf("email verified = %v, want %v", stored.EmailVerified, tc.verified)
+			}
+		})
+	}
+}
@@ -0,0 +1,413 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+	"github.com/lite-blog/backend/pkg/worker"
+)
+
+var (
+	ErrInvalidSubscriptionToken = errors.New("invalid subscription token")
+	ErrSubscriptionTokenExpired = errors.New("subscription token expired")
+	ErrInvalidFrequency         = errors.New("invalid subscription frequency")
+)
+
+const (
+	subscriptionConfirmExpire  = 24 * time.Hour
+	subscriptionResendThrottle = time.Minute
+	defaultNewsletterBatchSize = 500
+	defaultDigestCheckInterval = time.Hour
+	newPostPreviewMaxLength    = 500
+	digestExcerptMaxLength     = 200
+)
+
+type NewsletterService struct {
+	subscriberRepo *repository.SubscriberRepository
+	articleRepo    *repository.ArticleRepository
+	emailService   *EmailService
+	workers        *worker.Group
+	cfg            *config.Config
+}
+
+func NewNewsletterService(
+	subscriberRepo *repository.SubscriberRepository,
+	articleRepo *repository.ArticleRepository,
+	emailService *EmailService,
+	workers *worker.Group,
+	cfg *config.Config,
+) *NewsletterService {
+	return &NewsletterService{
+		subscriberRepo: subscriberRepo,
+		articleRepo:    articleRepo,
+		emailService:   emailService,
+		workers:        workers,
+		cfg:            cfg,
+	}
+}
+
+// Subscribe subscribes an email address to new posts. Logged-in users subscribing
+// their own verified address are activated immediately; everyone else gets a
+// double opt-in confirmation email. To avoid revealing who is subscribed, the
+// result is the same whether or not the address was already known.
+func (s *NewsletterService) Subscribe(ctx context.Context, email string, frequency model.SubscriptionFrequency, language string, user *model.User) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" && user != nil {
+		email = user.Email
+	}
+	if frequency == "" {
+		frequency = model.FrequencyInstant
+	}
+	if !isValidFrequency(frequency) {
+		return ErrInvalidFrequency
+	}
+	language = NormalizeLanguage(language)
+	if language == "" && user != nil {
+		language = user.Language
+	}
+	if language == "" {
+		language = DefaultLanguage
+	}
+
+	subscriber, err := s.subscriberRepo.FindByEmail(email)
+	if err != nil {
+		subscriber = &model.Subscriber{
+			Email:  email,
+			Status: model.SubscriberStatusPending,
+		}
+	}
+
+	ownVerifiedEmail := user != nil && user.EmailVerified && strings.EqualFold(user.Email, email)
+	if ownVerifiedEmail {
+		subscriber.UserID = &user.ID
+	}
+
+	// An active subscriber only changes preferences when it is provably theirs
+	if subscriber.IsActive() {
+		if !ownVerifiedEmail {
+			return nil
+		}
+		subscriber.Frequency = frequency
+		subscriber.Language = language
+		return s.subscriberRepo.Update(subscriber)
+	}
+
+	subscriber.Frequency = frequency
+	subscriber.Language = language
+
+	if ownVerifiedEmail {
+		now := time.Now()
+		subscriber.Status = model.SubscriberStatusActive
+		subscriber.ConfirmedAt = &now
+		subscriber.UnsubscribedAt = nil
+		subscriber.ConfirmToken = nil
+		subscriber.ConfirmExpireAt = nil
+		return s.saveSubscriber(subscriber)
+	}
+
+	// Throttle confirmation emails to the same address
+	if subscriber.ConfirmationSentAt != nil && time.Since(*subscriber.ConfirmationSentAt) < subscriptionResendThrottle {
+		return nil
+	}
+
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	expireAt := now.Add(subscriptionConfirmExpire)
+	subscriber.ConfirmToken = &token
+	subscriber.ConfirmExpireAt = &expireAt
+	subscriber.ConfirmationSentAt = &now
+
+	if err := s.saveSubscriber(subscriber); err != nil {
+		return err
+	}
+
+	return s.emailService.SendSubscriptionConfirmation(ctx, email, token, language, int(subscriptionConfirmExpire/time.Minute))
+}
+
+// Confirm activates a subscription from its double opt-in token
+func (s *NewsletterService) Confirm(token string) error {
+	if token == "" {
+		return ErrInvalidSubscriptionToken
+	}
+
+	subscriber, err := s.subscriberRepo.FindByConfirmToken(token)
+	if err != nil {
+		return ErrInvalidSubscriptionToken
+	}
+	if subscriber.ConfirmExpireAt != nil && time.Now().After(*subscriber.ConfirmExpireAt) {
+		return ErrSubscriptionTokenExpired
+	}
+
+	now := time.Now()
+	subscriber.Status = model.SubscriberStatusActive
+	subscriber.ConfirmedAt = &now
+	subscriber.UnsubscribedAt = nil
+	subscriber.ConfirmToken = nil
+	subscriber.ConfirmExpireAt = nil
+
+	return s.subscriberRepo.Update(subscriber)
+}
+
+// Unsubscribe opts a subscriber out using the signed token from an email
+func (s *NewsletterService) Unsubscribe(token string) error {
+	subscriber, err := s.subscriberFromUnsubscribeToken(token)
+	if err != nil {
+		return err
+	}
+	if subscriber.Status == model.SubscriberStatusUnsubscribed {
+		return nil
+	}
+
+	now := time.Now()
+	subscriber.Status = model.SubscriberStatusUnsubscribed
+	subscriber.UnsubscribedAt = &now
+	subscriber.ConfirmToken = nil
+	subscriber.ConfirmExpireAt = nil
+
+	return s.subscriberRepo.Update(subscriber)
+}
+
+// ListSubscribers returns a paginated list of subscribers, optionally filtered by status
+func (s *NewsletterService) ListSubscribers(status string, page, pageSize int) ([]model.Subscriber, int64, error) {
+	return s.subscriberRepo.List(status, page, pageSize)
+}
+
+// NotifyArticlePublished emails instant subscribers about a newly published article.
+// Emails are queued in the background so publishing is not slowed down by large lists,
+// and shutdown waits for them to be queued.
+func (s *NewsletterService) NotifyArticlePublished(article *model.Article) {
+	if article.Visibility == model.VisibilityHidden {
+		return
+	}
+
+	articleCopy := *article
+	s.workers.Go("new post emails", func(ctx context.Context) {
+		if err := s.notifyInstantSubscribers(ctx, &articleCopy); err != nil {
+			slog.ErrorContext(ctx, "Failed to queue new post emails", "article_id", articleCopy.ID, "error", err)
+		}
+	})
+}
+
+func (s *NewsletterService) notifyInstantSubscribers(ctx context.Context, article *model.Article) error {
+	// Only send the preview, so member-only content doesn't leak through email
+	preview := GeneratePreview(article.Content, PreviewConfig{
+		Percentage:     article.PreviewPercentage,
+		MinChars:       article.PreviewMinChars,
+		SmartParagraph: article.PreviewSmartParagraph,
+	})
+	data := map[string]interface{}{
+		"ArticleTitle": article.Title,
+		"ArticleURL":   s.articleURL(article),
+		"Preview":      generateExcerpt(preview, newPostPreviewMaxLength),
+	}
+
+	var afterID uint
+	for {
+		subscribers, err := s.subscriberRepo.FindActiveAfter(model.FrequencyInstant, afterID, s.batchSize())
+		if err != nil {
+			return err
+		}
+		if len(subscribers) == 0 {
+			return nil
+		}
+
+		recipients := make([]BulkRecipient, len(subscribers))
+		for i := range subscribers {
+			recipients[i] = BulkRecipient{
+				Email:          subscribers[i].Email,
+				Language:       subscribers[i].Language,
+				UnsubscribeURL: s.unsubscribeURL(&subscribers[i]),
+				Data:           data,
+			}
+		}
+		if err := s.emailService.SendBulkTemplate(ctx, EmailTemplateNewPost, recipients); err != nil {
+			return err
+		}
+
+		afterID = subscribers[len(subscribers)-1].ID
+	}
+}
+
+// RunDigests periodically queues daily and weekly digests until ctx is cancelled
+func (s *NewsletterService) RunDigests(ctx context.Context) {
+	interval := defaultDigestCheckInterval
+	if s.cfg.Email.Newsletter.DigestCheckMinutes > 0 {
+		interval = time.Duration(s.cfg.Email.Newsletter.DigestCheckMinutes) * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.ProcessDigests(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDigests queues digests for all subscribers that are due one. It stops
+// between batches when ctx is cancelled; the rest are picked up next time.
+func (s *NewsletterService) ProcessDigests(ctx context.Context) {
+	if err := s.sendDigests(ctx, model.FrequencyDaily, 24*time.Hour); err != nil {
+		slog.ErrorContext(ctx, "Failed to queue daily digests", "error", err)
+	}
+	if err := s.sendDigests(ctx, model.FrequencyWeekly, 7*24*time.Hour); err != nil {
+		slog.ErrorContext(ctx, "Failed to queue weekly digests", "error", err)
+	}
+}
+
+func (s *NewsletterService) sendDigests(ctx context.Context, frequency model.SubscriptionFrequency, period time.Duration) error {
+	now := time.Now()
+
+	var afterID uint
+	for ctx.Err() == nil {
+		subscribers, err := s.subscriberRepo.FindDigestDue(frequency, now.Add(-period), afterID, s.batchSize())
+		if err != nil {
+			return err
+		}
+		if len(subscribers) == 0 {
+			return nil
+		}
+
+		// Load the articles for the whole batch once, then pick each subscriber's share
+		earliest := now
+		for i := range subscribers {
+			if since := digestSince(&subscribers[i]); since.Before(earliest) {
+				earliest = since
+			}
+		}
+		articles, err := s.articleRepo.FindPublishedSince(earliest)
+		if err != nil {
+			return err
+		}
+
+		var recipients []BulkRecipient
+		for i := range subscribers {
+			since := digestSince(&subscribers[i])
+			var items []DigestArticle
+			for j := range articles {
+				if articles[j].PublishedAt.After(since) {
+					items = append(items, DigestArticle{
+						Title:   articles[j].Title,
+						Excerpt: generateExcerpt(articles[j].Content, digestExcerptMaxLength),
+						URL:     s.articleURL(&articles[j]),
+					})
+				}
+			}
+			if len(items) == 0 {
+				continue
+			}
+			recipients = append(recipients, BulkRecipient{
+				Email:          subscribers[i].Email,
+				Language:       subscribers[i].Language,
+				UnsubscribeURL: s.unsubscribeURL(&subscribers[i]),
+				Data: map[string]interface{}{
+					"Frequency": string(frequency),
+					"Articles":  items,
+				},
+			})
+		}
+		if err := s.emailService.SendBulkTemplate(ctx, EmailTemplateDigest, recipients); err != nil {
+			return err
+		}
+
+		// Start the next period even when there was nothing to send, so digests keep their cadence
+		for i := range subscribers {
+			if err := s.subscriberRepo.UpdateLastDigestAt(subscribers[i].ID, now); err != nil {
+				return err
+			}
+		}
+
+		afterID = subscribers[len(subscribers)-1].ID
+	}
+	return nil
+}
+
+// UnsubscribeToken returns the signed token used in unsubscribe links
+func (s *NewsletterService) UnsubscribeToken(subscriber *model.Subscriber) string {
+	return strconv.FormatUint(uint64(subscriber.ID), 10) + "." + s.unsubscribeSignature(subscriber)
+}
+
+func (s *NewsletterService) subscriberFromUnsubscribeToken(token string) (*model.Subscriber, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidSubscriptionToken
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return nil, ErrInvalidSubscriptionToken
+	}
+
+	subscriber, err := s.subscriberRepo.FindByID(uint(id))
+	if err != nil {
+		return nil, ErrInvalidSubscriptionToken
+	}
+	if !hmac.Equal([]byte(parts[1]), []byte(s.unsubscribeSignature(subscriber))) {
+		return nil, ErrInvalidSubscriptionToken
+	}
+	return subscriber, nil
+}
+
+func (s *NewsletterService) unsubscribeSignature(subscriber *model.Subscriber) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.Email.Newsletter.SigningSecret))
+	fmt.Fprintf(mac, "unsubscribe:%d:%s", subscriber.ID, subscriber.Email)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *NewsletterService) unsubscribeURL(subscriber *model.Subscriber) string {
+	return fmt.Sprintf("%s/api/subscriptions/unsubscribe?token=%s", s.emailService.getSiteURL(), s.UnsubscribeToken(subscriber))
+}
+
+func (s *NewsletterService) articleURL(article *model.Article) string {
+	return fmt.Sprintf("%s/posts/%s", s.emailService.getSiteURL(), article.Slug)
+}
+
+func (s *NewsletterService) saveSubscriber(subscriber *model.Subscriber) error {
+	if subscriber.ID == 0 {
+		return s.subscriberRepo.Create(subscriber)
+	}
+	return s.subscriberRepo.Update(subscriber)
+}
+
+func (s *NewsletterService) batchSize() int {
+	if s.cfg.Email.Newsletter.BatchSize > 0 {
+		return s.cfg.Email.Newsletter.BatchSize
+	}
+	return defaultNewsletterBatchSize
+}
+
+// digestSince returns the start of the period a subscriber's next digest covers
+func digestSince(subscriber *model.Subscriber) time.Time {
+	if subscriber.LastDigestAt != nil {
+		return *subscriber.LastDigestAt
+	}
+	if subscriber.ConfirmedAt != nil {
+		return *subscriber.ConfirmedAt
+	}
+	return subscriber.CreatedAt
+}
+
+func isValidFrequency(frequency model.SubscriptionFrequency) bool {
+	switch frequency {
+	case model.FrequencyInstant, model.FrequencyDaily, model.FrequencyWeekly:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+	"github.com/lite-blog/backend/pkg/jwt"
+	"github.com/lite-blog/backend/pkg/oauth"
+)
+
+var (
+	ErrOAuthProviderNotFound = errors.New("sign-in provider not found")
+	ErrOAuthStateInvalid     = errors.New("sign-in state is invalid or expired")
+	ErrOAuthFailed           = errors.New("sign-in with provider failed")
+	ErrOAuthEmailNotVerified = errors.New("provider did not return a verified email")
+	ErrOAuthAccountConflict  = errors.New("an unverified account already uses this email")
+)
+
+// OAuthStateTTL is how long the user has to complete sign-in at the provider
+const OAuthStateTTL = 10 * time.Minute
+
+// OAuthProviderInfo describes a configured sign-in provider
+type OAuthProviderInfo struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// oauthState is kept in a signed cookie between the redirect to the provider
+// and the callback. The PKCE verifier never leaves the user's browser and this
+// server.
+type oauthState struct {
+	Provider  string `json:"p"`
+	State     string `json:"s"`
+	Nonce     string `json:"n"`
+	Verifier  string `json:"v"`
+	Redirect  string `json:"r"`
+	ExpiresAt int64  `json:"e"`
+}
+
+// OAuthService signs users in through external OAuth/OIDC providers
+type OAuthService struct {
+	userRepo       *repository.UserRepository
+	roleRepo       *repository.RoleRepository
+	identityRepo   *repository.UserIdentityRepository
+	siteInfoGetter SiteInfoGetter
+	registration   *RegistrationService
+	jwtKeys        *jwt.KeySet
+	cfg            *config.Config
+	providers      map[string]oauth.Provider
+	providerInfo   []OAuthProviderInfo
+}
+
+func NewOAuthService(
+	userRepo *repository.UserRepository,
+	roleRepo *repository.RoleRepository,
+	identityRepo *repository.UserIdentityRepository,
+	siteInfoGetter SiteInfoGetter,
+	registration *RegistrationService,
+	jwtKeys *jwt.KeySet,
+	cfg *config.Config,
+) *OAuthService {
+	providers, providerInfo := newOAuthProviders(&cfg.OAuth)
+	return &OAuthService{
+		userRepo:       userRepo,
+		roleRepo:       roleRepo,
+		identityRepo:   identityRepo,
+		siteInfoGetter: siteInfoGetter,
+		registration:   registration,
+		jwtKeys:        jwtKeys,
+		cfg:            cfg,
+		providers:      providers,
+		providerInfo:   providerInfo,
+	}
+}
+
+// newOAuthProviders builds the providers that have a client ID configured
+func newOAuthProviders(cfg *config.OAuthConfig) (map[string]oauth.Provider, []OAuthProviderInfo) {
+	providers := make(map[string]oauth.Provider)
+	info := make([]OAuthProviderInfo, 0)
+
+	for id, providerCfg := range cfg.Providers {
+		if providerCfg.ClientID == "" {
+			continue
+		}
+
+		kind := providerCfg.Type
+		if kind == "" {
+			kind = "oidc"
+			if id == "github" || id == "google" {
+				kind = id
+			}
+		}
+
+		name := providerCfg.Name
+		var provider oauth.Provider
+		switch kind {
+		case "github":
+			provider = oauth.NewGitHubProvider(providerCfg.ClientID, providerCfg.ClientSecret)
+			if name == "" {
+				name = "GitHub"
+			}
+		case "google":
+			provider = oauth.NewOIDCProvider(oauth.GoogleIssuer, providerCfg.ClientID, providerCfg.ClientSecret, providerCfg.Scopes)
+			if name == "" {
+				name = "Google"
+			}
+		case "oidc":
+			if providerCfg.Issuer == "" {
+				slog.Warn("Skipping OAuth provider without an issuer", "provider", id)
+				continue
+			}
+			provider = oauth.NewOIDCProvider(providerCfg.Issuer, providerCfg.ClientID, providerCfg.ClientSecret, providerCfg.Scopes)
+		default:
+			slog.Warn("Skipping OAuth provider of unknown type", "provider", id, "type", kind)
+			continue
+		}
+		if name == "" {
+			name = id
+		}
+
+		providers[id] = provider
+		info = append(info, OAuthProviderInfo{ID: id, Name: name})
+	}
+
+	sort.Slice(info, func(i, j int) bool { return info[i].ID < info[j].ID })
+	return providers, info
+}
+
+// Providers returns the configured sign-in providers
+func (s *OAuthService) Providers() []OAuthProviderInfo {
+	return s.providerInfo
+}
+
+// Begin starts a sign-in, returning the provider URL to redirect to and the
+// state to keep in a cookie until the callback
+func (s *OAuthService) Begin(ctx context.Context, providerID, redirect string) (string, string, error) {
+	provider, ok := s.providers[providerID]
+	if !ok {
+		return "", "", ErrOAuthProviderNotFound
+	}
+
+	state := &oauthState{
+		Provider:  providerID,
+		Redirect:  safeRedirect(redirect),
+		ExpiresAt: time.Now().Add(OAuthStateTTL).Unix(),
+	}
+	var err error
+	for _, field := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+		if *field, err = oauth.RandomString(); err != nil {
+			return "", "", err
+		}
+	}
+
+	authURL, err := provider.AuthCodeURL(s.redirectURI(providerID), state.State, state.Nonce, oauth.CodeChallenge(state.Verifier))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to start OAuth sign-in", "provider", providerID, "error", err)
+		return "", "", ErrOAuthFailed
+	}
+
+	cookie, err := s.signState(state)
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, cookie, nil
+}
+
+// Complete handles the provider callback: it checks the state, redeems the code
+// and signs in the linked user, creating or linking an account if needed. It
+// returns the session token and where to send the user. Like AuthService.Login,
+// it returns ErrMFARequired with a pending MFA token for two-factor accounts.
+func (s *OAuthService) Complete(ctx context.Context, providerID, stateCookie, state, code string) (*model.User, string, string, error) {
+	saved, err := s.verifyState(stateCookie)
+	if err != nil || saved.Provider != providerID || !hmac.Equal([]byte(saved.State), []byte(state)) {
+		return nil, "", "", ErrOAuthStateInvalid
+	}
+
+	provider, ok := s.providers[providerID]
+	if !ok {
+		return nil, "", saved.Redirect, ErrOAuthProviderNotFound
+	}
+
+	identity, err := provider.Exchange(ctx, s.redirectURI(providerID), code, saved.Verifier, saved.Nonce)
+	if err != nil {
+		slog.WarnContext(ctx, "OAuth sign-in failed", "provider", providerID, "error", err)
+		return nil, "", saved.Redirect, ErrOAuthFailed
+	}
+
+	user, err := s.resolveUser(ctx, providerID, identity)
+	if err != nil {
+		return nil, "", saved.Redirect, err
+	}
+	if user.Status == model.UserStatusDisabled {
+		return nil, "", saved.Redirect, ErrUserDisabled
+	}
+
+	if user.TOTPEnabled {
+		mfaToken, err := jwt.GeneratePurposeToken(user.ID, jwt.PurposeMFA, s.jwtKeys, MFATokenTTL)
+		if err != nil {
+			return nil, "", saved.Redirect, err
+		}
+		return user, mfaToken, saved.Redirect, ErrMFARequired
+	}
+
+	token, err := generateSessionToken(user, s.jwtKeys, s.cfg)
+	if err != nil {
+		return nil, "", saved.Redirect, err
+	}
+	return user, token, saved.Redirect, nil
+}
+
+// resolveUser finds the user for a provider identity. New identities are linked
+// to the account with the same email, or get a new account, but only if the
+// provider verified the email.
+func (s *OAuthService) resolveUser(ctx context.Context, providerID string, identity *oauth.Identity) (*model.User, error) {
+	now := time.Now()
+	email := strings.ToLower(strings.TrimSpace(identity.Email))
+
+	if linked, err := s.identityRepo.FindByProviderSubject(providerID, identity.Subject); err == nil {
+		user, err := s.userRepo.FindByID(linked.UserID)
+		if err != nil {
+			return nil, ErrUserNotFound
+		}
+		linked.LastLoginAt = &now
+		if email != "" {
+			linked.Email = email
+		}
+		if err := s.identityRepo.Update(linked); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	if email == "" || !identity.EmailVerified {
+		return nil, ErrOAuthEmailNotVerified
+	}
+
+	user, err := s.userRepo.FindByEmail(email)
+	if err == nil {
+		// Linking to an unverified account would let whoever registered it
+		// with a password keep access to the real owner's account
+		if !user.EmailVerified {
+			return nil, ErrOAuthAccountConflict
+		}
+	} else {
+		if err := s.registration.CheckSignup(email); err != nil {
+			return nil, err
+		}
+		user, err = createVerifiedUser(s.userRepo, s.roleRepo, email, "")
+		if err != nil {
+			return nil, err
+		}
+		slog.InfoContext(ctx, "Created user from OAuth sign-in", "user_id", user.ID, "provider", providerID)
+	}
+
+	err = s.identityRepo.Create(&model.UserIdentity{
+		UserID:      user.ID,
+		Provider:    providerID,
+		Subject:     identity.Subject,
+		Email:       email,
+		LastLoginAt: &now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// redirectURI is the callback URL registered with the provider
+func (s *OAuthService) redirectURI(providerID string) string {
+	return strings.TrimRight(s.siteInfoGetter.GetSiteURL(), "/") + "/api/auth/oauth/" + providerID + "/callback"
+}
+
+func (s *OAuthService) signState(state *oauthState) (string, error) {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + s.stateSignature(encoded), nil
+}
+
+func (s *OAuthService) verifyState(cookie string) (*oauthState, error) {
+	parts := strings.SplitN(cookie, ".", 2)
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(s.stateSignature(parts[0]))) {
+		return nil, ErrOAuthStateInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrOAuthStateInvalid
+	}
+	var state oauthState
+	if err := json.Unmarshal(payload, &state); err != nil || time.Now().Unix() > state.ExpiresAt {
+		return nil, ErrOAuthStateInvalid
+	}
+	return &state, nil
+}
+
+func (s *OAuthService) stateSignature(payload string) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.OAuth.StateSecret))
+	mac.Write([]byte("oauth-state:" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// safeRedirect only allows paths on this site, so the login can't be used as an open redirect
+func safeRedirect(redirect string) string {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.HasPrefix(redirect, "/\\") {
+		return "/"
+	}
+	return redirect
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+
+	"github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+	"github.com/lite-blog/backend/pkg/jwt"
+	"github.com/lite-blog/backend/pkg/oauth/oauthtest"
+)
+
+// newOAuthService returns a service whose "sso" provider is issuer
+func newOAuthService(env *testEnv, issuer *oauthtest.Issuer) *OAuthService {
+	env.cfg.OAuth.StateSecret = "state-secret"
+	env.cfg.OAuth.Providers = map[string]config.OAuthProviderConfig{
+		"sso": {Type: "oidc", Issuer: issuer.URL(), ClientID: "blog", ClientSecret: "client-secret"},
+	}
+	roleRepo := repository.NewRoleRepository(env.db)
+	registration := NewRegistrationService(repository.NewInvitationRepository(env.db), env.userRepo, roleRepo, openRegistration{}, env.site)
+	return NewOAuthService(env.userRepo, roleRepo, repository.NewUserIdentityRepository(env.db), env.site, registration, env.keys, env.cfg)
+}
+
+func newOAuthIssuer(t *testing.T) *oauthtest.Issuer {
+	t.Helper()
+	issuer := oauthtest.NewIssuer("blog", "client-secret")
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+// beginOAuth starts a sign-in and has the issuer approve it, returning the
+// state cookie and the callback's state and code
+func beginOAuth(t *testing.T, service *OAuthService, issuer *oauthtest.Issuer, redirect string) (cookie, state, code string) {
+	t.Helper()
+	authURL, cookie, err := service.Begin(context.Background(), "sso", redirect)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if !strings.Contains(authURL, "code_challenge_method=S256") {
+		t.Errorf("authorization URL has no PKCE challenge: %s", authURL)
+	}
+	code, state, err = issuer.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	return cookie, state, code
+}
+
+func oauthSignIn(t *testing.T, service *OAuthService, issuer *oauthtest.Issuer, redirect string) (*model.User, string, string, error) {
+	t.Helper()
+	cookie, state, code := beginOAuth(t, service, issuer, redirect)
+	return service.Complete(context.Background(), "sso", cookie, state, code)
+}
+
+func TestOAuthSignInCreatesAndLinksAccount(t *testing.T) {
+	env := newTestEnv(t)
+	issuer := newOAuthIssuer(t)
+	service := newOAuthService(env, issuer)
+	issuer.User.Email = "New.User@Example.com"
+
+	user, token, redirect, err := oauthSignIn(t, service, issuer, "/posts/hello")
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if user.Email != "new.user@example.com" || !user.EmailVerified {
+		t.Errorf("user = %s verified=%v, want a verified account for the lowercased email", user.Email, user.EmailVerified)
+	}
+	if redirect != "/posts/hello" {
+		t.Errorf("redirect = %q, want /posts/hello", redirect)
+	}
+	if claims, err := jwt.ValidateToken(token, env.keys); err != nil || claims.UserID != user.ID {
+		t.Errorf("session token is invalid: %v", err)
+	}
+	identity, err := service.identityRepo.FindByProviderSubject("sso", "user-1")
+	if err != nil || identity.UserID != user.ID {
+		t.Fatalf("identity was not linked to the new user: %v", err)
+	}
+
+	// The next sign-in finds the account through the linked identity, even
+	// after the email changes at the provider
+	issuer.User.Email = "renamed@example.com"
+	again, _, _, err := oauthSignIn(t, service, issuer, "")
+	if err != nil {
+		t.Fatalf("second sign-in: %v", err)
+	}
+	if again.ID != user.ID {
+		t.Errorf("second sign-in returned user %d, want %d", again.ID, user.ID)
+	}
+}
+
+func TestOAuthSignInLinksVerifiedAccount(t *testing.T) {
+	env := newTestEnv(t)
+	issuer := newOAuthIssuer(t)
+	service := newOAuthService(env, issuer)
+	existing := env.createUser(t, "user@example.com", true)
+
+	user, _, _, err := oauthSignIn(t, service, issuer, "")
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if user.ID != existing.ID {
+		t.Errorf("signed in as user %d, want the existing account %d", user.ID, existing.ID)
+	}
+}
+
+func TestOAuthSignInRefusesUnverifiedEmail(t *testing.T) {
+	env := newTestEnv(t)
+	issuer := newOAuthIssuer(t)
+	service := newOAuthService(env, issuer)
+	existing := env.createUser(t, "user@example.com", true)
+	issuer.User.EmailVerified = false
+
+	if _, _, _, err := oauthSignIn(t, service, issuer, ""); err != ErrOAuthEmailNotVerified {
+		t.Fatalf("error = %v, want ErrOAuthEmailNotVerified", err)
+	}
+	if _, err := service.identityRepo.FindByProviderSubject("sso", "user-1"); err == nil {
+		t.Error("an unverified email was linked to the existing account")
+	}
+	if identities, _ := service.identityRepo.FindByUserID(existing.ID); len(identities) != 0 {
+		t.Errorf("existing account has %d linked identities, want 0", len(identities))
+	}
+
+	// No account is created for an unverified email either
+	issuer.User.Email = "someone.else@example.com"
+	if _, _, _, err := oauthSignIn(t, service, issuer, ""); err != ErrOAuthEmailNotVerified {
+		t.Fatalf("error = %v, want ErrOAuthEmailNotVerified", err)
+	}
+	if _, err := env.userRepo.FindByEmail("someone.else@example.com"); err == nil {
+		t.Error("an account was created for an unverified email")
+	}
+}
+
+func TestOAuthSignInRefusesUnverifiedAccount(t *testing.T) {
+	env := newTestEnv(t)
+	issuer := newOAuthIssuer(t)
+	service := newOAuthService(env, issuer)
+	env.createUser(t, "user@example.com", false)
+
+	if _, _, _, err := oauthSignIn(t, service, issuer, ""); err != ErrOAuthAccountConflict {
+		t.Fatalf("error = %v, want ErrOAuthAccountConflict", err)
+	}
+}
+
+func TestOAuthStateMismatch(t *testing.T) {
+	env := newTestEnv(t)
+	issuer := newOAuthIssuer(t)
+	service := newOAuthService(env, issuer)
+
+	other := *service
+	otherCfg := *other.cfg
+	otherCfg.OAuth.StateSecret = "another-secret"
+	other.cfg = &otherCfg
+
+	tests := []struct {
+		name     string
+		complete func(cookie, state, code string) error
+	}{
+		{"state parameter from another sign-in", func(cookie, _, code string) error {
+			_, otherState, _ := beginOAuth(t, service, issuer, "")
+			_, _, _, err := service.Complete(context.Background(), "sso", cookie, otherState, code)
+			return err
+		}},
+		{"missing cookie", func(_, state, code string) error {
+			_, _, _, err := service.Complete(context.Background(), "sso", "", state, code)
+			return err
+		}},
+		{"tampered cookie", func(cookie, state, code string) error {
+			payload, signature, _ := strings.Cut(cookie, ".")
+			tampered := payload[:len(payload)-2] + "xx." + signature
+			_, _, _, err := service.Complete(context.Background(), "sso", tampered, state, code)
+			return err
+		}},
+		{"cookie for another provider", func(cookie, state, code string) error {
+			_, _, _, err := service.Complete(context.Background(), "github", cookie, state, code)
+			return err
+		}},
+		{"cookie signed with another secret", func(cookie, state, code string) error {
+			_, _, _, err := other.Complete(context.Background(), "sso", cookie, state, code)
+			return err
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cookie, state, code := beginOAuth(t, service, issuer, "")
+			if err := tc.complete(cookie, state, code); err != ErrOAuthStateInvalid {
+				t.Errorf("error = %v, want ErrOAuthStateInvalid", err)
+			}
+		})
+	}
+}
+
+func TestOAuthRejectsCodeFromAnotherSignIn(t *testing.T) {
+	env := newTestEnv(t)
+	issuer := newOAuthIssuer(t)
+	service := newOAuthService(env, issuer)
+
+	// An attacker's code, injected into the victim's callback, was issued for
+	// another PKCE challenge and nonce
+	cookie, state, _ := beginOAuth(t, service, issuer, "")
+	_, _, attackerCode := beginOAuth(t, service, issuer, "")
+	if _, _, _, err := service.Complete(context.Background(), "sso", cookie, state, attackerCode); err != ErrOAuthFailed {
+		t.Errorf("error = %v, want ErrOAuthFailed", err)
+	}
+}
+
+func TestOAuthRejectsIDTokenSignedWithWrongKey(t *testing.T) {
+	env := newTestEnv(t)
+	issuer := newOAuthIssuer(t)
+	service := newOAuthService(env, issuer)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.SigningKey = key
+
+	if _, _, _, err := oauthSignIn(t, service, issuer, ""); err != ErrOAuthFailed {
+		t.Fatalf("error = %v, want ErrOAuthFailed", err)
+	}
+	if _, err := env.userRepo.FindByEmail("user@example.com"); err == nil {
+		t.Error("an account was created from a forged ID token")
+	}
+}
+
+func TestOAuthRedirectStaysOnSite(t *testing.T) {
+	env := newTestEnv(t)
+	issuer := newOAuthIssuer(t)
+	service := newOAuthService(env, issuer)
+	for _, redirect := range []string{"https://evil.example.com", "//evil.example.com", "/\\evil.example.com"} {
+		_, _, got, err := oauthSignIn(t, service, issuer, redirect)
+		if err != nil {
+			t.Fatalf("Complete: %v", err)
+		}
+		if got != "/" {
+			t.Errorf("redirect %q became %q, want /", redirect, got)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+	"github.com/lite-blog/backend/pkg/jwt"
+	"github.com/lite-blog/backend/pkg/webauthn"
+)
+
+var (
+	ErrPasskeysUnavailable     = errors.New("passkeys are not available for this site URL")
+	ErrPasskeyChallengeInvalid = errors.New("passkey challenge is invalid or expired")
+	ErrPasskeyInvalid          = errors.New("passkey verification failed")
+	ErrPasskeyNotFound         = errors.New("passkey not found")
+	ErrPasskeyExists           = errors.New("passkey already registered")
+)
+
+// defaultPasskeyName is used when the user doesn't name a passkey
+const defaultPasskeyName = "Passkey"
+
+// PasskeyService handles WebAuthn passkey registration, login and management
+type PasskeyService struct {
+	userRepo       *repository.UserRepository
+	passkeyRepo    *repository.PasskeyRepository
+	challengeRepo  *repository.PasskeyChallengeRepository
+	siteInfoGetter SiteInfoGetter
+	jwtKeys        *jwt.KeySet
+	cfg            *config.Config
+}
+
+func NewPasskeyService(
+	userRepo *repository.UserRepository,
+	passkeyRepo *repository.PasskeyRepository,
+	challengeRepo *repository.PasskeyChallengeRepository,
+	siteInfoGetter SiteInfoGetter,
+	jwtKeys *jwt.KeySet,
+	cfg *config.Config,
+) *PasskeyService {
+	return &PasskeyService{
+		userRepo:       userRepo,
+		passkeyRepo:    passkeyRepo,
+		challengeRepo:  challengeRepo,
+		siteInfoGetter: siteInfoGetter,
+		jwtKeys:        jwtKeys,
+		cfg:            cfg,
+	}
+}
+
+// BeginRegistration returns options for navigator.credentials.create
+func (s *PasskeyService) BeginRegistration(userID uint) (*webauthn.CredentialCreationOptions, error) {
+	rp, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	passkeys, err := s.passkeyRepo.FindByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	exclude := make([]webauthn.CredentialDescriptor, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		if descriptor, ok := passkeyDescriptor(&passkey); ok {
+			exclude = append(exclude, descriptor)
+		}
+	}
+
+	challenge, err := s.newChallenge(model.PasskeyChallengeRegistration, &user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return rp.RegistrationOptions(challenge, webauthn.UserEntity{
+		ID:          userHandle(user.ID),
+		Name:        user.Email,
+		DisplayName: user.Email,
+	}, exclude), nil
+}
+
+// FinishRegistration verifies the browser's response and stores the passkey
+func (s *PasskeyService) FinishRegistration(ctx context.Context, userID uint, name string, resp *webauthn.RegistrationResponse) (*model.Passkey, error) {
+	rp, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := s.consumeChallenge(resp.Response.ClientDataJSON, model.PasskeyChallengeRegistration)
+	if err != nil {
+		return nil, err
+	}
+	// The challenge must have been issued to the same user
+	if challenge.UserID == nil || *challenge.UserID != userID {
+		return nil, ErrPasskeyChallengeInvalid
+	}
+
+	credential, err := rp.VerifyRegistration(resp, decodeChallenge(challenge.Challenge))
+	if err != nil {
+		slog.WarnContext(ctx, "Passkey registration failed", "user_id", userID, "error", err)
+		return nil, ErrPasskeyInvalid
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(credential.ID)
+	if _, err := s.passkeyRepo.FindByCredentialID(credentialID); err == nil {
+		return nil, ErrPasskeyExists
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = defaultPasskeyName
+	}
+	passkey := &model.Passkey{
+		UserID:         userID,
+		CredentialID:   credentialID,
+		PublicKey:      credential.PublicKey,
+		SignCount:      credential.SignCount,
+		AAGUID:         hex.EncodeToString(credential.AAGUID),
+		Transports:     strings.Join(credential.Transports, ","),
+		Name:           name,
+		BackupEligible: credential.BackupEligible,
+		BackedUp:       credential.BackedUp,
+	}
+	if err := s.passkeyRepo.Create(passkey); err != nil {
+		return nil, err
+	}
+	return passkey, nil
+}
+
+// BeginLogin returns options for navigator.credentials.get. No credentials are
+// listed, so the browser offers the passkeys it has for the site and no account
+// needs to be entered first.
+func (s *PasskeyService) BeginLogin() (*webauthn.CredentialRequestOptions, error) {
+	rp, err := s.relyingParty()
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := s.newChallenge(model.PasskeyChallengeLogin, nil)
+	if err != nil {
+		return nil, err
+	}
+	return rp.LoginOptions(challenge, nil), nil
+}
+
+// FinishLogin verifies an assertion and returns a session token. Like
+// AuthService.Login, it returns ErrMFARequired with a pending MFA token when the
+// authenticator didn't verify the user (PIN, biometrics) and the account has
+// two-factor authentication enabled.
+func (s *PasskeyService) FinishLogin(ctx context.Context, resp *webauthn.AssertionResponse) (*model.User, string, error) {
+	rp, err := s.relyingParty()
+	if err != nil {
+		return nil, "", err
+	}
+
+	challenge, err := s.consumeChallenge(resp.Response.ClientDataJSON, model.PasskeyChallengeLogin)
+	if err != nil {
+		return nil, "", err
+	}
+
+	passkey, err := s.passkeyRepo.FindByCredentialID(base64.RawURLEncoding.EncodeToString(resp.RawID))
+	if err != nil {
+		return nil, "", ErrPasskeyInvalid
+	}
+	if len(resp.Response.UserHandle) > 0 && binaryUserID(resp.Response.UserHandle) != passkey.UserID {
+		return nil, "", ErrPasskeyInvalid
+	}
+
+	assertion, err := rp.VerifyAssertion(resp, decodeChallenge(challenge.Challenge), passkey.PublicKey, passkey.SignCount)
+	if err != nil {
+		slog.WarnContext(ctx, "Passkey login failed", "passkey_id", passkey.ID, "error", err)
+		return nil, "", ErrPasskeyInvalid
+	}
+
+	user, err := s.userRepo.FindByID(passkey.UserID)
+	if err != nil {
+		return nil, "", ErrPasskeyInvalid
+	}
+	if user.Status == model.UserStatusDisabled {
+		return nil, "", ErrUserDisabled
+	}
+
+	updated, err := s.passkeyRepo.UpdateSignCount(passkey.ID, passkey.SignCount, assertion.SignCount, assertion.BackedUp, time.Now())
+	if err != nil {
+		return nil, "", err
+	}
+	if !updated {
+		return nil, "", ErrPasskeyInvalid
+	}
+
+	if user.TOTPEnabled && !assertion.UserVerified {
+		mfaToken, err := jwt.GeneratePurposeToken(user.ID, jwt.PurposeMFA, s.jwtKeys, MFATokenTTL)
+		if err != nil {
+			return nil, "", err
+		}
+		return user, mfaToken, ErrMFARequired
+	}
+
+	token, err := generateSessionToken(user, s.jwtKeys, s.cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, token, nil
+}
+
+// ListPasskeys returns the user's passkeys
+func (s *PasskeyService) ListPasskeys(userID uint) ([]model.Passkey, error) {
+	return s.passkeyRepo.FindByUserID(userID)
+}
+
+// RenamePasskey renames one of the user's passkeys
+func (s *PasskeyService) RenamePasskey(userID, id uint, name string) (*model.Passkey, error) {
+	passkey, err := s.findOwnPasskey(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = defaultPasskeyName
+	}
+	passkey.Name = name
+	if err := s.passkeyRepo.Update(passkey); err != nil {
+		return nil, err
+	}
+	return passkey, nil
+}
+
+// DeletePasskey removes one of the user's passkeys. The password still works,
+// so removing the last passkey can't lock the user out.
+func (s *PasskeyService) DeletePasskey(userID, id uint) error {
+	passkey, err := s.findOwnPasskey(userID, id)
+	if err != nil {
+		return err
+	}
+	return s.passkeyRepo.Delete(passkey.ID)
+}
+
+func (s *PasskeyService) findOwnPasskey(userID, id uint) (*model.Passkey, error) {
+	passkey, err := s.passkeyRepo.FindByID(id)
+	if err != nil || passkey.UserID != userID {
+		return nil, ErrPasskeyNotFound
+	}
+	return passkey, nil
+}
+
+// relyingParty derives the relying party from the configured site URL, so
+// passkeys are scoped to the site's domain
+func (s *PasskeyService) relyingParty() (*webauthn.RelyingParty, error) {
+	rp, err := webauthn.NewRelyingParty(s.siteInfoGetter.GetSiteURL(), s.siteInfoGetter.GetSiteName())
+	if err != nil {
+		return nil, ErrPasskeysUnavailable
+	}
+	return rp, nil
+}
+
+func (s *PasskeyService) newChallenge(purpose model.PasskeyChallengePurpose, userID *uint) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+	err = s.challengeRepo.Create(&model.PasskeyChallenge{
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Purpose:   purpose,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(webauthn.Timeout),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// consumeChallenge looks up the challenge a response answers and uses it up
+func (s *PasskeyService) consumeChallenge(clientDataJSON []byte, purpose model.PasskeyChallengePurpose) (*model.PasskeyChallenge, error) {
+	clientData, err := webauthn.ParseClientData(clientDataJSON)
+	if err != nil || len(clientData.Challenge) == 0 {
+		return nil, ErrPasskeyChallengeInvalid
+	}
+	challenge, err := s.challengeRepo.Consume(base64.RawURLEncoding.EncodeToString(clientData.Challenge), purpose)
+	if err != nil {
+		return nil, ErrPasskeyChallengeInvalid
+	}
+	return challenge, nil
+}
+
+func decodeChallenge(challenge string) []byte {
+	decoded, _ := base64.RawURLEncoding.DecodeString(challenge)
+	return decoded
+}
+
+// passkeyDescriptor refers to a stored passkey in WebAuthn options
+func passkeyDescriptor(passkey *model.Passkey) (webauthn.CredentialDescriptor, bool) {
+	id, err := base64.RawURLEncoding.DecodeString(passkey.CredentialID)
+	if err != nil {
+		return webauthn.CredentialDescriptor{}, false
+	}
+	descriptor := webauthn.CredentialDescriptor{Type: "public-key", ID: id}
+	if passkey.Transports != "" {
+		descriptor.Transports = strings.Split(passkey.Transports, ",")
+	}
+	return descriptor, true
+}
+
+// userHandle is the WebAuthn user ID: the account ID as 8 bytes, which contains no personal data
+func userHandle(userID uint) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(userID))
+}
+
+func binaryUserID(handle []byte) uint {
+	if len(handle) != 8 {
+		return 0
+	}
+	return uint(binary.BigEndian.Uint64(handle))
+}
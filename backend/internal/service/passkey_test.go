@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lite-blog/backend/internal/repository"
+	"github.com/lite-blog/backend/pkg/jwt"
+	"github.com/lite-blog/backend/pkg/webauthn"
+	"github.com/lite-blog/backend/pkg/webauthn/webauthntest"
+)
+
+func newPasskeyService(env *testEnv) *PasskeyService {
+	return NewPasskeyService(env.userRepo, repository.NewPasskeyRepository(env.db), repository.NewPasskeyChallengeRepository(env.db), env.site, env.keys, env.cfg)
+}
+
+// registerPasskey runs a registration ceremony for userID on authenticator
+func registerPasskey(t *testing.T, service *PasskeyService, userID uint, authenticator *webauthntest.Authenticator) {
+	t.Helper()
+	options, err := service.BeginRegistration(userID)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	resp, err := authenticator.Create(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.FinishRegistration(context.Background(), userID, "Laptop", resp); err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+}
+
+// passkeyAssertion starts a login and returns the authenticator's response to it
+func passkeyAssertion(t *testing.T, service *PasskeyService, authenticator *webauthntest.Authenticator) *webauthn.AssertionResponse {
+	t.Helper()
+	options, err := service.BeginLogin()
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	resp, err := authenticator.Get(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	env := newTestEnv(t)
+	service := newPasskeyService(env)
+	user := env.createUser(t, "reader@example.com", true)
+	authenticator := webauthntest.New(testSiteURL)
+
+	options, err := service.BeginRegistration(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := authenticator.Create(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passkey, err := service.FinishRegistration(context.Background(), user.ID, "Laptop", resp)
+	if err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	if passkey.UserID != user.ID || passkey.Name != "Laptop" || passkey.Transports != "internal" {
+		t.Errorf("passkey = %+v", passkey)
+	}
+
+	for i := 1; i <= 2; i++ {
+		signedIn, token, err := service.FinishLogin(context.Background(), passkeyAssertion(t, service, authenticator))
+		if err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+		if signedIn.ID != user.ID {
+			t.Errorf("login %d: signed in as user %d, want %d", i, signedIn.ID, user.ID)
+		}
+		claims, err := jwt.ValidateToken(token, env.keys)
+		if err != nil || claims.UserID != user.ID {
+			t.Errorf("login %d: session token is invalid: %v", i, err)
+		}
+	}
+
+	stored, err := service.passkeyRepo.FindByID(passkey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.SignCount != 2 || stored.LastUsedAt == nil {
+		t.Errorf("stored sign count = %d, last used %v; want 2 and set", stored.SignCount, stored.LastUsedAt)
+	}
+}
+
+func TestPasskeyRegistrationExcludesExistingCredentials(t *testing.T) {
+	env := newTestEnv(t)
+	service := newPasskeyService(env)
+	user := env.createUser(t, "reader@example.com", true)
+	authenticator := webauthntest.New(testSiteURL)
+	registerPasskey(t, service, user.ID, authenticator)
+
+	options, err := service.BeginRegistration(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options.ExcludeCredentials) != 1 {
+		t.Fatalf("excluded %d credentials, want 1", len(options.ExcludeCredentials))
+	}
+	if _, err := authenticator.Create(options); err == nil {
+		t.Error("authenticator registered a second credential for the same account")
+	}
+}
+
+func TestPasskeyLoginSignCountRegression(t *testing.T) {
+	env := newTestEnv(t)
+	service := newPasskeyService(env)
+	user := env.createUser(t, "reader@example.com", true)
+	authenticator := webauthntest.New(testSiteURL)
+	registerPasskey(t, service, user.ID, authenticator)
+
+	// A cloned authenticator answers with a counter the site has already seen
+	older := passkeyAssertion(t, service, authenticator)
+	newer := passkeyAssertion(t, service, authenticator)
+	if _, _, err := service.FinishLogin(context.Background(), newer); err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	if _, _, err := service.FinishLogin(context.Background(), older); err != ErrPasskeyInvalid {
+		t.Errorf("error = %v, want ErrPasskeyInvalid", err)
+	}
+}
+
+func TestPasskeyWrongOriginAndRPID(t *testing.T) {
+	env := newTestEnv(t)
+	service := newPasskeyService(env)
+	user := env.createUser(t, "reader@example.com", true)
+
+	t.Run("registration from another origin", func(t *testing.T) {
+		options, err := service.BeginRegistration(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := webauthntest.New("https://evil.example.com").Create(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := service.FinishRegistration(context.Background(), user.ID, "", resp); err != ErrPasskeyInvalid {
+			t.Errorf("error = %v, want ErrPasskeyInvalid", err)
+		}
+	})
+
+	t.Run("registration for another RP ID", func(t *testing.T) {
+		options, err := service.BeginRegistration(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		options.RP.ID = "example.com"
+		resp, err := webauthntest.New(testSiteURL).Create(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := service.FinishRegistration(context.Background(), user.ID, "", resp); err != ErrPasskeyInvalid {
+			t.Errorf("error = %v, want ErrPasskeyInvalid", err)
+		}
+	})
+
+	authenticator := webauthntest.New(testSiteURL)
+	registerPasskey(t, service, user.ID, authenticator)
+
+	t.Run("login from another origin", func(t *testing.T) {
+		authenticator.Origin = "https://evil.example.com"
+		defer func() { authenticator.Origin = testSiteURL }()
+		if _, _, err := service.FinishLogin(context.Background(), passkeyAssertion(t, service, authenticator)); err != ErrPasskeyInvalid {
+			t.Errorf("error = %v, want ErrPasskeyInvalid", err)
+		}
+	})
+
+	passkeys, err := service.passkeyRepo.FindByUserID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passkeys) != 1 {
+		t.Errorf("user has %d passkeys, want only the one from the right origin", len(passkeys))
+	}
+}
+
+func TestPasskeyReplayedChallenge(t *testing.T) {
+	env := newTestEnv(t)
+	service := newPasskeyService(env)
+	user := env.createUser(t, "reader@example.com", true)
+	authenticator := webauthntest.New(testSiteURL)
+
+	options, err := service.BeginRegistration(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registration, err := authenticator.Create(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.FinishRegistration(context.Background(), user.ID, "", registration); err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	if _, err := service.FinishRegistration(context.Background(), user.ID, "", registration); err != ErrPasskeyChallengeInvalid {
+		t.Errorf("replayed registration: error = %v, want ErrPasskeyChallengeInvalid", err)
+	}
+
+	login := passkeyAssertion(t, service, authenticator)
+	if _, _, err := service.FinishLogin(context.Background(), login); err != nil {
+		t.Fatalf("FinishLogin: %v", err)
+	}
+	if _, _, err := service.FinishLogin(context.Background(), login); err != ErrPasskeyChallengeInvalid {
+		t.Errorf("replayed login: error = %v, want ErrPasskeyChallengeInvalid", err)
+	}
+}
+
+func TestPasskeyChallengeBoundToPurposeAndUser(t *testing.T) {
+	env := newTestEnv(t)
+	service := newPasskeyService(env)
+	user := env.createUser(t, "reader@example.com", true)
+	authenticator := webauthntest.New(testSiteURL)
+
+	// A registration challenge issued to one user can't register a passkey for another
+	options, err := service.BeginRegistration(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := authenticator.Create(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.FinishRegistration(context.Background(), user.ID+1, "", resp); err != ErrPasskeyChallengeInvalid {
+		t.Errorf("other user: error = %v, want ErrPasskeyChallengeInvalid", err)
+	}
+
+	// and a login challenge can't be used to register
+	registerPasskey(t, service, user.ID, authenticator)
+	loginOptions, err := service.BeginLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.Challenge = loginOptions.Challenge
+	options.ExcludeCredentials = nil
+	resp, err = webauthntest.New(testSiteURL).Create(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.FinishRegistration(context.Background(), user.ID, "", resp); err != ErrPasskeyChallengeInvalid {
+		t.Errorf("login challenge: error = %v, want ErrPasskeyChallengeInvalid", err)
+	}
+}
+
+func TestPasskeyLoginWithoutUserVerificationRequiresMFA(t *testing.T) {
+	env := newTestEnv(t)
+	service := newPasskeyService(env)
+	user := env.createUser(t, "reader@example.com", true)
+	authenticator := webauthntest.New(testSiteURL)
+	registerPasskey(t, service, user.ID, authenticator)
+	user.TOTPEnabled = true
+	if err := env.userRepo.UpdateTwoFactor(user); err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator.UserVerified = false
+	_, token, err := service.FinishLogin(context.Background(), passkeyAssertion(t, service, authenticator))
+	if err != ErrMFARequired {
+		t.Fatalf("error = %v, want ErrMFARequired", err)
+	}
+	if _, err := jwt.ValidatePurposeToken(token, jwt.PurposeMFA, env.keys); err != nil {
+		t.Errorf("MFA token is invalid: %v", err)
+	}
+}
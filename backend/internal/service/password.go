@@ -0,0 +1,136 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+	"github.com/lite-blog/backend/pkg/password"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrWeakPassword = errors.New("password does not meet the policy")
+
+const (
+	defaultPasswordMinLength    = 8
+	defaultPasswordMinClasses   = 1
+	defaultPasswordHistoryCount = 3
+)
+
+// PasswordPolicyError is returned when a new password breaks the policy. It
+// lists every violation, so the user can fix them all at once.
+type PasswordPolicyError struct {
+	Violations []password.Violation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	codes := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		codes[i] = v.Code
+	}
+	return fmt.Sprintf("%v: %s", ErrWeakPassword, strings.Join(codes, ", "))
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// PasswordPolicy checks new passwords against the configured policy and,
+// when changing a password, the user's recent passwords
+type PasswordPolicy struct {
+	historyRepo *repository.PasswordHistoryRepository
+	cfg         *config.PasswordConfig
+}
+
+func NewPasswordPolicy(historyRepo *repository.PasswordHistoryRepository, cfg *config.PasswordConfig) *PasswordPolicy {
+	return &PasswordPolicy{
+		historyRepo: historyRepo,
+		cfg:         cfg,
+	}
+}
+
+// Policy returns the policy with defaults filled in
+func (p *PasswordPolicy) Policy() password.Policy {
+	policy := password.Policy{
+		MinLength:   defaultPasswordMinLength,
+		MinClasses:  defaultPasswordMinClasses,
+		BlockCommon: !p.cfg.AllowCommon,
+	}
+	if p.cfg.MinLength > 0 {
+		policy.MinLength = p.cfg.MinLength
+	}
+	if p.cfg.MinClasses > 0 {
+		policy.MinClasses = min(p.cfg.MinClasses, 4)
+	}
+	return policy
+}
+
+// HistoryCount returns how many recent passwords can't be reused
+func (p *PasswordPolicy) HistoryCount() int {
+	switch {
+	case p.cfg.HistoryCount < 0:
+		return 0
+	case p.cfg.HistoryCount > 0:
+		return p.cfg.HistoryCount
+	default:
+		return defaultPasswordHistoryCount
+	}
+}
+
+// Check returns a *PasswordPolicyError if a new account's password breaks the policy
+func (p *PasswordPolicy) Check(newPassword, email string) error {
+	if violations := p.Policy().Check(newPassword, email); len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// CheckChange is Check for a user changing their password. The current
+// password counts as the most recent one.
+func (p *PasswordPolicy) CheckChange(user *model.User, newPassword string) error {
+	violations := p.Policy().Check(newPassword, user.Email)
+
+	if count := p.HistoryCount(); count > 0 && p.wasUsed(user, newPassword, count) {
+		violations = append(violations, password.Reused(count))
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// Remember keeps a hash the user just replaced, so it can't be reused
+func (p *PasswordPolicy) Remember(userID uint, oldHash string) error {
+	count := p.HistoryCount()
+	if count <= 1 {
+		// The current password is always checked, so nothing else is needed
+		return nil
+	}
+	// The current hash lives on the user, so history holds the ones before it
+	return p.historyRepo.Add(userID, oldHash, count-1)
+}
+
+// wasUsed checks newPassword against the current and recent password hashes
+func (p *PasswordPolicy) wasUsed(user *model.User, newPassword string, count int) bool {
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(newPassword)) == nil {
+		return true
+	}
+	if count <= 1 {
+		return false
+	}
+
+	history, err := p.historyRepo.FindRecent(user.ID, count-1)
+	if err != nil {
+		return false
+	}
+	for _, entry := range history {
+		if bcrypt.CompareHashAndPassword([]byte(entry.PasswordHash), []byte(newPassword)) == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// PasswordResetTTL is how long an emailed password reset link stays valid
+	PasswordResetTTL = 30 * time.Minute
+
+	// Request limits, so the endpoint can't be used to flood an inbox
+	passwordResetUserLimit  = 3
+	passwordResetUserWindow = time.Hour
+	passwordResetIPLimit    = 10
+	passwordResetIPWindow   = time.Hour
+)
+
+// PasswordResetService sets new passwords through single-use links sent by
+// email. It is also how accounts created by a sign-in provider, a magic link
+// or an import get their first password.
+type PasswordResetService struct {
+	userRepo       *repository.UserRepository
+	resetRepo      *repository.PasswordResetRepository
+	emailService   *EmailService
+	passwordPolicy *PasswordPolicy
+}
+
+func NewPasswordResetService(
+	userRepo *repository.UserRepository,
+	resetRepo *repository.PasswordResetRepository,
+	emailService *EmailService,
+	passwordPolicy *PasswordPolicy,
+) *PasswordResetService {
+	return &PasswordResetService{
+		userRepo:       userRepo,
+		resetRepo:      resetRepo,
+		emailService:   emailService,
+		passwordPolicy: passwordPolicy,
+	}
+}
+
+// Request emails a reset link. To avoid revealing which emails have accounts,
+// it returns nil without sending anything when the email has no account that
+// can sign in. Unverified accounts are left out too: whoever registered them
+// may not own the email.
+func (s *PasswordResetService) Request(ctx context.Context, email, ip string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	now := time.Now()
+	if s.resetRepo.CountByIPSince(ip, now.Add(-passwordResetIPWindow)) >= passwordResetIPLimit {
+		return ErrTooManyRequests
+	}
+
+	user, err := s.userRepo.FindByEmail(email)
+	if err != nil || user.Status == model.UserStatusDisabled || !user.EmailVerified {
+		return nil
+	}
+	if s.resetRepo.CountByUserSince(user.ID, now.Add(-passwordResetUserWindow)) >= passwordResetUserLimit {
+		return ErrTooManyRequests
+	}
+
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	reset := &model.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hashPasswordResetToken(token),
+		RequestIP: ip,
+		ExpiresAt: now.Add(PasswordResetTTL),
+	}
+	if err := s.resetRepo.Create(reset); err != nil {
+		return err
+	}
+
+	return s.emailService.SendPasswordReset(ctx, user.Email, token, user.Language, int(PasswordResetTTL/time.Minute))
+}
+
+// Reset redeems a reset link and sets the new password, revoking the user's
+// sessions. Two-factor authentication stays on, so signing in still needs a
+// code. A password that breaks the policy returns a *PasswordPolicyError and
+// leaves the link usable.
+func (s *PasswordResetService) Reset(ctx context.Context, token, newPassword string) error {
+	reset, err := s.resetRepo.FindByTokenHash(hashPasswordResetToken(token))
+	if err != nil || reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		return ErrInvalidToken
+	}
+
+	user, err := s.userRepo.FindByID(reset.UserID)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if user.Status == model.UserStatusDisabled {
+		return ErrUserDisabled
+	}
+	if err := s.passwordPolicy.CheckChange(user, newPassword); err != nil {
+		return err
+	}
+
+	used, err := s.resetRepo.MarkUsed(reset.ID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidToken
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	oldHash := user.PasswordHash
+	if err := s.userRepo.UpdatePassword(user, string(hashedPassword)); err != nil {
+		return err
+	}
+	if err := s.passwordPolicy.Remember(user.ID, oldHash); err != nil {
+		slog.ErrorContext(ctx, "Failed to record password history", "user_id", user.ID, "error", err)
+	}
+	if err := s.resetRepo.DeleteByUserID(user.ID); err != nil {
+		slog.ErrorContext(ctx, "Failed to delete password reset links", "user_id", user.ID, "error", err)
+	}
+
+	slog.InfoContext(ctx, "Reset password with emailed link", "user_id", user.ID)
+	return nil
+}
+
+// hashPasswordResetToken hashes a reset token for storage. The tokens are
+// random enough that a fast hash is sufficient.
+func hashPasswordResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
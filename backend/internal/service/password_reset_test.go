@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordResetSetsPasswordOnce(t *testing.T) {
+	env := newTestEnv(t)
+	resetRepo := repository.NewPasswordResetRepository(env.db)
+	policy := NewPasswordPolicy(repository.NewPasswordHistoryRepository(env.db), &env.cfg.Password)
+	service := NewPasswordResetService(env.userRepo, resetRepo, nil, policy)
+
+	// An account made by a magic link has a password nobody knows
+	user, err := createVerifiedUser(env.userRepo, repository.NewRoleRepository(env.db), "reader@example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reset := &model.PasswordReset{UserID: user.ID, TokenHash: hashPasswordResetToken("token"), ExpiresAt: time.Now().Add(PasswordResetTTL)}
+	if err := resetRepo.Create(reset); err != nil {
+		t.Fatal(err)
+	}
+
+	// A rejected password leaves the link usable
+	var weak *PasswordPolicyError
+	if err := service.Reset(context.Background(), "token", "short"); !errors.As(err, &weak) {
+		t.Fatalf("error = %v, want a *PasswordPolicyError", err)
+	}
+
+	const newPassword = "correct horse battery staple"
+	if err := service.Reset(context.Background(), "token", newPassword); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	stored, err := env.userRepo.FindByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(stored.PasswordHash), []byte(newPassword)) != nil {
+		t.Error("the new password doesn't match")
+	}
+	if stored.SessionVersion != user.SessionVersion+1 {
+		t.Errorf("session version = %d, want %d so other sessions are revoked", stored.SessionVersion, user.SessionVersion+1)
+	}
+
+	if err := service.Reset(context.Background(), "token", "another good passphrase"); err != ErrInvalidToken {
+		t.Errorf("reusing the link: error = %v, want ErrInvalidToken", err)
+	}
+}
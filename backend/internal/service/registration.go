@@ -0,0 +1,316 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+)
+
+var (
+	ErrRegistrationClosed      = errors.New("registration is closed")
+	ErrInvitationRequired      = errors.New("an invitation is required to sign up")
+	ErrEmailDomainNotAllowed   = errors.New("sign-up is not allowed for this email domain")
+	ErrInvitationInvalid       = errors.New("invalid or expired invitation")
+	ErrInvitationEmailMismatch = errors.New("invitation is for a different email")
+	ErrInvitationNotFound      = errors.New("invitation not found")
+	ErrInvalidRegistrationMode = errors.New("invalid registration mode")
+	ErrInvitationAdminRole     = errors.New("invitations can't grant the admin role")
+	ErrInvitationEmailRequired = errors.New("invitations that grant roles must be for one email")
+)
+
+const (
+	// defaultInvitationDays is how long invitations last unless set otherwise
+	defaultInvitationDays = 7
+	// invitationTokenPrefix starts every invitation token
+	invitationTokenPrefix = "inv_"
+)
+
+// RegistrationPolicy provides the registration mode and allowed email domains
+type RegistrationPolicy interface {
+	GetRegistrationPolicy() (string, []string)
+}
+
+// InvitationOptions describes a new invitation. Zero values use the defaults:
+// any email, one use, no extra roles or membership, expiring after a week.
+type InvitationOptions struct {
+	Email         string
+	Roles         []string
+	MemberDays    int
+	MaxUses       int
+	ExpiresInDays int
+	Note          string
+}
+
+// RegistrationService decides who may sign up and manages invitations
+type RegistrationService struct {
+	invitationRepo *repository.InvitationRepository
+	userRepo       *repository.UserRepository
+	roleRepo       *repository.RoleRepository
+	policy         RegistrationPolicy
+	siteInfoGetter SiteInfoGetter
+}
+
+func NewRegistrationService(
+	invitationRepo *repository.InvitationRepository,
+	userRepo *repository.UserRepository,
+	roleRepo *repository.RoleRepository,
+	policy RegistrationPolicy,
+	siteInfoGetter SiteInfoGetter,
+) *RegistrationService {
+	return &RegistrationService{
+		invitationRepo: invitationRepo,
+		userRepo:       userRepo,
+		roleRepo:       roleRepo,
+		policy:         policy,
+		siteInfoGetter: siteInfoGetter,
+	}
+}
+
+// Mode returns the current registration mode
+func (s *RegistrationService) Mode() string {
+	mode, _ := s.policy.GetRegistrationPolicy()
+	if mode == "" {
+		return model.RegistrationModeOpen
+	}
+	return mode
+}
+
+// CheckSignup reports whether email may sign up without an invitation. Sign-ups
+// through magic links and OAuth providers use this.
+func (s *RegistrationService) CheckSignup(email string) error {
+	mode, domains := s.policy.GetRegistrationPolicy()
+	switch mode {
+	case model.RegistrationModeClosed:
+		return ErrRegistrationClosed
+	case model.RegistrationModeInvite:
+		return ErrInvitationRequired
+	case model.RegistrationModeDomain:
+		if !emailDomainAllowed(email, domains) {
+			return ErrEmailDomainNotAllowed
+		}
+	}
+	return nil
+}
+
+// CheckEmailDomain reports whether an existing user may move to email. It
+// only restricts anything in domain mode.
+func (s *RegistrationService) CheckEmailDomain(email string) error {
+	mode, domains := s.policy.GetRegistrationPolicy()
+	if mode == model.RegistrationModeDomain && !emailDomainAllowed(email, domains) {
+		return ErrEmailDomainNotAllowed
+	}
+	return nil
+}
+
+// BeginSignup checks that email may sign up, reserving a use of the invitation
+// if a token is given. An invitation lets anyone it's for sign up in any mode
+// but closed. The returned invitation, if any, must be passed to CompleteSignup
+// once the account exists, or to CancelSignup if creating it failed.
+func (s *RegistrationService) BeginSignup(email, invitationToken string) (*model.Invitation, error) {
+	if invitationToken == "" {
+		return nil, s.CheckSignup(email)
+	}
+	if s.Mode() == model.RegistrationModeClosed {
+		return nil, ErrRegistrationClosed
+	}
+
+	invitation, err := s.invitationRepo.FindByTokenHash(hashInvitationToken(invitationToken))
+	if err != nil || !invitation.IsUsable(time.Now()) {
+		return nil, ErrInvitationInvalid
+	}
+	if invitation.Email != "" && !strings.EqualFold(invitation.Email, email) {
+		return nil, ErrInvitationEmailMismatch
+	}
+
+	reserved, err := s.invitationRepo.Reserve(invitation.ID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !reserved {
+		return nil, ErrInvitationInvalid
+	}
+	return invitation, nil
+}
+
+// CompleteSignup records who used the invitation. Its roles and membership
+// wait for GrantInvitations, so an address nobody has proven they own gets
+// nothing from it.
+func (s *RegistrationService) CompleteSignup(invitation *model.Invitation, user *model.User) error {
+	if invitation == nil {
+		return nil
+	}
+
+	if err := s.invitationRepo.CreateUse(&model.InvitationUse{
+		InvitationID: invitation.ID,
+		UserID:       user.ID,
+		Email:        user.Email,
+	}); err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return s.GrantInvitations(user)
+	}
+	return nil
+}
+
+// GrantInvitations grants the roles and membership of the invitations a user
+// signed up with. It is called once their email is verified.
+func (s *RegistrationService) GrantInvitations(user *model.User) error {
+	uses, err := s.invitationRepo.FindUngrantedUses(user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, use := range uses {
+		granted, err := s.invitationRepo.MarkUseGranted(use.ID, time.Now())
+		if err != nil {
+			return err
+		}
+		if !granted {
+			continue
+		}
+		invitation, err := s.invitationRepo.FindByID(use.InvitationID)
+		if err != nil {
+			continue
+		}
+		if err := s.grantInvitation(invitation, user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// grantInvitation gives user the invitation's roles and membership
+func (s *RegistrationService) grantInvitation(invitation *model.Invitation, user *model.User) error {
+	for _, code := range invitation.RoleList() {
+		// Invitations made before admin grants were refused may still hold it
+		if code == model.RoleCodeAdmin || user.HasRole(code) {
+			continue
+		}
+		role, err := s.roleRepo.FindByCode(code)
+		if err != nil {
+			continue
+		}
+		if err := s.userRepo.AssignRole(user.ID, role.ID); err != nil {
+			return err
+		}
+		user.Roles = append(user.Roles, *role)
+	}
+
+	if invitation.MemberDays > 0 {
+		expireAt := time.Now().AddDate(0, 0, invitation.MemberDays)
+		user.MemberExpireAt = &expireAt
+		if err := s.userRepo.Update(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CancelSignup gives back the invitation use reserved by BeginSignup
+func (s *RegistrationService) CancelSignup(invitation *model.Invitation) {
+	if invitation != nil {
+		s.invitationRepo.Release(invitation.ID)
+	}
+}
+
+// CreateInvitation creates an invitation and returns it with the plaintext
+// token, which is only shown this once. An invitation that grants roles must
+// name the email it is for, so a leaked link can't hand them out; the admin
+// role is never granted this way.
+func (s *RegistrationService) CreateInvitation(createdBy *model.User, opts InvitationOptions) (*model.Invitation, string, error) {
+	opts.Email = strings.ToLower(strings.TrimSpace(opts.Email))
+	if len(opts.Roles) > 0 && opts.Email == "" {
+		return nil, "", ErrInvitationEmailRequired
+	}
+
+	roles := make([]string, 0, len(opts.Roles))
+	for _, code := range opts.Roles {
+		if code == model.RoleCodeAdmin {
+			return nil, "", ErrInvitationAdminRole
+		}
+		if _, err := s.roleRepo.FindByCode(code); err != nil {
+			return nil, "", ErrRoleNotFound
+		}
+		if !slices.Contains(roles, code) {
+			roles = append(roles, code)
+		}
+	}
+
+	random, err := generateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	token := invitationTokenPrefix + random
+
+	if opts.MaxUses <= 0 {
+		opts.MaxUses = 1
+	}
+	if opts.ExpiresInDays <= 0 {
+		opts.ExpiresInDays = defaultInvitationDays
+	}
+
+	invitation := &model.Invitation{
+		TokenHash:   hashInvitationToken(token),
+		Email:       opts.Email,
+		Roles:       strings.Join(roles, " "),
+		MemberDays:  opts.MemberDays,
+		MaxUses:     opts.MaxUses,
+		Note:        strings.TrimSpace(opts.Note),
+		CreatedByID: createdBy.ID,
+		ExpiresAt:   time.Now().AddDate(0, 0, opts.ExpiresInDays),
+	}
+	if err := s.invitationRepo.Create(invitation); err != nil {
+		return nil, "", err
+	}
+	return invitation, token, nil
+}
+
+// InvitationURL returns the sign-up link for an invitation token
+func (s *RegistrationService) InvitationURL(token string) string {
+	return strings.TrimRight(s.siteInfoGetter.GetSiteURL(), "/") + "/register?invitation=" + token
+}
+
+// ListInvitations returns a page of invitations with the accounts that used them
+func (s *RegistrationService) ListInvitations(page, pageSize int) ([]model.Invitation, int64, error) {
+	return s.invitationRepo.List(page, pageSize)
+}
+
+// RevokeInvitation stops an invitation from being used
+func (s *RegistrationService) RevokeInvitation(id uint) error {
+	if _, err := s.invitationRepo.FindByID(id); err != nil {
+		return ErrInvitationNotFound
+	}
+	return s.invitationRepo.Revoke(id, time.Now())
+}
+
+// LookupInvitation returns a usable invitation, so the sign-up page can show
+// who it's for before the user registers
+func (s *RegistrationService) LookupInvitation(token string) (*model.Invitation, error) {
+	if s.Mode() == model.RegistrationModeClosed {
+		return nil, ErrRegistrationClosed
+	}
+	invitation, err := s.invitationRepo.FindByTokenHash(hashInvitationToken(token))
+	if err != nil || !invitation.IsUsable(time.Now()) {
+		return nil, ErrInvitationInvalid
+	}
+	return invitation, nil
+}
+
+// emailDomainAllowed checks if the domain of email is in domains
+func emailDomainAllowed(email string, domains []string) bool {
+	_, domain, _ := strings.Cut(email, "@")
+	return slices.Contains(domains, strings.ToLower(domain))
+}
+
+// hashInvitationToken returns the stored form of an invitation token
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
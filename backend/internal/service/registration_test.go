@@ -0,0 +1,47 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+)
+
+func TestInvitationGrantedOnVerification(t *testing.T) {
+	env := newTestEnv(t)
+	roleRepo := repository.NewRoleRepository(env.db)
+	service := NewRegistrationService(repository.NewInvitationRepository(env.db), env.userRepo, roleRepo, openRegistration{}, env.site)
+
+	admin := env.createUser(t, "admin@example.com", true)
+	_, token, err := service.CreateInvitation(admin, InvitationOptions{Email: "invited@example.com", Roles: []string{model.RoleCodeMember}, MemberDays: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	invitation, err := service.BeginSignup("invited@example.com", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := env.createUser(t, "invited@example.com", false)
+	if err := service.CompleteSignup(invitation, user); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, _ := env.userRepo.FindByID(user.ID)
+	if stored.HasRole(model.RoleCodeMember) || stored.MemberExpireAt != nil {
+		t.Fatal("an unverified account was granted the invitation's role and membership")
+	}
+
+	// Verifying the email grants them, once
+	for range 2 {
+		if err := service.GrantInvitations(stored); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stored, _ = env.userRepo.FindByID(user.ID)
+	if !stored.HasRole(model.RoleCodeMember) || stored.MemberExpireAt == nil {
+		t.Error("the verified account wasn't granted the invitation's role and membership")
+	}
+	if n := len(stored.Roles); n != 1 {
+		t.Errorf("user has %d roles, want 1", n)
+	}
+}
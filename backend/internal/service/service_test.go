@@ -0,0 +1,84 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+	"github.com/lite-blog/backend/pkg/jwt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testSiteURL = "https://blog.example.com"
+
+// testEnv is what most services are built from: a migrated and seeded
+// database that lasts for the test, a config, signing keys and a fixed site
+type testEnv struct {
+	db       *gorm.DB
+	cfg      *config.Config
+	keys     *jwt.KeySet
+	site     testSiteInfo
+	userRepo *repository.UserRepository
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(t.TempDir()+"/test.db"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := model.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := model.Seed(db); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	keys, err := jwt.NewKeySet(jwt.NewHMACKey("", []byte("test-secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{}
+	cfg.JWT.ExpireHours = 1
+	return &testEnv{
+		db:       db,
+		cfg:      cfg,
+		keys:     keys,
+		site:     testSiteInfo{url: testSiteURL},
+		userRepo: repository.NewUserRepository(db, 0),
+	}
+}
+
+// createUser adds a user who has a password
+func (e *testEnv) createUser(t *testing.T, email string, verified bool) *model.User {
+	t.Helper()
+	user := &model.User{Email: email, PasswordHash: "x", EmailVerified: verified}
+	if err := e.userRepo.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// testSiteInfo is a fixed SiteInfoGetter
+type testSiteInfo struct {
+	url string
+}
+
+func (s testSiteInfo) GetSiteName() string  { return "Test Blog" }
+func (s testSiteInfo) GetSiteURL() string   { return s.url }
+func (s testSiteInfo) GetEmailFrom() string { return "noreply@example.com" }
+
+// openRegistration lets anyone sign up
+type openRegistration struct{}
+
+func (openRegistration) GetRegistrationPolicy() (string, []string) {
+	return model.RegistrationModeOpen, nil
+}
@@ -1,6 +1,11 @@
 package service
 
 import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+
 	"github.com/lite-blog/backend/internal/model"
 	"github.com/lite-blog/backend/internal/repository"
 )
@@ -96,3 +101,143 @@ func (s *SettingService) GetEmailFrom() string {
 	}
 	return settings.EmailFrom
 }
+
+// GetSecuritySettings returns the security policy settings
+func (s *SettingService) GetSecuritySettings() (*model.SecuritySettings, error) {
+	settings, err := s.settingRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	securitySettings := model.DefaultSecuritySettings()
+	for _, setting := range settings {
+		switch setting.Key {
+		case "security.require_admin_2fa":
+			securitySettings.RequireAdmin2FA = setting.Value == "true"
+		case "security.allow_magic_link_signup":
+			securitySettings.AllowMagicLinkSignup = setting.Value == "true"
+		case "security.challenge_enabled":
+			securitySettings.ChallengeEnabled = setting.Value == "true"
+		case "security.challenge_difficulty":
+			if difficulty, err := strconv.Atoi(setting.Value); err == nil {
+				securitySettings.ChallengeDifficulty = difficulty
+			}
+		case "security.registration_mode":
+			securitySettings.RegistrationMode = setting.Value
+		case "security.allowed_email_domains":
+			securitySettings.AllowedEmailDomains = normalizeEmailDomains(strings.Split(setting.Value, ","))
+		}
+	}
+
+	return securitySettings, nil
+}
+
+// UpdateSecuritySettings updates the security policy settings
+func (s *SettingService) UpdateSecuritySettings(settings *model.SecuritySettings) error {
+	if settings.ChallengeDifficulty == 0 {
+		settings.ChallengeDifficulty = model.DefaultChallengeDifficulty
+	}
+	if settings.ChallengeDifficulty < model.MinChallengeDifficulty || settings.ChallengeDifficulty > model.MaxChallengeDifficulty {
+		return ErrInvalidChallengeDifficulty
+	}
+	if settings.RegistrationMode == "" {
+		settings.RegistrationMode = model.RegistrationModeOpen
+	}
+	if !slices.Contains(model.RegistrationModes, settings.RegistrationMode) {
+		return ErrInvalidRegistrationMode
+	}
+	settings.AllowedEmailDomains = normalizeEmailDomains(settings.AllowedEmailDomains)
+
+	updates := map[string]string{
+		"security.require_admin_2fa":       strconv.FormatBool(settings.RequireAdmin2FA),
+		"security.allow_magic_link_signup": strconv.FormatBool(settings.AllowMagicLinkSignup),
+		"security.challenge_enabled":       strconv.FormatBool(settings.ChallengeEnabled),
+		"security.challenge_difficulty":    strconv.Itoa(settings.ChallengeDifficulty),
+		"security.registration_mode":       settings.RegistrationMode,
+		"security.allowed_email_domains":   strings.Join(settings.AllowedEmailDomains, ","),
+	}
+
+	return s.settingRepo.UpdateMultiple(updates)
+}
+
+// IsAdmin2FARequired reports whether admins must use two-factor authentication
+func (s *SettingService) IsAdmin2FARequired() bool {
+	settings, err := s.GetSecuritySettings()
+	if err != nil {
+		return false
+	}
+	return settings.RequireAdmin2FA
+}
+
+// IsMagicLinkSignupAllowed reports whether magic links can create new accounts
+func (s *SettingService) IsMagicLinkSignupAllowed() bool {
+	settings, err := s.GetSecuritySettings()
+	if err != nil {
+		return false
+	}
+	return settings.AllowMagicLinkSignup
+}
+
+// GetChallengePolicy reports whether challenges are required and their base difficulty
+func (s *SettingService) GetChallengePolicy() (bool, int) {
+	settings, err := s.GetSecuritySettings()
+	if err != nil {
+		return false, model.DefaultChallengeDifficulty
+	}
+	return settings.ChallengeEnabled, settings.ChallengeDifficulty
+}
+
+// GetRegistrationPolicy returns the registration mode and the email domains
+// allowed to sign up in domain mode
+func (s *SettingService) GetRegistrationPolicy() (string, []string) {
+	settings, err := s.GetSecuritySettings()
+	if err != nil {
+		return model.RegistrationModeOpen, nil
+	}
+	return settings.RegistrationMode, settings.AllowedEmailDomains
+}
+
+// normalizeEmailDomains lowercases domains and drops blanks and duplicates
+func normalizeEmailDomains(domains []string) []string {
+	normalized := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "@")
+		if domain != "" && !slices.Contains(normalized, domain) {
+			normalized = append(normalized, domain)
+		}
+	}
+	return normalized
+}
+
+// emailTemplateKey returns the setting key holding an email template override
+func emailTemplateKey(name, language string) string {
+	return "email_template." + name + "." + language
+}
+
+// GetEmailTemplateOverride returns the admin override of an email template, if any
+func (s *SettingService) GetEmailTemplateOverride(name, language string) (*EmailTemplateSource, error) {
+	setting, err := s.settingRepo.GetByKey(emailTemplateKey(name, language))
+	if err != nil {
+		return nil, err
+	}
+
+	var source EmailTemplateSource
+	if err := json.Unmarshal([]byte(setting.Value), &source); err != nil {
+		return nil, err
+	}
+	return &source, nil
+}
+
+// SaveEmailTemplateOverride stores an admin override of an email template
+func (s *SettingService) SaveEmailTemplateOverride(name, language string, source *EmailTemplateSource) error {
+	data, err := json.Marshal(source)
+	if err != nil {
+		return err
+	}
+	return s.settingRepo.Upsert(emailTemplateKey(name, language), string(data))
+}
+
+// DeleteEmailTemplateOverride removes an admin override of an email template
+func (s *SettingService) DeleteEmailTemplateOverride(name, language string) error {
+	return s.settingRepo.Delete(emailTemplateKey(name, language))
+}
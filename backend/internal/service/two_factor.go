@@ -0,0 +1,323 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/lite-blog/backend/internal/config"
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+	"github.com/lite-blog/backend/pkg/jwt"
+	"github.com/lite-blog/backend/pkg/totp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrMFARequired         = errors.New("two-factor authentication required")
+	ErrInvalidMFACode      = errors.New("invalid two-factor authentication code")
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication already enabled")
+	ErrMFANotEnabled       = errors.New("two-factor authentication not enabled")
+	ErrMFASetupRequired    = errors.New("two-factor authentication setup not started")
+	ErrMFARequiredByPolicy = errors.New("two-factor authentication is required for administrators")
+)
+
+const (
+	// MFATokenTTL is how long a user has to enter their code after the password step
+	MFATokenTTL = 5 * time.Minute
+	// totpSkew allows one time step of clock drift either way
+	totpSkew          = 1
+	maxMFAFailures    = 5
+	mfaLockout        = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// recoveryCodeAlphabet avoids characters that are easily confused (0/o, 1/l/i)
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// SecurityPolicy provides the site's security settings
+type SecurityPolicy interface {
+	IsAdmin2FARequired() bool
+}
+
+// TOTPSetup is returned when a user starts enrolling an authenticator app
+type TOTPSetup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth:// URI to render as a QR code
+}
+
+// TwoFactorStatus describes a user's two-factor authentication state
+type TwoFactorStatus struct {
+	Enabled                bool  `json:"enabled"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+	Required               bool  `json:"required"`
+}
+
+type TwoFactorService struct {
+	userRepo         *repository.UserRepository
+	recoveryCodeRepo *repository.RecoveryCodeRepository
+	siteInfoGetter   SiteInfoGetter
+	securityPolicy   SecurityPolicy
+	jwtKeys          *jwt.KeySet
+	cfg              *config.Config
+}
+
+func NewTwoFactorService(
+	userRepo *repository.UserRepository,
+	recoveryCodeRepo *repository.RecoveryCodeRepository,
+	siteInfoGetter SiteInfoGetter,
+	securityPolicy SecurityPolicy,
+	jwtKeys *jwt.KeySet,
+	cfg *config.Config,
+) *TwoFactorService {
+	return &TwoFactorService{
+		userRepo:         userRepo,
+		recoveryCodeRepo: recoveryCodeRepo,
+		siteInfoGetter:   siteInfoGetter,
+		securityPolicy:   securityPolicy,
+		jwtKeys:          jwtKeys,
+		cfg:              cfg,
+	}
+}
+
+// Status returns the user's two-factor authentication state
+func (s *TwoFactorService) Status(user *model.User) *TwoFactorStatus {
+	status := &TwoFactorStatus{
+		Enabled:  user.TOTPEnabled,
+		Required: s.isRequiredFor(user),
+	}
+	if user.TOTPEnabled {
+		status.RecoveryCodesRemaining = s.recoveryCodeRepo.CountUnused(user.ID)
+	}
+	return status
+}
+
+// Setup generates a new TOTP secret for the user. It only takes effect once
+// confirmed with a code through Enable.
+func (s *TwoFactorService) Setup(userID uint) (*TOTPSetup, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPSecret = &secret
+	if err := s.userRepo.UpdateTwoFactor(user); err != nil {
+		return nil, err
+	}
+
+	issuer := "Lite Blog"
+	if s.siteInfoGetter != nil {
+		issuer = s.siteInfoGetter.GetSiteName()
+	}
+	return &TOTPSetup{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(issuer, user.Email, secret),
+	}, nil
+}
+
+// Enable confirms enrollment with a code from the authenticator app and returns
+// the recovery codes, which are only shown this once
+func (s *TwoFactorService) Enable(userID uint, code string) ([]string, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == nil {
+		return nil, ErrMFASetupRequired
+	}
+
+	counter, ok := totp.Validate(*user.TOTPSecret, code, time.Now(), totpSkew)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	user.TOTPEnabled = true
+	user.TOTPLastCounter = counter
+	user.TOTPFailedAttempts = 0
+	user.TOTPLockedUntil = nil
+	if err := s.userRepo.UpdateTwoFactor(user); err != nil {
+		return nil, err
+	}
+
+	return s.generateRecoveryCodes(user.ID)
+}
+
+// Disable turns off two-factor authentication after checking the password and a code
+func (s *TwoFactorService) Disable(userID uint, password, code string) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return ErrUserNotFound
+	}
+	if !user.TOTPEnabled {
+		return ErrMFANotEnabled
+	}
+	if s.isRequiredFor(user) {
+		return ErrMFARequiredByPolicy
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+	if err := s.verifyCode(user, code); err != nil {
+		return err
+	}
+
+	user.TOTPEnabled = false
+	user.TOTPSecret = nil
+	user.TOTPLastCounter = 0
+	if err := s.userRepo.UpdateTwoFactor(user); err != nil {
+		return err
+	}
+	return s.recoveryCodeRepo.DeleteForUser(user.ID)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a code
+func (s *TwoFactorService) RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrMFANotEnabled
+	}
+	if err := s.verifyCode(user, code); err != nil {
+		return nil, err
+	}
+
+	return s.generateRecoveryCodes(user.ID)
+}
+
+// CompleteLogin finishes a two-factor login started by AuthService.Login,
+// exchanging the pending MFA token and a code for a session token
+func (s *TwoFactorService) CompleteLogin(mfaToken, code string) (*model.User, string, error) {
+	claims, err := jwt.ValidatePurposeToken(mfaToken, jwt.PurposeMFA, s.jwtKeys)
+	if err != nil {
+		return nil, "", ErrInvalidToken
+	}
+
+	user, err := s.userRepo.FindByID(claims.UserID)
+	if err != nil {
+		return nil, "", ErrInvalidToken
+	}
+	if user.Status == model.UserStatusDisabled {
+		return nil, "", ErrUserDisabled
+	}
+	if !user.TOTPEnabled {
+		return nil, "", ErrMFANotEnabled
+	}
+
+	if err := s.verifyCode(user, code); err != nil {
+		return nil, "", err
+	}
+
+	token, err := generateSessionToken(user, s.jwtKeys, s.cfg)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, token, nil
+}
+
+// verifyCode accepts either a TOTP code or an unused recovery code. Repeated
+// failures lock verification for a while to stop brute-forcing the 6 digit codes.
+func (s *TwoFactorService) verifyCode(user *model.User, code string) error {
+	if user.TOTPLockedUntil != nil && time.Now().Before(*user.TOTPLockedUntil) {
+		return ErrTooManyRequests
+	}
+
+	if s.checkCode(user, code) {
+		user.TOTPFailedAttempts = 0
+		user.TOTPLockedUntil = nil
+		return s.userRepo.UpdateTwoFactor(user)
+	}
+
+	user.TOTPFailedAttempts++
+	if user.TOTPFailedAttempts >= maxMFAFailures {
+		lockedUntil := time.Now().Add(mfaLockout)
+		user.TOTPLockedUntil = &lockedUntil
+		user.TOTPFailedAttempts = 0
+	}
+	if err := s.userRepo.UpdateTwoFactor(user); err != nil {
+		return err
+	}
+	return ErrInvalidMFACode
+}
+
+func (s *TwoFactorService) checkCode(user *model.User, code string) bool {
+	code = strings.TrimSpace(code)
+
+	if user.TOTPSecret != nil {
+		// Codes from an already accepted time step are replays
+		counter, ok := totp.Validate(*user.TOTPSecret, code, time.Now(), totpSkew)
+		if ok && counter > user.TOTPLastCounter {
+			user.TOTPLastCounter = counter
+			return true
+		}
+		if ok {
+			return false
+		}
+	}
+
+	used, err := s.recoveryCodeRepo.Use(user.ID, hashRecoveryCode(code), time.Now())
+	return err == nil && used
+}
+
+// generateRecoveryCodes replaces the user's recovery codes, storing only their hashes
+func (s *TwoFactorService) generateRecoveryCodes(userID uint) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := randomRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = hashRecoveryCode(code)
+	}
+
+	if err := s.recoveryCodeRepo.ReplaceForUser(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *TwoFactorService) isRequiredFor(user *model.User) bool {
+	return s.securityPolicy != nil && user.IsAdmin() && s.securityPolicy.IsAdmin2FARequired()
+}
+
+// randomRecoveryCode returns a code like "k7mqp-x3vnd"
+func randomRecoveryCode() (string, error) {
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	code := make([]byte, 0, 11)
+	for i := 0; i < 10; i++ {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code = append(code, recoveryCodeAlphabet[n.Int64()])
+	}
+	return string(code), nil
+}
+
+// hashRecoveryCode hashes a recovery code, ignoring case and separators.
+// The codes are random enough that a fast hash is sufficient.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -13,17 +14,27 @@ var (
 	ErrCannotDeleteSelf    = errors.New("cannot delete your own account")
 	ErrCannotRemoveOwnRole = errors.New("cannot remove your own admin role")
 	ErrRoleNotFound        = errors.New("role not found")
+	ErrInvalidBulkAction   = errors.New("invalid bulk action")
+)
+
+// Bulk actions on users
+const (
+	BulkActionDisable          = "disable"
+	BulkActionAssignRole       = "assign_role"
+	BulkActionExtendMembership = "extend_membership"
 )
 
 type UserService struct {
-	userRepo *repository.UserRepository
-	roleRepo *repository.RoleRepository
+	userRepo   *repository.UserRepository
+	roleRepo   *repository.RoleRepository
+	loginGuard *LoginGuard
 }
 
-func NewUserService(userRepo *repository.UserRepository, roleRepo *repository.RoleRepository) *UserService {
+func NewUserService(userRepo *repository.UserRepository, roleRepo *repository.RoleRepository, loginGuard *LoginGuard) *UserService {
 	return &UserService{
-		userRepo: userRepo,
-		roleRepo: roleRepo,
+		userRepo:   userRepo,
+		roleRepo:   roleRepo,
+		loginGuard: loginGuard,
 	}
 }
 
@@ -48,6 +59,7 @@ type UserDetail struct {
 	IsMember       bool       `json:"is_member"`
 	MemberExpireAt *time.Time `json:"member_expire_at,omitempty"`
 	Roles          []RoleInfo `json:"roles"`
+	LockedUntil    *time.Time `json:"locked_until,omitempty"` // Set while sign-in is locked after failed attempts
 	CreatedAt      time.Time  `json:"created_at"`
 	UpdatedAt      time.Time  `json:"updated_at"`
 }
@@ -59,9 +71,9 @@ type RoleInfo struct {
 	Name string `json:"name"`
 }
 
-// ListUsers returns a paginated list of users
-func (s *UserService) ListUsers(page, pageSize int) ([]UserListItem, int64, error) {
-	users, total, err := s.userRepo.List(page, pageSize)
+// ListUsers returns a paginated list of users matching the filter
+func (s *UserService) ListUsers(filter repository.UserFilter, page, pageSize int) ([]UserListItem, int64, error) {
+	users, total, err := s.userRepo.List(filter, page, pageSize)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -111,6 +123,7 @@ func (s *UserService) GetUserByID(id uint) (*UserDetail, error) {
 		IsMember:       user.IsMember(),
 		MemberExpireAt: user.MemberExpireAt,
 		Roles:          roles,
+		LockedUntil:    s.loginGuard.LockedUntil(user.Email),
 		CreatedAt:      user.CreatedAt,
 		UpdatedAt:      user.UpdatedAt,
 	}, nil
@@ -182,20 +195,112 @@ func (s *UserService) RemoveRole(userID uint, roleCode string, currentUserID uin
 	return s.userRepo.RemoveRole(userID, role.ID)
 }
 
-// DeleteUser deletes a user by ID
-func (s *UserService) DeleteUser(id uint, currentUserID uint) error {
+// UnlockUser lifts a sign-in lockout caused by failed login attempts
+func (s *UserService) UnlockUser(id uint) error {
+	user, err := s.userRepo.FindByID(id)
+	if err != nil {
+		return ErrUserNotFound
+	}
+
+	return s.loginGuard.Unlock(user.Email)
+}
+
+// DeleteUser deletes a user by ID, anonymizing their personal data right away
+func (s *UserService) DeleteUser(ctx context.Context, id uint, currentUserID uint) error {
 	// Prevent deleting own account
 	if id == currentUserID {
 		return ErrCannotDeleteSelf
 	}
 
 	// Check if user exists
-	_, err := s.userRepo.FindByID(id)
+	user, err := s.userRepo.FindByID(id)
 	if err != nil {
 		return ErrUserNotFound
 	}
 
-	return s.userRepo.Delete(id)
+	return anonymizeUser(ctx, s.userRepo, s.loginGuard, user)
+}
+
+// BulkUserAction is a change applied to many users at once
+type BulkUserAction struct {
+	Action   string
+	RoleCode string // For BulkActionAssignRole
+	Days     int    // For BulkActionExtendMembership
+}
+
+// BulkUserResult is the outcome of a bulk action for one user. Err is nil if
+// the user was changed.
+type BulkUserResult struct {
+	UserID uint
+	Err    error
+}
+
+// BulkUpdate applies an action to users in one transaction. Users the action
+// doesn't apply to, such as unknown IDs or the current user for disable, are
+// skipped and reported; the others are changed together, or not at all if
+// the database fails.
+func (s *UserService) BulkUpdate(ids []uint, action BulkUserAction, currentUserID uint) ([]BulkUserResult, error) {
+	var apply func(repo *repository.UserRepository, user *model.User) error
+	switch action.Action {
+	case BulkActionDisable:
+		apply = func(repo *repository.UserRepository, user *model.User) error {
+			if user.ID == currentUserID {
+				return ErrCannotDisableSelf
+			}
+			return repo.UpdateStatus(user.ID, model.UserStatusDisabled)
+		}
+	case BulkActionAssignRole:
+		role, err := s.roleRepo.FindByCode(action.RoleCode)
+		if err != nil {
+			return nil, ErrRoleNotFound
+		}
+		apply = func(repo *repository.UserRepository, user *model.User) error {
+			return repo.AssignRole(user.ID, role.ID)
+		}
+	case BulkActionExtendMembership:
+		if action.Days < 1 {
+			return nil, ErrInvalidBulkAction
+		}
+		apply = func(repo *repository.UserRepository, user *model.User) error {
+			// Extend from the current expiry, or from now if it has lapsed
+			from := time.Now()
+			if user.MemberExpireAt != nil && user.MemberExpireAt.After(from) {
+				from = *user.MemberExpireAt
+			}
+			expireAt := from.AddDate(0, 0, action.Days)
+			user.MemberExpireAt = &expireAt
+			return repo.Update(user)
+		}
+	default:
+		return nil, ErrInvalidBulkAction
+	}
+
+	results := make([]BulkUserResult, 0, len(ids))
+	err := s.userRepo.Transaction(func(repo *repository.UserRepository) error {
+		results = results[:0]
+		for _, id := range ids {
+			user, err := repo.FindByID(id)
+			if err != nil {
+				results = append(results, BulkUserResult{UserID: id, Err: ErrUserNotFound})
+				continue
+			}
+
+			err = apply(repo, user)
+			switch err {
+			case nil:
+				results = append(results, BulkUserResult{UserID: id})
+			case ErrCannotDisableSelf:
+				results = append(results, BulkUserResult{UserID: id, Err: err})
+			default:
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
 }
 
 // GetAllRoles returns all available roles
@@ -0,0 +1,405 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lite-blog/backend/internal/model"
+	"github.com/lite-blog/backend/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	userImportBatchSize = 500
+	userImportMaxErrors = 1000
+	userExportBatchSize = 500
+)
+
+// ErrInvalidImportFile is returned for a CSV file without an email column
+var ErrInvalidImportFile = errors.New("import file needs a header row with an email column")
+
+// UserImportRowError is a row of a user import that was rejected
+type UserImportRowError struct {
+	Row   int    `json:"row"` // Line in the file, counting the header as 1
+	Email string `json:"email,omitempty"`
+	Error string `json:"error"`
+}
+
+// UserImportReport summarizes a user import. In a dry run, Created and
+// Updated count the rows that would be.
+type UserImportReport struct {
+	DryRun          bool                 `json:"dry_run"`
+	Rows            int                  `json:"rows"`
+	Created         int                  `json:"created"`
+	Updated         int                  `json:"updated"`
+	Failed          int                  `json:"failed"`
+	Errors          []UserImportRowError `json:"errors"`
+	ErrorsTruncated bool                 `json:"errors_truncated"` // Only the first errors are listed
+}
+
+func (r *UserImportReport) fail(row int, email string, err error) {
+	r.Failed++
+	if len(r.Errors) >= userImportMaxErrors {
+		r.ErrorsTruncated = true
+		return
+	}
+	r.Errors = append(r.Errors, UserImportRowError{Row: row, Email: email, Error: err.Error()})
+}
+
+// userImportRow is a validated row of a user import
+type userImportRow struct {
+	line     int
+	email    string
+	roles    []model.Role
+	expireAt *time.Time // nil leaves the membership unchanged
+	language string     // empty leaves the language unchanged
+}
+
+// ImportUsersCSV creates or updates users from CSV with the columns email,
+// roles, member_expire_at and language; only email is required, and other
+// columns, such as those of an export, are ignored. Roles are separated by
+// semicolons and added to the user's roles. Empty cells leave a field
+// unchanged. Dates are RFC 3339 or YYYY-MM-DD (UTC).
+//
+// The file is read as a stream and written in batches, each in a transaction.
+// Invalid rows are reported and skipped. A dry run only validates.
+func (s *UserService) ImportUsersCSV(r io.Reader, dryRun bool) (*UserImportReport, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, ErrInvalidImportFile
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, ErrInvalidImportFile
+	}
+
+	roleList, err := s.roleRepo.List()
+	if err != nil {
+		return nil, err
+	}
+	roles := make(map[string]model.Role, len(roleList))
+	for _, role := range roleList {
+		roles[role.Code] = role
+	}
+	var userRole *model.Role
+	if role, ok := roles[model.RoleCodeUser]; ok {
+		userRole = &role
+	}
+
+	report := &UserImportReport{DryRun: dryRun, Errors: []UserImportRowError{}}
+	seen := make(map[string]int)
+	batch := make([]userImportRow, 0, userImportBatchSize)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			report.Rows++
+			report.fail(parseErr.StartLine, "", parseErr.Err)
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		report.Rows++
+
+		cell := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row, err := parseUserImportRow(line, cell, roles)
+		if err == nil && seen[row.email] != 0 {
+			err = fmt.Errorf("duplicate of row %d", seen[row.email])
+		}
+		if err != nil {
+			report.fail(line, strings.ToLower(cell("email")), err)
+			continue
+		}
+		seen[row.email] = line
+
+		batch = append(batch, row)
+		if len(batch) == userImportBatchSize {
+			s.importUserBatch(batch, userRole, dryRun, report)
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		s.importUserBatch(batch, userRole, dryRun, report)
+	}
+
+	return report, nil
+}
+
+// parseUserImportRow validates a row read through cell
+func parseUserImportRow(line int, cell func(string) string, roles map[string]model.Role) (userImportRow, error) {
+	row := userImportRow{line: line, email: strings.ToLower(cell("email"))}
+
+	if row.email == "" {
+		return row, errors.New("email is required")
+	}
+	if addr, err := mail.ParseAddress(row.email); err != nil || addr.Address != row.email {
+		return row, errors.New("invalid email address")
+	}
+
+	for _, code := range strings.Split(cell("roles"), ";") {
+		code = strings.ToLower(strings.TrimSpace(code))
+		if code == "" {
+			continue
+		}
+		role, ok := roles[code]
+		if !ok {
+			return row, fmt.Errorf("unknown role %q", code)
+		}
+		// Admins are made one at a time, never from a file
+		if code == model.RoleCodeAdmin {
+			return row, errors.New("the admin role can't be imported")
+		}
+		row.roles = append(row.roles, role)
+	}
+
+	if value := cell("member_expire_at"); value != "" {
+		expireAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			expireAt, err = time.Parse("2006-01-02", value)
+		}
+		if err != nil {
+			return row, fmt.Errorf("invalid member_expire_at %q", value)
+		}
+		row.expireAt = &expireAt
+	}
+
+	if value := cell("language"); value != "" {
+		row.language = NormalizeLanguage(value)
+		if row.language == "" {
+			return row, fmt.Errorf("unsupported language %q", value)
+		}
+	}
+
+	return row, nil
+}
+
+// userImportOutcome is what a set of import rows did, or would do
+type userImportOutcome struct {
+	created  int
+	updated  int
+	rejected []userImportRejection
+}
+
+// userImportRejection is a row that conflicts with an existing account
+type userImportRejection struct {
+	row userImportRow
+	err error
+}
+
+func (r *UserImportReport) add(outcome *userImportOutcome) {
+	r.Created += outcome.created
+	r.Updated += outcome.updated
+	for _, rejection := range outcome.rejected {
+		r.fail(rejection.row.line, rejection.row.email, rejection.err)
+	}
+}
+
+// importUserBatch writes a batch of rows in one transaction. If it fails, the
+// rows are retried one at a time, so only the rows at fault are reported.
+func (s *UserService) importUserBatch(batch []userImportRow, userRole *model.Role, dryRun bool, report *UserImportReport) {
+	outcome, err := s.importUserRows(batch, userRole, dryRun)
+	if err == nil {
+		report.add(outcome)
+		return
+	}
+
+	for _, row := range batch {
+		outcome, err := s.importUserRows([]userImportRow{row}, userRole, dryRun)
+		if err != nil {
+			report.fail(row.line, row.email, err)
+			continue
+		}
+		report.add(outcome)
+	}
+}
+
+// importUserRows writes rows in one transaction. Rows whose email matches a
+// deleted account, or several accounts differing only in case, are rejected
+// without failing the others.
+func (s *UserService) importUserRows(rows []userImportRow, userRole *model.Role, dryRun bool) (*userImportOutcome, error) {
+	emails := make([]string, len(rows))
+	for i, row := range rows {
+		emails[i] = row.email
+	}
+
+	var outcome *userImportOutcome
+	err := s.userRepo.Transaction(func(repo *repository.UserRepository) error {
+		outcome = &userImportOutcome{}
+
+		users, err := repo.FindByEmails(emails)
+		if err != nil {
+			return err
+		}
+		existing := make(map[string][]*model.User, len(users))
+		for i := range users {
+			email := strings.ToLower(users[i].Email)
+			existing[email] = append(existing[email], &users[i])
+		}
+
+		for _, row := range rows {
+			matches := existing[row.email]
+			switch {
+			case len(matches) > 1:
+				outcome.rejected = append(outcome.rejected, userImportRejection{row, errors.New("email matches more than one account")})
+			case len(matches) == 1 && matches[0].DeletedAt.Valid:
+				outcome.rejected = append(outcome.rejected, userImportRejection{row, errors.New("email belongs to a deleted account")})
+			case len(matches) == 0:
+				outcome.created++
+				if !dryRun {
+					if err := createImportedUser(repo, userRole, row); err != nil {
+						return err
+					}
+				}
+			default:
+				outcome.updated++
+				if !dryRun {
+					if err := updateImportedUser(repo, matches[0], row); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return outcome, nil
+}
+
+// createImportedUser creates a verified account for an imported row. Like
+// accounts made by sign-in providers, it has an unusable random password;
+// the user signs in another way or sets one later.
+func createImportedUser(repo *repository.UserRepository, userRole *model.Role, row userImportRow) error {
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return err
+	}
+	// The password is random and never used, so a low cost is safe and keeps
+	// large imports fast
+	hashedPassword, err := bcrypt.GenerateFromPassword(password, bcrypt.MinCost)
+	if err != nil {
+		return err
+	}
+
+	user := &model.User{
+		Email:          row.email,
+		PasswordHash:   string(hashedPassword),
+		EmailVerified:  true,
+		MemberExpireAt: row.expireAt,
+		Language:       row.language,
+		Status:         model.UserStatusActive,
+		Roles:          row.roles,
+	}
+	if userRole != nil && !user.HasRole(model.RoleCodeUser) {
+		user.Roles = append(user.Roles, *userRole)
+	}
+	return repo.Create(user)
+}
+
+// updateImportedUser applies an imported row to an existing user
+func updateImportedUser(repo *repository.UserRepository, user *model.User, row userImportRow) error {
+	if row.expireAt != nil || row.language != "" {
+		if row.expireAt != nil {
+			user.MemberExpireAt = row.expireAt
+		}
+		if row.language != "" {
+			user.Language = row.language
+		}
+		if err := repo.Update(user); err != nil {
+			return err
+		}
+	}
+
+	for _, role := range row.roles {
+		if !user.HasRole(role.Code) {
+			if err := repo.AssignRole(user.ID, role.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteUsersCSV writes the users matching the filter and their membership
+// state as CSV, in ID order. The file can be imported again.
+func (s *UserService) WriteUsersCSV(w io.Writer, filter repository.UserFilter) error {
+	writer := csv.NewWriter(w)
+	header := []string{"id", "email", "email_verified", "status", "roles", "member_expire_at", "membership", "is_member", "language", "created_at"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	err := s.userRepo.Each(filter, userExportBatchSize, func(batch []model.User) error {
+		now := time.Now()
+		for _, user := range batch {
+			expireAt := ""
+			membership := repository.MembershipNone
+			if user.MemberExpireAt != nil {
+				expireAt = user.MemberExpireAt.UTC().Format(time.RFC3339)
+				membership = repository.MembershipExpired
+				if user.MemberExpireAt.After(now) {
+					membership = repository.MembershipActive
+				}
+			}
+			status := "active"
+			if user.Status == model.UserStatusDisabled {
+				status = "disabled"
+			}
+
+			row := []string{
+				strconv.FormatUint(uint64(user.ID), 10),
+				user.Email,
+				strconv.FormatBool(user.EmailVerified),
+				status,
+				strings.Join(user.GetRoleCodes(), ";"),
+				expireAt,
+				membership,
+				strconv.FormatBool(user.IsMember()),
+				user.Language,
+				user.CreatedAt.UTC().Format(time.RFC3339),
+			}
+			for i := range row {
+				row[i] = csvSafe(row[i])
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -12,15 +12,33 @@ type Claims struct {
 	UserID uint     `json:"user_id"`
 	Email  string   `json:"email"`
 	Roles  []string `json:"roles"`
+	// Purpose marks restricted tokens (e.g. PurposeMFA); it is empty for session tokens
+	Purpose string `json:"purpose,omitempty"`
+	// SessionVersion is the user's session version when the token was issued.
+	// Bumping the user's version revokes older sessions.
+	SessionVersion int `json:"sv,omitempty"`
+	// RolesVersion is the user's roles version when the token was issued.
+	// Roles are always checked against the database; a stale version only
+	// means the session should be re-issued.
+	RolesVersion int `json:"rv,omitempty"`
+	// ImpersonatorID is the admin viewing the site as this user. Impersonated
+	// sessions are read-only.
+	ImpersonatorID uint `json:"imp,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a new JWT token
-func GenerateToken(userID uint, email string, roles []string, secret string, expireHours int) (string, error) {
+// PurposeMFA marks a token issued after the password step of a two-factor login.
+// It only allows completing the login, not accessing the API.
+const PurposeMFA = "mfa"
+
+// GenerateToken generates a new session token signed with the key set's signing key
+func GenerateToken(userID uint, email string, roles []string, sessionVersion, rolesVersion int, keys *KeySet, expireHours int) (string, error) {
 	claims := Claims{
-		UserID: userID,
-		Email:  email,
-		Roles:  roles,
+		UserID:         userID,
+		Email:          email,
+		Roles:          roles,
+		SessionVersion: sessionVersion,
+		RolesVersion:   rolesVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expireHours) * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -28,28 +46,59 @@ func GenerateToken(userID uint, email string, roles []string, secret string, exp
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return keys.Sign(&claims)
 }
 
-// ValidateToken validates a JWT token and returns the claims
-func ValidateToken(tokenString string, secret string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte(secret), nil
-	})
+// GenerateImpersonationToken generates a session token for userID that is
+// marked as held by the impersonating admin
+func GenerateImpersonationToken(userID uint, email string, roles []string, sessionVersion, rolesVersion int, impersonatorID uint, keys *KeySet, ttl time.Duration) (string, error) {
+	claims := Claims{
+		UserID:         userID,
+		Email:          email,
+		Roles:          roles,
+		SessionVersion: sessionVersion,
+		RolesVersion:   rolesVersion,
+		ImpersonatorID: impersonatorID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+	}
 
+	return keys.Sign(&claims)
+}
+
+// GeneratePurposeToken generates a short-lived restricted token for a single purpose
+func GeneratePurposeToken(userID uint, purpose string, keys *KeySet, ttl time.Duration) (string, error) {
+	claims := Claims{
+		UserID:  userID,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return keys.Sign(&claims)
+}
+
+// ValidatePurposeToken validates a restricted token and checks its purpose
+func ValidatePurposeToken(tokenString string, purpose string, keys *KeySet) (*Claims, error) {
+	claims, err := ValidateToken(tokenString, keys)
 	if err != nil {
 		return nil, err
 	}
-
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	if claims.Purpose != purpose {
+		return nil, errors.New("invalid token purpose")
 	}
+	return claims, nil
+}
 
-	return nil, errors.New("invalid token")
+// ValidateToken validates a JWT token against the key set and returns the claims
+func ValidateToken(tokenString string, keys *KeySet) (*Claims, error) {
+	return keys.Parse(tokenString)
 }
 
 // HasRole checks if the claims contain a specific role
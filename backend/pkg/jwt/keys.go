@@ -0,0 +1,275 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+var (
+	ErrUnknownKey         = errors.New("unknown signing key")
+	ErrUnsupportedKey     = errors.New("unsupported key type for algorithm")
+	ErrNoSigningKey       = errors.New("key can only verify tokens")
+	ErrDuplicateKey       = errors.New("duplicate key ID")
+	ErrUnsupportedAlg     = errors.New("unsupported signing algorithm")
+	ErrInvalidKeyMaterial = errors.New("invalid PEM key")
+)
+
+// Key signs and verifies tokens. Keys loaded from a public key, and HMAC keys
+// without a secret, can only verify.
+type Key struct {
+	ID        string
+	Algorithm string
+	signKey   interface{} // []byte, *rsa.PrivateKey or ed25519.PrivateKey
+	verifyKey interface{} // []byte, *rsa.PublicKey or ed25519.PublicKey
+}
+
+// NewHMACKey returns an HS256 key
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{ID: id, Algorithm: AlgorithmHS256, signKey: secret, verifyKey: secret}
+}
+
+// ParsePrivateKeyPEM loads an RS256 or EdDSA signing key from a PKCS#8 (or
+// PKCS#1 RSA) PEM block
+func ParsePrivateKeyPEM(id, algorithm string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKeyMaterial
+	}
+
+	var parsed interface{}
+	var err error
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeyMaterial, err)
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		if algorithm != AlgorithmRS256 {
+			return nil, ErrUnsupportedKey
+		}
+		return &Key{ID: id, Algorithm: algorithm, signKey: k, verifyKey: &k.PublicKey}, nil
+	case ed25519.PrivateKey:
+		if algorithm != AlgorithmEdDSA {
+			return nil, ErrUnsupportedKey
+		}
+		return &Key{ID: id, Algorithm: algorithm, signKey: k, verifyKey: k.Public()}, nil
+	default:
+		return nil, ErrUnsupportedKey
+	}
+}
+
+// ParsePublicKeyPEM loads an RS256 or EdDSA key that only verifies tokens,
+// such as a retired key whose private half was destroyed
+func ParsePublicKeyPEM(id, algorithm string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKeyMaterial
+	}
+
+	var parsed interface{}
+	var err error
+	if block.Type == "RSA PUBLIC KEY" {
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeyMaterial, err)
+	}
+
+	switch parsed.(type) {
+	case *rsa.PublicKey:
+		if algorithm != AlgorithmRS256 {
+			return nil, ErrUnsupportedKey
+		}
+	case ed25519.PublicKey:
+		if algorithm != AlgorithmEdDSA {
+			return nil, ErrUnsupportedKey
+		}
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	return &Key{ID: id, Algorithm: algorithm, verifyKey: parsed}, nil
+}
+
+// CanSign checks if the key holds the private half or secret
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// signingMethod returns the JWT signing method for the key's algorithm
+func (k *Key) signingMethod() (jwt.SigningMethod, error) {
+	switch k.Algorithm {
+	case AlgorithmHS256:
+		return jwt.SigningMethodHS256, nil
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, ErrUnsupportedAlg
+	}
+}
+
+// KeySet signs tokens with one key and verifies them with any key in the set,
+// picked by the token's "kid" header. Keeping the previous key in the set
+// after rotating lets tokens signed with it work until they expire. A key with
+// an empty ID signs without a "kid" and verifies tokens that have none, as
+// issued before keys had IDs.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+	order   []string
+}
+
+// NewKeySet returns a key set that signs with signing and also verifies with others
+func NewKeySet(signing *Key, others ...*Key) (*KeySet, error) {
+	if !signing.CanSign() {
+		return nil, ErrNoSigningKey
+	}
+
+	ks := &KeySet{signing: signing, keys: make(map[string]*Key)}
+	for _, key := range append([]*Key{signing}, others...) {
+		if _, err := key.signingMethod(); err != nil {
+			return nil, err
+		}
+		if _, ok := ks.keys[key.ID]; ok {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateKey, key.ID)
+		}
+		ks.keys[key.ID] = key
+		ks.order = append(ks.order, key.ID)
+	}
+	return ks, nil
+}
+
+// SigningKeyID returns the ID of the key new tokens are signed with
+func (ks *KeySet) SigningKeyID() string {
+	return ks.signing.ID
+}
+
+// DeriveSecret derives a key for one purpose from the signing key, for
+// features that sign their own data and have no secret configured. The
+// result changes whenever the signing key does.
+func (ks *KeySet) DeriveSecret(purpose string) ([]byte, error) {
+	var material []byte
+	switch key := ks.signing.signKey.(type) {
+	case []byte:
+		material = key
+	case *rsa.PrivateKey, ed25519.PrivateKey:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		material = der
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	return hkdf.Key(sha256.New, material, nil, purpose, 32)
+}
+
+// Sign signs claims with the signing key
+func (ks *KeySet) Sign(claims *Claims) (string, error) {
+	method, err := ks.signing.signingMethod()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(method, claims)
+	if ks.signing.ID != "" {
+		token.Header["kid"] = ks.signing.ID
+	}
+	return token.SignedString(ks.signing.signKey)
+}
+
+// Parse verifies a token with the key named by its "kid" header and returns the claims
+func (ks *KeySet) Parse(tokenString string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		// The algorithm comes from our key, never the token, so an RSA public
+		// key can't be passed off as an HMAC secret
+		if token.Method.Alg() != key.Algorithm {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key.verifyKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+		return claims, nil
+	}
+	return nil, errors.New("invalid token")
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"` // OKP
+	X         string `json:"x,omitempty"`   // OKP
+	N         string `json:"n,omitempty"`   // RSA
+	E         string `json:"e,omitempty"`   // RSA
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeys returns the set's public keys, so other services can verify
+// tokens. HMAC secrets are never included.
+func (ks *KeySet) PublicKeys() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, id := range ks.order {
+		key := ks.keys[id]
+		switch pub := key.verifyKey.(type) {
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "OKP",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Algorithm,
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(pub),
+			})
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Algorithm,
+				N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		}
+	}
+	return set
+}
@@ -0,0 +1,151 @@
+// Package oauth implements the client side of the OAuth 2.0 authorization code
+// flow with PKCE (RFC 7636) for signing in through OpenID Connect providers and
+// GitHub.
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrExchangeFailed = errors.New("authorization code exchange failed")
+	ErrInvalidIDToken = errors.New("invalid ID token")
+	ErrNoIdentity     = errors.New("provider did not return a usable identity")
+)
+
+// maxResponseSize bounds provider responses
+const maxResponseSize = 1 << 20
+
+// Identity is the account information a provider vouches for
+type Identity struct {
+	Subject       string // Stable account ID at the provider
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is a sign-in provider
+type Provider interface {
+	// AuthCodeURL returns the URL to send the browser to
+	AuthCodeURL(redirectURI, state, nonce, codeChallenge string) (string, error)
+	// Exchange redeems the authorization code and returns the signed-in identity
+	Exchange(ctx context.Context, redirectURI, code, codeVerifier, nonce string) (*Identity, error)
+}
+
+// NewHTTPClient returns the HTTP client used for provider requests
+func NewHTTPClient() *http.Client {
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+// RandomString returns a random URL-safe string, for states, nonces and PKCE verifiers
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge derives the S256 PKCE challenge from a verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authCodeURL builds an authorization request URL
+func authCodeURL(endpoint, clientID, redirectURI, state, codeChallenge string, scopes []string, extra url.Values) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	params := u.Query()
+	params.Set("response_type", "code")
+	params.Set("client_id", clientID)
+	params.Set("redirect_uri", redirectURI)
+	params.Set("scope", strings.Join(scopes, " "))
+	params.Set("state", state)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+	for key, values := range extra {
+		params[key] = values
+	}
+	u.RawQuery = params.Encode()
+	return u.String(), nil
+}
+
+// tokenResponse is a token endpoint response (RFC 6749 §5.1)
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// exchangeCode redeems an authorization code at the token endpoint
+func exchangeCode(ctx context.Context, client *http.Client, endpoint, clientID, clientSecret, redirectURI, code, codeVerifier string) (*tokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("client_id", clientID)
+	form.Set("client_secret", clientSecret)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&token); err != nil {
+		return nil, fmt.Errorf("%w: status %d", ErrExchangeFailed, resp.StatusCode)
+	}
+	// GitHub reports errors with a 200 status
+	if resp.StatusCode != http.StatusOK || token.Error != "" || token.AccessToken == "" {
+		return nil, fmt.Errorf("%w: status %d: %s %s", ErrExchangeFailed, resp.StatusCode, token.Error, token.Description)
+	}
+	return &token, nil
+}
+
+// getJSON fetches a JSON document, authenticating with a bearer token if given
+func getJSON(ctx context.Context, client *http.Client, endpoint, accessToken string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
@@ -0,0 +1,298 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// GoogleIssuer is Google's OpenID Connect issuer
+const GoogleIssuer = "https://accounts.google.com"
+
+// jwksRefreshInterval limits how often unknown key IDs trigger a JWKS refetch
+const jwksRefreshInterval = time.Minute
+
+// metadata is the subset of the OpenID provider metadata we use
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider signs in with an OpenID Connect provider. Endpoints are
+// discovered from the issuer on first use.
+type OIDCProvider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	HTTPClient   *http.Client
+
+	mu         sync.Mutex
+	metadata   *metadata
+	keys       map[string]any
+	keysLoaded time.Time
+}
+
+// NewOIDCProvider returns a provider for an OpenID Connect issuer
+func NewOIDCProvider(issuer, clientID, clientSecret string, scopes []string) *OIDCProvider {
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	return &OIDCProvider{
+		Issuer:       strings.TrimRight(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+		HTTPClient:   NewHTTPClient(),
+	}
+}
+
+// AuthCodeURL returns the provider's authorization URL
+func (p *OIDCProvider) AuthCodeURL(redirectURI, state, nonce, codeChallenge string) (string, error) {
+	meta, err := p.discover(context.Background())
+	if err != nil {
+		return "", err
+	}
+	return authCodeURL(meta.AuthorizationEndpoint, p.ClientID, redirectURI, state, codeChallenge, p.Scopes, url.Values{
+		"nonce": {nonce},
+	})
+}
+
+// Exchange redeems the code and verifies the ID token
+func (p *OIDCProvider) Exchange(ctx context.Context, redirectURI, code, codeVerifier, nonce string) (*Identity, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := exchangeCode(ctx, p.HTTPClient, meta.TokenEndpoint, p.ClientID, p.ClientSecret, redirectURI, code, codeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, ErrInvalidIDToken
+	}
+
+	claims, err := p.verifyIDToken(ctx, token.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}
+
+	// Some providers only put the email in the userinfo response
+	if identity.Email == "" && meta.UserInfoEndpoint != "" {
+		var info idTokenClaims
+		if err := getJSON(ctx, p.HTTPClient, meta.UserInfoEndpoint, token.AccessToken, &info); err != nil {
+			return nil, err
+		}
+		if info.Subject != claims.Subject {
+			return nil, ErrNoIdentity
+		}
+		identity.Email = info.Email
+		identity.EmailVerified = bool(info.EmailVerified)
+		if identity.Name == "" {
+			identity.Name = info.Name
+		}
+	}
+
+	if identity.Subject == "" {
+		return nil, ErrNoIdentity
+	}
+	return identity, nil
+}
+
+// idTokenClaims are the ID token and userinfo claims we use
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	Name          string   `json:"name"`
+}
+
+// flexBool accepts booleans sent as strings, which some providers do for email_verified
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case bool:
+		*b = flexBool(v)
+	case string:
+		*b = flexBool(v == "true")
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// verifyIDToken checks the ID token signature and claims (OIDC Core §3.1.3.7)
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, raw, nonce string) (*idTokenClaims, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// discover fetches and caches the provider metadata
+func (p *OIDCProvider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var meta metadata
+	if err := getJSON(ctx, p.HTTPClient, p.Issuer+"/.well-known/openid-configuration", "", &meta); err != nil {
+		return nil, err
+	}
+	// The issuer must match exactly, or tokens from another issuer could be accepted
+	if meta.Issuer != p.Issuer {
+		return nil, fmt.Errorf("OIDC discovery returned issuer %q, expected %q", meta.Issuer, p.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is incomplete")
+	}
+	p.metadata = &meta
+	return p.metadata, nil
+}
+
+// key returns the signing key with the given ID, refetching the key set when
+// an unknown key shows up after the provider rotates keys
+func (p *OIDCProvider) key(ctx context.Context, kid string) (any, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysLoaded) < jwksRefreshInterval {
+		return nil, errors.New("unknown signing key")
+	}
+
+	keys, err := fetchJWKS(ctx, p.HTTPClient, meta.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysLoaded = time.Now()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+// jwk is a JSON Web Key (RFC 7517) holding an RSA or EC public key
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetchJWKS fetches a key set, skipping keys it can't use
+func fetchJWKS(ctx context.Context, client *http.Client, jwksURI string) (map[string]any, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(ctx, client, jwksURI, "", &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, errors.New("unsupported curve")
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("invalid EC point")
+		}
+		return key, nil
+	}
+	return nil, errors.New("unsupported key type")
+}
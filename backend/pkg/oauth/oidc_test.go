@@ -0,0 +1,137 @@
+package oauth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/lite-blog/backend/pkg/oauth"
+	"github.com/lite-blog/backend/pkg/oauth/oauthtest"
+)
+
+const redirectURI = "https://blog.example.com/api/auth/oauth/sso/callback"
+
+func newIssuer(t *testing.T) (*oauthtest.Issuer, *oauth.OIDCProvider) {
+	t.Helper()
+	issuer := oauthtest.NewIssuer("blog", "client-secret")
+	t.Cleanup(issuer.Close)
+	return issuer, oauth.NewOIDCProvider(issuer.URL(), "blog", "client-secret", nil)
+}
+
+// authorize starts a sign-in with a fresh PKCE verifier and returns the code
+// the issuer redirected back with
+func authorize(t *testing.T, issuer *oauthtest.Issuer, provider *oauth.OIDCProvider, nonce string) (code, verifier string) {
+	t.Helper()
+	verifier, err := oauth.RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := provider.AuthCodeURL(redirectURI, "state-1", nonce, oauth.CodeChallenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, state, err := issuer.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if state != "state-1" {
+		t.Fatalf("issuer returned state %q, want state-1", state)
+	}
+	return code, verifier
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	issuer, provider := newIssuer(t)
+	authURL, err := provider.AuthCodeURL(redirectURI, "state-1", "nonce-1", oauth.CodeChallenge("verifier"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme+"://"+u.Host+u.Path != issuer.URL()+"/authorize" {
+		t.Errorf("authorization endpoint = %s", u.Path)
+	}
+	for key, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             "blog",
+		"redirect_uri":          redirectURI,
+		"scope":                 "openid email profile",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        oauth.CodeChallenge("verifier"),
+		"code_challenge_method": "S256",
+	} {
+		if got := u.Query().Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	issuer, provider := newIssuer(t)
+	code, verifier := authorize(t, issuer, provider, "nonce-1")
+
+	identity, err := provider.Exchange(context.Background(), redirectURI, code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := oauth.Identity{Subject: "user-1", Email: "user@example.com", EmailVerified: true, Name: "Test User"}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+
+	// Codes are single use
+	if _, err := provider.Exchange(context.Background(), redirectURI, code, verifier, "nonce-1"); !errors.Is(err, oauth.ErrExchangeFailed) {
+		t.Errorf("second exchange: error = %v, want ErrExchangeFailed", err)
+	}
+}
+
+func TestOIDCExchangeRequiresPKCEVerifier(t *testing.T) {
+	issuer, provider := newIssuer(t)
+	code, _ := authorize(t, issuer, provider, "nonce-1")
+
+	other, err := oauth.RandomString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Exchange(context.Background(), redirectURI, code, other, "nonce-1"); !errors.Is(err, oauth.ErrExchangeFailed) {
+		t.Errorf("error = %v, want ErrExchangeFailed", err)
+	}
+}
+
+func TestOIDCExchangeRequiresSameRedirectURI(t *testing.T) {
+	issuer, provider := newIssuer(t)
+	code, verifier := authorize(t, issuer, provider, "nonce-1")
+
+	if _, err := provider.Exchange(context.Background(), "https://evil.example.com/callback", code, verifier, "nonce-1"); !errors.Is(err, oauth.ErrExchangeFailed) {
+		t.Errorf("error = %v, want ErrExchangeFailed", err)
+	}
+}
+
+func TestOIDCExchangeNonceMismatch(t *testing.T) {
+	issuer, provider := newIssuer(t)
+	code, verifier := authorize(t, issuer, provider, "nonce-1")
+
+	if _, err := provider.Exchange(context.Background(), redirectURI, code, verifier, "nonce-2"); !errors.Is(err, oauth.ErrInvalidIDToken) {
+		t.Errorf("error = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestOIDCExchangeRejectsTokenSignedWithWrongKey(t *testing.T) {
+	issuer, provider := newIssuer(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.SigningKey = key
+	code, verifier := authorize(t, issuer, provider, "nonce-1")
+
+	if _, err := provider.Exchange(context.Background(), redirectURI, code, verifier, "nonce-1"); !errors.Is(err, oauth.ErrInvalidIDToken) {
+		t.Errorf("error = %v, want ErrInvalidIDToken", err)
+	}
+}
@@ -0,0 +1,136 @@
+// Package password checks new passwords against a policy: a minimum length,
+// a number of character classes, and a bundled offline list of commonly used
+// passwords. Violations carry a code and parameters so clients can show them
+// in the user's language.
+package password
+
+import (
+	_ "embed"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxBytes is the longest password bcrypt can hash
+const MaxBytes = 72
+
+// Violation codes
+const (
+	CodeTooShort      = "too_short"       // Params: min
+	CodeTooLong       = "too_long"        // Params: max, in bytes
+	CodeTooFewClasses = "too_few_classes" // Params: min
+	CodeCommon        = "common"
+	CodeContainsEmail = "contains_email"
+	CodeReused        = "reused" // Params: count, the number of recent passwords checked
+)
+
+// Violation is one way a password breaks the policy. Message is an English
+// fallback; clients should localize by Code and Params.
+type Violation struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Params  map[string]int `json:"params,omitempty"`
+}
+
+// Policy describes which passwords are accepted
+type Policy struct {
+	MinLength   int  `json:"min_length"`   // In characters
+	MinClasses  int  `json:"min_classes"`  // Of lowercase, uppercase, digits and symbols
+	BlockCommon bool `json:"block_common"` // Reject passwords on the common list
+}
+
+//go:embed common.txt
+var commonList string
+
+var common = func() map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, line := range strings.Split(commonList, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			set[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return set
+}()
+
+// Check returns the ways password breaks the policy, or nil if it is
+// acceptable. The password may not contain email's local part.
+func (p Policy) Check(password, email string) []Violation {
+	var violations []Violation
+
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooShort,
+			Message: "Password is too short",
+			Params:  map[string]int{"min": p.MinLength},
+		})
+	}
+	if len(password) > MaxBytes {
+		violations = append(violations, Violation{
+			Code:    CodeTooLong,
+			Message: "Password is too long",
+			Params:  map[string]int{"max": MaxBytes},
+		})
+	}
+	if Classes(password) < p.MinClasses {
+		violations = append(violations, Violation{
+			Code:    CodeTooFewClasses,
+			Message: "Password needs more kinds of characters: lowercase, uppercase, digits or symbols",
+			Params:  map[string]int{"min": p.MinClasses},
+		})
+	}
+	if p.BlockCommon && IsCommon(password) {
+		violations = append(violations, Violation{
+			Code:    CodeCommon,
+			Message: "Password is too common",
+		})
+	}
+	if local, _, _ := strings.Cut(strings.ToLower(email), "@"); len(local) >= 3 && strings.Contains(strings.ToLower(password), local) {
+		violations = append(violations, Violation{
+			Code:    CodeContainsEmail,
+			Message: "Password must not contain your email",
+		})
+	}
+
+	return violations
+}
+
+// Reused returns the violation for a password that was used recently
+func Reused(count int) Violation {
+	return Violation{
+		Code:    CodeReused,
+		Message: "Password was used recently",
+		Params:  map[string]int{"count": count},
+	}
+}
+
+// IsCommon checks if password, ignoring case, is on the common list
+func IsCommon(password string) bool {
+	_, ok := common[strings.ToLower(password)]
+	return ok
+}
+
+// Classes counts the character classes in password: lowercase, uppercase,
+// digits and anything else
+func Classes(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	n := 0
+	for _, has := range []bool{lower, upper, digit, other} {
+		if has {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,303 @@
+// Package sns verifies Amazon SNS HTTP(S) notification messages.
+package sns
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message types
+const (
+	TypeNotification             = "Notification"
+	TypeSubscriptionConfirmation = "SubscriptionConfirmation"
+	TypeUnsubscribeConfirmation  = "UnsubscribeConfirmation"
+)
+
+var (
+	ErrInvalidMessage     = errors.New("invalid SNS message")
+	ErrInvalidCertURL     = errors.New("untrusted SNS signing certificate URL")
+	ErrInvalidSignature   = errors.New("invalid SNS message signature")
+	ErrUnsupportedVersion = errors.New("unsupported SNS signature version")
+	ErrMessageExpired     = errors.New("SNS message is too old")
+)
+
+const (
+	// DefaultMaxAge is how old a message may be. SNS stops retrying an HTTP
+	// delivery within an hour, so anything older is a replay.
+	DefaultMaxAge = time.Hour
+	// maxClockSkew is how far in the future a message timestamp may be
+	maxClockSkew = 5 * time.Minute
+)
+
+// amazonHost matches the hosts SNS serves signing certificates and subscribe URLs from
+var amazonHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// Message is an SNS message as posted to an HTTP(S) endpoint
+type Message struct {
+	Type             string `json:"Type"`
+	MessageID        string `json:"MessageId"`
+	Token            string `json:"Token,omitempty"`
+	TopicArn         string `json:"TopicArn"`
+	Subject          string `json:"Subject,omitempty"`
+	Message          string `json:"Message"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+	SubscribeURL     string `json:"SubscribeURL,omitempty"`
+	UnsubscribeURL   string `json:"UnsubscribeURL,omitempty"`
+}
+
+// ParseMessage decodes an SNS message from a request body
+func ParseMessage(body []byte) (*Message, error) {
+	var msg Message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, ErrInvalidMessage
+	}
+	if msg.Type == "" || msg.MessageID == "" || msg.Signature == "" || msg.SigningCertURL == "" {
+		return nil, ErrInvalidMessage
+	}
+	return &msg, nil
+}
+
+// StringToSign builds the canonical string SNS signs for the message type
+func (m *Message) StringToSign() (string, error) {
+	var keys []string
+	switch m.Type {
+	case TypeNotification:
+		keys = []string{"Message", "MessageId", "Subject", "Timestamp", "TopicArn", "Type"}
+	case TypeSubscriptionConfirmation, TypeUnsubscribeConfirmation:
+		keys = []string{"Message", "MessageId", "SubscribeURL", "Timestamp", "Token", "TopicArn", "Type"}
+	default:
+		return "", ErrInvalidMessage
+	}
+
+	values := map[string]string{
+		"Message":      m.Message,
+		"MessageId":    m.MessageID,
+		"Subject":      m.Subject,
+		"SubscribeURL": m.SubscribeURL,
+		"Timestamp":    m.Timestamp,
+		"Token":        m.Token,
+		"TopicArn":     m.TopicArn,
+		"Type":         m.Type,
+	}
+
+	var b strings.Builder
+	for _, key := range keys {
+		// Subject is only part of the signature when the notification has one
+		if key == "Subject" && m.Subject == "" {
+			continue
+		}
+		b.WriteString(key)
+		b.WriteByte('\n')
+		b.WriteString(values[key])
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// Verifier checks SNS message signatures, caching signing certificates
+type Verifier struct {
+	// HTTPClient fetches signing certificates and confirms subscriptions
+	HTTPClient *http.Client
+	// AllowedHost reports whether certificates and subscribe URLs may be fetched from a host.
+	// It defaults to the Amazon SNS hosts; tests can point it at a local TLS server.
+	AllowedHost func(host string) bool
+	// MaxAge is how old a message's Timestamp may be; zero uses DefaultMaxAge
+	MaxAge time.Duration
+
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+// NewVerifier creates a verifier that trusts the Amazon SNS hosts
+func NewVerifier() *Verifier {
+	return &Verifier{
+		HTTPClient:  &http.Client{Timeout: 10 * time.Second},
+		AllowedHost: IsAmazonHost,
+		certs:       make(map[string]*x509.Certificate),
+	}
+}
+
+// IsAmazonHost reports whether host is an Amazon SNS endpoint
+func IsAmazonHost(host string) bool {
+	return amazonHost.MatchString(strings.ToLower(host))
+}
+
+// Verify checks the message signature against its signing certificate, and
+// that the message is recent enough not to be a replay
+func (v *Verifier) Verify(msg *Message) error {
+	var hash crypto.Hash
+	switch msg.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return ErrUnsupportedVersion
+	}
+
+	certURL, err := v.checkURL(msg.SigningCertURL)
+	if err != nil {
+		return ErrInvalidCertURL
+	}
+	if !strings.HasSuffix(certURL.Path, ".pem") {
+		return ErrInvalidCertURL
+	}
+
+	if err := v.checkTimestamp(msg.Timestamp); err != nil {
+		return err
+	}
+
+	stringToSign, err := msg.StringToSign()
+	if err != nil {
+		return err
+	}
+	signature, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	cert, err := v.certificate(certURL.String())
+	if err != nil {
+		return err
+	}
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return ErrInvalidSignature
+	}
+
+	var digest []byte
+	if hash == crypto.SHA1 {
+		sum := sha1.Sum([]byte(stringToSign))
+		digest = sum[:]
+	} else {
+		sum := sha256.Sum256([]byte(stringToSign))
+		digest = sum[:]
+	}
+	if err := rsa.VerifyPKCS1v15(publicKey, hash, digest, signature); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ConfirmSubscription visits the SubscribeURL of a verified SubscriptionConfirmation message
+func (v *Verifier) ConfirmSubscription(ctx context.Context, msg *Message) error {
+	if msg.Type != TypeSubscriptionConfirmation {
+		return ErrInvalidMessage
+	}
+	subscribeURL, err := v.checkURL(msg.SubscribeURL)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, subscribeURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("confirm SNS subscription: unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// checkURL only allows https URLs on trusted hosts, so a forged message can't make
+// us fetch arbitrary URLs or trust a certificate we don't control
+func (v *Verifier) checkURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.User != nil {
+		return nil, ErrInvalidCertURL
+	}
+	allowed := v.AllowedHost
+	if allowed == nil {
+		allowed = IsAmazonHost
+	}
+	if !allowed(u.Hostname()) {
+		return nil, ErrInvalidCertURL
+	}
+	return u, nil
+}
+
+// checkTimestamp rejects messages older than MaxAge. The timestamp is part of
+// the signed string, so it can't be refreshed on a captured message.
+func (v *Verifier) checkTimestamp(timestamp string) error {
+	sent, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return ErrInvalidMessage
+	}
+	maxAge := v.MaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+	age := time.Since(sent)
+	if age > maxAge || age < -maxClockSkew {
+		return ErrMessageExpired
+	}
+	return nil
+}
+
+func (v *Verifier) certificate(certURL string) (*x509.Certificate, error) {
+	v.mu.Lock()
+	cert, ok := v.certs[certURL]
+	v.mu.Unlock()
+	if ok {
+		return cert, nil
+	}
+
+	resp, err := v.HTTPClient.Get(certURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetch SNS signing certificate: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch SNS signing certificate: unexpected status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, fmt.Errorf("fetch SNS signing certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("fetch SNS signing certificate: no PEM data")
+	}
+	cert, err = x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse SNS signing certificate: %w", err)
+	}
+	if time.Now().After(cert.NotAfter) {
+		return nil, fmt.Errorf("SNS signing certificate expired")
+	}
+
+	v.mu.Lock()
+	if v.certs == nil {
+		v.certs = make(map[string]*x509.Certificate)
+	}
+	v.certs[certURL] = cert
+	v.mu.Unlock()
+	return cert, nil
+}
@@ -0,0 +1,219 @@
+package sns_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lite-blog/backend/pkg/sns"
+	"github.com/lite-blog/backend/pkg/sns/snstest"
+)
+
+const topicArn = "arn:aws:sns:us-east-1:123456789012:ses-feedback"
+
+func newServer(t *testing.T) *snstest.Server {
+	t.Helper()
+	server := snstest.NewServer()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestVerify(t *testing.T) {
+	server := newServer(t)
+	verifier := server.Verifier()
+
+	for _, version := range []string{"1", "2"} {
+		for _, subject := range []string{"", "Amazon SES Email Event Notification"} {
+			msg := server.Notification(topicArn, `{"notificationType":"Bounce"}`)
+			msg.Subject = subject
+			server.Sign(msg, version)
+			if err := verifier.Verify(msg); err != nil {
+				t.Errorf("version %s, subject %q: %v", version, subject, err)
+			}
+		}
+	}
+
+	if err := verifier.Verify(server.SubscriptionConfirmation(topicArn)); err != nil {
+		t.Errorf("subscription confirmation: %v", err)
+	}
+}
+
+func TestVerifyParsedMessage(t *testing.T) {
+	server := newServer(t)
+	body, err := json.Marshal(server.Notification(topicArn, "hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := sns.ParseMessage(body)
+	if err != nil {
+		t.Fatalf("ParseMessage: %v", err)
+	}
+	if err := server.Verifier().Verify(msg); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestVerifyRejectsTamperedMessage(t *testing.T) {
+	server := newServer(t)
+	verifier := server.Verifier()
+
+	tests := map[string]func(msg *sns.Message){
+		"message":  func(msg *sns.Message) { msg.Message = `{"notificationType":"Complaint"}` },
+		"topic":    func(msg *sns.Message) { msg.TopicArn = topicArn + "-other" },
+		"type":     func(msg *sns.Message) { msg.Type = sns.TypeUnsubscribeConfirmation },
+		"subject":  func(msg *sns.Message) { msg.Subject = "Added" },
+		"version":  func(msg *sns.Message) { msg.SignatureVersion = "1" },
+		"encoding": func(msg *sns.Message) { msg.Signature = "not base64!" },
+	}
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			msg := server.Notification(topicArn, `{"notificationType":"Bounce"}`)
+			tamper(msg)
+			if err := verifier.Verify(msg); !errors.Is(err, sns.ErrInvalidSignature) {
+				t.Errorf("error = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsSignatureFromAnotherKey(t *testing.T) {
+	server := newServer(t)
+	other := newServer(t)
+
+	// Signed by another key, but pointing at this server's certificate
+	msg := server.Notification(topicArn, "hello")
+	other.Sign(msg, "2")
+	msg.SigningCertURL = server.CertURL
+	if err := server.Verifier().Verify(msg); !errors.Is(err, sns.ErrInvalidSignature) {
+		t.Errorf("error = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifyRejectsUntrustedCertURL(t *testing.T) {
+	server := newServer(t)
+
+	t.Run("disallowed host", func(t *testing.T) {
+		verifier := server.Verifier()
+		verifier.AllowedHost = sns.IsAmazonHost
+		if err := verifier.Verify(server.Notification(topicArn, "hello")); !errors.Is(err, sns.ErrInvalidCertURL) {
+			t.Errorf("error = %v, want ErrInvalidCertURL", err)
+		}
+	})
+
+	for name, certURL := range map[string]string{
+		"http":      strings.Replace(server.CertURL, "https://", "http://", 1),
+		"not a pem": strings.TrimSuffix(server.CertURL, ".pem") + ".txt",
+		"userinfo":  strings.Replace(server.CertURL, "https://", "https://sns.us-east-1.amazonaws.com@", 1),
+		"relative":  "/SimpleNotificationService-test.pem",
+	} {
+		t.Run(name, func(t *testing.T) {
+			msg := server.Notification(topicArn, "hello")
+			msg.SigningCertURL = certURL
+			if err := server.Verifier().Verify(msg); !errors.Is(err, sns.ErrInvalidCertURL) {
+				t.Errorf("error = %v, want ErrInvalidCertURL", err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsUnsupportedVersion(t *testing.T) {
+	server := newServer(t)
+	msg := server.Notification(topicArn, "hello")
+	msg.SignatureVersion = "3"
+	if err := server.Verifier().Verify(msg); !errors.Is(err, sns.ErrUnsupportedVersion) {
+		t.Errorf("error = %v, want ErrUnsupportedVersion", err)
+	}
+}
+
+func TestVerifyRejectsReplayedMessage(t *testing.T) {
+	server := newServer(t)
+	verifier := server.Verifier()
+
+	tests := []struct {
+		name      string
+		timestamp string
+		want      error
+	}{
+		{"within the max age", time.Now().Add(-50 * time.Minute).UTC().Format(time.RFC3339Nano), nil},
+		{"slightly in the future", time.Now().Add(time.Minute).UTC().Format(time.RFC3339Nano), nil},
+		{"older than the max age", time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339Nano), sns.ErrMessageExpired},
+		{"far in the future", time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano), sns.ErrMessageExpired},
+		{"unparseable", "yesterday", sns.ErrInvalidMessage},
+		{"missing", "", sns.ErrInvalidMessage},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := server.Notification(topicArn, "hello")
+			msg.Timestamp = tc.timestamp
+			server.Sign(msg, "2")
+			if err := verifier.Verify(msg); !errors.Is(err, tc.want) {
+				t.Errorf("error = %v, want %v", err, tc.want)
+			}
+		})
+	}
+
+	verifier.MaxAge = 10 * time.Minute
+	msg := server.Notification(topicArn, "hello")
+	msg.Timestamp = time.Now().Add(-15 * time.Minute).UTC().Format(time.RFC3339)
+	server.Sign(msg, "2")
+	if err := verifier.Verify(msg); !errors.Is(err, sns.ErrMessageExpired) {
+		t.Errorf("custom max age: error = %v, want ErrMessageExpired", err)
+	}
+}
+
+func TestConfirmSubscription(t *testing.T) {
+	server := newServer(t)
+	verifier := server.Verifier()
+
+	msg := server.SubscriptionConfirmation(topicArn)
+	if err := verifier.ConfirmSubscription(context.Background(), msg); err != nil {
+		t.Fatalf("ConfirmSubscription: %v", err)
+	}
+	if !server.Confirmed(msg.Token) {
+		t.Error("subscription was not confirmed")
+	}
+
+	// A forged SubscribeURL can't make the verifier fetch other hosts
+	forged := server.SubscriptionConfirmation(topicArn)
+	forged.SubscribeURL = "https://internal.example.com/admin?Token=" + forged.Token
+	if err := verifier.ConfirmSubscription(context.Background(), forged); !errors.Is(err, sns.ErrInvalidCertURL) {
+		t.Errorf("error = %v, want ErrInvalidCertURL", err)
+	}
+
+	if err := verifier.ConfirmSubscription(context.Background(), server.Notification(topicArn, "hello")); !errors.Is(err, sns.ErrInvalidMessage) {
+		t.Errorf("notification: error = %v, want ErrInvalidMessage", err)
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	for name, body := range map[string]string{
+		"not JSON":          "hello",
+		"missing type":      `{"MessageId":"1","Signature":"c2ln","SigningCertURL":"https://sns.us-east-1.amazonaws.com/a.pem"}`,
+		"missing signature": `{"Type":"Notification","MessageId":"1","SigningCertURL":"https://sns.us-east-1.amazonaws.com/a.pem"}`,
+		"missing cert URL":  `{"Type":"Notification","MessageId":"1","Signature":"c2ln"}`,
+	} {
+		if _, err := sns.ParseMessage([]byte(body)); !errors.Is(err, sns.ErrInvalidMessage) {
+			t.Errorf("%s: error = %v, want ErrInvalidMessage", name, err)
+		}
+	}
+}
+
+func TestIsAmazonHost(t *testing.T) {
+	for host, want := range map[string]bool{
+		"sns.us-east-1.amazonaws.com":          true,
+		"SNS.eu-west-1.amazonaws.com":          true,
+		"sns.cn-north-1.amazonaws.com.cn":      true,
+		"sns.us-east-1.amazonaws.com.evil.com": false,
+		"evil-sns.us-east-1.amazonaws.com":     false,
+		"sns.amazonaws.com":                    false,
+		"s3.us-east-1.amazonaws.com":           false,
+		"127.0.0.1":                            false,
+	} {
+		if got := sns.IsAmazonHost(host); got != want {
+			t.Errorf("IsAmazonHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
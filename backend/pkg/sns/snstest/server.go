@@ -0,0 +1,225 @@
+// Package snstest provides a local stand-in for the Amazon SNS endpoints that
+// serve signing certificates and confirm subscriptions, for exercising SNS
+// message verification in tests.
+package snstest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/lite-blog/backend/pkg/sns"
+)
+
+// certPath is where the signing certificate is served
+const certPath = "/SimpleNotificationService-test.pem"
+
+// Server serves an SNS signing certificate over TLS, using a certificate
+// chain from a CA generated for the test. Messages signed with Sign verify
+// against the certificate at CertURL.
+type Server struct {
+	Server  *httptest.Server
+	CertURL string
+
+	ca        *x509.CertPool
+	key       *rsa.PrivateKey
+	cert      []byte // PEM
+	mu        sync.Mutex
+	confirmed map[string]bool // subscription tokens that were confirmed
+}
+
+// NewServer starts a server. Call Close when done.
+func NewServer() *Server {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	caTemplate := certTemplate("snstest CA")
+	caTemplate.IsCA = true
+	caTemplate.BasicConstraintsValid = true
+	caTemplate.KeyUsage = x509.KeyUsageCertSign
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		panic(err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		panic(err)
+	}
+
+	// The TLS certificate for the local server
+	tlsKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	tlsTemplate := certTemplate("127.0.0.1")
+	tlsTemplate.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	tlsTemplate.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	tlsDER, err := x509.CreateCertificate(rand.Reader, tlsTemplate, caCert, &tlsKey.PublicKey, caKey)
+	if err != nil {
+		panic(err)
+	}
+
+	// The certificate SNS messages are signed with
+	signingKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	signingTemplate := certTemplate("sns.test.amazonaws.com")
+	signingTemplate.KeyUsage = x509.KeyUsageDigitalSignature
+	signingDER, err := x509.CreateCertificate(rand.Reader, signingTemplate, caCert, &signingKey.PublicKey, caKey)
+	if err != nil {
+		panic(err)
+	}
+
+	s := &Server{
+		ca:        x509.NewCertPool(),
+		key:       signingKey,
+		cert:      pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: signingDER}),
+		confirmed: make(map[string]bool),
+	}
+	s.ca.AddCert(caCert)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(certPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(s.cert)
+	})
+	mux.HandleFunc("/confirm", s.confirm)
+	s.Server = httptest.NewUnstartedServer(mux)
+	s.Server.TLS = &tls.Config{Certificates: []tls.Certificate{{
+		Certificate: [][]byte{tlsDER, caDER},
+		PrivateKey:  tlsKey,
+	}}}
+	s.Server.StartTLS()
+	s.CertURL = s.Server.URL + certPath
+	return s
+}
+
+// Close shuts the server down
+func (s *Server) Close() {
+	s.Server.Close()
+}
+
+// Verifier returns a verifier that trusts the test CA and only fetches from
+// this server's host
+func (s *Server) Verifier() *sns.Verifier {
+	host := s.Server.Listener.Addr().(*net.TCPAddr).IP.String()
+	verifier := sns.NewVerifier()
+	verifier.HTTPClient = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: s.ca}},
+	}
+	verifier.AllowedHost = func(h string) bool { return h == host }
+	return verifier
+}
+
+// Notification returns a notification for topicArn, sent now and signed with
+// signature version 2
+func (s *Server) Notification(topicArn, message string) *sns.Message {
+	msg := &sns.Message{
+		Type:      sns.TypeNotification,
+		MessageID: randomString(),
+		TopicArn:  topicArn,
+		Message:   message,
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+	}
+	s.Sign(msg, "2")
+	return msg
+}
+
+// SubscriptionConfirmation returns a signed subscription confirmation whose
+// SubscribeURL confirms on this server
+func (s *Server) SubscriptionConfirmation(topicArn string) *sns.Message {
+	token := randomString()
+	msg := &sns.Message{
+		Type:         sns.TypeSubscriptionConfirmation,
+		MessageID:    randomString(),
+		Token:        token,
+		TopicArn:     topicArn,
+		Message:      "You have chosen to subscribe to the topic " + topicArn,
+		Timestamp:    time.Now().UTC().Format(time.RFC3339Nano),
+		SubscribeURL: s.Server.URL + "/confirm?" + url.Values{"Token": {token}}.Encode(),
+	}
+	s.Sign(msg, "2")
+	return msg
+}
+
+// Sign sets the signature fields of msg, using signature version "1" (SHA1)
+// or "2" (SHA256). Change msg before calling Sign, or the signature won't match.
+func (s *Server) Sign(msg *sns.Message, version string) {
+	msg.SignatureVersion = version
+	msg.SigningCertURL = s.CertURL
+	stringToSign, err := msg.StringToSign()
+	if err != nil {
+		panic(err)
+	}
+
+	var signature []byte
+	if version == "1" {
+		sum := sha1.Sum([]byte(stringToSign))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA1, sum[:])
+	} else {
+		sum := sha256.Sum256([]byte(stringToSign))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+	}
+	if err != nil {
+		panic(err)
+	}
+	msg.Signature = base64.StdEncoding.EncodeToString(signature)
+}
+
+// Confirmed reports whether the subscription with token was confirmed
+func (s *Server) Confirmed(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.confirmed[token]
+}
+
+func (s *Server) confirm(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("Token")
+	if token == "" {
+		http.Error(w, "missing token", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.confirmed[token] = true
+	s.mu.Unlock()
+	w.Write([]byte("<ConfirmSubscriptionResponse/>"))
+}
+
+func certTemplate(commonName string) *x509.Certificate {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		panic(err)
+	}
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
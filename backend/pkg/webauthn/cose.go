@@ -0,0 +1,124 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// COSE algorithm identifiers (RFC 9053) supported for credentials
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// COSE key types and curves
+const (
+	coseKeyTypeOKP int64 = 1
+	coseKeyTypeEC2 int64 = 2
+	coseKeyTypeRSA int64 = 3
+
+	coseCurveP256    int64 = 1
+	coseCurveEd25519 int64 = 6
+)
+
+// COSE key map labels
+const (
+	coseLabelKty int64 = 1
+	coseLabelAlg int64 = 3
+	coseLabelCrv int64 = -1 // Also RSA modulus n
+	coseLabelX   int64 = -2 // Also RSA exponent e
+	coseLabelY   int64 = -3
+)
+
+// minRSABits rejects weak RSA keys
+const minRSABits = 2048
+
+var ErrUnsupportedKey = errors.New("unsupported credential public key")
+
+// SupportedAlgorithms lists the algorithms offered in registration options, in order of preference
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// publicKey is a decoded COSE public key
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE_Key, as stored with a credential
+func parsePublicKey(data []byte) (*publicKey, error) {
+	item, rest, err := decodeCBOR(data)
+	if err != nil || len(rest) != 0 {
+		return nil, ErrUnsupportedKey
+	}
+	m, ok := item.(map[any]any)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+
+	kty, _ := m[coseLabelKty].(int64)
+	alg, _ := m[coseLabelAlg].(int64)
+
+	switch {
+	case kty == coseKeyTypeEC2 && alg == AlgES256:
+		crv, _ := m[coseLabelCrv].(int64)
+		x, _ := m[coseLabelX].([]byte)
+		y, _ := m[coseLabelY].([]byte)
+		if crv != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, ErrUnsupportedKey
+		}
+		key := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, ErrUnsupportedKey
+		}
+		return &publicKey{alg: alg, key: key}, nil
+
+	case kty == coseKeyTypeOKP && alg == AlgEdDSA:
+		crv, _ := m[coseLabelCrv].(int64)
+		x, _ := m[coseLabelX].([]byte)
+		if crv != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedKey
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case kty == coseKeyTypeRSA && alg == AlgRS256:
+		n, _ := m[coseLabelCrv].([]byte)
+		e, _ := m[coseLabelX].([]byte)
+		if len(e) == 0 || len(e) > 4 {
+			return nil, ErrUnsupportedKey
+		}
+		exponent := new(big.Int).SetBytes(e)
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+		if key.N.BitLen() < minRSABits || key.E < 3 {
+			return nil, ErrUnsupportedKey
+		}
+		return &publicKey{alg: alg, key: key}, nil
+	}
+
+	return nil, ErrUnsupportedKey
+}
+
+// verify checks a signature over data
+func (k *publicKey) verify(data, signature []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
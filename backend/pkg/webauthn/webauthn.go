@@ -0,0 +1,470 @@
+// Package webauthn implements the relying party side of WebAuthn (passkey)
+// registration and authentication ceremonies.
+//
+// Registration asks for "none" attestation: credentials are trusted because the
+// signed-in user registered them, not because of who made the authenticator, so
+// attestation statements are not verified.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Ceremony types found in client data
+const (
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+)
+
+// User verification requirements
+const (
+	UserVerificationRequired  = "required"
+	UserVerificationPreferred = "preferred"
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent    = 0x01
+	flagUserVerified   = 0x04
+	flagBackupEligible = 0x08
+	flagBackedUp       = 0x10
+	flagAttestedData   = 0x40
+	flagExtensionData  = 0x80
+)
+
+const (
+	challengeSize = 32
+	// Timeout is how long the browser waits for the user during a ceremony
+	Timeout = 5 * time.Minute
+	// maxCredentialIDSize is the limit from the WebAuthn spec
+	maxCredentialIDSize = 1023
+)
+
+var (
+	ErrInvalidResponse     = errors.New("invalid WebAuthn response")
+	ErrInvalidRelyingParty = errors.New("site URL can't be used as a WebAuthn relying party")
+	ErrCeremonyMismatch    = errors.New("client data is for a different ceremony")
+	ErrChallengeMismatch   = errors.New("challenge does not match")
+	ErrOriginMismatch      = errors.New("origin does not match")
+	ErrRPIDMismatch        = errors.New("relying party ID does not match")
+	ErrUserNotPresent      = errors.New("user presence was not confirmed")
+	ErrUserNotVerified     = errors.New("user verification was required but not performed")
+	ErrInvalidSignature    = errors.New("invalid assertion signature")
+	ErrSignCount           = errors.New("signature counter did not increase, the authenticator may be cloned")
+)
+
+// Base64URL is binary data encoded as unpadded base64url in JSON, as used by
+// the WebAuthn JSON serialization
+type Base64URL []byte
+
+// MarshalJSON encodes the bytes as an unpadded base64url string
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes a base64url string, with or without padding
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return ErrInvalidResponse
+	}
+	*b = decoded
+	return nil
+}
+
+// RelyingPartyEntity identifies the site to the authenticator
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity identifies the account a credential is created for
+type UserEntity struct {
+	ID          Base64URL `json:"id"` // Opaque user handle; must not contain personal data
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+// CredentialParameter is an acceptable credential type and algorithm
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor refers to an existing credential
+type CredentialDescriptor struct {
+	Type       string    `json:"type"`
+	ID         Base64URL `json:"id"`
+	Transports []string  `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelection expresses requirements on the authenticator
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CredentialCreationOptions is passed to navigator.credentials.create as publicKey
+type CredentialCreationOptions struct {
+	Challenge              Base64URL              `json:"challenge"`
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// CredentialRequestOptions is passed to navigator.credentials.get as publicKey
+type CredentialRequestOptions struct {
+	Challenge        Base64URL              `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse is the JSON form of the PublicKeyCredential returned by
+// navigator.credentials.create
+type RegistrationResponse struct {
+	ID       string    `json:"id"`
+	RawID    Base64URL `json:"rawId"`
+	Type     string    `json:"type"`
+	Response struct {
+		ClientDataJSON    Base64URL `json:"clientDataJSON"`
+		AttestationObject Base64URL `json:"attestationObject"`
+		Transports        []string  `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON form of the PublicKeyCredential returned by
+// navigator.credentials.get
+type AssertionResponse struct {
+	ID       string    `json:"id"`
+	RawID    Base64URL `json:"rawId"`
+	Type     string    `json:"type"`
+	Response struct {
+		ClientDataJSON    Base64URL `json:"clientDataJSON"`
+		AuthenticatorData Base64URL `json:"authenticatorData"`
+		Signature         Base64URL `json:"signature"`
+		UserHandle        Base64URL `json:"userHandle"`
+	} `json:"response"`
+}
+
+// ClientData is the decoded clientDataJSON
+type ClientData struct {
+	Type        string    `json:"type"`
+	Challenge   Base64URL `json:"challenge"`
+	Origin      string    `json:"origin"`
+	CrossOrigin bool      `json:"crossOrigin"`
+}
+
+// ParseClientData decodes clientDataJSON, e.g. to look up the challenge it answers
+func ParseClientData(data []byte) (*ClientData, error) {
+	var clientData ClientData
+	if err := json.Unmarshal(data, &clientData); err != nil {
+		return nil, ErrInvalidResponse
+	}
+	return &clientData, nil
+}
+
+// Credential is a verified credential, to be stored for later logins
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte // COSE_Key
+	SignCount      uint32
+	AAGUID         []byte // Identifies the authenticator model
+	Transports     []string
+	UserVerified   bool
+	BackupEligible bool // Multi-device credential, e.g. synced through a password manager
+	BackedUp       bool
+}
+
+// Assertion is the result of a verified authentication
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+	BackedUp     bool
+}
+
+// RelyingParty verifies ceremonies for one site
+type RelyingParty struct {
+	ID               string // Domain the credentials are scoped to
+	Name             string
+	Origin           string // Origin the browser reports, e.g. https://blog.example.com
+	UserVerification string
+}
+
+// NewRelyingParty derives the relying party from the site URL. Browsers only
+// allow WebAuthn on https origins, or http on localhost.
+func NewRelyingParty(siteURL, name string) (*RelyingParty, error) {
+	u, err := url.Parse(strings.TrimSpace(siteURL))
+	if err != nil || u.Hostname() == "" {
+		return nil, ErrInvalidRelyingParty
+	}
+	host := strings.ToLower(u.Hostname())
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if host != "localhost" && !strings.HasSuffix(host, ".localhost") {
+			return nil, ErrInvalidRelyingParty
+		}
+	default:
+		return nil, ErrInvalidRelyingParty
+	}
+
+	return &RelyingParty{
+		ID:               host,
+		Name:             name,
+		Origin:           u.Scheme + "://" + strings.ToLower(u.Host),
+		UserVerification: UserVerificationPreferred,
+	}, nil
+}
+
+// NewChallenge returns a random challenge
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// RegistrationOptions returns options for creating a discoverable credential
+// (passkey), excluding credentials the user already has
+func (rp *RelyingParty) RegistrationOptions(challenge []byte, user UserEntity, exclude []CredentialDescriptor) *CredentialCreationOptions {
+	params := make([]CredentialParameter, len(SupportedAlgorithms))
+	for i, alg := range SupportedAlgorithms {
+		params[i] = CredentialParameter{Type: "public-key", Alg: alg}
+	}
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+
+	return &CredentialCreationOptions{
+		Challenge:          challenge,
+		RP:                 RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:               user,
+		PubKeyCredParams:   params,
+		Timeout:            Timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "required",
+			UserVerification: rp.UserVerification,
+		},
+		Attestation: "none",
+	}
+}
+
+// LoginOptions returns options for an assertion. With no allowed credentials
+// the browser offers any passkey for the site.
+func (rp *RelyingParty) LoginOptions(challenge []byte, allow []CredentialDescriptor) *CredentialRequestOptions {
+	if allow == nil {
+		allow = []CredentialDescriptor{}
+	}
+	return &CredentialRequestOptions{
+		Challenge:        challenge,
+		RPID:             rp.ID,
+		Timeout:          Timeout.Milliseconds(),
+		AllowCredentials: allow,
+		UserVerification: rp.UserVerification,
+	}
+}
+
+// VerifyRegistration verifies a registration response against the challenge
+// that was issued for it (WebAuthn §7.1)
+func (rp *RelyingParty) VerifyRegistration(resp *RegistrationResponse, challenge []byte) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, ErrInvalidResponse
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, ceremonyCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	item, rest, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, ErrInvalidResponse
+	}
+	attestation, ok := item.(map[any]any)
+	if !ok {
+		return nil, ErrInvalidResponse
+	}
+	if format, ok := attestation["fmt"].(string); !ok || format == "" {
+		return nil, ErrInvalidResponse
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, ErrInvalidResponse
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil {
+		return nil, ErrInvalidResponse
+	}
+	if len(resp.RawID) > 0 && !bytes.Equal(resp.RawID, authData.credentialID) {
+		return nil, ErrInvalidResponse
+	}
+	if _, err := parsePublicKey(authData.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:             authData.credentialID,
+		PublicKey:      authData.publicKey,
+		SignCount:      authData.signCount,
+		AAGUID:         authData.aaguid,
+		Transports:     resp.Response.Transports,
+		UserVerified:   authData.flags&flagUserVerified != 0,
+		BackupEligible: authData.flags&flagBackupEligible != 0,
+		BackedUp:       authData.flags&flagBackedUp != 0,
+	}, nil
+}
+
+// VerifyAssertion verifies an authentication response against the challenge
+// that was issued for it and the stored credential (WebAuthn §7.2)
+func (rp *RelyingParty) VerifyAssertion(resp *AssertionResponse, challenge []byte, publicKey []byte, storedSignCount uint32) (*Assertion, error) {
+	if resp.Type != "public-key" {
+		return nil, ErrInvalidResponse
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, ceremonyGet, challenge); err != nil {
+		return nil, err
+	}
+
+	authData, err := parseAuthenticatorData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := append(append([]byte{}, resp.Response.AuthenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, resp.Response.Signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	// Authenticators without a counter always report 0
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return nil, ErrSignCount
+	}
+
+	return &Assertion{
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+		BackedUp:     authData.flags&flagBackedUp != 0,
+	}, nil
+}
+
+func (rp *RelyingParty) verifyClientData(data []byte, ceremony string, challenge []byte) error {
+	clientData, err := ParseClientData(data)
+	if err != nil {
+		return err
+	}
+	if clientData.Type != ceremony {
+		return ErrCeremonyMismatch
+	}
+	if len(challenge) == 0 || subtle.ConstantTimeCompare(clientData.Challenge, challenge) != 1 {
+		return ErrChallengeMismatch
+	}
+	if clientData.Origin != rp.Origin || clientData.CrossOrigin {
+		return ErrOriginMismatch
+	}
+	return nil
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(authData *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(authData.rpIDHash, rpIDHash[:]) != 1 {
+		return ErrRPIDMismatch
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return ErrUserNotPresent
+	}
+	if rp.UserVerification == UserVerificationRequired && authData.flags&flagUserVerified == 0 {
+		return ErrUserNotVerified
+	}
+	return nil
+}
+
+// authenticatorData is the decoded authenticator data structure (WebAuthn §6.1)
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, ErrInvalidResponse
+	}
+	authData := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if authData.flags&flagAttestedData != 0 {
+		if len(rest) < 18 {
+			return nil, ErrInvalidResponse
+		}
+		authData.aaguid = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen == 0 || idLen > maxCredentialIDSize || len(rest) < idLen {
+			return nil, ErrInvalidResponse
+		}
+		authData.credentialID = rest[:idLen]
+		rest = rest[idLen:]
+
+		// The public key is a CBOR item of unknown length; decode it to find the end
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrInvalidResponse
+		}
+		authData.publicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+
+	if authData.flags&flagExtensionData != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrInvalidResponse
+		}
+		rest = after
+	}
+
+	if len(rest) != 0 {
+		return nil, ErrInvalidResponse
+	}
+	return authData, nil
+}
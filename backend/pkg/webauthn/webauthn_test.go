@@ -0,0 +1,252 @@
+package webauthn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lite-blog/backend/pkg/webauthn"
+	"github.com/lite-blog/backend/pkg/webauthn/webauthntest"
+)
+
+const testOrigin = "https://blog.example.com"
+
+func newRelyingParty(t *testing.T) *webauthn.RelyingParty {
+	t.Helper()
+	rp, err := webauthn.NewRelyingParty(testOrigin, "Blog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rp
+}
+
+func newChallenge(t *testing.T) []byte {
+	t.Helper()
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return challenge
+}
+
+// register creates a credential on authenticator and verifies it
+func register(t *testing.T, rp *webauthn.RelyingParty, authenticator *webauthntest.Authenticator) *webauthn.Credential {
+	t.Helper()
+	challenge := newChallenge(t)
+	resp, err := authenticator.Create(rp.RegistrationOptions(challenge, webauthn.UserEntity{ID: []byte{0, 0, 0, 0, 0, 0, 0, 1}, Name: "reader"}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := rp.VerifyRegistration(resp, challenge)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+	return credential
+}
+
+// login asks authenticator for an assertion and returns it with its challenge
+func login(t *testing.T, rp *webauthn.RelyingParty, authenticator *webauthntest.Authenticator) (*webauthn.AssertionResponse, []byte) {
+	t.Helper()
+	challenge := newChallenge(t)
+	resp, err := authenticator.Get(rp.LoginOptions(challenge, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, challenge
+}
+
+func TestRegistrationAndLogin(t *testing.T) {
+	rp := newRelyingParty(t)
+	authenticator := webauthntest.New(testOrigin)
+
+	credential := register(t, rp, authenticator)
+	if len(credential.ID) == 0 || len(credential.PublicKey) == 0 {
+		t.Fatal("credential has no ID or public key")
+	}
+	if !credential.UserVerified || credential.SignCount != 0 {
+		t.Errorf("credential = %+v, want user verified with sign count 0", credential)
+	}
+
+	signCount := credential.SignCount
+	for i := 1; i <= 2; i++ {
+		resp, challenge := login(t, rp, authenticator)
+		assertion, err := rp.VerifyAssertion(resp, challenge, credential.PublicKey, signCount)
+		if err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+		if assertion.SignCount != uint32(i) {
+			t.Errorf("login %d: sign count = %d, want %d", i, assertion.SignCount, i)
+		}
+		signCount = assertion.SignCount
+	}
+}
+
+func TestVerifyAssertionSignCount(t *testing.T) {
+	rp := newRelyingParty(t)
+	authenticator := webauthntest.New(testOrigin)
+	credential := register(t, rp, authenticator)
+
+	resp, challenge := login(t, rp, authenticator) // sign count 1
+	for _, stored := range []uint32{1, 5} {
+		if _, err := rp.VerifyAssertion(resp, challenge, credential.PublicKey, stored); !errors.Is(err, webauthn.ErrSignCount) {
+			t.Errorf("stored count %d: error = %v, want ErrSignCount", stored, err)
+		}
+	}
+
+	// Authenticators without a counter report 0 every time
+	authenticator.ZeroCounter = true
+	for i := 0; i < 2; i++ {
+		resp, challenge := login(t, rp, authenticator)
+		if _, err := rp.VerifyAssertion(resp, challenge, credential.PublicKey, 0); err != nil {
+			t.Fatalf("zero counter login %d: %v", i, err)
+		}
+	}
+	// but one that had a counter can't drop back to 0
+	resp, challenge = login(t, rp, authenticator)
+	if _, err := rp.VerifyAssertion(resp, challenge, credential.PublicKey, 1); !errors.Is(err, webauthn.ErrSignCount) {
+		t.Errorf("counter reset to 0: error = %v, want ErrSignCount", err)
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	rp := newRelyingParty(t)
+	user := webauthn.UserEntity{ID: []byte{1}, Name: "reader"}
+
+	tests := []struct {
+		name   string
+		origin string
+		modify func(options *webauthn.CredentialCreationOptions)
+		verify []byte // challenge to verify against; nil uses the issued one
+		want   error
+	}{
+		{name: "wrong origin", origin: "https://evil.example.com", want: webauthn.ErrOriginMismatch},
+		{name: "http origin", origin: "http://blog.example.com", want: webauthn.ErrOriginMismatch},
+		{name: "wrong RP ID", origin: testOrigin, modify: func(o *webauthn.CredentialCreationOptions) { o.RP.ID = "evil.example.com" }, want: webauthn.ErrRPIDMismatch},
+		{name: "wrong challenge", origin: testOrigin, verify: []byte("another challenge"), want: webauthn.ErrChallengeMismatch},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			challenge := newChallenge(t)
+			options := rp.RegistrationOptions(challenge, user, nil)
+			if tc.modify != nil {
+				tc.modify(options)
+			}
+			resp, err := webauthntest.New(tc.origin).Create(options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.verify != nil {
+				challenge = tc.verify
+			}
+			if _, err := rp.VerifyRegistration(resp, challenge); !errors.Is(err, tc.want) {
+				t.Errorf("error = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	rp := newRelyingParty(t)
+	authenticator := webauthntest.New(testOrigin)
+	credential := register(t, rp, authenticator)
+
+	t.Run("wrong origin", func(t *testing.T) {
+		authenticator.Origin = "https://blog.example.com.evil.example"
+		defer func() { authenticator.Origin = testOrigin }()
+		resp, challenge := login(t, rp, authenticator)
+		if _, err := rp.VerifyAssertion(resp, challenge, credential.PublicKey, 0); !errors.Is(err, webauthn.ErrOriginMismatch) {
+			t.Errorf("error = %v, want ErrOriginMismatch", err)
+		}
+	})
+
+	t.Run("wrong RP ID", func(t *testing.T) {
+		other, err := webauthn.NewRelyingParty("https://example.com", "Other")
+		if err != nil {
+			t.Fatal(err)
+		}
+		other.Origin = testOrigin // same origin, so only the RP ID hash differs
+		resp, challenge := login(t, rp, authenticator)
+		if _, err := other.VerifyAssertion(resp, challenge, credential.PublicKey, 0); !errors.Is(err, webauthn.ErrRPIDMismatch) {
+			t.Errorf("error = %v, want ErrRPIDMismatch", err)
+		}
+	})
+
+	t.Run("challenge from another ceremony", func(t *testing.T) {
+		resp, _ := login(t, rp, authenticator)
+		if _, err := rp.VerifyAssertion(resp, newChallenge(t), credential.PublicKey, 0); !errors.Is(err, webauthn.ErrChallengeMismatch) {
+			t.Errorf("error = %v, want ErrChallengeMismatch", err)
+		}
+	})
+
+	t.Run("registration response as assertion", func(t *testing.T) {
+		challenge := newChallenge(t)
+		created, err := webauthntest.New(testOrigin).Create(rp.RegistrationOptions(challenge, webauthn.UserEntity{ID: []byte{2}}, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := &webauthn.AssertionResponse{Type: "public-key"}
+		resp.Response.ClientDataJSON = created.Response.ClientDataJSON
+		if _, err := rp.VerifyAssertion(resp, challenge, credential.PublicKey, 0); !errors.Is(err, webauthn.ErrCeremonyMismatch) {
+			t.Errorf("error = %v, want ErrCeremonyMismatch", err)
+		}
+	})
+
+	t.Run("tampered authenticator data", func(t *testing.T) {
+		resp, challenge := login(t, rp, authenticator)
+		data := append([]byte{}, resp.Response.AuthenticatorData...)
+		data[len(data)-1] ^= 0xff // sign count
+		resp.Response.AuthenticatorData = data
+		if _, err := rp.VerifyAssertion(resp, challenge, credential.PublicKey, 0); !errors.Is(err, webauthn.ErrInvalidSignature) {
+			t.Errorf("error = %v, want ErrInvalidSignature", err)
+		}
+	})
+
+	t.Run("another credential's key", func(t *testing.T) {
+		otherCredential := register(t, rp, webauthntest.New(testOrigin))
+		resp, challenge := login(t, rp, authenticator)
+		if _, err := rp.VerifyAssertion(resp, challenge, otherCredential.PublicKey, 0); !errors.Is(err, webauthn.ErrInvalidSignature) {
+			t.Errorf("error = %v, want ErrInvalidSignature", err)
+		}
+	})
+
+	t.Run("user verification required", func(t *testing.T) {
+		strict := *rp
+		strict.UserVerification = webauthn.UserVerificationRequired
+		authenticator.UserVerified = false
+		defer func() { authenticator.UserVerified = true }()
+		resp, challenge := login(t, rp, authenticator)
+		if _, err := strict.VerifyAssertion(resp, challenge, credential.PublicKey, 0); !errors.Is(err, webauthn.ErrUserNotVerified) {
+			t.Errorf("error = %v, want ErrUserNotVerified", err)
+		}
+	})
+}
+
+func TestNewRelyingParty(t *testing.T) {
+	tests := []struct {
+		siteURL      string
+		id, origin   string
+		wantRejected bool
+	}{
+		{siteURL: "https://Blog.Example.com/", id: "blog.example.com", origin: "https://blog.example.com"},
+		{siteURL: "https://blog.example.com:8443", id: "blog.example.com", origin: "https://blog.example.com:8443"},
+		{siteURL: "http://localhost:3000", id: "localhost", origin: "http://localhost:3000"},
+		{siteURL: "http://blog.example.com", wantRejected: true},
+		{siteURL: "ftp://blog.example.com", wantRejected: true},
+		{siteURL: "", wantRejected: true},
+	}
+	for _, tc := range tests {
+		rp, err := webauthn.NewRelyingParty(tc.siteURL, "Blog")
+		if tc.wantRejected {
+			if !errors.Is(err, webauthn.ErrInvalidRelyingParty) {
+				t.Errorf("%q: error = %v, want ErrInvalidRelyingParty", tc.siteURL, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tc.siteURL, err)
+			continue
+		}
+		if rp.ID != tc.id || rp.Origin != tc.origin {
+			t.Errorf("%q: got ID %q origin %q, want %q %q", tc.siteURL, rp.ID, rp.Origin, tc.id, tc.origin)
+		}
+	}
+}
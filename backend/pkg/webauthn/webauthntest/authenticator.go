@@ -0,0 +1,233 @@
+// Package webauthntest provides a software authenticator for exercising
+// WebAuthn registration and login flows in tests, without a browser.
+package webauthntest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/lite-blog/backend/pkg/webauthn"
+)
+
+var ErrNoCredential = errors.New("no matching credential")
+
+// Authenticator is an in-memory ES256 authenticator that behaves like a browser
+// and platform authenticator together: it builds the client data for Origin and
+// signs with keys it keeps in memory.
+type Authenticator struct {
+	Origin string
+	// UserVerified controls the UV flag, as if the user entered a PIN or used biometrics
+	UserVerified bool
+	// ZeroCounter makes the authenticator report a sign count of 0, like most synced passkeys
+	ZeroCounter bool
+
+	credentials []*credential
+}
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+// New returns an authenticator for pages served from origin
+func New(origin string) *Authenticator {
+	return &Authenticator{Origin: origin, UserVerified: true}
+}
+
+// Create performs navigator.credentials.create
+func (a *Authenticator) Create(options *webauthn.CredentialCreationOptions) (*webauthn.RegistrationResponse, error) {
+	for _, excluded := range options.ExcludeCredentials {
+		if a.find(options.RP.ID, excluded.ID) != nil {
+			return nil, errors.New("authenticator already has a credential for this account")
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	cred := &credential{
+		id:         id,
+		rpID:       options.RP.ID,
+		userHandle: options.User.ID,
+		key:        key,
+	}
+	a.credentials = append(a.credentials, cred)
+
+	clientData, err := a.clientData("webauthn.create", options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	authData := a.authenticatorData(cred.rpID, 0x40, 0)
+	authData = binary.BigEndian.AppendUint16(append(authData, make([]byte, 16)...), uint16(len(id)))
+	authData = append(authData, id...)
+	authData = append(authData, encodeCBOR(map[any]any{
+		int64(1):  int64(2),  // kty: EC2
+		int64(3):  int64(-7), // alg: ES256
+		int64(-1): int64(1),  // crv: P-256
+		int64(-2): key.X.FillBytes(make([]byte, 32)),
+		int64(-3): key.Y.FillBytes(make([]byte, 32)),
+	})...)
+
+	resp := &webauthn.RegistrationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(id),
+		RawID: id,
+		Type:  "public-key",
+	}
+	resp.Response.ClientDataJSON = clientData
+	resp.Response.AttestationObject = encodeCBOR(map[any]any{
+		"fmt":      "none",
+		"attStmt":  map[any]any{},
+		"authData": authData,
+	})
+	resp.Response.Transports = []string{"internal"}
+	return resp, nil
+}
+
+// Get performs navigator.credentials.get, using the first matching credential
+func (a *Authenticator) Get(options *webauthn.CredentialRequestOptions) (*webauthn.AssertionResponse, error) {
+	var cred *credential
+	if len(options.AllowCredentials) == 0 {
+		for _, c := range a.credentials {
+			if c.rpID == options.RPID {
+				cred = c
+				break
+			}
+		}
+	} else {
+		for _, allowed := range options.AllowCredentials {
+			if cred = a.find(options.RPID, allowed.ID); cred != nil {
+				break
+			}
+		}
+	}
+	if cred == nil {
+		return nil, ErrNoCredential
+	}
+
+	signCount := uint32(0)
+	if !a.ZeroCounter {
+		cred.signCount++
+		signCount = cred.signCount
+	}
+
+	clientData, err := a.clientData("webauthn.get", options.Challenge)
+	if err != nil {
+		return nil, err
+	}
+	authData := a.authenticatorData(cred.rpID, 0, signCount)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &webauthn.AssertionResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(cred.id),
+		RawID: cred.id,
+		Type:  "public-key",
+	}
+	resp.Response.ClientDataJSON = clientData
+	resp.Response.AuthenticatorData = authData
+	resp.Response.Signature = signature
+	resp.Response.UserHandle = cred.userHandle
+	return resp, nil
+}
+
+func (a *Authenticator) find(rpID string, id []byte) *credential {
+	for _, c := range a.credentials {
+		if c.rpID == rpID && bytes.Equal(c.id, id) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge []byte) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+}
+
+// authenticatorData builds the fixed part of the authenticator data
+func (a *Authenticator) authenticatorData(rpID string, extraFlags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	flags := byte(0x01) | extraFlags // UP
+	if a.UserVerified {
+		flags |= 0x04
+	}
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+// encodeCBOR encodes the few value types authenticators need
+func encodeCBOR(value any) []byte {
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case map[any]any:
+		// Canonical CBOR sorts keys by their encoding
+		keys := make([][]byte, 0, len(v))
+		encoded := make(map[string][]byte, len(v))
+		for key, item := range v {
+			k := encodeCBOR(key)
+			keys = append(keys, k)
+			encoded[string(k)] = encodeCBOR(item)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) < len(keys[j])
+			}
+			return bytes.Compare(keys[i], keys[j]) < 0
+		})
+		out := cborHead(5, uint64(len(v)))
+		for _, k := range keys {
+			out = append(out, k...)
+			out = append(out, encoded[string(k)]...)
+		}
+		return out
+	}
+	panic("webauthntest: unsupported CBOR value")
+}
+
+func cborHead(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major<<5 | 24, byte(arg)}
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(arg))
+	case arg <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(arg))
+	}
+	return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, arg)
+}
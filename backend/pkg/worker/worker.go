@@ -0,0 +1,104 @@
+// Package worker runs background jobs that the server waits for on shutdown.
+// Long-running loops watch the group's context and return when it is
+// cancelled, after saving their progress; one-off jobs may simply finish.
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+)
+
+// ErrStopped is returned for jobs started after the group began shutting down
+var ErrStopped = errors.New("worker group is shutting down")
+
+// Group tracks running background jobs
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	stopped  bool
+	cleanups []cleanup
+}
+
+// cleanup releases something the jobs use once they have all returned
+type cleanup struct {
+	name string
+	fn   func() error
+}
+
+// NewGroup returns an empty group
+func NewGroup() *Group {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Group{ctx: ctx, cancel: cancel}
+}
+
+// Go runs fn in the background. The context is cancelled when the group
+// shuts down. A panic in fn is logged and doesn't bring down the server.
+func (g *Group) Go(name string, fn func(ctx context.Context)) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.stopped {
+		slog.Warn("Not starting background job", "job", name, "error", ErrStopped)
+		return ErrStopped
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				slog.Error("Background job panicked", "job", name, "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			}
+		}()
+		fn(g.ctx)
+	}()
+	return nil
+}
+
+// OnShutdown registers fn to run during Shutdown after all jobs have
+// returned, such as closing a connection they send through. Functions run in
+// reverse order of registration.
+func (g *Group) OnShutdown(name string, fn func() error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.cleanups = append(g.cleanups, cleanup{name: name, fn: fn})
+}
+
+// Shutdown stops new jobs, cancels the running ones and waits for them to
+// return, then runs the OnShutdown functions. If ctx ends first, it returns
+// ctx's error and leaves the jobs running and their resources open.
+func (g *Group) Shutdown(ctx context.Context) error {
+	g.mu.Lock()
+	g.stopped = true
+	g.mu.Unlock()
+	g.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	g.mu.Lock()
+	cleanups := g.cleanups
+	g.cleanups = nil
+	g.mu.Unlock()
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		if err := cleanups[i].fn(); err != nil {
+			slog.Warn("Failed to clean up after background jobs", "name", cleanups[i].name, "error", err)
+		}
+	}
+	return nil
+}